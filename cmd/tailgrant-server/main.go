@@ -15,6 +15,7 @@ import (
 
 	"github.com/rajsinghtech/tailgrant/internal/config"
 	"github.com/rajsinghtech/tailgrant/internal/grant"
+	"github.com/rajsinghtech/tailgrant/internal/notify"
 	"github.com/rajsinghtech/tailgrant/internal/server"
 	"github.com/rajsinghtech/tailgrant/internal/tsapi"
 	"github.com/rajsinghtech/tailgrant/ui"
@@ -39,7 +40,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	grantStore, err := grant.NewYAMLGrantTypeStore(cfg.Grants)
+	grantStore, err := grant.NewYAMLGrantTypeStore(cfg.Grants, cfg.Admins)
 	if err != nil {
 		slog.Error("failed to create grant store", "error", err)
 		os.Exit(1)
@@ -130,6 +131,49 @@ func main() {
 		slog.Info("VIP service listening", "name", svcCfg.Name, "fqdn", sl.FQDN, "port", svcCfg.Port)
 	}
 
+	slack, err := notify.NewSlack(cfg.Notifications.Slack, cfg.Notifications.BaseURL)
+	if err != nil {
+		slog.Error("invalid slack config", "error", err)
+		os.Exit(1)
+	}
+	var slackSecret string
+	if slack != nil {
+		slackSecret = cfg.Notifications.Slack.SigningSecret
+		switch {
+		case cfg.Server.Webhook == nil:
+			slog.Warn("slack is configured without server.webhook; approval buttons will not work")
+		case slackSecret == "":
+			slog.Error("slack signingSecret is required (or set SLACK_SIGNING_SECRET)")
+			os.Exit(1)
+		}
+	}
+
+	// Webhook listener (optional). Tailscale webhooks and Slack interactions
+	// are delivered from outside the tailnet, so this listener is public and
+	// the handlers authenticate requests by signature.
+	var webhookLn net.Listener
+	if wh := cfg.Server.Webhook; wh != nil {
+		var err error
+		switch {
+		case wh.Secret == "" && slack == nil:
+			err = fmt.Errorf("secret is required (or set TS_WEBHOOK_SECRET)")
+		case wh.Funnel && wh.ListenAddr != "":
+			err = fmt.Errorf("set only one of funnel and listenAddr")
+		case wh.Funnel:
+			webhookLn, err = srv.ListenFunnel("tcp", ":443")
+		case wh.ListenAddr != "":
+			webhookLn, err = net.Listen("tcp", wh.ListenAddr)
+		default:
+			err = fmt.Errorf("set funnel or listenAddr")
+		}
+		if err != nil {
+			slog.Error("failed to start webhook listener", "error", err)
+			os.Exit(1)
+		}
+		defer func() { _ = webhookLn.Close() }()
+		slog.Info("webhook receiver listening", "addr", webhookLn.Addr(), "funnel", wh.Funnel)
+	}
+
 	temporalOpts := client.Options{
 		HostPort:  cfg.Temporal.Address,
 		Namespace: cfg.Temporal.Namespace,
@@ -158,7 +202,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	router := server.NewRouter(lc, tc, tsClient, grantStore, cfg.Temporal.TaskQueue, staticFS)
+	router := server.NewRouter(lc, tc, tsClient, grantStore, cfg.Temporal.TaskQueue, cfg.Temporal.Namespace, cfg.Admins, cfg.Audit.File, staticFS)
 
 	httpServer := &http.Server{Handler: router}
 
@@ -182,6 +226,20 @@ func main() {
 		}()
 	}
 
+	if webhookLn != nil {
+		webhookServer := &http.Server{Handler: server.NewWebhookRouter(tc, tsClient, grantStore, cfg.Temporal.Namespace, cfg.Server.Webhook.Secret, slack, slackSecret)}
+		go func() {
+			if err := webhookServer.Serve(webhookLn); err != nil && err != http.ErrServerClosed {
+				slog.Error("webhook http error", "error", err)
+			}
+		}()
+		defer func() {
+			shutCtx, c := context.WithTimeout(context.Background(), 10*time.Second)
+			defer c()
+			_ = webhookServer.Shutdown(shutCtx)
+		}()
+	}
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-sigCh
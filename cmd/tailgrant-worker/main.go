@@ -11,8 +11,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/rajsinghtech/tailgrant/internal/audit"
 	"github.com/rajsinghtech/tailgrant/internal/config"
 	"github.com/rajsinghtech/tailgrant/internal/grant"
+	"github.com/rajsinghtech/tailgrant/internal/notify"
 	"github.com/rajsinghtech/tailgrant/internal/tsapi"
 	"google.golang.org/grpc"
 	"tailscale.com/tsnet"
@@ -39,6 +41,26 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	auditSink, err := audit.Open(cfg.Audit)
+	if err != nil {
+		slog.Error("failed to open audit log", "error", err)
+		os.Exit(1)
+	}
+	if auditSink != nil {
+		defer func() { _ = auditSink.Close() }()
+	}
+
+	notifier, err := notify.New(cfg.Notifications)
+	if err != nil {
+		slog.Error("invalid notifications config", "error", err)
+		os.Exit(1)
+	}
+	slack, err := notify.NewSlack(cfg.Notifications.Slack, cfg.Notifications.BaseURL)
+	if err != nil {
+		slog.Error("invalid slack config", "error", err)
+		os.Exit(1)
+	}
+
 	hostname := cfg.Tailscale.Hostname
 	if hostname == "" {
 		hostname = "tailgrant"
@@ -105,21 +127,32 @@ func main() {
 	}
 	defer tc.Close()
 
+	// GrantWorkflow upserts custom search attributes; register any that are
+	// missing before it runs.
+	if err := grant.EnsureSearchAttributes(ctx, tc, cfg.Temporal.Namespace); err != nil {
+		slog.Error("failed to register search attributes (register them with `temporal operator search-attribute create`)", "namespace", cfg.Temporal.Namespace, "error", err)
+		os.Exit(1)
+	}
+
 	w := worker.New(tc, cfg.Temporal.TaskQueue, worker.Options{})
 
 	userOps := tsapi.NewUserOperations(tsClient)
-	activities := &grant.Activities{TS: tsClient, Temporal: tc, UserOps: userOps}
+	principals := tsapi.NewPrincipalResolver(tsClient)
+	activities := &grant.Activities{TS: tsClient, Temporal: tc, UserOps: userOps, Principals: principals, Audit: auditSink, Notifier: notifier, Slack: slack}
 	w.RegisterWorkflow(grant.GrantWorkflow)
 	w.RegisterWorkflow(grant.ApprovalWorkflow)
 	w.RegisterWorkflow(grant.DeviceTagManagerWorkflow)
+	w.RegisterWorkflow(grant.PolicyEditorWorkflow)
 	w.RegisterWorkflow(grant.ReconciliationWorkflow)
+	w.RegisterWorkflow(grant.UserQuotaWorkflow)
+	w.RegisterWorkflow(grant.NotificationWorkflow)
 	w.RegisterActivity(activities)
 
 	slog.Info("starting temporal worker", "taskQueue", cfg.Temporal.TaskQueue)
 
-	// Collect all grant tags for reconciliation (skip user-action grant types
-	// since they don't manage device tags).
-	grantStore, err := grant.NewYAMLGrantTypeStore(cfg.Grants)
+	// Collect all grant tags for reconciliation (skip grant types that
+	// don't act on devices since they don't manage device tags).
+	grantStore, err := grant.NewYAMLGrantTypeStore(cfg.Grants, cfg.Admins)
 	if err != nil {
 		slog.Error("failed to create grant store", "error", err)
 		os.Exit(1)
@@ -127,12 +160,16 @@ func main() {
 	grantTypes, _ := grantStore.List()
 	var allGrantTags []string
 	var allPostureKeys []string
+	keyExpiry, deviceAuthorize, policyGrants := false, false, false
 	seenTags := make(map[string]struct{})
 	seenKeys := make(map[string]struct{})
 	for _, gt := range grantTypes {
-		if gt.Action == grant.ActionUserRole || gt.Action == grant.ActionUserRestore {
+		if !gt.Action.TargetsDevices() {
 			continue
 		}
+		keyExpiry = keyExpiry || gt.Action == grant.ActionKeyExpiry
+		deviceAuthorize = deviceAuthorize || gt.Action == grant.ActionDeviceAuthorize
+		policyGrants = policyGrants || gt.Action == grant.ActionPolicyGrant
 		for _, tag := range gt.Tags {
 			if _, ok := seenTags[tag]; !ok {
 				seenTags[tag] = struct{}{}
@@ -147,8 +184,10 @@ func main() {
 		}
 	}
 
-	// Ensure a single ReconciliationWorkflow is running. WorkflowIDReusePolicy
-	// prevents duplicates if one already exists from a previous run.
+	// Ensure a single ReconciliationWorkflow is running, and hand it this
+	// worker's input. Signal-with-start starts it if it is not running, and
+	// otherwise signals the running one, which applies the input from its
+	// next pass.
 	reconcileOpts := client.StartWorkflowOptions{
 		ID:        "reconciliation",
 		TaskQueue: cfg.Temporal.TaskQueue,
@@ -156,12 +195,15 @@ func main() {
 	reconcileInput := grant.ReconciliationInput{
 		GrantTags:        allGrantTags,
 		GrantPostureKeys: allPostureKeys,
+		KeyExpiry:        keyExpiry,
+		DeviceAuthorize:  deviceAuthorize,
+		PolicyGrants:     policyGrants,
 	}
-	_, err = tc.ExecuteWorkflow(ctx, reconcileOpts, grant.ReconciliationWorkflow, reconcileInput)
+	_, err = tc.SignalWithStartWorkflow(ctx, reconcileOpts.ID, "configure", reconcileInput, reconcileOpts, grant.ReconciliationWorkflow, reconcileInput)
 	if err != nil {
-		slog.Warn("failed to start reconciliation workflow (may already be running)", "error", err)
+		slog.Warn("failed to configure reconciliation workflow", "error", err)
 	} else {
-		slog.Info("reconciliation workflow started", "grantTags", allGrantTags, "postureKeys", allPostureKeys)
+		slog.Info("reconciliation workflow configured", "grantTags", allGrantTags, "postureKeys", allPostureKeys)
 	}
 
 	sigCh := make(chan os.Signal, 1)
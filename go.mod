@@ -4,6 +4,7 @@ go 1.25.6
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/tailscale/hujson v0.0.0-20221223112325-20486734a56a
 	go.temporal.io/sdk v1.40.0
 	gopkg.in/yaml.v3 v3.0.1
 	tailscale.com v1.94.1
@@ -75,7 +76,6 @@ require (
 	github.com/robfig/cron v1.2.0 // indirect
 	github.com/stretchr/objx v0.5.2 // indirect
 	github.com/stretchr/testify v1.11.1
-	github.com/tailscale/hujson v0.0.0-20221223112325-20486734a56a // indirect
 	go.temporal.io/api v1.62.1
 	golang.org/x/net v0.48.0 // indirect
 	golang.org/x/oauth2 v0.34.0 // indirect
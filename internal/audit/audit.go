@@ -0,0 +1,174 @@
+// Package audit records grant lifecycle events for auditors. Events are
+// emitted by the workflows through the RecordAuditEvent activity and written
+// to one or more sinks.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+)
+
+// EventType identifies a grant lifecycle event.
+type EventType string
+
+const (
+	EventRequested  EventType = "requested"
+	EventApproved   EventType = "approved"
+	EventDenied     EventType = "denied"
+	EventActivated  EventType = "activated"
+	EventFailed     EventType = "failed"
+	EventExtended   EventType = "extended"
+	EventRevoked    EventType = "revoked"
+	EventExpired    EventType = "expired"
+	EventCancelled  EventType = "cancelled"
+	EventReconciled EventType = "reconciliation_corrected"
+
+	// Break-glass grants skip approval; these record their review.
+	EventBreakGlass             EventType = "break_glass"
+	EventBreakGlassAcknowledged EventType = "break_glass_acknowledged"
+	EventBreakGlassRejected     EventType = "break_glass_rejected"
+	EventBreakGlassUnreviewed   EventType = "break_glass_unreviewed"
+)
+
+// Event is one audit record. ID is stable across activity retries, so a
+// consumer can drop the duplicates at-least-once delivery may produce.
+// PrevHash and Hash are only set by the file sink.
+type Event struct {
+	ID        string            `json:"id"`
+	Time      time.Time         `json:"time"`
+	Type      EventType         `json:"type"`
+	GrantID   string            `json:"grantID,omitempty"`
+	GrantType string            `json:"grantType,omitempty"`
+	Requester string            `json:"requester,omitempty"`
+	Actor     string            `json:"actor,omitempty"`
+	Targets   []string          `json:"targets,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	PrevHash  string            `json:"prevHash,omitempty"`
+	Hash      string            `json:"hash,omitempty"`
+}
+
+// Sink writes audit events somewhere durable.
+type Sink interface {
+	Write(ctx context.Context, ev Event) error
+	Close() error
+}
+
+// Open builds the sinks enabled in c. It returns nil if none are.
+func Open(c config.AuditConfig) (Sink, error) {
+	var sinks multiSink
+	if c.File != "" {
+		f, err := OpenFile(c.File)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, f)
+	}
+	if c.Stdout {
+		sinks = append(sinks, NewWriterSink(os.Stdout))
+	}
+	if c.Syslog != nil {
+		s, err := OpenSyslog(*c.Syslog)
+		if err != nil {
+			_ = sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	switch len(sinks) {
+	case 0:
+		return nil, nil
+	case 1:
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
+
+// multiSink writes every event to all of its sinks. A failure in one does
+// not stop the others; the activity retry then writes the event again to
+// all of them.
+type multiSink []Sink
+
+func (m multiSink) Write(ctx context.Context, ev Event) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(ctx, ev); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// WriterSink writes events as JSON lines to an io.Writer, e.g. stdout for
+// collection by a log shipper.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(_ context.Context, ev Event) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshal audit event: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write audit event: %w", err)
+	}
+	return nil
+}
+
+func (s *WriterSink) Close() error { return nil }
+
+// SyslogSink sends each event as a JSON message to syslog.
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+// OpenSyslog connects to the syslog daemon described by c.
+func OpenSyslog(c config.SyslogConfig) (*SyslogSink, error) {
+	tag := c.Tag
+	if tag == "" {
+		tag = "tailgrant"
+	}
+	w, err := syslog.Dial(c.Network, c.Address, syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, fmt.Errorf("connect to syslog: %w", err)
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+func (s *SyslogSink) Write(_ context.Context, ev Event) error {
+	msg, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshal audit event: %w", err)
+	}
+	if err := s.w.Info(string(msg)); err != nil {
+		return fmt.Errorf("write audit event to syslog: %w", err)
+	}
+	return nil
+}
+
+func (s *SyslogSink) Close() error { return s.w.Close() }
@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxLineSize bounds a single JSONL record when reading the log back.
+const maxLineSize = 1 << 20
+
+// FileSink appends events to a JSONL file. Each record carries the hash of
+// the one before it and its own hash, so editing or deleting a record breaks
+// the chain from that point on. Only one process should write a given file.
+type FileSink struct {
+	mu   sync.Mutex
+	f    *os.File
+	last string
+}
+
+// OpenFile opens or creates an audit log and resumes its hash chain.
+func OpenFile(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	s := &FileSink{f: f}
+	err = scan(f, func(_ int, ev Event) error {
+		s.last = ev.Hash
+		return nil
+	})
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("read audit log %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *FileSink) Write(_ context.Context, ev Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ev.Time = ev.Time.UTC()
+	ev.PrevHash = s.last
+	hash, err := hashEvent(ev)
+	if err != nil {
+		return err
+	}
+	ev.Hash = hash
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshal audit event: %w", err)
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write audit event: %w", err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("sync audit log: %w", err)
+	}
+	s.last = hash
+	return nil
+}
+
+func (s *FileSink) Close() error { return s.f.Close() }
+
+// hashEvent returns the hex SHA-256 of the event's JSON encoding with Hash
+// empty. PrevHash is included, which is what links the chain.
+func hashEvent(ev Event) (string, error) {
+	ev.Hash = ""
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return "", fmt.Errorf("marshal audit event: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// scan calls fn for each record in r. Blank lines are skipped; a record
+// that is not valid JSON is an error.
+func scan(r io.Reader, fn func(line int, ev Event) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for n := 1; sc.Scan(); n++ {
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var ev Event
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		if err := fn(n, ev); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// Filter selects events from a log. Zero fields match everything; To is
+// exclusive.
+type Filter struct {
+	From    time.Time
+	To      time.Time
+	GrantID string
+	Limit   int
+}
+
+func (f Filter) match(ev Event) bool {
+	if !f.From.IsZero() && ev.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !ev.Time.Before(f.To) {
+		return false
+	}
+	return f.GrantID == "" || ev.GrantID == f.GrantID
+}
+
+// Log is the result of reading an audit log. The whole chain is verified
+// on every read; ChainError describes the first break, if any.
+type Log struct {
+	Events     []Event `json:"events"`
+	Truncated  bool    `json:"truncated,omitempty"`
+	Verified   bool    `json:"verified"`
+	ChainError string  `json:"chainError,omitempty"`
+}
+
+// ReadFile returns the events in the log at path that match f, in the
+// order they were written, and verifies the hash chain.
+func ReadFile(path string, f Filter) (*Log, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	defer file.Close()
+	return Read(file, f)
+}
+
+// Read is ReadFile for an io.Reader.
+func Read(r io.Reader, f Filter) (*Log, error) {
+	log := &Log{Events: []Event{}}
+	var chainErr error
+	prev := ""
+	err := scan(r, func(n int, ev Event) error {
+		if chainErr == nil {
+			chainErr = verify(n, ev, prev)
+		}
+		prev = ev.Hash
+		if !f.match(ev) {
+			return nil
+		}
+		if f.Limit > 0 && len(log.Events) == f.Limit {
+			log.Truncated = true
+			return nil
+		}
+		log.Events = append(log.Events, ev)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Verified = chainErr == nil
+	if chainErr != nil {
+		log.ChainError = chainErr.Error()
+	}
+	return log, nil
+}
+
+func verify(line int, ev Event, prev string) error {
+	if ev.PrevHash != prev {
+		return fmt.Errorf("hash chain broken at line %d: prevHash does not match the previous record", line)
+	}
+	want, err := hashEvent(ev)
+	if err != nil {
+		return err
+	}
+	if ev.Hash != want {
+		return fmt.Errorf("hash chain broken at line %d: record hash mismatch", line)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeEvents(t *testing.T, path string, events ...Event) {
+	t.Helper()
+	s, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer s.Close()
+	for _, ev := range events {
+		if err := s.Write(context.Background(), ev); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+}
+
+func TestFileSink_HashChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	base := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	writeEvents(t, path,
+		Event{ID: "1", Time: base, Type: EventRequested, GrantID: "g1", Actor: "alice@example.com"},
+		Event{ID: "2", Time: base.Add(time.Minute), Type: EventApproved, GrantID: "g1", Actor: "bob@example.com"},
+	)
+	// Reopening resumes the chain from the last record.
+	writeEvents(t, path,
+		Event{ID: "3", Time: base.Add(time.Hour), Type: EventExpired, GrantID: "g1", Details: map[string]string{"b": "2", "a": "1"}},
+	)
+
+	log, err := ReadFile(path, Filter{})
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !log.Verified {
+		t.Fatalf("chain not verified: %s", log.ChainError)
+	}
+	if len(log.Events) != 3 {
+		t.Fatalf("got %d events, want 3", len(log.Events))
+	}
+	if log.Events[0].PrevHash != "" {
+		t.Errorf("first record prevHash = %q, want empty", log.Events[0].PrevHash)
+	}
+	for i := 1; i < len(log.Events); i++ {
+		if log.Events[i].PrevHash != log.Events[i-1].Hash {
+			t.Errorf("record %d prevHash does not link to record %d", i, i-1)
+		}
+	}
+}
+
+func TestRead_DetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	base := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	writeEvents(t, path,
+		Event{ID: "1", Time: base, Type: EventRequested, GrantID: "g1"},
+		Event{ID: "2", Time: base.Add(time.Minute), Type: EventDenied, GrantID: "g1", Actor: "bob@example.com"},
+		Event{ID: "3", Time: base.Add(2 * time.Minute), Type: EventRequested, GrantID: "g2"},
+	)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+
+	tests := []struct {
+		name    string
+		content string
+		line    string
+	}{
+		{"edited record", lines[0] + strings.Replace(lines[1], "denied", "approved", 1) + lines[2], "line 2"},
+		{"deleted record", lines[0] + lines[2], "line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := Read(strings.NewReader(tt.content), Filter{})
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if log.Verified || !strings.Contains(log.ChainError, tt.line) {
+				t.Errorf("Verified = %v, ChainError = %q, want break at %s", log.Verified, log.ChainError, tt.line)
+			}
+		})
+	}
+}
+
+func TestRead_Filter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	base := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	writeEvents(t, path,
+		Event{ID: "1", Time: base, Type: EventRequested, GrantID: "g1"},
+		Event{ID: "2", Time: base.Add(time.Hour), Type: EventRequested, GrantID: "g2"},
+		Event{ID: "3", Time: base.Add(2 * time.Hour), Type: EventActivated, GrantID: "g2"},
+		Event{ID: "4", Time: base.Add(3 * time.Hour), Type: EventExpired, GrantID: "g2"},
+	)
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+		trunc  bool
+	}{
+		{"all", Filter{}, []string{"1", "2", "3", "4"}, false},
+		{"from inclusive", Filter{From: base.Add(time.Hour)}, []string{"2", "3", "4"}, false},
+		{"to exclusive", Filter{To: base.Add(2 * time.Hour)}, []string{"1", "2"}, false},
+		{"grant", Filter{GrantID: "g2", To: base.Add(3 * time.Hour)}, []string{"2", "3"}, false},
+		{"limit", Filter{Limit: 2}, []string{"1", "2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := ReadFile(path, tt.filter)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			var ids []string
+			for _, ev := range log.Events {
+				ids = append(ids, ev.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") || log.Truncated != tt.trunc {
+				t.Errorf("got %v (truncated %v), want %v (truncated %v)", ids, log.Truncated, tt.want, tt.trunc)
+			}
+		})
+	}
+}
+
+func TestOpenFile_PartialRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte(`{"id":"1","type":"requ`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFile(path); err == nil {
+		t.Fatal("expected an error for a truncated record")
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewWriterSink(&buf)
+	ev := Event{ID: "1", Time: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), Type: EventRevoked, GrantID: "g1", Actor: "alice@example.com"}
+	if err := s.Write(context.Background(), ev); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	var got Event
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not a JSON line: %v", err)
+	}
+	if got.Type != EventRevoked || got.Actor != "alice@example.com" || got.Hash != "" {
+		t.Errorf("got %+v", got)
+	}
+}
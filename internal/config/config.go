@@ -8,11 +8,14 @@ import (
 )
 
 type Config struct {
-	Temporal  TemporalConfig   `yaml:"temporal"`
-	Tailscale TailscaleConfig  `yaml:"tailscale"`
-	Server    ServerConfig     `yaml:"server"`
-	Worker    WorkerConfig     `yaml:"worker"`
-	Grants    []GrantTypeConfig `yaml:"grants"`
+	Temporal      TemporalConfig      `yaml:"temporal"`
+	Tailscale     TailscaleConfig     `yaml:"tailscale"`
+	Server        ServerConfig        `yaml:"server"`
+	Worker        WorkerConfig        `yaml:"worker"`
+	Grants        []GrantTypeConfig   `yaml:"grants"`
+	Admins        []string            `yaml:"admins"` // logins that may revoke or extend any grant
+	Audit         AuditConfig         `yaml:"audit"`
+	Notifications NotificationsConfig `yaml:"notifications"`
 }
 
 type TemporalConfig struct {
@@ -35,6 +38,17 @@ type ServerConfig struct {
 	UseTLS     *bool          `yaml:"useTLS"`
 	Tags       []string       `yaml:"tags"`
 	Service    *ServiceConfig `yaml:"service"`
+	Webhook    *WebhookConfig `yaml:"webhook"`
+}
+
+// WebhookConfig enables the receiver for Tailscale webhooks and Slack
+// interactions. Both are delivered from outside the tailnet, so the
+// receiver is served either over Funnel or on a plain listener, never
+// behind WhoIs.
+type WebhookConfig struct {
+	Secret     string `yaml:"secret"`     // Tailscale webhook signing secret; TS_WEBHOOK_SECRET overrides
+	Funnel     bool   `yaml:"funnel"`     // serve on :443 over Tailscale Funnel
+	ListenAddr string `yaml:"listenAddr"` // or listen outside tsnet, e.g. ":8081" behind a reverse proxy
 }
 
 type ServiceConfig struct {
@@ -50,16 +64,124 @@ type WorkerConfig struct {
 	Tags      []string `yaml:"tags"`
 }
 
+// AuditConfig selects where grant lifecycle audit events are written. Any
+// combination of sinks may be enabled.
+type AuditConfig struct {
+	File   string        `yaml:"file"`   // append-only JSONL log with hash chaining
+	Stdout bool          `yaml:"stdout"` // one JSON event per line on stdout
+	Syslog *SyslogConfig `yaml:"syslog"`
+}
+
+type SyslogConfig struct {
+	Network string `yaml:"network"` // "udp" or "tcp"; empty for the local syslog daemon
+	Address string `yaml:"address"` // e.g. "syslog.example.com:514"
+	Tag     string `yaml:"tag"`     // defaults to "tailgrant"
+}
+
+// NotificationsConfig configures where grant lifecycle notifications are
+// delivered.
+type NotificationsConfig struct {
+	BaseURL  string                      `yaml:"baseURL"` // TailGrant UI URL for deep links, e.g. "https://tailgrant.example.ts.net"
+	Webhooks []NotificationWebhookConfig `yaml:"webhooks"`
+	Slack    *SlackConfig                `yaml:"slack"`
+	Email    *EmailConfig                `yaml:"email"`
+}
+
+// EmailConfig sends notifications over SMTP: pending approvals to the
+// approvers listed by login, and decisions, activation and expiry warnings
+// to the requester. STARTTLS is used when the server offers it.
+type EmailConfig struct {
+	Host      string `yaml:"host"`
+	Port      int    `yaml:"port"`      // defaults to 587
+	Username  string `yaml:"username"`  // omit for unauthenticated relays
+	Password  string `yaml:"password"`  // SMTP_PASSWORD overrides
+	From      string `yaml:"from"`      // sender address, e.g. "TailGrant <tailgrant@example.com>"
+	Templates string `yaml:"templates"` // directory of <event>.tmpl files overriding the built-in templates
+}
+
+// SlackConfig posts approval requests to a Slack channel with Approve and
+// Deny buttons. The app's interactivity request URL must point at
+// /webhooks/slack on the server's webhook listener.
+type SlackConfig struct {
+	BotToken      string `yaml:"botToken"`      // xoxb- token with chat:write and users:read.email; SLACK_BOT_TOKEN overrides
+	SigningSecret string `yaml:"signingSecret"` // verifies interaction callbacks; SLACK_SIGNING_SECRET overrides
+	Channel       string `yaml:"channel"`       // channel ID approval requests are posted to
+	APIURL        string `yaml:"apiURL"`        // defaults to https://slack.com/api
+}
+
+// NotificationWebhookConfig is an outbound webhook endpoint.
+type NotificationWebhookConfig struct {
+	Name   string   `yaml:"name"`
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"` // HMAC-SHA256 signing key; unsigned if empty
+	Events []string `yaml:"events"` // events to deliver; empty delivers all
+}
+
 type GrantTypeConfig struct {
-	Name              string                   `yaml:"name"`
-	Description       string                   `yaml:"description"`
-	Tags              []string                 `yaml:"tags"`
-	PostureAttributes []PostureAttributeConfig `yaml:"postureAttributes"`
-	MaxDuration       string                   `yaml:"maxDuration"`
-	RiskLevel         string                   `yaml:"riskLevel"`
-	Approvers         []string                 `yaml:"approvers"`
-	Action            string                   `yaml:"action"`
-	UserAction        *UserActionConfig        `yaml:"userAction"`
+	Name               string                   `yaml:"name"`
+	Description        string                   `yaml:"description"`
+	Tags               []string                 `yaml:"tags"`
+	PostureAttributes  []PostureAttributeConfig `yaml:"postureAttributes"`
+	MaxDuration        string                   `yaml:"maxDuration"`
+	RiskLevel          string                   `yaml:"riskLevel"`
+	Approvers          []string                 `yaml:"approvers"`
+	RequiredApprovals  int                      `yaml:"requiredApprovals"` // distinct approvals needed, defaults to 1
+	Action             string                   `yaml:"action"`
+	UserAction         *UserActionConfig        `yaml:"userAction"`
+	RouteAction        *RouteActionConfig       `yaml:"routeAction"`
+	GroupAction        *GroupActionConfig       `yaml:"groupAction"`
+	PolicyGrant        *PolicyGrantConfig       `yaml:"policyGrant"`
+	ExtendPolicy       string                   `yaml:"extendPolicy"` // "requester_or_approver" (default), "requester", "approver", "none"
+	Approval           *ApprovalConfig          `yaml:"approval"`
+	Policy             []PolicyRuleConfig       `yaml:"policy"`             // evaluated in order, first match wins
+	EligibleRequesters []string                 `yaml:"eligibleRequesters"` // logins, group:<name> or autogroup:<role>; empty allows everyone
+	Targets            *TargetsConfig           `yaml:"targets"`
+	Quota              *QuotaConfig             `yaml:"quota"`
+	ExpiryWarning      string                   `yaml:"expiryWarning"` // lead time for the expiring_soon notification, e.g. "10m"
+
+	MaxTotalDuration          string `yaml:"maxTotalDuration"`          // cap on activation to expiry across all extensions
+	MaxExtensions             int    `yaml:"maxExtensions"`             // 0 allows any number
+	ExtensionRequiresApproval bool   `yaml:"extensionRequiresApproval"` // send every extension back through approval
+
+	BreakGlass bool `yaml:"breakGlass"` // high risk only: requests may skip approval and are reviewed afterwards
+}
+
+// QuotaConfig limits how much of a grant type each user may hold. Zero
+// values mean no limit.
+type QuotaConfig struct {
+	MaxConcurrentPerUser   int    `yaml:"maxConcurrentPerUser"`   // pending, scheduled and active grants
+	MaxGrantsPerUserPerDay int    `yaml:"maxGrantsPerUserPerDay"` // requests in any rolling 24h
+	MaxActiveTime          string `yaml:"maxActiveTime"`          // cumulative grant time per activeTimeWindow, e.g. "8h"
+	ActiveTimeWindow       string `yaml:"activeTimeWindow"`       // rolling window for maxActiveTime, defaults to "24h"
+}
+
+// TargetsConfig restricts which devices a tag grant type may target. Every
+// set field must match.
+type TargetsConfig struct {
+	Tags           []string `yaml:"tags"`           // device must carry one of these tags
+	Hostnames      []string `yaml:"hostnames"`      // glob patterns, e.g. "db-*"
+	OS             []string `yaml:"os"`             // e.g. "linux", "macOS"
+	RequesterOwned bool     `yaml:"requesterOwned"` // only the requester's own untagged devices
+}
+
+// PolicyRuleConfig is a request policy rule: when the expression matches,
+// the request gets the rule's decision.
+type PolicyRuleConfig struct {
+	When     string `yaml:"when"`
+	Decision string `yaml:"decision"` // "allow", "deny" or "require_approval"
+	Message  string `yaml:"message"`
+}
+
+// ApprovalConfig configures an escalation chain. When stages are set they
+// replace the top-level approvers list.
+type ApprovalConfig struct {
+	Stages []ApprovalStageConfig `yaml:"stages"`
+}
+
+type ApprovalStageConfig struct {
+	Name      string   `yaml:"name"`
+	Approvers []string `yaml:"approvers"`
+	Timeout   string   `yaml:"timeout"` // how long this stage waits before escalating
 }
 
 type PostureAttributeConfig struct {
@@ -72,6 +194,26 @@ type UserActionConfig struct {
 	Role string `yaml:"role"`
 }
 
+// RouteActionConfig lists the advertised routes a routes grant enables.
+type RouteActionConfig struct {
+	Routes   []string `yaml:"routes"`   // subnet routes, e.g. "10.20.0.0/24"
+	ExitNode bool     `yaml:"exitNode"` // also enable the device as an exit node
+}
+
+// GroupActionConfig names the policy file group a group_membership grant
+// adds a user to.
+type GroupActionConfig struct {
+	Group  string `yaml:"group"`  // e.g. "group:db-admins"
+	Member string `yaml:"member"` // "requester" (default) or "target"
+}
+
+// PolicyGrantConfig is the access a policy_grant grant gives the requester
+// to the target devices, as in a policy file grants entry.
+type PolicyGrantConfig struct {
+	IP  []string                    `yaml:"ip"`  // e.g. "tcp:22", "*"
+	App map[string][]map[string]any `yaml:"app"` // capability name to values, e.g. "example.com/cap/db"
+}
+
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -123,4 +265,18 @@ func applyEnvOverrides(cfg *Config) {
 	if tailnet := os.Getenv("TS_TAILNET"); tailnet != "" {
 		cfg.Tailscale.Tailnet = tailnet
 	}
+	if secret := os.Getenv("TS_WEBHOOK_SECRET"); secret != "" && cfg.Server.Webhook != nil {
+		cfg.Server.Webhook.Secret = secret
+	}
+	if slack := cfg.Notifications.Slack; slack != nil {
+		if token := os.Getenv("SLACK_BOT_TOKEN"); token != "" {
+			slack.BotToken = token
+		}
+		if secret := os.Getenv("SLACK_SIGNING_SECRET"); secret != "" {
+			slack.SigningSecret = secret
+		}
+	}
+	if password := os.Getenv("SMTP_PASSWORD"); password != "" && cfg.Notifications.Email != nil {
+		cfg.Notifications.Email.Password = password
+	}
 }
@@ -292,6 +292,98 @@ tailscale:
 	}
 }
 
+func TestLoad_EnvOverrideWebhookSecret(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configData := `
+server:
+  webhook:
+    funnel: true
+    secret: "yaml-secret"
+`
+
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	t.Setenv("TS_WEBHOOK_SECRET", "env-secret")
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	if cfg.Server.Webhook == nil || !cfg.Server.Webhook.Funnel {
+		t.Fatalf("Webhook = %+v, want funnel enabled", cfg.Server.Webhook)
+	}
+	if cfg.Server.Webhook.Secret != "env-secret" {
+		t.Errorf("Webhook.Secret = %q, want %q", cfg.Server.Webhook.Secret, "env-secret")
+	}
+}
+
+func TestLoad_EnvOverrideSlack(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configData := `
+notifications:
+  slack:
+    channel: "C0123"
+    botToken: "yaml-token"
+`
+
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	t.Setenv("SLACK_BOT_TOKEN", "env-token")
+	t.Setenv("SLACK_SIGNING_SECRET", "env-signing-secret")
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	slack := cfg.Notifications.Slack
+	if slack == nil || slack.Channel != "C0123" {
+		t.Fatalf("Slack = %+v, want channel C0123", slack)
+	}
+	if slack.BotToken != "env-token" || slack.SigningSecret != "env-signing-secret" {
+		t.Errorf("Slack = %+v, want env token and signing secret", slack)
+	}
+}
+
+func TestLoad_EnvOverrideSMTPPassword(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configData := `
+notifications:
+  email:
+    host: "smtp.example.com"
+    username: "tailgrant"
+    password: "yaml-password"
+    from: "tailgrant@example.com"
+`
+
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	t.Setenv("SMTP_PASSWORD", "env-password")
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	email := cfg.Notifications.Email
+	if email == nil || email.Host != "smtp.example.com" {
+		t.Fatalf("Email = %+v, want host smtp.example.com", email)
+	}
+	if email.Password != "env-password" {
+		t.Errorf("Email.Password = %q, want %q", email.Password, "env-password")
+	}
+}
+
 func TestLoad_PostureAttributes(t *testing.T) {
 	tempDir := t.TempDir()
 	configPath := filepath.Join(tempDir, "config.yaml")
@@ -5,19 +5,27 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/rajsinghtech/tailgrant/internal/audit"
+	"github.com/rajsinghtech/tailgrant/internal/notify"
 	"github.com/rajsinghtech/tailgrant/internal/tsapi"
 	tailscale "tailscale.com/client/tailscale/v2"
 	enumspb "go.temporal.io/api/enums/v1"
 	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/api/workflowservice/v1"
 	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
 )
 
 // Activities holds dependencies for Tailscale API activity implementations.
 type Activities struct {
-	TS       *tailscale.Client
-	Temporal client.Client
-	UserOps  *tsapi.UserOperations
+	TS         *tailscale.Client
+	Temporal   client.Client
+	UserOps    *tsapi.UserOperations
+	Principals *tsapi.PrincipalResolver
+	Audit      audit.Sink
+	Notifier   *notify.Notifier
+	Slack      *notify.Slack
 }
 
 // GetDevice fetches a device by ID.
@@ -67,6 +75,52 @@ func (a *Activities) SetDeviceTags(ctx context.Context, deviceID string, tags []
 	return nil
 }
 
+// GetDeviceRoutes fetches the routes a device advertises and those enabled
+// for it.
+func (a *Activities) GetDeviceRoutes(ctx context.Context, deviceID string) (*tailscale.DeviceRoutes, error) {
+	logger := activity.GetLogger(ctx)
+	logger.Info("GetDeviceRoutes", "deviceID", deviceID)
+
+	routes, err := a.TS.Devices().SubnetRoutes(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("get device routes %s: %w", deviceID, err)
+	}
+	return routes, nil
+}
+
+// SetDeviceRoutes sets the full list of enabled routes on a device.
+func (a *Activities) SetDeviceRoutes(ctx context.Context, deviceID string, routes []string) error {
+	logger := activity.GetLogger(ctx)
+	logger.Info("SetDeviceRoutes", "deviceID", deviceID, "routes", routes)
+
+	if err := a.TS.Devices().SetSubnetRoutes(ctx, deviceID, routes); err != nil {
+		return fmt.Errorf("set device routes %s: %w", deviceID, err)
+	}
+	return nil
+}
+
+// SetDeviceKeyExpiryDisabled disables or re-enables key expiry on a device.
+func (a *Activities) SetDeviceKeyExpiryDisabled(ctx context.Context, deviceID string, disabled bool) error {
+	logger := activity.GetLogger(ctx)
+	logger.Info("SetDeviceKeyExpiryDisabled", "deviceID", deviceID, "disabled", disabled)
+
+	if err := a.TS.Devices().SetKey(ctx, deviceID, tailscale.DeviceKey{KeyExpiryDisabled: disabled}); err != nil {
+		return fmt.Errorf("set key expiry on %s: %w", deviceID, err)
+	}
+	return nil
+}
+
+// SetDeviceAuthorized authorizes or de-authorizes a device.
+func (a *Activities) SetDeviceAuthorized(ctx context.Context, deviceID string, authorized bool) error {
+	logger := activity.GetLogger(ctx)
+	logger.Info("SetDeviceAuthorized", "deviceID", deviceID, "authorized", authorized)
+
+	if err := a.TS.Devices().SetAuthorized(ctx, deviceID, authorized); err != nil {
+		return fmt.Errorf("set authorized on %s: %w", deviceID, err)
+	}
+	return nil
+}
+
 // SignalWithStartDeviceTagManager atomically starts the DeviceTagManager workflow
 // (if not already running) and sends it an add-grant signal. This avoids the race
 // where SignalExternalWorkflow fails because no workflow exists yet.
@@ -93,6 +147,185 @@ func (a *Activities) SignalWithStartDeviceTagManager(ctx context.Context, nodeID
 	return nil
 }
 
+// SignalWithStartPolicyEditor starts the PolicyEditorWorkflow if it is not
+// already running and sends it an add-membership signal.
+func (a *Activities) SignalWithStartPolicyEditor(ctx context.Context, taskQueue string, sig AddMembershipSignal) error {
+	logger := activity.GetLogger(ctx)
+	logger.Info("SignalWithStartPolicyEditor", "grantID", sig.GrantID, "group", sig.Membership.Group)
+
+	return a.signalWithStartPolicyEditor(ctx, taskQueue, "add-membership", sig)
+}
+
+// SignalWithStartPolicyEditorGrant starts the PolicyEditorWorkflow if it is
+// not already running and sends it an add-policy-grant signal.
+func (a *Activities) SignalWithStartPolicyEditorGrant(ctx context.Context, taskQueue string, sig AddPolicyGrantSignal) error {
+	logger := activity.GetLogger(ctx)
+	logger.Info("SignalWithStartPolicyEditorGrant", "grantID", sig.GrantID)
+
+	return a.signalWithStartPolicyEditor(ctx, taskQueue, "add-policy-grant", sig)
+}
+
+// SignalWithStartPolicyEditorSync starts the PolicyEditorWorkflow if it is
+// not already running and asks it to rewrite the policy file from its state.
+// Reconciliation uses it to strip grants entries no grant owns.
+func (a *Activities) SignalWithStartPolicyEditorSync(ctx context.Context, taskQueue string) error {
+	logger := activity.GetLogger(ctx)
+	logger.Info("SignalWithStartPolicyEditorSync")
+
+	return a.signalWithStartPolicyEditor(ctx, taskQueue, "sync", SyncSignal{})
+}
+
+func (a *Activities) signalWithStartPolicyEditor(ctx context.Context, taskQueue, signalName string, arg any) error {
+	_, err := a.Temporal.SignalWithStartWorkflow(
+		ctx,
+		PolicyEditorWorkflowID,
+		signalName,
+		arg,
+		client.StartWorkflowOptions{
+			ID:        PolicyEditorWorkflowID,
+			TaskQueue: taskQueue,
+		},
+		PolicyEditorWorkflow,
+		PolicyEditorState{},
+	)
+	if err != nil {
+		return fmt.Errorf("signal-with-start policy editor: %w", err)
+	}
+	return nil
+}
+
+// UpdatePolicyGroups adds and removes group members in the tailnet policy
+// file in one write, keeping its comments and formatting. The write is
+// conditional on the policy's ETag, so a concurrent edit fails the
+// activity and the retry starts over from the new policy. It returns the
+// memberships that were added, leaving out members already in the group.
+func (a *Activities) UpdatePolicyGroups(ctx context.Context, add, remove []GroupMembership) ([]GroupMembership, error) {
+	logger := activity.GetLogger(ctx)
+	logger.Info("UpdatePolicyGroups", "add", len(add), "remove", len(remove))
+
+	raw, err := a.TS.PolicyFile().Raw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get policy file: %w", err)
+	}
+
+	policy := []byte(raw.HuJSON)
+	var added []GroupMembership
+	changed := false
+	for _, m := range remove {
+		var ok bool
+		if policy, ok, err = tsapi.RemoveGroupMember(policy, m.Group, m.Member); err != nil {
+			return nil, fmt.Errorf("remove %s from %s: %w", m.Member, m.Group, err)
+		}
+		changed = changed || ok
+	}
+	for _, m := range add {
+		var ok bool
+		if policy, ok, err = tsapi.AddGroupMember(policy, m.Group, m.Member); err != nil {
+			return nil, fmt.Errorf("add %s to %s: %w", m.Member, m.Group, err)
+		}
+		if ok {
+			added = append(added, m)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+
+	if err := a.TS.PolicyFile().Set(ctx, string(policy), raw.ETag); err != nil {
+		return nil, fmt.Errorf("set policy file: %w", err)
+	}
+	return added, nil
+}
+
+// ValidatePolicyGrant checks that the tailnet policy file is still valid
+// with a grant's entry added, without writing it. An entry the policy
+// validate endpoint rejects fails the activity without retries.
+func (a *Activities) ValidatePolicyGrant(ctx context.Context, grantID string, entry tsapi.PolicyGrant) error {
+	logger := activity.GetLogger(ctx)
+	logger.Info("ValidatePolicyGrant", "grantID", grantID)
+
+	raw, err := a.TS.PolicyFile().Raw(ctx)
+	if err != nil {
+		return fmt.Errorf("get policy file: %w", err)
+	}
+	grants := make(map[string]tsapi.PolicyGrant)
+	ids, err := tsapi.MarkedGrantIDs([]byte(raw.HuJSON))
+	if err != nil {
+		return temporal.NewNonRetryableApplicationError(err.Error(), errTypeInvalidPolicy, err)
+	}
+	for _, id := range ids {
+		grants[id] = tsapi.PolicyGrant{} // already in the file, left as is
+	}
+	grants[grantID] = entry
+	policy, _, err := tsapi.SyncMarkedGrants([]byte(raw.HuJSON), grants)
+	if err != nil {
+		return temporal.NewNonRetryableApplicationError(err.Error(), errTypeInvalidPolicy, err)
+	}
+	return a.validatePolicy(ctx, policy)
+}
+
+// SyncPolicyGrants brings the grants entries TailGrant marked in the
+// tailnet policy file in line with grants, keyed by grant ID: missing
+// entries are inserted and entries of other grant IDs are removed. The
+// result is validated before it is written, and the write is conditional
+// on the policy's ETag like UpdatePolicyGroups.
+func (a *Activities) SyncPolicyGrants(ctx context.Context, grants map[string]tsapi.PolicyGrant) error {
+	logger := activity.GetLogger(ctx)
+	logger.Info("SyncPolicyGrants", "grants", len(grants))
+
+	raw, err := a.TS.PolicyFile().Raw(ctx)
+	if err != nil {
+		return fmt.Errorf("get policy file: %w", err)
+	}
+	policy, changed, err := tsapi.SyncMarkedGrants([]byte(raw.HuJSON), grants)
+	if err != nil {
+		return fmt.Errorf("sync policy grants: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := a.validatePolicy(ctx, policy); err != nil {
+		return err
+	}
+	if err := a.TS.PolicyFile().Set(ctx, string(policy), raw.ETag); err != nil {
+		return fmt.Errorf("set policy file: %w", err)
+	}
+	return nil
+}
+
+// ListPolicyGrantMarkers returns the grant IDs of the grants entries
+// TailGrant marked in the tailnet policy file.
+func (a *Activities) ListPolicyGrantMarkers(ctx context.Context) ([]string, error) {
+	logger := activity.GetLogger(ctx)
+	logger.Info("ListPolicyGrantMarkers")
+
+	raw, err := a.TS.PolicyFile().Raw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get policy file: %w", err)
+	}
+	ids, err := tsapi.MarkedGrantIDs([]byte(raw.HuJSON))
+	if err != nil {
+		return nil, fmt.Errorf("list policy grant markers: %w", err)
+	}
+	return ids, nil
+}
+
+// validatePolicy checks a policy file with the policy validate endpoint.
+// A policy the endpoint rejects is a non-retryable error.
+func (a *Activities) validatePolicy(ctx context.Context, policy []byte) error {
+	err := tsapi.ValidatePolicy(ctx, a.TS, policy)
+	if err == nil {
+		return nil
+	}
+	var rejected *tsapi.PolicyValidationError
+	if errors.As(err, &rejected) {
+		return temporal.NewNonRetryableApplicationError(err.Error(), errTypeInvalidPolicy, err)
+	}
+	return fmt.Errorf("validate policy file: %w", err)
+}
+
 // CheckWorkflowExists returns true if a workflow with the given ID is currently running.
 func (a *Activities) CheckWorkflowExists(ctx context.Context, workflowID string) (bool, error) {
 	logger := activity.GetLogger(ctx)
@@ -110,6 +343,31 @@ func (a *Activities) CheckWorkflowExists(ctx context.Context, workflowID string)
 	return status == enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING, nil
 }
 
+// ListRunningTagManagers returns the IDs of all running DeviceTagManager
+// workflows from visibility, which may lag behind workflows just started.
+func (a *Activities) ListRunningTagManagers(ctx context.Context) ([]string, error) {
+	logger := activity.GetLogger(ctx)
+	logger.Info("ListRunningTagManagers")
+
+	var ids []string
+	var token []byte
+	for {
+		resp, err := a.Temporal.ListWorkflow(ctx, &workflowservice.ListWorkflowExecutionsRequest{
+			Query:         "WorkflowType = 'DeviceTagManagerWorkflow' AND ExecutionStatus = 'Running'",
+			NextPageToken: token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list tag managers: %w", err)
+		}
+		for _, exec := range resp.Executions {
+			ids = append(ids, exec.GetExecution().GetWorkflowId())
+		}
+		if token = resp.NextPageToken; len(token) == 0 {
+			return ids, nil
+		}
+	}
+}
+
 // QueryActiveGrants queries a DeviceTagManager workflow for its active grants.
 // Returns nil map if the workflow can't be queried.
 func (a *Activities) QueryActiveGrants(ctx context.Context, workflowID string) (map[string]GrantAssets, error) {
@@ -128,6 +386,60 @@ func (a *Activities) QueryActiveGrants(ctx context.Context, workflowID string) (
 	return activeGrants, nil
 }
 
+// QueryOriginalKeyExpiry queries a DeviceTagManager workflow for the key
+// expiry setting it will restore, nil if it has none.
+func (a *Activities) QueryOriginalKeyExpiry(ctx context.Context, workflowID string) (*bool, error) {
+	logger := activity.GetLogger(ctx)
+	logger.Info("QueryOriginalKeyExpiry", "workflowID", workflowID)
+
+	resp, err := a.Temporal.QueryWorkflow(ctx, workflowID, "", "original-key-expiry")
+	if err != nil {
+		return nil, fmt.Errorf("query original key expiry %s: %w", workflowID, err)
+	}
+
+	var original *bool
+	if err := resp.Get(&original); err != nil {
+		return nil, fmt.Errorf("decode original key expiry %s: %w", workflowID, err)
+	}
+	return original, nil
+}
+
+// QueryOriginalAuthorized queries a DeviceTagManager workflow for the
+// authorization it will restore, nil if it has none.
+func (a *Activities) QueryOriginalAuthorized(ctx context.Context, workflowID string) (*bool, error) {
+	logger := activity.GetLogger(ctx)
+	logger.Info("QueryOriginalAuthorized", "workflowID", workflowID)
+
+	resp, err := a.Temporal.QueryWorkflow(ctx, workflowID, "", "original-authorized")
+	if err != nil {
+		return nil, fmt.Errorf("query original authorized %s: %w", workflowID, err)
+	}
+
+	var original *bool
+	if err := resp.Get(&original); err != nil {
+		return nil, fmt.Errorf("decode original authorized %s: %w", workflowID, err)
+	}
+	return original, nil
+}
+
+// QueryPolicyGrants queries the PolicyEditorWorkflow for the policy file
+// grants entries it keeps, keyed by grant ID.
+func (a *Activities) QueryPolicyGrants(ctx context.Context) (map[string]tsapi.PolicyGrant, error) {
+	logger := activity.GetLogger(ctx)
+	logger.Info("QueryPolicyGrants")
+
+	resp, err := a.Temporal.QueryWorkflow(ctx, PolicyEditorWorkflowID, "", "policy-grants")
+	if err != nil {
+		return nil, fmt.Errorf("query policy grants: %w", err)
+	}
+
+	var grants map[string]tsapi.PolicyGrant
+	if err := resp.Get(&grants); err != nil {
+		return nil, fmt.Errorf("decode policy grants: %w", err)
+	}
+	return grants, nil
+}
+
 // SetPostureAttribute sets a posture attribute on a device.
 func (a *Activities) SetPostureAttribute(ctx context.Context, deviceID string, key string, value any) error {
 	logger := activity.GetLogger(ctx)
@@ -176,9 +488,10 @@ func (a *Activities) GetUser(ctx context.Context, userID string) (*UserInfo, err
 		return nil, fmt.Errorf("get user %s: %w", userID, err)
 	}
 	return &UserInfo{
-		ID:     user.ID,
-		Role:   string(user.Role),
-		Status: string(user.Status),
+		ID:        user.ID,
+		LoginName: user.LoginName,
+		Role:      string(user.Role),
+		Status:    string(user.Status),
 	}, nil
 }
 
@@ -223,3 +536,24 @@ func (a *Activities) RestoreUser(ctx context.Context, userID string) error {
 	}
 	return nil
 }
+
+// ResolveCaller resolves a login's approver and admin membership for a grant
+// type against the tailnet's policy-file groups and user roles.
+func (a *Activities) ResolveCaller(ctx context.Context, gt GrantType, login string) (Caller, error) {
+	if a.Principals == nil {
+		return Caller{}, fmt.Errorf("principal resolver not configured")
+	}
+	logger := activity.GetLogger(ctx)
+	logger.Info("ResolveCaller", "grantType", gt.Name, "login", login)
+
+	return ResolveCaller(ctx, a.Principals, gt, login)
+}
+
+// LoadPolicyInputs gathers the device facts request policy rules can see,
+// one input per target device.
+func (a *Activities) LoadPolicyInputs(ctx context.Context, grantType GrantType, req GrantRequest) ([]PolicyInput, error) {
+	logger := activity.GetLogger(ctx)
+	logger.Info("LoadPolicyInputs", "grantID", req.ID, "grantType", grantType.Name)
+
+	return NewPolicyInputs(ctx, a.TS, &grantType, req)
+}
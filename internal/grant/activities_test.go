@@ -31,4 +31,12 @@ func TestActivities_Registration(t *testing.T) {
 	env.RegisterActivity(a.SetPostureAttribute)
 	env.RegisterActivity(a.DeletePostureAttribute)
 	env.RegisterActivity(a.GetPostureAttributes)
+	env.RegisterActivity(a.SignalWithStartPolicyEditor)
+	env.RegisterActivity(a.UpdatePolicyGroups)
+	env.RegisterActivity(a.SignalWithStartPolicyEditorGrant)
+	env.RegisterActivity(a.SignalWithStartPolicyEditorSync)
+	env.RegisterActivity(a.ValidatePolicyGrant)
+	env.RegisterActivity(a.SyncPolicyGrants)
+	env.RegisterActivity(a.ListPolicyGrantMarkers)
+	env.RegisterActivity(a.QueryPolicyGrants)
 }
@@ -1,31 +1,172 @@
 package grant
 
 import (
+	"slices"
 	"time"
 
+	"github.com/rajsinghtech/tailgrant/internal/notify"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
 )
 
-const approvalTimeout = 24 * time.Hour
+// defaultApprovalTimeout applies to grant types without escalation stages.
+const defaultApprovalTimeout = 24 * time.Hour
 
-func ApprovalWorkflow(ctx workflow.Context, grantID string, grantType GrantType, requesterLogin string) (ApprovalResult, error) {
+// ApprovalQuorum returns the number of distinct approvals a grant type needs.
+func (gt GrantType) ApprovalQuorum() int {
+	if gt.RequiredApprovals < 1 {
+		return 1
+	}
+	return gt.RequiredApprovals
+}
+
+// Stages returns the grant type's escalation chain. Grant types without
+// configured stages have a single stage of their approvers with the
+// default timeout.
+func (gt GrantType) Stages() []ApprovalStage {
+	if len(gt.ApprovalStages) > 0 {
+		return gt.ApprovalStages
+	}
+	return []ApprovalStage{{
+		Approvers: gt.Approvers,
+		Timeout:   JSONDuration(defaultApprovalTimeout),
+	}}
+}
+
+// ForStage returns a copy of the grant type whose approvers are those
+// eligible at the given escalation stage: the approvers of that stage and
+// every earlier one.
+func (gt GrantType) ForStage(index int) GrantType {
+	if len(gt.ApprovalStages) == 0 {
+		return gt
+	}
+	index = min(max(index, 0), len(gt.ApprovalStages)-1)
+	var approvers []string
+	for _, stage := range gt.ApprovalStages[:index+1] {
+		for _, a := range stage.Approvers {
+			if !slices.Contains(approvers, a) {
+				approvers = append(approvers, a)
+			}
+		}
+	}
+	gt.Approvers = approvers
+	return gt
+}
+
+// ForLastStage returns the grant type narrowed to the last escalation
+// stage, whose approvers include those of every stage.
+func (gt GrantType) ForLastStage() GrantType {
+	return gt.ForStage(len(gt.ApprovalStages) - 1)
+}
+
+// StageStatus describes escalation stage index of the grant type, due to
+// time out at deadline.
+func (gt GrantType) StageStatus(index int, deadline time.Time) ApprovalStageStatus {
+	stages := gt.Stages()
+	return ApprovalStageStatus{
+		Index:     index,
+		Total:     len(stages),
+		Name:      stages[index].Name,
+		Approvers: gt.ForStage(index).Approvers,
+		Deadline:  deadline,
+	}
+}
+
+// ApprovalWorkflow collects approvals for a grant request. For a renewal,
+// renewedBy is whoever asked for it; neither they nor the grant's requester
+// may approve.
+func ApprovalWorkflow(ctx workflow.Context, grantID string, grantType GrantType, requesterLogin, renewedBy string) (ApprovalResult, error) {
 	logger := workflow.GetLogger(ctx)
 	logger.Info("ApprovalWorkflow started", "grantID", grantID)
 
-	approvers := make(map[string]struct{}, len(grantType.Approvers))
-	for _, a := range grantType.Approvers {
-		approvers[a] = struct{}{}
-	}
+	quorum := grantType.ApprovalQuorum()
+	stages := grantType.Stages()
+	parent := workflow.GetInfo(ctx).ParentWorkflowExecution
+
+	actCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: 30 * time.Second,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 5,
+		},
+	})
 
 	approveCh := workflow.GetSignalChannel(ctx, "approve")
 	denyCh := workflow.GetSignalChannel(ctx, "deny")
+	cancelCh := workflow.GetSignalChannel(ctx, "cancel")
 
+	stage := 0
+	stageGT := grantType.ForStage(stage)
+	deadline := workflow.Now(ctx).Add(time.Duration(stages[stage].Timeout))
 	timerCtx, timerCancel := workflow.WithCancel(ctx)
-	timerFuture := workflow.NewTimer(timerCtx, approvalTimeout)
+	timerFuture := workflow.NewTimer(timerCtx, time.Duration(stages[stage].Timeout))
 
 	var result ApprovalResult
+	var approvals []string
 	decided := false
 
+	// reportProgress keeps the parent's status query current with partial
+	// approvals and the escalation stage.
+	reportProgress := func() {
+		if parent == nil {
+			return
+		}
+		if err := workflow.SignalExternalWorkflow(ctx, parent.ID, parent.RunID, "approval-progress", ApprovalProgress{
+			Approvals: approvals,
+			Required:  quorum,
+			Stage:     grantType.StageStatus(stage, deadline),
+		}).Get(ctx, nil); err != nil {
+			logger.Error("Failed to signal approval progress", "grantID", grantID, "error", err)
+		}
+	}
+
+	// notifyPending tells the approvers eligible at the current stage that
+	// the grant is waiting for them.
+	notifyPending := func() {}
+	if workflow.GetVersion(ctx, "notifications", workflow.DefaultVersion, 1) == 1 {
+		notifyPending = func() {
+			sendNotification(ctx, notify.Notification{
+				Event:         notify.EventPendingApproval,
+				GrantID:       grantID,
+				GrantType:     grantType.Name,
+				Requester:     requesterLogin,
+				Approvers:     stageGT.Approvers,
+				Stage:         stages[stage].Name,
+				StageDeadline: deadline,
+			})
+		}
+	}
+	notifyPending()
+
+	// Post the request to Slack with Approve and Deny buttons, and keep the
+	// message current until it is decided.
+	var activities *Activities
+	var slackMsg *notify.SlackMessage
+	approvalMessage := func() notify.ApprovalMessage {
+		return notify.ApprovalMessage{
+			GrantID:   grantID,
+			GrantType: grantType.Name,
+			Requester: requesterLogin,
+			Approvers: stageGT.Approvers,
+			Stage:     stages[stage].Name,
+			Deadline:  deadline,
+			Approvals: approvals,
+			Required:  quorum,
+		}
+	}
+	updateSlack := func(msg notify.ApprovalMessage) {
+		if slackMsg == nil {
+			return
+		}
+		if err := workflow.ExecuteActivity(actCtx, activities.UpdateApprovalMessage, *slackMsg, msg).Get(ctx, nil); err != nil {
+			logger.Error("Failed to update Slack approval message", "grantID", grantID, "error", err)
+		}
+	}
+	if workflow.GetVersion(ctx, "slack-approvals", workflow.DefaultVersion, 1) == 1 {
+		if err := workflow.ExecuteActivity(actCtx, activities.PostApprovalMessage, approvalMessage()).Get(ctx, &slackMsg); err != nil {
+			logger.Error("Failed to post Slack approval message", "grantID", grantID, "error", err)
+		}
+	}
+
 	for !decided {
 		sel := workflow.NewSelector(ctx)
 
@@ -33,13 +174,31 @@ func ApprovalWorkflow(ctx workflow.Context, grantID string, grantType GrantType,
 			var sig ApproveSignal
 			ch.Receive(ctx, &sig)
 
-			if sig.ApprovedBy == requesterLogin {
+			if sig.ApprovedBy == requesterLogin || (renewedBy != "" && sig.ApprovedBy == renewedBy) {
 				logger.Warn("Self-approval rejected", "grantID", grantID, "attemptedBy", sig.ApprovedBy)
 				return
 			}
 
-			if _, ok := approvers[sig.ApprovedBy]; !ok && len(approvers) > 0 {
-				logger.Warn("Unauthorized approval attempt", "grantID", grantID, "attemptedBy", sig.ApprovedBy)
+			caller, err := resolveCaller(actCtx, stageGT, sig.ApprovedBy)
+			if err != nil {
+				logger.Error("Failed to resolve approver", "grantID", grantID, "attemptedBy", sig.ApprovedBy, "error", err)
+				return
+			}
+			if !CanApprove(GrantRequest{Requester: requesterLogin}, caller) {
+				logger.Warn("Unauthorized approval attempt", "grantID", grantID, "attemptedBy", sig.ApprovedBy, "stage", stage)
+				return
+			}
+
+			if slices.Contains(approvals, sig.ApprovedBy) {
+				logger.Info("Duplicate approval ignored", "grantID", grantID, "approvedBy", sig.ApprovedBy)
+				return
+			}
+			approvals = append(approvals, sig.ApprovedBy)
+
+			if len(approvals) < quorum {
+				logger.Info("Partial approval recorded", "grantID", grantID, "approvedBy", sig.ApprovedBy, "approvals", len(approvals), "required", quorum)
+				reportProgress()
+				updateSlack(approvalMessage())
 				return
 			}
 
@@ -47,6 +206,7 @@ func ApprovalWorkflow(ctx workflow.Context, grantID string, grantType GrantType,
 			result = ApprovalResult{
 				Approved:   true,
 				ApprovedBy: sig.ApprovedBy,
+				Approvals:  approvals,
 			}
 			decided = true
 			logger.Info("Grant approved", "grantID", grantID, "approvedBy", sig.ApprovedBy)
@@ -55,29 +215,93 @@ func ApprovalWorkflow(ctx workflow.Context, grantID string, grantType GrantType,
 		sel.AddReceive(denyCh, func(ch workflow.ReceiveChannel, more bool) {
 			var sig DenySignal
 			ch.Receive(ctx, &sig)
+
+			caller, err := resolveCaller(actCtx, stageGT, sig.DeniedBy)
+			if err != nil {
+				logger.Error("Failed to resolve denier", "grantID", grantID, "attemptedBy", sig.DeniedBy, "error", err)
+				return
+			}
+			if !CanDeny(caller) {
+				logger.Warn("Unauthorized deny attempt", "grantID", grantID, "attemptedBy", sig.DeniedBy, "stage", stage)
+				return
+			}
+
 			timerCancel()
 			result = ApprovalResult{
-				Approved: false,
-				DeniedBy: sig.DeniedBy,
-				Reason:   sig.Reason,
+				Approved:  false,
+				Approvals: approvals,
+				DeniedBy:  sig.DeniedBy,
+				Reason:    sig.Reason,
 			}
 			decided = true
 			logger.Info("Grant denied", "grantID", grantID, "deniedBy", sig.DeniedBy)
 		})
 
+		sel.AddReceive(cancelCh, func(ch workflow.ReceiveChannel, more bool) {
+			var sig CancelSignal
+			ch.Receive(ctx, &sig)
+
+			if !CanCancel(GrantRequest{Requester: requesterLogin}, Caller{Login: sig.CancelledBy}) {
+				logger.Warn("Unauthorized cancel attempt", "grantID", grantID, "attemptedBy", sig.CancelledBy)
+				return
+			}
+
+			timerCancel()
+			result = ApprovalResult{
+				Approved:    false,
+				Approvals:   approvals,
+				Reason:      "cancelled by requester",
+				CancelledBy: sig.CancelledBy,
+			}
+			decided = true
+			logger.Info("Grant request cancelled", "grantID", grantID, "cancelledBy", sig.CancelledBy)
+		})
+
 		sel.AddFuture(timerFuture, func(f workflow.Future) {
-			if err := f.Get(ctx, nil); err == nil {
-				result = ApprovalResult{
-					Approved: false,
-					Reason:   "approval timed out",
-				}
-				decided = true
-				logger.Info("Approval timed out", "grantID", grantID)
+			if err := f.Get(ctx, nil); err != nil {
+				return
 			}
+			if stage+1 < len(stages) {
+				stage++
+				stageGT = grantType.ForStage(stage)
+				timeout := time.Duration(stages[stage].Timeout)
+				deadline = workflow.Now(ctx).Add(timeout)
+				timerCtx, timerCancel = workflow.WithCancel(ctx)
+				timerFuture = workflow.NewTimer(timerCtx, timeout)
+				logger.Info("Approval escalated", "grantID", grantID, "stage", stage, "name", stages[stage].Name)
+				reportProgress()
+				notifyPending()
+				updateSlack(approvalMessage())
+				return
+			}
+			result = ApprovalResult{
+				Approved:  false,
+				Approvals: approvals,
+				Reason:    "approval timed out",
+			}
+			decided = true
+			logger.Info("Approval timed out", "grantID", grantID)
 		})
 
 		sel.Select(ctx)
 	}
 
+	final := approvalMessage()
+	switch {
+	case result.Approved:
+		final.Outcome = notify.OutcomeApproved
+		final.DecidedBy = result.ApprovedBy
+	case result.CancelledBy != "":
+		final.Outcome = notify.OutcomeCancelled
+		final.DecidedBy = result.CancelledBy
+	case result.DeniedBy != "":
+		final.Outcome = notify.OutcomeDenied
+		final.DecidedBy = result.DeniedBy
+		final.Note = result.Reason
+	default:
+		final.Outcome = notify.OutcomeTimedOut
+	}
+	updateSlack(final)
+
 	return result, nil
 }
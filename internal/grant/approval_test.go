@@ -0,0 +1,271 @@
+package grant
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestApprovalWorkflow_Approved(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+
+	grantType := GrantType{
+		Name:      "admin-access",
+		RiskLevel: RiskHigh,
+		Approvers: []string{"approver@example.com"},
+	}
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "approver@example.com"})
+	}, time.Minute)
+
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-1", grantType, "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result ApprovalResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.True(t, result.Approved)
+	require.Equal(t, "approver@example.com", result.ApprovedBy)
+}
+
+func TestApprovalWorkflow_UnauthorizedSignalsIgnored(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+
+	grantType := GrantType{
+		Name:      "admin-access",
+		RiskLevel: RiskHigh,
+		Approvers: []string{"approver@example.com"},
+	}
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("deny", DenySignal{DeniedBy: "mallory@example.com"})
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "mallory@example.com"})
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "user@example.com"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("deny", DenySignal{DeniedBy: "approver@example.com", Reason: "not needed"})
+	}, 2*time.Minute)
+
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-2", grantType, "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result ApprovalResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.False(t, result.Approved)
+	require.Equal(t, "approver@example.com", result.DeniedBy)
+}
+
+func TestApprovalWorkflow_CancelledByRequester(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+
+	grantType := GrantType{
+		Name:      "admin-access",
+		RiskLevel: RiskHigh,
+		Approvers: []string{"approver@example.com"},
+	}
+
+	// Only the requester may cancel; an approver denies instead.
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("cancel", CancelSignal{CancelledBy: "approver@example.com"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("cancel", CancelSignal{CancelledBy: "user@example.com"})
+	}, 2*time.Minute)
+
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-cancel", grantType, "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result ApprovalResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.False(t, result.Approved)
+	require.Equal(t, "user@example.com", result.CancelledBy)
+	require.Empty(t, result.DeniedBy)
+}
+
+func TestApprovalWorkflow_Quorum(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+
+	grantType := GrantType{
+		Name:              "admin-access",
+		RiskLevel:         RiskHigh,
+		Approvers:         []string{"a@example.com", "b@example.com", "c@example.com"},
+		RequiredApprovals: 2,
+	}
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "a@example.com"})
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "a@example.com"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "c@example.com"})
+	}, 2*time.Minute)
+
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-3", grantType, "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result ApprovalResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.True(t, result.Approved)
+	require.Equal(t, "c@example.com", result.ApprovedBy)
+	require.Equal(t, []string{"a@example.com", "c@example.com"}, result.Approvals)
+}
+
+func TestApprovalWorkflow_QuorumDeniedAfterPartial(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+
+	grantType := GrantType{
+		Name:              "admin-access",
+		RiskLevel:         RiskHigh,
+		Approvers:         []string{"a@example.com", "b@example.com"},
+		RequiredApprovals: 2,
+	}
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "a@example.com"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("deny", DenySignal{DeniedBy: "b@example.com"})
+	}, 2*time.Minute)
+
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-4", grantType, "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result ApprovalResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.False(t, result.Approved)
+	require.Equal(t, "b@example.com", result.DeniedBy)
+	require.Equal(t, []string{"a@example.com"}, result.Approvals)
+}
+
+func TestApprovalWorkflow_GroupApprover(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+
+	grantType := GrantType{
+		Name:      "admin-access",
+		RiskLevel: RiskHigh,
+		Approvers: []string{"group:secops"},
+	}
+
+	var a *Activities
+	env.OnActivity(a.ResolveCaller, mock.Anything, grantType, "mallory@example.com").
+		Return(Caller{Login: "mallory@example.com"}, nil)
+	env.OnActivity(a.ResolveCaller, mock.Anything, grantType, "alice@example.com").
+		Return(Caller{Login: "alice@example.com", Approver: true}, nil)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "mallory@example.com"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "alice@example.com"})
+	}, 2*time.Minute)
+
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-5", grantType, "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result ApprovalResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.True(t, result.Approved)
+	require.Equal(t, []string{"alice@example.com"}, result.Approvals)
+	env.AssertExpectations(t)
+}
+
+func escalationGrantType() GrantType {
+	return GrantType{
+		Name:      "admin-access",
+		RiskLevel: RiskHigh,
+		Approvers: []string{"oncall@example.com", "lead@example.com"},
+		ApprovalStages: []ApprovalStage{
+			{Name: "on-call", Approvers: []string{"oncall@example.com"}, Timeout: JSONDuration(15 * time.Minute)},
+			{Name: "leads", Approvers: []string{"lead@example.com"}, Timeout: JSONDuration(time.Hour)},
+		},
+	}
+}
+
+func TestApprovalWorkflow_EscalatesToNextStage(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+
+	// The lead is not yet eligible during the on-call stage.
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "lead@example.com"})
+	}, 5*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "lead@example.com"})
+	}, 20*time.Minute)
+
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-6", escalationGrantType(), "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result ApprovalResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.True(t, result.Approved)
+	require.Equal(t, "lead@example.com", result.ApprovedBy)
+}
+
+func TestApprovalWorkflow_EarlierStageStaysEligible(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("deny", DenySignal{DeniedBy: "oncall@example.com", Reason: "not now"})
+	}, 30*time.Minute)
+
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-7", escalationGrantType(), "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result ApprovalResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.False(t, result.Approved)
+	require.Equal(t, "oncall@example.com", result.DeniedBy)
+}
+
+func TestApprovalWorkflow_LastStageTimesOut(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+
+	start := env.Now()
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-8", escalationGrantType(), "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result ApprovalResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.False(t, result.Approved)
+	require.Equal(t, "approval timed out", result.Reason)
+	require.Equal(t, 75*time.Minute, env.Now().Sub(start))
+}
@@ -0,0 +1,44 @@
+package grant
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/audit"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// RecordAuditEvent writes an audit event to the configured sinks. The
+// event ID is derived from the workflow run and activity ID, so retries of
+// the same event share an ID. It is a no-op when no sinks are configured.
+func (a *Activities) RecordAuditEvent(ctx context.Context, ev audit.Event) error {
+	if a.Audit == nil {
+		return nil
+	}
+	info := activity.GetInfo(ctx)
+	ev.ID = fmt.Sprintf("%s/%s", info.WorkflowExecution.RunID, info.ActivityID)
+	if err := a.Audit.Write(ctx, ev); err != nil {
+		return fmt.Errorf("record audit event %s: %w", ev.Type, err)
+	}
+	return nil
+}
+
+// recordAudit records an audit event stamped with the workflow's clock.
+// Failures are logged rather than returned: an unavailable sink must not
+// keep a grant from being revoked or expiring.
+func recordAudit(ctx workflow.Context, ev audit.Event) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: 10 * time.Second,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 5,
+		},
+	})
+	ev.Time = workflow.Now(ctx)
+	var activities *Activities
+	if err := workflow.ExecuteActivity(ctx, activities.RecordAuditEvent, ev).Get(ctx, nil); err != nil {
+		workflow.GetLogger(ctx).Error("Failed to record audit event", "type", ev.Type, "grantID", ev.GrantID, "error", err)
+	}
+}
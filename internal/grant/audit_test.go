@@ -0,0 +1,158 @@
+package grant
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/audit"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+	tailscale "tailscale.com/client/tailscale/v2"
+)
+
+func TestGrantWorkflow_AuditEvents(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:            "grant-audit",
+		Requester:     "user@example.com",
+		GrantTypeName: "high-risk-access",
+		TargetNodeID:  "node-456",
+		Duration:      30 * time.Minute,
+		Reason:        "incident 42",
+	}
+
+	grantType := GrantType{
+		Name:      "high-risk-access",
+		Tags:      []string{"tag:jit-admin"},
+		RiskLevel: RiskHigh,
+		Approvers: []string{"approver@example.com"},
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	var events []audit.Event
+	env.OnActivity("RecordAuditEvent", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		events = append(events, args.Get(1).(audit.Event))
+	}).Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflowByID("approval-grant-audit", "approve", ApproveSignal{ApprovedBy: "approver@example.com"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("extend", ExtendSignal{ExtendedBy: "user@example.com", Duration: time.Hour})
+	}, 10*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflowByID("approval-grant-audit", "approve", ApproveSignal{ApprovedBy: "approver@example.com"})
+	}, 15*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("revoke", RevokeSignal{RevokedBy: "approver@example.com", Reason: "done"})
+	}, 20*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var types []audit.EventType
+	for _, ev := range events {
+		types = append(types, ev.Type)
+		require.Equal(t, "grant-audit", ev.GrantID)
+		require.Equal(t, "high-risk-access", ev.GrantType)
+		require.Equal(t, "user@example.com", ev.Requester)
+		require.Equal(t, []string{"node-456"}, ev.Targets)
+		require.False(t, ev.Time.IsZero())
+	}
+	require.Equal(t, []audit.EventType{
+		audit.EventRequested, audit.EventApproved, audit.EventActivated, audit.EventRequested, audit.EventExtended, audit.EventRevoked,
+	}, types)
+
+	require.Equal(t, "incident 42", events[0].Reason)
+	require.Equal(t, "30m0s", events[0].Details["duration"])
+	require.Equal(t, "approver@example.com", events[1].Actor)
+	require.Equal(t, "user@example.com", events[3].Actor)
+	require.Equal(t, "true", events[3].Details["renewal"])
+	require.Equal(t, "user@example.com", events[4].Actor)
+	require.Equal(t, "approver@example.com", events[4].Details["approvedBy"])
+	require.Equal(t, "1h0m0s", events[4].Details["duration"])
+	require.Equal(t, "approver@example.com", events[5].Actor)
+	require.Equal(t, "done", events[5].Reason)
+}
+
+func TestGrantWorkflow_AuditPolicyDenied(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	grantType := GrantType{
+		Name:      "ssh",
+		Tags:      []string{"tag:ssh"},
+		RiskLevel: RiskLow,
+		Policy: []PolicyRule{
+			{When: `target.os == "windows"`, Decision: DecisionDeny, Message: "no windows targets"},
+		},
+	}
+	request := GrantRequest{ID: "grant-denied", Requester: "user@example.com", TargetNodeID: "node-1", Duration: 30 * time.Minute}
+
+	var events []audit.Event
+	env.OnActivity("LoadPolicyInputs", mock.Anything, mock.Anything, mock.Anything).Return([]PolicyInput{{
+		RequesterLogin: "user@example.com",
+		TargetOS:       "windows",
+	}}, nil)
+	env.OnActivity("RecordAuditEvent", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		events = append(events, args.Get(1).(audit.Event))
+	}).Return(nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.Len(t, events, 2)
+	require.Equal(t, audit.EventDenied, events[1].Type)
+	require.Equal(t, "no windows targets", events[1].Reason)
+	require.Equal(t, "1", events[1].Details["rule"])
+}
+
+func TestReconciliationWorkflow_AuditsCorrections(t *testing.T) {
+	env, _ := setupReconcileTestEnv()
+
+	env.OnActivity("ListDevices", mock.Anything).Return([]tailscale.Device{
+		{NodeID: "node-1", Tags: []string{"tag:server", "tag:ssh-granted"}},
+	}, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string(nil), nil)
+	env.OnActivity("CheckWorkflowExists", mock.Anything, "device-tags-node-1").Return(false, nil)
+	env.OnActivity("SetDeviceTags", mock.Anything, "node-1", []string{"tag:server"}).Return(nil)
+	var events []audit.Event
+	env.OnActivity("RecordAuditEvent", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		events = append(events, args.Get(1).(audit.Event))
+	}).Return(nil)
+
+	env.ExecuteWorkflow(ReconciliationWorkflow, ReconciliationInput{GrantTags: []string{"tag:ssh-granted"}})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.Len(t, events, 1)
+	require.Equal(t, audit.EventReconciled, events[0].Type)
+	require.Equal(t, []string{"node-1"}, events[0].Targets)
+	require.Equal(t, "tag:ssh-granted", events[0].Details["tags"])
+}
+
+func TestActivities_RecordAuditEvent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := audit.OpenFile(path)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestActivityEnvironment()
+	a := &Activities{Audit: sink}
+	env.RegisterActivity(a.RecordAuditEvent)
+
+	_, err = env.ExecuteActivity(a.RecordAuditEvent, audit.Event{Type: audit.EventRequested, GrantID: "g1"})
+	require.NoError(t, err)
+
+	log, err := audit.ReadFile(path, audit.Filter{})
+	require.NoError(t, err)
+	require.True(t, log.Verified)
+	require.Len(t, log.Events, 1)
+	require.Equal(t, "g1", log.Events[0].GrantID)
+	require.NotEmpty(t, log.Events[0].ID)
+}
@@ -0,0 +1,220 @@
+package grant
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/tsapi"
+)
+
+// ExtendPolicy controls who may extend an active grant.
+type ExtendPolicy string
+
+const (
+	ExtendRequesterOrApprover ExtendPolicy = "requester_or_approver"
+	ExtendRequester           ExtendPolicy = "requester"
+	ExtendApprover            ExtendPolicy = "approver"
+	ExtendNone                ExtendPolicy = "none"
+)
+
+// ParseExtendPolicy validates an extend policy string. An empty string
+// selects the default, ExtendRequesterOrApprover.
+func ParseExtendPolicy(s string) (ExtendPolicy, error) {
+	switch p := ExtendPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return ExtendRequesterOrApprover, nil
+	case ExtendRequesterOrApprover, ExtendRequester, ExtendApprover, ExtendNone:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid extendPolicy %q", s)
+	}
+}
+
+// Caller is the user acting on a grant, with approver and admin membership
+// already resolved against the tailnet. Approver and admin lists may name
+// policy-file groups and autogroups, which can only be expanded through the
+// Tailscale API, so membership is resolved once per action and the checks
+// below stay pure.
+type Caller struct {
+	Login    string `json:"login"`
+	Approver bool   `json:"approver"`
+	Admin    bool   `json:"admin"`
+}
+
+// Directory resolves group and autogroup principals for a login.
+// *tsapi.PrincipalResolver is the production implementation.
+type Directory interface {
+	IsMember(ctx context.Context, login string, principals []string) (bool, error)
+}
+
+// NeedsDirectory reports whether resolving callers for the grant type
+// requires a Directory lookup, i.e. whether its approvers or admins name
+// any groups.
+func (gt GrantType) NeedsDirectory() bool {
+	return slices.ContainsFunc(gt.Approvers, tsapi.IsGroupPrincipal) ||
+		slices.ContainsFunc(gt.Admins, tsapi.IsGroupPrincipal)
+}
+
+// ResolveCaller resolves login's approver and admin membership for the grant
+// type. dir is only consulted when the grant type names groups.
+func ResolveCaller(ctx context.Context, dir Directory, gt GrantType, login string) (Caller, error) {
+	if login == "" || !gt.NeedsDirectory() {
+		return staticCaller(gt, login), nil
+	}
+	c := Caller{Login: login}
+	if dir == nil {
+		return c, fmt.Errorf("grant type %q names groups but no directory is configured", gt.Name)
+	}
+
+	var err error
+	if c.Approver, err = dir.IsMember(ctx, login, gt.Approvers); err != nil {
+		return c, fmt.Errorf("resolve approvers: %w", err)
+	}
+	if c.Admin, err = dir.IsMember(ctx, login, gt.Admins); err != nil {
+		return c, fmt.Errorf("resolve admins: %w", err)
+	}
+	return c, nil
+}
+
+// staticCaller resolves membership by login equality alone, which is exact
+// for grant types that do not name groups.
+func staticCaller(gt GrantType, login string) Caller {
+	if login == "" {
+		return Caller{}
+	}
+	return Caller{
+		Login:    login,
+		Approver: slices.Contains(gt.Approvers, login),
+		Admin:    slices.Contains(gt.Admins, login),
+	}
+}
+
+// CanRequest reports whether login may request grants of the given type.
+// An empty EligibleRequesters list allows every tailnet user.
+func CanRequest(ctx context.Context, dir Directory, gt GrantType, login string) (bool, error) {
+	if login == "" {
+		return false, nil
+	}
+	if len(gt.EligibleRequesters) == 0 {
+		return true, nil
+	}
+	if !slices.ContainsFunc(gt.EligibleRequesters, tsapi.IsGroupPrincipal) {
+		return slices.Contains(gt.EligibleRequesters, login), nil
+	}
+	if dir == nil {
+		return false, fmt.Errorf("grant type %q names groups but no directory is configured", gt.Name)
+	}
+	ok, err := dir.IsMember(ctx, login, gt.EligibleRequesters)
+	if err != nil {
+		return false, fmt.Errorf("resolve eligible requesters: %w", err)
+	}
+	return ok, nil
+}
+
+// IsAdmin reports whether login is one of the global admins. admins may
+// name groups and autogroups, which are resolved through dir.
+func IsAdmin(ctx context.Context, dir Directory, admins []string, login string) (bool, error) {
+	if login == "" {
+		return false, nil
+	}
+	if !slices.ContainsFunc(admins, tsapi.IsGroupPrincipal) {
+		return slices.Contains(admins, login), nil
+	}
+	if dir == nil {
+		return false, fmt.Errorf("admins name groups but no directory is configured")
+	}
+	ok, err := dir.IsMember(ctx, login, admins)
+	if err != nil {
+		return false, fmt.Errorf("resolve admins: %w", err)
+	}
+	return ok, nil
+}
+
+// The authorization checks below are pure functions of the grant type,
+// request and resolved caller so they can run both in HTTP handlers and
+// inside workflows. The workflows re-check every signal, so a direct
+// Temporal signal cannot bypass the handler.
+
+// CanApprove reports whether the caller may approve the request. Requesters
+// can never approve their own grants.
+func CanApprove(req GrantRequest, c Caller) bool {
+	return c.Login != "" && c.Login != req.Requester && c.Approver
+}
+
+// CanDeny reports whether the caller may deny a pending request. Only
+// approvers may deny.
+func CanDeny(c Caller) bool {
+	return c.Login != "" && c.Approver
+}
+
+// CanRevoke reports whether the caller may revoke the grant: the requester,
+// an approver, or an admin.
+func CanRevoke(req GrantRequest, c Caller) bool {
+	if c.Login == "" {
+		return false
+	}
+	return c.Login == req.Requester || c.Approver || c.Admin
+}
+
+// CanCancel reports whether the caller may cancel a grant that has not yet
+// activated. Only the requester may withdraw their own request.
+func CanCancel(req GrantRequest, c Caller) bool {
+	return c.Login != "" && c.Login == req.Requester
+}
+
+// CanExtend reports whether the caller may extend the grant under the grant
+// type's extend policy. Admins may extend unless extension is disabled.
+func CanExtend(gt GrantType, req GrantRequest, c Caller) bool {
+	if c.Login == "" {
+		return false
+	}
+	policy := gt.ExtendPolicy
+	if policy == "" {
+		policy = ExtendRequesterOrApprover
+	}
+	if policy == ExtendNone {
+		return false
+	}
+	if c.Admin {
+		return true
+	}
+	switch policy {
+	case ExtendRequester:
+		return c.Login == req.Requester
+	case ExtendApprover:
+		return c.Approver
+	default:
+		return c.Login == req.Requester || c.Approver
+	}
+}
+
+// CheckExtension reports why extending the grant to run d from now would
+// break the grant type's extension limits, or nil if it would not. The
+// error is meant to be shown to the caller.
+func CheckExtension(gt GrantType, state GrantState, d time.Duration, now time.Time) error {
+	if maxDur := time.Duration(gt.MaxDuration); maxDur > 0 && d > maxDur {
+		return fmt.Errorf("extension %s exceeds max %s for grant type %q", d, maxDur, gt.Name)
+	}
+	if gt.MaxExtensions > 0 && len(state.Extensions) >= gt.MaxExtensions {
+		return fmt.Errorf("grant type %q allows at most %d extensions", gt.Name, gt.MaxExtensions)
+	}
+	if maxTotal := time.Duration(gt.MaxTotalDuration); maxTotal > 0 {
+		left := state.ActivatedAt.Add(maxTotal).Sub(now)
+		if left < time.Second {
+			return fmt.Errorf("grant has reached the max lifetime of %s for grant type %q", maxTotal, gt.Name)
+		}
+		if d > left {
+			return fmt.Errorf("extension %s would exceed the max lifetime of %s for grant type %q; at most %s remains", d, maxTotal, gt.Name, left.Truncate(time.Second))
+		}
+	}
+	return nil
+}
+
+// RenewalNeedsApproval reports whether renewals of the grant type wait for
+// a new approval before the grant is extended.
+func (gt GrantType) RenewalNeedsApproval() bool {
+	return gt.RiskLevel > RiskLow || gt.ExtensionRequiresApproval
+}
@@ -0,0 +1,289 @@
+package grant
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExtendPolicy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ExtendPolicy
+		wantErr bool
+	}{
+		{"", ExtendRequesterOrApprover, false},
+		{"requester", ExtendRequester, false},
+		{"Approver", ExtendApprover, false},
+		{"none", ExtendNone, false},
+		{"requester_or_approver", ExtendRequesterOrApprover, false},
+		{"anyone", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseExtendPolicy(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExtendPolicy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseExtendPolicy(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeDirectory resolves group principals from a static membership map.
+type fakeDirectory struct {
+	members map[string][]string
+	err     error
+}
+
+func (d *fakeDirectory) IsMember(_ context.Context, login string, principals []string) (bool, error) {
+	if d.err != nil {
+		return false, d.err
+	}
+	for _, p := range principals {
+		if p == login || slices.Contains(d.members[p], login) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func mustResolve(t *testing.T, dir Directory, gt GrantType, login string) Caller {
+	t.Helper()
+	c, err := ResolveCaller(context.Background(), dir, gt, login)
+	if err != nil {
+		t.Fatalf("ResolveCaller(%q) error = %v", login, err)
+	}
+	return c
+}
+
+func TestAuthorization(t *testing.T) {
+	gt := GrantType{
+		Name:      "admin-access",
+		Approvers: []string{"approver@example.com"},
+		Admins:    []string{"root@example.com"},
+	}
+	req := GrantRequest{Requester: "user@example.com"}
+
+	tests := []struct {
+		name  string
+		check func(c Caller) bool
+		login string
+		want  bool
+	}{
+		{"approve by approver", func(c Caller) bool { return CanApprove(req, c) }, "approver@example.com", true},
+		{"approve by requester", func(c Caller) bool { return CanApprove(GrantRequest{Requester: "approver@example.com"}, c) }, "approver@example.com", false},
+		{"approve by admin", func(c Caller) bool { return CanApprove(req, c) }, "root@example.com", false},
+		{"deny by approver", CanDeny, "approver@example.com", true},
+		{"deny by requester", CanDeny, "user@example.com", false},
+		{"deny by stranger", CanDeny, "other@example.com", false},
+		{"revoke by requester", func(c Caller) bool { return CanRevoke(req, c) }, "user@example.com", true},
+		{"revoke by approver", func(c Caller) bool { return CanRevoke(req, c) }, "approver@example.com", true},
+		{"revoke by admin", func(c Caller) bool { return CanRevoke(req, c) }, "root@example.com", true},
+		{"revoke by stranger", func(c Caller) bool { return CanRevoke(req, c) }, "other@example.com", false},
+		{"revoke by empty login", func(c Caller) bool { return CanRevoke(GrantRequest{}, c) }, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.check(mustResolve(t, nil, gt, tt.login)); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveCaller_Groups(t *testing.T) {
+	gt := GrantType{
+		Name:      "admin-access",
+		Approvers: []string{"group:secops", "lead@example.com"},
+		Admins:    []string{"autogroup:admin"},
+	}
+	dir := &fakeDirectory{members: map[string][]string{
+		"group:secops":    {"alice@example.com"},
+		"autogroup:admin": {"root@example.com"},
+	}}
+
+	tests := []struct {
+		login    string
+		approver bool
+		admin    bool
+	}{
+		{"alice@example.com", true, false},
+		{"lead@example.com", true, false},
+		{"root@example.com", false, true},
+		{"other@example.com", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.login, func(t *testing.T) {
+			c := mustResolve(t, dir, gt, tt.login)
+			if c.Approver != tt.approver || c.Admin != tt.admin {
+				t.Errorf("ResolveCaller(%q) = %+v, want approver=%v admin=%v", tt.login, c, tt.approver, tt.admin)
+			}
+		})
+	}
+
+	if _, err := ResolveCaller(context.Background(), nil, gt, "alice@example.com"); err == nil {
+		t.Error("expected error resolving groups without a directory")
+	}
+	if _, err := ResolveCaller(context.Background(), &fakeDirectory{err: errors.New("api down")}, gt, "alice@example.com"); err == nil {
+		t.Error("expected directory error to propagate")
+	}
+}
+
+func TestCanExtend(t *testing.T) {
+	req := GrantRequest{Requester: "user@example.com"}
+	base := GrantType{
+		Approvers: []string{"approver@example.com"},
+		Admins:    []string{"root@example.com"},
+	}
+
+	tests := []struct {
+		policy ExtendPolicy
+		login  string
+		want   bool
+	}{
+		{"", "user@example.com", true},
+		{"", "approver@example.com", true},
+		{"", "other@example.com", false},
+		{ExtendRequester, "user@example.com", true},
+		{ExtendRequester, "approver@example.com", false},
+		{ExtendApprover, "user@example.com", false},
+		{ExtendApprover, "approver@example.com", true},
+		{ExtendApprover, "root@example.com", true},
+		{ExtendNone, "user@example.com", false},
+		{ExtendNone, "root@example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy)+"/"+tt.login, func(t *testing.T) {
+			gt := base
+			gt.ExtendPolicy = tt.policy
+			if got := CanExtend(gt, req, mustResolve(t, nil, gt, tt.login)); got != tt.want {
+				t.Errorf("CanExtend(%q, %q) = %v, want %v", tt.policy, tt.login, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckExtension(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	gt := GrantType{
+		Name:             "ssh",
+		MaxDuration:      JSONDuration(time.Hour),
+		MaxTotalDuration: JSONDuration(3 * time.Hour),
+		MaxExtensions:    2,
+	}
+	state := GrantState{ActivatedAt: start}
+	once := GrantState{ActivatedAt: start, Extensions: []Extension{{By: "user@example.com"}}}
+	twice := GrantState{ActivatedAt: start, Extensions: make([]Extension, 2)}
+
+	tests := []struct {
+		name    string
+		state   GrantState
+		d       time.Duration
+		now     time.Time
+		wantErr string
+	}{
+		{"within limits", state, time.Hour, start.Add(30 * time.Minute), ""},
+		{"over maxDuration", state, 2 * time.Hour, start, "exceeds max 1h0m0s"},
+		{"extensions used up", twice, time.Minute, start, "allows at most 2 extensions"},
+		{"over lifetime", once, time.Hour, start.Add(150 * time.Minute), "at most 30m0s remains"},
+		{"lifetime reached", once, time.Minute, start.Add(3 * time.Hour), "reached the max lifetime of 3h0m0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckExtension(gt, tt.state, tt.d, tt.now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := CheckExtension(GrantType{Name: "ssh"}, twice, 5*time.Hour, start.Add(10*time.Hour)); err != nil {
+		t.Errorf("no limits: unexpected error: %v", err)
+	}
+}
+
+func TestCanRequest(t *testing.T) {
+	dir := &fakeDirectory{members: map[string][]string{
+		"group:sre":       {"sre@example.com"},
+		"autogroup:admin": {"root@example.com"},
+	}}
+
+	tests := []struct {
+		name     string
+		eligible []string
+		dir      Directory
+		login    string
+		want     bool
+		wantErr  bool
+	}{
+		{"open to everyone", nil, nil, "user@example.com", true, false},
+		{"empty login", nil, nil, "", false, false},
+		{"listed login", []string{"user@example.com"}, nil, "user@example.com", true, false},
+		{"unlisted login", []string{"user@example.com"}, nil, "other@example.com", false, false},
+		{"group member", []string{"group:sre", "autogroup:admin"}, dir, "sre@example.com", true, false},
+		{"role member", []string{"group:sre", "autogroup:admin"}, dir, "root@example.com", true, false},
+		{"not a member", []string{"group:sre", "autogroup:admin"}, dir, "user@example.com", false, false},
+		{"groups without directory", []string{"group:sre"}, nil, "sre@example.com", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gt := GrantType{Name: "ssh-access", EligibleRequesters: tt.eligible}
+			got, err := CanRequest(context.Background(), tt.dir, gt, tt.login)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CanRequest error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CanRequest(%q) = %v, want %v", tt.login, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	dir := &fakeDirectory{members: map[string][]string{
+		"group:secops": {"secops@example.com"},
+	}}
+
+	tests := []struct {
+		name    string
+		admins  []string
+		dir     Directory
+		login   string
+		want    bool
+		wantErr bool
+	}{
+		{"no admins", nil, nil, "user@example.com", false, false},
+		{"empty login", []string{"user@example.com"}, nil, "", false, false},
+		{"listed login", []string{"user@example.com"}, nil, "user@example.com", true, false},
+		{"unlisted login", []string{"user@example.com"}, nil, "other@example.com", false, false},
+		{"group member", []string{"group:secops"}, dir, "secops@example.com", true, false},
+		{"not a member", []string{"group:secops"}, dir, "user@example.com", false, false},
+		{"groups without directory", []string{"group:secops"}, nil, "secops@example.com", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IsAdmin(context.Background(), tt.dir, tt.admins, tt.login)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IsAdmin error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("IsAdmin(%q) = %v, want %v", tt.login, got, tt.want)
+			}
+		})
+	}
+}
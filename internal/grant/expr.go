@@ -0,0 +1,589 @@
+package grant
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// This file implements the small expression language used by grant type
+// policy rules. Expressions are boolean conditions over a fixed set of
+// variables, for example:
+//
+//	"tag:oncall" in requester.tags && time.hour >= 9 && time.hour < 17
+//	request.duration > 4h || target.os == "windows"
+//
+// Evaluation is a pure function of the parsed expression and its variables,
+// so the same rule gives the same answer in an HTTP handler and on workflow
+// replay.
+
+// Expr is a parsed policy expression.
+type Expr struct {
+	src  string
+	root node
+}
+
+// ParseExpr parses a policy expression.
+func ParseExpr(src string) (*Expr, error) {
+	p := &parser{lex: lexer{src: src}}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+func (e *Expr) String() string { return e.src }
+
+// Eval evaluates the expression against vars, which maps dotted variable
+// names to string, float64, bool, time.Duration or []string values. The
+// result must be a boolean.
+func (e *Expr) Eval(vars map[string]any) (bool, error) {
+	v, err := e.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q is %s, not bool", e.src, typeName(v))
+	}
+	return b, nil
+}
+
+// Lexer
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokDuration
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case c == '"' || c == '\'':
+		l.pos++
+		var sb strings.Builder
+		for l.pos < len(l.src) && l.src[l.pos] != c {
+			if l.src[l.pos] == '\\' && l.pos+1 < len(l.src) {
+				l.pos++
+			}
+			sb.WriteByte(l.src[l.pos])
+			l.pos++
+		}
+		if l.pos >= len(l.src) {
+			return token{}, fmt.Errorf("unterminated string at offset %d", start)
+		}
+		l.pos++
+		return token{kind: tokString, text: sb.String(), pos: start}, nil
+
+	case c >= '0' && c <= '9':
+		for l.pos < len(l.src) && (isNum(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		// A number followed by unit letters is a duration, e.g. 90m or 1h30m.
+		if l.pos < len(l.src) && isAlpha(l.src[l.pos]) {
+			for l.pos < len(l.src) && (isAlpha(l.src[l.pos]) || isNum(l.src[l.pos]) || l.src[l.pos] == '.') {
+				l.pos++
+			}
+			return token{kind: tokDuration, text: l.src[start:l.pos], pos: start}, nil
+		}
+		return token{kind: tokNumber, text: l.src[start:l.pos], pos: start}, nil
+
+	case isAlpha(c) || c == '_':
+		for l.pos < len(l.src) && (isAlpha(l.src[l.pos]) || isNum(l.src[l.pos]) || l.src[l.pos] == '_' || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}, nil
+	}
+
+	l.pos++
+	switch c {
+	case '(':
+		return token{kind: tokLParen, text: "(", pos: start}, nil
+	case ')':
+		return token{kind: tokRParen, text: ")", pos: start}, nil
+	case '[':
+		return token{kind: tokLBracket, text: "[", pos: start}, nil
+	case ']':
+		return token{kind: tokRBracket, text: "]", pos: start}, nil
+	case ',':
+		return token{kind: tokComma, text: ",", pos: start}, nil
+	}
+	for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!"} {
+		if strings.HasPrefix(l.src[start:], op) {
+			l.pos = start + len(op)
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	return token{}, fmt.Errorf("unexpected character %q at offset %d", c, start)
+}
+
+// Parser
+
+type parser struct {
+	lex lexer
+	tok token
+	err error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("offset %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) isOp(op string) bool {
+	return p.err == nil && (p.tok.kind == tokOp || p.tok.kind == tokIdent) && p.tok.text == op
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.isOp("||") {
+		p.next()
+		var right node
+		if right, err = p.parseAnd(); err == nil {
+			left = logicalNode{op: "||", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.isOp("&&") {
+		p.next()
+		var right node
+		if right, err = p.parseUnary(); err == nil {
+			left = logicalNode{op: "&&", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOp("!") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.isOp(op) {
+			p.next()
+			right, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			return compareNode{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch tok.kind {
+	case tokString:
+		p.next()
+		return literalNode{value: tok.text}, p.err
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		p.next()
+		return literalNode{value: n}, p.err
+	case tokDuration:
+		d, err := time.ParseDuration(tok.text)
+		if err != nil {
+			return nil, p.errorf("invalid duration %q", tok.text)
+		}
+		p.next()
+		return literalNode{value: d}, p.err
+	case tokLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ) but found %s", p.tok)
+		}
+		p.next()
+		return inner, p.err
+	case tokLBracket:
+		p.next()
+		var items []node
+		for p.err == nil && p.tok.kind != tokRBracket {
+			item, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if p.tok.kind == tokComma {
+				p.next()
+			} else if p.tok.kind != tokRBracket {
+				return nil, p.errorf("expected , or ] but found %s", p.tok)
+			}
+		}
+		p.next()
+		return listNode{items: items}, p.err
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return literalNode{value: true}, p.err
+		case "false":
+			return literalNode{value: false}, p.err
+		}
+		if p.tok.kind != tokLParen {
+			return varNode{name: tok.text}, p.err
+		}
+		fn, ok := exprFuncs[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("offset %d: unknown function %q", tok.pos, tok.text)
+		}
+		p.next()
+		var args []node
+		for p.err == nil && p.tok.kind != tokRParen {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.tok.kind == tokComma {
+				p.next()
+			} else if p.tok.kind != tokRParen {
+				return nil, p.errorf("expected , or ) but found %s", p.tok)
+			}
+		}
+		p.next()
+		if len(args) != fn.arity {
+			return nil, fmt.Errorf("offset %d: %s takes %d arguments, got %d", tok.pos, tok.text, fn.arity, len(args))
+		}
+		return callNode{name: tok.text, fn: fn.call, args: args}, p.err
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+// AST
+
+type node interface {
+	eval(vars map[string]any) (any, error)
+}
+
+type literalNode struct{ value any }
+
+func (n literalNode) eval(map[string]any) (any, error) { return n.value, nil }
+
+type varNode struct{ name string }
+
+func (n varNode) eval(vars map[string]any) (any, error) {
+	v, ok := vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %q", n.name)
+	}
+	return v, nil
+}
+
+type listNode struct{ items []node }
+
+func (n listNode) eval(vars map[string]any) (any, error) {
+	out := make([]string, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("list items must be strings, got %s", typeName(v))
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+type notNode struct{ operand node }
+
+func (n notNode) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("! needs bool, got %s", typeName(v))
+	}
+	return !b, nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+func (n logicalNode) eval(vars map[string]any) (any, error) {
+	lv, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := lv.(bool)
+	if !ok {
+		return nil, fmt.Errorf("%s needs bool operands, got %s", n.op, typeName(lv))
+	}
+	// Both sides are always evaluated so type errors surface regardless of
+	// the inputs a rule happens to be tested with.
+	rv, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := rv.(bool)
+	if !ok {
+		return nil, fmt.Errorf("%s needs bool operands, got %s", n.op, typeName(rv))
+	}
+	if n.op == "&&" {
+		return l && r, nil
+	}
+	return l || r, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n compareNode) eval(vars map[string]any) (any, error) {
+	lv, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "in" {
+		s, ok := lv.(string)
+		list, lok := rv.([]string)
+		if !ok || !lok {
+			return nil, fmt.Errorf("in needs string and list, got %s and %s", typeName(lv), typeName(rv))
+		}
+		for _, item := range list {
+			if item == s {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	var c int
+	switch l := lv.(type) {
+	case string:
+		r, ok := rv.(string)
+		if !ok {
+			return nil, mismatch(n.op, lv, rv)
+		}
+		c = strings.Compare(l, r)
+	case float64:
+		r, ok := rv.(float64)
+		if !ok {
+			return nil, mismatch(n.op, lv, rv)
+		}
+		c = cmpOrdered(l, r)
+	case time.Duration:
+		r, ok := rv.(time.Duration)
+		if !ok {
+			return nil, mismatch(n.op, lv, rv)
+		}
+		c = cmpOrdered(l, r)
+	case bool:
+		r, ok := rv.(bool)
+		if !ok || (n.op != "==" && n.op != "!=") {
+			return nil, mismatch(n.op, lv, rv)
+		}
+		if l != r {
+			c = 1
+		}
+	default:
+		return nil, mismatch(n.op, lv, rv)
+	}
+
+	switch n.op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func cmpOrdered[T float64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func mismatch(op string, l, r any) error {
+	return fmt.Errorf("cannot compare %s %s %s", typeName(l), op, typeName(r))
+}
+
+type callNode struct {
+	name string
+	fn   func(args []any) (any, error)
+	args []node
+}
+
+func (n callNode) eval(vars map[string]any) (any, error) {
+	args := make([]any, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return v, nil
+}
+
+type exprFunc struct {
+	arity int
+	call  func(args []any) (any, error)
+}
+
+// exprFuncs are the built-in functions. startsWith and endsWith also accept
+// a list as their first argument, matching if any element matches, so
+// startsWith(target.tags, "tag:prod") works as expected.
+var exprFuncs = map[string]exprFunc{
+	"startsWith": {2, stringPredicate(strings.HasPrefix)},
+	"endsWith":   {2, stringPredicate(strings.HasSuffix)},
+	"contains":   {2, stringPredicate(strings.Contains)},
+	"matches": {2, func(args []any) (any, error) {
+		s, ok1 := args[0].(string)
+		pattern, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("needs two strings")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(s), nil
+	}},
+}
+
+func stringPredicate(pred func(s, arg string) bool) func(args []any) (any, error) {
+	return func(args []any) (any, error) {
+		arg, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("second argument must be a string, got %s", typeName(args[1]))
+		}
+		switch v := args[0].(type) {
+		case string:
+			return pred(v, arg), nil
+		case []string:
+			for _, s := range v {
+				if pred(s, arg) {
+					return true, nil
+				}
+			}
+			return false, nil
+		default:
+			return nil, fmt.Errorf("first argument must be a string or list, got %s", typeName(args[0]))
+		}
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case time.Duration:
+		return "duration"
+	case []string:
+		return "list"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
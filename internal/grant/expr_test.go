@@ -0,0 +1,99 @@
+package grant
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExprEval(t *testing.T) {
+	vars := map[string]any{
+		"requester.login":  "alice@example.com",
+		"requester.tags":   []string{"tag:oncall", "tag:laptop"},
+		"target.os":        "linux",
+		"target.tags":      []string{"tag:prod-db"},
+		"request.duration": 90 * time.Minute,
+		"time.hour":        float64(14),
+		"time.weekday":     "Saturday",
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`requester.login == "alice@example.com"`, true},
+		{`requester.login != 'alice@example.com'`, false},
+		{`"tag:oncall" in requester.tags`, true},
+		{`"tag:admin" in requester.tags`, false},
+		{`target.os in ["linux", "macOS"]`, true},
+		{`request.duration > 1h`, true},
+		{`request.duration <= 1h30m`, true},
+		{`time.hour >= 9 && time.hour < 17`, true},
+		{`time.weekday == "Saturday" || time.weekday == "Sunday"`, true},
+		{`!(time.hour >= 9 && time.hour < 17)`, false},
+		{`startsWith(target.tags, "tag:prod")`, true},
+		{`endsWith(requester.login, "@example.com")`, true},
+		{`contains(requester.login, "bob")`, false},
+		{`matches(requester.login, "^[a-z]+@example\\.com$")`, true},
+		{`true && !false`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseExpr(%q) error = %v", tt.expr, err)
+			}
+			got, err := expr.Eval(vars)
+			if err != nil {
+				t.Fatalf("Eval(%q) error = %v", tt.expr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	vars := map[string]any{
+		"request.duration": time.Hour,
+		"time.hour":        float64(9),
+	}
+
+	parseErrors := []string{
+		``,
+		`time.hour >=`,
+		`(time.hour > 1`,
+		`"unterminated`,
+		`time.hour # 1`,
+		`unknown(time.hour)`,
+		`startsWith("a")`,
+		`time.hour > 1 time.hour`,
+	}
+	for _, src := range parseErrors {
+		t.Run("parse/"+src, func(t *testing.T) {
+			if _, err := ParseExpr(src); err == nil {
+				t.Errorf("ParseExpr(%q) succeeded, want error", src)
+			}
+		})
+	}
+
+	evalErrors := []string{
+		`nope == 1`,
+		`request.duration > 1`,
+		`time.hour`,
+		`time.hour && true`,
+		`"a" in "abc"`,
+	}
+	for _, src := range evalErrors {
+		t.Run("eval/"+src, func(t *testing.T) {
+			expr, err := ParseExpr(src)
+			if err != nil {
+				t.Fatalf("ParseExpr(%q) error = %v", src, err)
+			}
+			if _, err := expr.Eval(vars); err == nil {
+				t.Errorf("Eval(%q) succeeded, want error", src)
+			}
+		})
+	}
+}
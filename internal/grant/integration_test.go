@@ -18,6 +18,7 @@ func setupIntegrationTestEnv() *testsuite.TestWorkflowEnvironment {
 	env.RegisterActivity(activities.SetDeviceTags)
 	env.RegisterWorkflow(ApprovalWorkflow)
 	env.RegisterWorkflow(DeviceTagManagerWorkflow)
+	registerNotifications(env)
 
 	// Allow the remove-grant signal to the DeviceTagManager.
 	env.OnSignalExternalWorkflow(mock.Anything, mock.Anything, mock.Anything, "remove-grant", mock.Anything).Return(nil)
@@ -77,7 +78,7 @@ func TestIntegration_FullGrantLifecycle_WithApproval(t *testing.T) {
 		Approved:   true,
 		ApprovedBy: "admin@example.com",
 	}
-	env.OnWorkflow("ApprovalWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(approvalResult, nil)
+	env.OnWorkflow("ApprovalWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(approvalResult, nil)
 
 	grantType := GrantType{
 		Name:        "root-access",
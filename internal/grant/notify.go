@@ -0,0 +1,103 @@
+package grant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/notify"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// notificationRetry backs off from seconds to minutes and gives up on a
+// channel after a day. Permanent failures, such as a 4xx from a webhook,
+// are not retried.
+var notificationRetry = workflow.ActivityOptions{
+	StartToCloseTimeout:    30 * time.Second,
+	ScheduleToCloseTimeout: 24 * time.Hour,
+	RetryPolicy: &temporal.RetryPolicy{
+		InitialInterval:    5 * time.Second,
+		BackoffCoefficient: 2,
+		MaximumInterval:    10 * time.Minute,
+	},
+}
+
+// NotificationWorkflow delivers one notification to every channel
+// subscribed to its event. Each channel is retried on its own, so a slow
+// or failing endpoint does not hold up the others.
+func NotificationWorkflow(ctx workflow.Context, n notify.Notification) error {
+	logger := workflow.GetLogger(ctx)
+
+	var activities *Activities
+	var channels []string
+	listCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: 10 * time.Second,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 5,
+		},
+	})
+	if err := workflow.ExecuteActivity(listCtx, activities.NotificationChannels, n.Event).Get(ctx, &channels); err != nil {
+		return fmt.Errorf("list notification channels: %w", err)
+	}
+
+	sendCtx := workflow.WithActivityOptions(ctx, notificationRetry)
+	futures := make([]workflow.Future, len(channels))
+	for i, ch := range channels {
+		futures[i] = workflow.ExecuteActivity(sendCtx, activities.DeliverNotification, ch, n)
+	}
+	var errs []error
+	for i, f := range futures {
+		if err := f.Get(ctx, nil); err != nil {
+			logger.Error("Failed to deliver notification", "event", n.Event, "grantID", n.GrantID, "channel", channels[i], "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", channels[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotificationChannels lists the channels subscribed to an event.
+func (a *Activities) NotificationChannels(ctx context.Context, event notify.EventType) ([]string, error) {
+	if a.Notifier == nil {
+		return nil, nil
+	}
+	return a.Notifier.Channels(event), nil
+}
+
+// DeliverNotification sends a notification to one channel. Channels
+// removed from the config since the notification was emitted are skipped.
+func (a *Activities) DeliverNotification(ctx context.Context, channel string, n notify.Notification) error {
+	logger := activity.GetLogger(ctx)
+	if a.Notifier == nil {
+		return nil
+	}
+	info := activity.GetInfo(ctx)
+	deliveryID := fmt.Sprintf("%s/%s", info.WorkflowExecution.ID, info.ActivityID)
+	err := a.Notifier.Deliver(ctx, channel, deliveryID, n)
+	var permanent *notify.PermanentError
+	switch {
+	case errors.Is(err, notify.ErrUnknownChannel):
+		logger.Warn("Notification channel no longer configured, skipping", "channel", channel)
+		return nil
+	case errors.As(err, &permanent):
+		return temporal.NewNonRetryableApplicationError(err.Error(), "PermanentError", err)
+	}
+	return err
+}
+
+// sendNotification starts a NotificationWorkflow for n, stamped with the
+// workflow's clock. Only the child's start is awaited: delivery retries run
+// on their own and outlive the grant if they need to.
+func sendNotification(ctx workflow.Context, n notify.Notification) {
+	n.Time = workflow.Now(ctx)
+	childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
+		ParentClosePolicy: enumspb.PARENT_CLOSE_POLICY_ABANDON,
+	})
+	f := workflow.ExecuteChildWorkflow(childCtx, NotificationWorkflow, n)
+	if err := f.GetChildWorkflowExecution().Get(ctx, nil); err != nil {
+		workflow.GetLogger(ctx).Error("Failed to start notification", "event", n.Event, "grantID", n.GrantID, "error", err)
+	}
+}
@@ -0,0 +1,250 @@
+package grant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+	"github.com/rajsinghtech/tailgrant/internal/notify"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+// registerNotifications registers NotificationWorkflow and the Slack
+// approval activities with nothing configured, so workflows under test can
+// notify.
+func registerNotifications(env *testsuite.TestWorkflowEnvironment) {
+	activities := &Activities{}
+	env.RegisterWorkflow(NotificationWorkflow)
+	env.RegisterActivity(activities.NotificationChannels)
+	env.RegisterActivity(activities.DeliverNotification)
+	env.RegisterActivity(activities.PostApprovalMessage)
+	env.RegisterActivity(activities.UpdateApprovalMessage)
+}
+
+// captureNotifications records every notification the workflow under test
+// starts.
+func captureNotifications(env *testsuite.TestWorkflowEnvironment) *[]notify.Notification {
+	var sent []notify.Notification
+	env.OnWorkflow(NotificationWorkflow, mock.Anything, mock.Anything).Return(func(ctx workflow.Context, n notify.Notification) error {
+		sent = append(sent, n)
+		return nil
+	})
+	return &sent
+}
+
+func notificationEvents(sent []notify.Notification) []notify.EventType {
+	var events []notify.EventType
+	for _, n := range sent {
+		events = append(events, n.Event)
+	}
+	return events
+}
+
+func TestGrantWorkflow_Notifications(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	sent := captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-notify",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:          "high-risk-access",
+		Tags:          []string{"tag:jit-admin"},
+		RiskLevel:     RiskHigh,
+		Approvers:     []string{"approver@example.com"},
+		ExpiryWarning: JSONDuration(10 * time.Minute),
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflowByID("approval-grant-notify", "approve", ApproveSignal{ApprovedBy: "approver@example.com"})
+	}, time.Minute)
+
+	start := env.Now()
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.Equal(t, []notify.EventType{
+		notify.EventPendingApproval, notify.EventApproved, notify.EventActivated, notify.EventExpiringSoon, notify.EventExpired,
+	}, notificationEvents(*sent))
+
+	for _, n := range *sent {
+		require.Equal(t, "grant-notify", n.GrantID)
+		require.Equal(t, "high-risk-access", n.GrantType)
+		require.Equal(t, "user@example.com", n.Requester)
+	}
+	pending, approved, activated, warning := (*sent)[0], (*sent)[1], (*sent)[2], (*sent)[3]
+	require.Equal(t, []string{"approver@example.com"}, pending.Approvers)
+	require.True(t, pending.StageDeadline.Equal(start.Add(24*time.Hour)))
+	require.Equal(t, "approver@example.com", approved.Actor)
+	require.Equal(t, []string{"node-456"}, activated.Targets)
+	require.True(t, activated.ExpiresAt.Equal(start.Add(31*time.Minute)))
+	require.True(t, warning.Time.Equal(start.Add(21*time.Minute)))
+}
+
+func TestGrantWorkflow_ExpiryWarningRearmedOnExtend(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	sent := captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-extend-warn",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:          "ssh",
+		Tags:          []string{"tag:ssh"},
+		RiskLevel:     RiskLow,
+		ExpiryWarning: JSONDuration(10 * time.Minute),
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("extend", ExtendSignal{ExtendedBy: "user@example.com", Duration: time.Hour})
+	}, 15*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("revoke", RevokeSignal{RevokedBy: "user@example.com", Reason: "done"})
+	}, 70*time.Minute)
+
+	start := env.Now()
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.Equal(t, []notify.EventType{
+		notify.EventActivated, notify.EventExpiringSoon, notify.EventRevoked,
+	}, notificationEvents(*sent))
+	// The warning for the original expiry is cancelled by the extension.
+	require.True(t, (*sent)[1].Time.Equal(start.Add(65*time.Minute)))
+	require.Equal(t, "user@example.com", (*sent)[2].Actor)
+	require.Equal(t, "done", (*sent)[2].Reason)
+}
+
+func TestApprovalWorkflow_NotifiesEachStage(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+	sent := captureNotifications(env)
+
+	grantType := GrantType{
+		Name:      "prod-db",
+		RiskLevel: RiskHigh,
+		ApprovalStages: []ApprovalStage{
+			{Name: "team", Approvers: []string{"lead@example.com"}, Timeout: JSONDuration(time.Hour)},
+			{Name: "oncall", Approvers: []string{"oncall@example.com"}, Timeout: JSONDuration(time.Hour)},
+		},
+	}
+
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-1", grantType, "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.Len(t, *sent, 2)
+	require.Equal(t, "team", (*sent)[0].Stage)
+	require.Equal(t, []string{"lead@example.com"}, (*sent)[0].Approvers)
+	require.Equal(t, "oncall", (*sent)[1].Stage)
+	require.Equal(t, []string{"lead@example.com", "oncall@example.com"}, (*sent)[1].Approvers)
+}
+
+func TestNotificationWorkflow(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+
+	n := notify.Notification{Event: notify.EventRevoked, GrantID: "grant-1"}
+	env.OnActivity("NotificationChannels", mock.Anything, notify.EventRevoked).Return([]string{"webhook:siem", "webhook:chat"}, nil)
+	env.OnActivity("DeliverNotification", mock.Anything, "webhook:siem", n).Return(nil)
+	env.OnActivity("DeliverNotification", mock.Anything, "webhook:chat", n).Return(
+		temporal.NewNonRetryableApplicationError("webhook chat rejected notification: 404 Not Found", "PermanentError", nil))
+
+	env.ExecuteWorkflow(NotificationWorkflow, n)
+
+	require.True(t, env.IsWorkflowCompleted())
+	err := env.GetWorkflowError()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "webhook:chat")
+	require.NotContains(t, err.Error(), "webhook:siem")
+	env.AssertExpectations(t)
+}
+
+func TestActivities_DeliverNotification(t *testing.T) {
+	const secret = "whsec-test"
+	var (
+		gotBody   []byte
+		gotHeader http.Header
+		status    = http.StatusNoContent
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotHeader = r.Header.Clone()
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	notifier, err := notify.New(config.NotificationsConfig{
+		BaseURL: "https://tailgrant.example.ts.net/",
+		Webhooks: []config.NotificationWebhookConfig{
+			{Name: "siem", URL: srv.URL, Secret: secret},
+		},
+	})
+	require.NoError(t, err)
+
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestActivityEnvironment()
+	a := &Activities{Notifier: notifier}
+	env.RegisterActivity(a.DeliverNotification)
+
+	n := notify.Notification{Event: notify.EventApproved, GrantID: "grant 1", Requester: "user@example.com"}
+	_, err = env.ExecuteActivity(a.DeliverNotification, "webhook:siem", n)
+	require.NoError(t, err)
+
+	var payload notify.Notification
+	require.NoError(t, json.Unmarshal(gotBody, &payload))
+	require.Equal(t, notify.EventApproved, payload.Event)
+	require.Equal(t, "https://tailgrant.example.ts.net/#grant=grant+1", payload.URL)
+	require.Equal(t, "approved", gotHeader.Get(notify.EventHeader))
+	require.NotEmpty(t, gotHeader.Get(notify.DeliveryHeader))
+	sig := gotHeader.Get(notify.SignatureHeader)
+	require.NotEmpty(t, sig)
+
+	// The signature covers the timestamp it carries and the exact body.
+	var ts int64
+	_, err = fmt.Sscanf(sig, "t=%d,", &ts)
+	require.NoError(t, err)
+	require.Equal(t, notify.Sign(secret, gotBody, time.Unix(ts, 0)), sig)
+
+	t.Run("rejected", func(t *testing.T) {
+		status = http.StatusGone
+		_, err := env.ExecuteActivity(a.DeliverNotification, "webhook:siem", n)
+		var appErr *temporal.ApplicationError
+		require.True(t, errors.As(err, &appErr), "error = %v", err)
+		require.True(t, appErr.NonRetryable())
+	})
+
+	t.Run("server error is retried", func(t *testing.T) {
+		status = http.StatusBadGateway
+		_, err := env.ExecuteActivity(a.DeliverNotification, "webhook:siem", n)
+		var appErr *temporal.ApplicationError
+		require.True(t, errors.As(err, &appErr), "error = %v", err)
+		require.False(t, appErr.NonRetryable())
+	})
+
+	t.Run("removed channel", func(t *testing.T) {
+		_, err := env.ExecuteActivity(a.DeliverNotification, "webhook:old", n)
+		require.NoError(t, err)
+	})
+}
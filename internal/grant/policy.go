@@ -1,11 +1,16 @@
 package grant
 
 import (
+	"context"
 	"fmt"
+	"net/netip"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/rajsinghtech/tailgrant/internal/config"
+	"github.com/rajsinghtech/tailgrant/internal/tsapi"
+	tailscale "tailscale.com/client/tailscale/v2"
 )
 
 type GrantTypeStore interface {
@@ -18,12 +23,20 @@ type YAMLGrantTypeStore struct {
 	order []*GrantType
 }
 
-func NewYAMLGrantTypeStore(configs []config.GrantTypeConfig) (*YAMLGrantTypeStore, error) {
+// NewYAMLGrantTypeStore builds grant types from config. admins is the global
+// admin set attached to every grant type for authorization checks.
+func NewYAMLGrantTypeStore(configs []config.GrantTypeConfig, admins []string) (*YAMLGrantTypeStore, error) {
 	store := &YAMLGrantTypeStore{
 		types: make(map[string]*GrantType, len(configs)),
 		order: make([]*GrantType, 0, len(configs)),
 	}
 
+	for _, a := range admins {
+		if err := tsapi.ValidatePrincipal(a); err != nil {
+			return nil, fmt.Errorf("admins: %w", err)
+		}
+	}
+
 	for _, c := range configs {
 		dur, err := time.ParseDuration(c.MaxDuration)
 		if err != nil {
@@ -36,6 +49,9 @@ func NewYAMLGrantTypeStore(configs []config.GrantTypeConfig) (*YAMLGrantTypeStor
 		}
 
 		var userAction *UserAction
+		var routeAction *RouteAction
+		var groupAction *GroupAction
+		var policyGrant *PolicyGrantAction
 		switch action {
 		case ActionTag:
 			if len(c.Tags) == 0 && len(c.PostureAttributes) == 0 {
@@ -64,28 +80,185 @@ func NewYAMLGrantTypeStore(configs []config.GrantTypeConfig) (*YAMLGrantTypeStor
 				return nil, fmt.Errorf("grant type %q: invalid role %q", c.Name, c.UserAction.Role)
 			}
 			userAction = &UserAction{Role: c.UserAction.Role}
-		case ActionUserRestore:
+		case ActionUserRestore, ActionKeyExpiry, ActionDeviceAuthorize:
 			// no extra config needed
+		case ActionRoutes:
+			if c.RouteAction == nil || (len(c.RouteAction.Routes) == 0 && !c.RouteAction.ExitNode) {
+				return nil, fmt.Errorf("grant type %q: routes action requires routeAction.routes or routeAction.exitNode", c.Name)
+			}
+			for _, route := range c.RouteAction.Routes {
+				if p, err := netip.ParsePrefix(route); err != nil || p != p.Masked() {
+					return nil, fmt.Errorf("grant type %q: invalid route %q, want a network prefix like 10.0.0.0/24", c.Name, route)
+				}
+			}
+			routeAction = &RouteAction{Routes: c.RouteAction.Routes, ExitNode: c.RouteAction.ExitNode}
+		case ActionGroupMembership:
+			if c.GroupAction == nil || c.GroupAction.Group == "" {
+				return nil, fmt.Errorf("grant type %q: group_membership action requires groupAction.group", c.Name)
+			}
+			if !strings.HasPrefix(c.GroupAction.Group, "group:") || c.GroupAction.Group == "group:" {
+				return nil, fmt.Errorf("grant type %q: invalid group %q, want group:<name>", c.Name, c.GroupAction.Group)
+			}
+			member := c.GroupAction.Member
+			switch member {
+			case "":
+				member = GroupMemberRequester
+			case GroupMemberRequester, GroupMemberTarget:
+			default:
+				return nil, fmt.Errorf("grant type %q: invalid groupAction.member %q (must be \"requester\" or \"target\")", c.Name, member)
+			}
+			groupAction = &GroupAction{Group: c.GroupAction.Group, Member: member}
+		case ActionPolicyGrant:
+			if c.PolicyGrant == nil || (len(c.PolicyGrant.IP) == 0 && len(c.PolicyGrant.App) == 0) {
+				return nil, fmt.Errorf("grant type %q: policy_grant action requires policyGrant.ip or policyGrant.app", c.Name)
+			}
+			for _, ip := range c.PolicyGrant.IP {
+				if ip == "" || strings.ContainsAny(ip, " \t") {
+					return nil, fmt.Errorf("grant type %q: invalid policyGrant.ip %q", c.Name, ip)
+				}
+			}
+			for name := range c.PolicyGrant.App {
+				if !strings.Contains(name, "/") {
+					return nil, fmt.Errorf("grant type %q: invalid policyGrant.app capability %q, want <domain>/<name>", c.Name, name)
+				}
+			}
+			policyGrant = &PolicyGrantAction{IP: c.PolicyGrant.IP, App: c.PolicyGrant.App}
 		default:
 			return nil, fmt.Errorf("grant type %q: unknown action %q", c.Name, action)
 		}
 
-		if ParseRiskLevel(c.RiskLevel) > RiskLow && len(c.Approvers) == 0 {
+		for _, a := range c.Approvers {
+			if err := tsapi.ValidatePrincipal(a); err != nil {
+				return nil, fmt.Errorf("grant type %q: approvers: %w", c.Name, err)
+			}
+		}
+
+		approvers := c.Approvers
+		var stages []ApprovalStage
+		if c.Approval != nil && len(c.Approval.Stages) > 0 {
+			if len(c.Approvers) > 0 {
+				return nil, fmt.Errorf("grant type %q: set approvers per stage when approval.stages is configured", c.Name)
+			}
+			if ParseRiskLevel(c.RiskLevel) == RiskLow {
+				return nil, fmt.Errorf("grant type %q: approval stages have no effect on low risk grants", c.Name)
+			}
+			stages, err = parseApprovalStages(c.Approval.Stages)
+			if err != nil {
+				return nil, fmt.Errorf("grant type %q: %w", c.Name, err)
+			}
+			approvers = GrantType{ApprovalStages: stages}.ForStage(len(stages) - 1).Approvers
+		}
+
+		if ParseRiskLevel(c.RiskLevel) > RiskLow && len(approvers) == 0 {
 			return nil, fmt.Errorf("grant type %q: medium/high risk requires at least one approver", c.Name)
 		}
 
+		for _, r := range c.EligibleRequesters {
+			if err := tsapi.ValidatePrincipal(r); err != nil {
+				return nil, fmt.Errorf("grant type %q: eligibleRequesters: %w", c.Name, err)
+			}
+		}
+
+		if c.Targets != nil && !action.TargetsDevices() {
+			return nil, fmt.Errorf("grant type %q: targets only apply to actions on devices", c.Name)
+		}
+		targets, err := parseTargetSelector(c.Targets)
+		if err != nil {
+			return nil, fmt.Errorf("grant type %q: %w", c.Name, err)
+		}
+
+		quota, err := parseQuota(c.Quota)
+		if err != nil {
+			return nil, fmt.Errorf("grant type %q: %w", c.Name, err)
+		}
+
+		policy, err := parsePolicyRules(c.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("grant type %q: %w", c.Name, err)
+		}
+		for _, rule := range policy {
+			if rule.Decision == DecisionRequireApproval && len(approvers) == 0 {
+				return nil, fmt.Errorf("grant type %q: require_approval rules need at least one approver", c.Name)
+			}
+		}
+
+		if c.RequiredApprovals < 0 {
+			return nil, fmt.Errorf("grant type %q: requiredApprovals must not be negative", c.Name)
+		}
+		if c.RequiredApprovals > 1 {
+			if ParseRiskLevel(c.RiskLevel) == RiskLow {
+				return nil, fmt.Errorf("grant type %q: requiredApprovals has no effect on low risk grants", c.Name)
+			}
+			// Group sizes are only known at approval time.
+			if !slices.ContainsFunc(approvers, tsapi.IsGroupPrincipal) && c.RequiredApprovals > len(approvers) {
+				return nil, fmt.Errorf("grant type %q: requiredApprovals %d exceeds the %d listed approvers", c.Name, c.RequiredApprovals, len(approvers))
+			}
+		}
+
+		extendPolicy, err := ParseExtendPolicy(c.ExtendPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("grant type %q: %w", c.Name, err)
+		}
+
+		var expiryWarning time.Duration
+		if c.ExpiryWarning != "" {
+			expiryWarning, err = time.ParseDuration(c.ExpiryWarning)
+			if err != nil || expiryWarning <= 0 {
+				return nil, fmt.Errorf("grant type %q: invalid expiryWarning %q", c.Name, c.ExpiryWarning)
+			}
+		}
+
+		var maxTotal time.Duration
+		if c.MaxTotalDuration != "" {
+			maxTotal, err = time.ParseDuration(c.MaxTotalDuration)
+			if err != nil || maxTotal <= 0 {
+				return nil, fmt.Errorf("grant type %q: invalid maxTotalDuration %q", c.Name, c.MaxTotalDuration)
+			}
+			if maxTotal < dur {
+				return nil, fmt.Errorf("grant type %q: maxTotalDuration %s is shorter than maxDuration %s", c.Name, maxTotal, dur)
+			}
+		}
+		if c.MaxExtensions < 0 {
+			return nil, fmt.Errorf("grant type %q: maxExtensions must not be negative", c.Name)
+		}
+		if c.ExtensionRequiresApproval && len(approvers) == 0 {
+			return nil, fmt.Errorf("grant type %q: extensionRequiresApproval needs at least one approver", c.Name)
+		}
+
+		if c.BreakGlass && ParseRiskLevel(c.RiskLevel) != RiskHigh {
+			return nil, fmt.Errorf("grant type %q: breakGlass is only allowed on high risk grant types", c.Name)
+		}
+
 		postureAttrs := convertPostureAttributes(c.PostureAttributes)
 
 		gt := &GrantType{
-			Name:              c.Name,
-			Description:       c.Description,
-			Tags:              c.Tags,
-			PostureAttributes: postureAttrs,
-			MaxDuration:       JSONDuration(dur),
-			RiskLevel:         ParseRiskLevel(c.RiskLevel),
-			Approvers:         c.Approvers,
-			Action:            action,
-			UserAction:        userAction,
+			Name:               c.Name,
+			Description:        c.Description,
+			Tags:               c.Tags,
+			PostureAttributes:  postureAttrs,
+			MaxDuration:        JSONDuration(dur),
+			RiskLevel:          ParseRiskLevel(c.RiskLevel),
+			Approvers:          approvers,
+			RequiredApprovals:  c.RequiredApprovals,
+			Action:             action,
+			UserAction:         userAction,
+			RouteAction:        routeAction,
+			GroupAction:        groupAction,
+			PolicyGrant:        policyGrant,
+			ExtendPolicy:       extendPolicy,
+			Admins:             admins,
+			ApprovalStages:     stages,
+			Policy:             policy,
+			EligibleRequesters: c.EligibleRequesters,
+			Targets:            targets,
+			Quota:              quota,
+			ExpiryWarning:      JSONDuration(expiryWarning),
+
+			MaxTotalDuration:          JSONDuration(maxTotal),
+			MaxExtensions:             c.MaxExtensions,
+			ExtensionRequiresApproval: c.ExtensionRequiresApproval,
+
+			BreakGlass: c.BreakGlass,
 		}
 
 		if _, exists := store.types[gt.Name]; exists {
@@ -99,6 +272,39 @@ func NewYAMLGrantTypeStore(configs []config.GrantTypeConfig) (*YAMLGrantTypeStor
 	return store, nil
 }
 
+// parseApprovalStages validates an escalation chain. Every stage needs at
+// least one approver and a positive timeout.
+func parseApprovalStages(configs []config.ApprovalStageConfig) ([]ApprovalStage, error) {
+	stages := make([]ApprovalStage, len(configs))
+	for i, sc := range configs {
+		label := fmt.Sprintf("approval stage %d", i+1)
+		if sc.Name != "" {
+			label = fmt.Sprintf("approval stage %q", sc.Name)
+		}
+		if len(sc.Approvers) == 0 {
+			return nil, fmt.Errorf("%s: requires at least one approver", label)
+		}
+		for _, a := range sc.Approvers {
+			if err := tsapi.ValidatePrincipal(a); err != nil {
+				return nil, fmt.Errorf("%s: %w", label, err)
+			}
+		}
+		timeout, err := time.ParseDuration(sc.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid timeout %q: %w", label, sc.Timeout, err)
+		}
+		if timeout <= 0 {
+			return nil, fmt.Errorf("%s: timeout must be positive", label)
+		}
+		stages[i] = ApprovalStage{
+			Name:      sc.Name,
+			Approvers: sc.Approvers,
+			Timeout:   JSONDuration(timeout),
+		}
+	}
+	return stages, nil
+}
+
 // validateTag checks that a tag follows Tailscale's format:
 // must start with "tag:", followed by a letter, then alphanumeric or dashes.
 func validateTag(tag string) error {
@@ -172,8 +378,215 @@ func (s *YAMLGrantTypeStore) List() ([]*GrantType, error) {
 	return out, nil
 }
 
-// EvaluatePolicy returns true if the grant type can be auto-approved
-// (i.e., risk level is Low and no explicit approvers are required).
-func EvaluatePolicy(grantType *GrantType, requesterLogin string) (autoApprove bool) {
-	return grantType.RiskLevel == RiskLow
+// Decision is the outcome of evaluating a grant request against policy.
+type Decision string
+
+const (
+	DecisionAllow           Decision = "allow"
+	DecisionDeny            Decision = "deny"
+	DecisionRequireApproval Decision = "require_approval"
+)
+
+// PolicyRule is a condition and the decision it yields when it matches.
+type PolicyRule struct {
+	When     string   `json:"when"`
+	Decision Decision `json:"decision"`
+	Message  string   `json:"message,omitempty"`
+
+	// expr is When compiled by NewYAMLGrantTypeStore. Rules decoded from a
+	// workflow argument do not carry it and compile When on first use.
+	expr *Expr
+}
+
+// condition returns the rule's compiled When expression.
+func (r *PolicyRule) condition() (*Expr, error) {
+	if r.expr == nil {
+		expr, err := ParseExpr(r.When)
+		if err != nil {
+			return nil, err
+		}
+		r.expr = expr
+	}
+	return r.expr, nil
+}
+
+// PolicyInput holds the facts a policy expression can see.
+type PolicyInput struct {
+	RequesterLogin string        `json:"requesterLogin"`
+	RequesterTags  []string      `json:"requesterTags"`
+	TargetName     string        `json:"targetName"`
+	TargetTags     []string      `json:"targetTags"`
+	TargetOS       string        `json:"targetOS"`
+	Duration       time.Duration `json:"duration"`
+	Reason         string        `json:"reason"`
+	Time           time.Time     `json:"time"`
+}
+
+// Vars exposes the input under the variable names used in expressions.
+// The time variables are always in UTC, whatever the worker's time zone.
+func (in PolicyInput) Vars() map[string]any {
+	t := in.Time.UTC()
+	return map[string]any{
+		"requester.login":  in.RequesterLogin,
+		"requester.tags":   nonNil(in.RequesterTags),
+		"target.name":      in.TargetName,
+		"target.tags":      nonNil(in.TargetTags),
+		"target.os":        in.TargetOS,
+		"request.duration": in.Duration,
+		"request.reason":   in.Reason,
+		"time.hour":        float64(t.Hour()),
+		"time.minute":      float64(t.Minute()),
+		"time.weekday":     t.Weekday().String(),
+	}
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// PolicyResult is the decision for a request and the rule that produced it.
+// Rule counts from 1, as in policy error messages; it is 0 when no rule
+// matched and the risk-level default applied.
+type PolicyResult struct {
+	Decision Decision `json:"decision"`
+	Rule     int      `json:"rule,omitempty"`
+	Message  string   `json:"message,omitempty"`
+}
+
+// NewPolicyInputs gathers the policy variables for a request, fetching the
+// requester and target devices when ts is non-nil and the grant type has
+// rules that could use them. There is one input per target device, with a
+// TargetTag resolved to the tagged devices the grant type's target
+// selector allows, so rules on target facts see every device the grant
+// applies to. Requests without target devices get a single input. The
+// caller sets Time.
+func NewPolicyInputs(ctx context.Context, ts *tailscale.Client, grantType *GrantType, req GrantRequest) ([]PolicyInput, error) {
+	in := PolicyInput{
+		RequesterLogin: req.Requester,
+		Duration:       req.Duration,
+		Reason:         req.Reason,
+	}
+	if ts == nil || len(grantType.Policy) == 0 {
+		return []PolicyInput{in}, nil
+	}
+	if req.RequesterNode != "" {
+		dev, err := ts.Devices().Get(ctx, req.RequesterNode)
+		if err != nil {
+			return nil, fmt.Errorf("get requester device %s: %w", req.RequesterNode, err)
+		}
+		in.RequesterTags = dev.Tags
+	}
+
+	var targets []tailscale.Device
+	if req.TargetTag != "" {
+		devices, err := ts.Devices().List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list devices for %s: %w", req.TargetTag, err)
+		}
+		for _, d := range devices {
+			if slices.Contains(d.Tags, req.TargetTag) && grantType.Targets.Check(&d, req.Requester) == nil {
+				targets = append(targets, d)
+			}
+		}
+	}
+	for _, id := range req.NodeIDs() {
+		dev, err := ts.Devices().Get(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("get target device %s: %w", id, err)
+		}
+		targets = append(targets, *dev)
+	}
+	if len(targets) == 0 {
+		return []PolicyInput{in}, nil
+	}
+	inputs := make([]PolicyInput, len(targets))
+	for i := range targets {
+		inputs[i] = in.ForTarget(&targets[i])
+	}
+	return inputs, nil
+}
+
+// ForTarget returns a copy of the input with the target facts of dev.
+func (in PolicyInput) ForTarget(dev *tailscale.Device) PolicyInput {
+	in.TargetName = dev.Name
+	in.TargetTags = dev.Tags
+	in.TargetOS = dev.OS
+	return in
+}
+
+// EvaluatePolicyTargets decides a request with one input per target device
+// and returns the most restrictive decision: the request is denied if any
+// target is denied, and needs approval if any target does.
+func EvaluatePolicyTargets(grantType *GrantType, inputs []PolicyInput) (PolicyResult, error) {
+	var result PolicyResult
+	for i, in := range inputs {
+		r, err := EvaluatePolicy(grantType, in)
+		if err != nil || r.Decision == DecisionDeny {
+			return r, err
+		}
+		if i == 0 || (r.Decision == DecisionRequireApproval && result.Decision != DecisionRequireApproval) {
+			result = r
+		}
+	}
+	if len(inputs) == 0 {
+		return EvaluatePolicy(grantType, PolicyInput{})
+	}
+	return result, nil
+}
+
+// EvaluatePolicy decides a grant request. Rules are checked in order and the
+// first match wins; without a match, low risk grants are allowed and others
+// require approval. A rule that fails to evaluate denies the request.
+func EvaluatePolicy(grantType *GrantType, in PolicyInput) (PolicyResult, error) {
+	vars := in.Vars()
+	for i := range grantType.Policy {
+		rule := &grantType.Policy[i]
+		n := i + 1
+		expr, err := rule.condition()
+		if err != nil {
+			return PolicyResult{Decision: DecisionDeny, Rule: n}, fmt.Errorf("policy rule %d: %w", n, err)
+		}
+		match, err := expr.Eval(vars)
+		if err != nil {
+			return PolicyResult{Decision: DecisionDeny, Rule: n}, fmt.Errorf("policy rule %d: %w", n, err)
+		}
+		if match {
+			return PolicyResult{Decision: rule.Decision, Rule: n, Message: rule.Message}, nil
+		}
+	}
+	if grantType.RiskLevel == RiskLow {
+		return PolicyResult{Decision: DecisionAllow}, nil
+	}
+	return PolicyResult{Decision: DecisionRequireApproval}, nil
+}
+
+// parsePolicyRules compiles policy rules once for every evaluation, and
+// evaluates each expression against empty input, which catches unknown
+// variables and type errors at startup.
+func parsePolicyRules(configs []config.PolicyRuleConfig) ([]PolicyRule, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+	rules := make([]PolicyRule, len(configs))
+	vars := PolicyInput{}.Vars()
+	for i, c := range configs {
+		decision := Decision(strings.ToLower(strings.TrimSpace(c.Decision)))
+		switch decision {
+		case DecisionAllow, DecisionDeny, DecisionRequireApproval:
+		default:
+			return nil, fmt.Errorf("policy rule %d: invalid decision %q (must be allow, deny or require_approval)", i+1, c.Decision)
+		}
+		expr, err := ParseExpr(c.When)
+		if err != nil {
+			return nil, fmt.Errorf("policy rule %d: %w", i+1, err)
+		}
+		if _, err := expr.Eval(vars); err != nil {
+			return nil, fmt.Errorf("policy rule %d: %w", i+1, err)
+		}
+		rules[i] = PolicyRule{When: c.When, Decision: decision, Message: c.Message, expr: expr}
+	}
+	return rules, nil
 }
@@ -1,6 +1,7 @@
 package grant
 
 import (
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -28,7 +29,7 @@ func TestNewYAMLGrantTypeStore(t *testing.T) {
 		},
 	}
 
-	store, err := NewYAMLGrantTypeStore(configs)
+	store, err := NewYAMLGrantTypeStore(configs, nil)
 	if err != nil {
 		t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
 	}
@@ -114,7 +115,7 @@ func TestNewYAMLGrantTypeStore_InvalidDuration(t *testing.T) {
 		},
 	}
 
-	store, err := NewYAMLGrantTypeStore(configs)
+	store, err := NewYAMLGrantTypeStore(configs, nil)
 	if err == nil {
 		t.Fatal("NewYAMLGrantTypeStore succeeded, expected error for invalid duration")
 	}
@@ -129,6 +130,222 @@ func TestNewYAMLGrantTypeStore_InvalidDuration(t *testing.T) {
 	}
 }
 
+func TestNewYAMLGrantTypeStore_ExpiryWarning(t *testing.T) {
+	cfg := config.GrantTypeConfig{
+		Name:          "ssh",
+		Tags:          []string{"tag:ssh"},
+		MaxDuration:   "1h",
+		ExpiryWarning: "10m",
+	}
+	store, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{cfg}, nil)
+	if err != nil {
+		t.Fatalf("NewYAMLGrantTypeStore: %v", err)
+	}
+	gt, _ := store.Get("ssh")
+	if time.Duration(gt.ExpiryWarning) != 10*time.Minute {
+		t.Errorf("ExpiryWarning = %v, want 10m", time.Duration(gt.ExpiryWarning))
+	}
+
+	for _, bad := range []string{"soon", "-5m"} {
+		cfg.ExpiryWarning = bad
+		if _, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{cfg}, nil); err == nil || !strings.Contains(err.Error(), "invalid expiryWarning") {
+			t.Errorf("expiryWarning %q: error = %v, want invalid expiryWarning", bad, err)
+		}
+	}
+}
+
+func TestNewYAMLGrantTypeStore_ExtensionLimits(t *testing.T) {
+	cfg := config.GrantTypeConfig{
+		Name:                      "ssh",
+		Tags:                      []string{"tag:ssh"},
+		MaxDuration:               "1h",
+		Approvers:                 []string{"lead@example.com"},
+		MaxTotalDuration:          "8h",
+		MaxExtensions:             3,
+		ExtensionRequiresApproval: true,
+	}
+	store, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{cfg}, nil)
+	if err != nil {
+		t.Fatalf("NewYAMLGrantTypeStore: %v", err)
+	}
+	gt, _ := store.Get("ssh")
+	if time.Duration(gt.MaxTotalDuration) != 8*time.Hour || gt.MaxExtensions != 3 || !gt.ExtensionRequiresApproval {
+		t.Errorf("extension limits = %v, %d, %v", time.Duration(gt.MaxTotalDuration), gt.MaxExtensions, gt.ExtensionRequiresApproval)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*config.GrantTypeConfig)
+		wantErr string
+	}{
+		{"bad maxTotalDuration", func(c *config.GrantTypeConfig) { c.MaxTotalDuration = "forever" }, "invalid maxTotalDuration"},
+		{"maxTotalDuration under maxDuration", func(c *config.GrantTypeConfig) { c.MaxTotalDuration = "30m" }, "shorter than maxDuration"},
+		{"negative maxExtensions", func(c *config.GrantTypeConfig) { c.MaxExtensions = -1 }, "maxExtensions must not be negative"},
+		{"approval without approvers", func(c *config.GrantTypeConfig) { c.Approvers = nil }, "extensionRequiresApproval needs at least one approver"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bad := cfg
+			tt.modify(&bad)
+			if _, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{bad}, nil); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewYAMLGrantTypeStore_BreakGlass(t *testing.T) {
+	cfg := config.GrantTypeConfig{
+		Name:        "prod-admin",
+		Tags:        []string{"tag:prod-admin"},
+		MaxDuration: "1h",
+		RiskLevel:   "high",
+		Approvers:   []string{"lead@example.com"},
+		BreakGlass:  true,
+	}
+	store, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{cfg}, nil)
+	if err != nil {
+		t.Fatalf("NewYAMLGrantTypeStore: %v", err)
+	}
+	if gt, _ := store.Get("prod-admin"); !gt.BreakGlass {
+		t.Error("breakGlass not set")
+	}
+
+	cfg.RiskLevel = "medium"
+	if _, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{cfg}, nil); err == nil || !strings.Contains(err.Error(), "only allowed on high risk") {
+		t.Errorf("error = %v, want breakGlass rejected on medium risk", err)
+	}
+}
+
+func TestNewYAMLGrantTypeStore_RouteAction(t *testing.T) {
+	cfg := config.GrantTypeConfig{
+		Name:        "lab-vlan",
+		Action:      "routes",
+		MaxDuration: "4h",
+		RouteAction: &config.RouteActionConfig{Routes: []string{"10.20.0.0/24", "fd7a:115c::/64"}, ExitNode: true},
+		Targets:     &config.TargetsConfig{Tags: []string{"tag:lab-router"}},
+	}
+	store, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{cfg}, nil)
+	if err != nil {
+		t.Fatalf("NewYAMLGrantTypeStore: %v", err)
+	}
+	gt, _ := store.Get("lab-vlan")
+	if gt.Action != ActionRoutes || gt.RouteAction == nil {
+		t.Fatalf("action = %q, routeAction = %v", gt.Action, gt.RouteAction)
+	}
+	if got := strings.Join(gt.RouteAction.EnabledRoutes(), ","); got != "10.20.0.0/24,fd7a:115c::/64,0.0.0.0/0,::/0" {
+		t.Errorf("enabled routes = %s", got)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*config.GrantTypeConfig)
+		wantErr string
+	}{
+		{"missing routeAction", func(c *config.GrantTypeConfig) { c.RouteAction = nil }, "requires routeAction"},
+		{"no routes", func(c *config.GrantTypeConfig) { c.RouteAction = &config.RouteActionConfig{} }, "requires routeAction"},
+		{"bad route", func(c *config.GrantTypeConfig) { c.RouteAction = &config.RouteActionConfig{Routes: []string{"lab"}} }, `invalid route "lab"`},
+		{"host bits set", func(c *config.GrantTypeConfig) {
+			c.RouteAction = &config.RouteActionConfig{Routes: []string{"10.20.0.1/24"}}
+		}, "invalid route"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bad := cfg
+			tt.modify(&bad)
+			if _, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{bad}, nil); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewYAMLGrantTypeStore_GroupAction(t *testing.T) {
+	cfg := config.GrantTypeConfig{
+		Name:        "db-admin",
+		Action:      "group_membership",
+		MaxDuration: "2h",
+		GroupAction: &config.GroupActionConfig{Group: "group:db-admins"},
+	}
+	store, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{cfg}, nil)
+	if err != nil {
+		t.Fatalf("NewYAMLGrantTypeStore: %v", err)
+	}
+	gt, _ := store.Get("db-admin")
+	if gt.GroupAction == nil || gt.GroupAction.Group != "group:db-admins" || gt.GroupAction.Member != GroupMemberRequester {
+		t.Fatalf("groupAction = %+v, want group:db-admins for the requester", gt.GroupAction)
+	}
+	if gt.TargetsUser() {
+		t.Error("requester membership should not need a target user")
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*config.GrantTypeConfig)
+		wantErr string
+	}{
+		{"missing groupAction", func(c *config.GrantTypeConfig) { c.GroupAction = nil }, "requires groupAction.group"},
+		{"not a group", func(c *config.GrantTypeConfig) { c.GroupAction = &config.GroupActionConfig{Group: "tag:db"} }, `invalid group "tag:db"`},
+		{"bad member", func(c *config.GrantTypeConfig) {
+			c.GroupAction = &config.GroupActionConfig{Group: "group:db-admins", Member: "approver"}
+		}, `invalid groupAction.member "approver"`},
+		{"targets", func(c *config.GrantTypeConfig) {
+			c.Targets = &config.TargetsConfig{Tags: []string{"tag:db"}}
+		}, "targets only apply to actions on devices"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bad := cfg
+			tt.modify(&bad)
+			if _, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{bad}, nil); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewYAMLGrantTypeStore_PolicyGrant(t *testing.T) {
+	cfg := config.GrantTypeConfig{
+		Name:        "ssh-prod",
+		Action:      "policy_grant",
+		MaxDuration: "1h",
+		PolicyGrant: &config.PolicyGrantConfig{IP: []string{"tcp:22"}},
+	}
+	store, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{cfg}, nil)
+	if err != nil {
+		t.Fatalf("NewYAMLGrantTypeStore: %v", err)
+	}
+	gt, _ := store.Get("ssh-prod")
+	if gt.PolicyGrant == nil || len(gt.PolicyGrant.IP) != 1 || gt.PolicyGrant.IP[0] != "tcp:22" {
+		t.Fatalf("policyGrant = %+v, want ip tcp:22", gt.PolicyGrant)
+	}
+	if !gt.Action.TargetsDevices() {
+		t.Error("policy grants should target devices")
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*config.GrantTypeConfig)
+		wantErr string
+	}{
+		{"missing policyGrant", func(c *config.GrantTypeConfig) { c.PolicyGrant = nil }, "requires policyGrant.ip or policyGrant.app"},
+		{"empty policyGrant", func(c *config.GrantTypeConfig) { c.PolicyGrant = &config.PolicyGrantConfig{} }, "requires policyGrant.ip or policyGrant.app"},
+		{"bad ip", func(c *config.GrantTypeConfig) { c.PolicyGrant = &config.PolicyGrantConfig{IP: []string{"tcp: 22"}} }, `invalid policyGrant.ip "tcp: 22"`},
+		{"bad app", func(c *config.GrantTypeConfig) {
+			c.PolicyGrant = &config.PolicyGrantConfig{App: map[string][]map[string]any{"db": {{}}}}
+		}, `invalid policyGrant.app capability "db"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bad := cfg
+			tt.modify(&bad)
+			if _, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{bad}, nil); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestNewYAMLGrantTypeStore_Duplicate(t *testing.T) {
 	configs := []config.GrantTypeConfig{
 		{
@@ -149,7 +366,7 @@ func TestNewYAMLGrantTypeStore_Duplicate(t *testing.T) {
 		},
 	}
 
-	store, err := NewYAMLGrantTypeStore(configs)
+	store, err := NewYAMLGrantTypeStore(configs, nil)
 	if err == nil {
 		t.Fatal("NewYAMLGrantTypeStore succeeded, expected error for duplicate grant type")
 	}
@@ -176,7 +393,7 @@ func TestYAMLGrantTypeStore_Get_NotFound(t *testing.T) {
 		},
 	}
 
-	store, err := NewYAMLGrantTypeStore(configs)
+	store, err := NewYAMLGrantTypeStore(configs, nil)
 	if err != nil {
 		t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
 	}
@@ -206,9 +423,12 @@ func TestEvaluatePolicy_LowRisk(t *testing.T) {
 		Approvers:   []string{},
 	}
 
-	autoApprove := EvaluatePolicy(grantType, "user@example.com")
-	if !autoApprove {
-		t.Error("EvaluatePolicy returned false for low risk grant, want true (auto-approve)")
+	result, err := EvaluatePolicy(grantType, PolicyInput{RequesterLogin: "user@example.com"})
+	if err != nil {
+		t.Fatalf("EvaluatePolicy failed: %v", err)
+	}
+	if result.Decision != DecisionAllow {
+		t.Errorf("EvaluatePolicy returned %q for low risk grant, want %q (auto-approve)", result.Decision, DecisionAllow)
 	}
 }
 
@@ -222,9 +442,12 @@ func TestEvaluatePolicy_HighRisk(t *testing.T) {
 		Approvers:   []string{"admin1", "admin2"},
 	}
 
-	autoApprove := EvaluatePolicy(grantType, "user@example.com")
-	if autoApprove {
-		t.Error("EvaluatePolicy returned true for high risk grant, want false (require approval)")
+	result, err := EvaluatePolicy(grantType, PolicyInput{RequesterLogin: "user@example.com"})
+	if err != nil {
+		t.Fatalf("EvaluatePolicy failed: %v", err)
+	}
+	if result.Decision != DecisionRequireApproval {
+		t.Errorf("EvaluatePolicy returned %q for high risk grant, want %q", result.Decision, DecisionRequireApproval)
 	}
 }
 
@@ -238,9 +461,12 @@ func TestEvaluatePolicy_MediumRisk(t *testing.T) {
 		Approvers:   []string{"admin"},
 	}
 
-	autoApprove := EvaluatePolicy(grantType, "user@example.com")
-	if autoApprove {
-		t.Error("EvaluatePolicy returned true for medium risk grant, want false (require approval)")
+	result, err := EvaluatePolicy(grantType, PolicyInput{RequesterLogin: "user@example.com"})
+	if err != nil {
+		t.Fatalf("EvaluatePolicy failed: %v", err)
+	}
+	if result.Decision != DecisionRequireApproval {
+		t.Errorf("EvaluatePolicy returned %q for medium risk grant, want %q", result.Decision, DecisionRequireApproval)
 	}
 }
 
@@ -257,7 +483,7 @@ func TestNewYAMLGrantTypeStore_UserRoleAction(t *testing.T) {
 		},
 	}
 
-	store, err := NewYAMLGrantTypeStore(configs)
+	store, err := NewYAMLGrantTypeStore(configs, nil)
 	if err != nil {
 		t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
 	}
@@ -289,7 +515,7 @@ func TestNewYAMLGrantTypeStore_UserRestoreAction(t *testing.T) {
 		},
 	}
 
-	store, err := NewYAMLGrantTypeStore(configs)
+	store, err := NewYAMLGrantTypeStore(configs, nil)
 	if err != nil {
 		t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
 	}
@@ -314,7 +540,7 @@ func TestNewYAMLGrantTypeStore_UserRoleMissingConfig(t *testing.T) {
 		},
 	}
 
-	_, err := NewYAMLGrantTypeStore(configs)
+	_, err := NewYAMLGrantTypeStore(configs, nil)
 	if err == nil {
 		t.Fatal("expected error for user_role action without userAction.role")
 	}
@@ -335,7 +561,7 @@ func TestNewYAMLGrantTypeStore_UserRoleInvalidRole(t *testing.T) {
 		},
 	}
 
-	_, err := NewYAMLGrantTypeStore(configs)
+	_, err := NewYAMLGrantTypeStore(configs, nil)
 	if err == nil {
 		t.Fatal("expected error for invalid role value")
 	}
@@ -355,7 +581,7 @@ func TestNewYAMLGrantTypeStore_UnknownAction(t *testing.T) {
 		},
 	}
 
-	_, err := NewYAMLGrantTypeStore(configs)
+	_, err := NewYAMLGrantTypeStore(configs, nil)
 	if err == nil {
 		t.Fatal("expected error for unknown action")
 	}
@@ -375,7 +601,7 @@ func TestNewYAMLGrantTypeStore_DefaultActionIsTag(t *testing.T) {
 		},
 	}
 
-	store, err := NewYAMLGrantTypeStore(configs)
+	store, err := NewYAMLGrantTypeStore(configs, nil)
 	if err != nil {
 		t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
 	}
@@ -399,7 +625,7 @@ func TestNewYAMLGrantTypeStore_PostureAttributesOnly(t *testing.T) {
 		},
 	}
 
-	store, err := NewYAMLGrantTypeStore(configs)
+	store, err := NewYAMLGrantTypeStore(configs, nil)
 	if err != nil {
 		t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
 	}
@@ -439,7 +665,7 @@ func TestNewYAMLGrantTypeStore_PostureAttributeInvalidKey(t *testing.T) {
 		},
 	}
 
-	_, err := NewYAMLGrantTypeStore(configs)
+	_, err := NewYAMLGrantTypeStore(configs, nil)
 	if err == nil {
 		t.Fatal("expected error for posture attribute key without custom: prefix")
 	}
@@ -461,7 +687,7 @@ func TestNewYAMLGrantTypeStore_PostureAttributeInvalidTarget(t *testing.T) {
 		},
 	}
 
-	_, err := NewYAMLGrantTypeStore(configs)
+	_, err := NewYAMLGrantTypeStore(configs, nil)
 	if err == nil {
 		t.Fatal("expected error for posture attribute with invalid target")
 	}
@@ -483,7 +709,7 @@ func TestNewYAMLGrantTypeStore_PostureAttributeDefaultTarget(t *testing.T) {
 		},
 	}
 
-	store, err := NewYAMLGrantTypeStore(configs)
+	store, err := NewYAMLGrantTypeStore(configs, nil)
 	if err != nil {
 		t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
 	}
@@ -507,7 +733,7 @@ func TestNewYAMLGrantTypeStore_PostureAttributeNilValue(t *testing.T) {
 		},
 	}
 
-	_, err := NewYAMLGrantTypeStore(configs)
+	_, err := NewYAMLGrantTypeStore(configs, nil)
 	if err == nil {
 		t.Fatal("expected error for posture attribute with nil value")
 	}
@@ -531,7 +757,7 @@ func TestNewYAMLGrantTypeStore_TagsAndPostureAttributes(t *testing.T) {
 		},
 	}
 
-	store, err := NewYAMLGrantTypeStore(configs)
+	store, err := NewYAMLGrantTypeStore(configs, nil)
 	if err != nil {
 		t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
 	}
@@ -561,7 +787,7 @@ func TestNewYAMLGrantTypeStore_NoTagsNoPostureAttributes(t *testing.T) {
 		},
 	}
 
-	_, err := NewYAMLGrantTypeStore(configs)
+	_, err := NewYAMLGrantTypeStore(configs, nil)
 	if err == nil {
 		t.Fatal("expected error for grant type with no tags and no posture attributes")
 	}
@@ -602,3 +828,283 @@ func TestParseRiskLevel(t *testing.T) {
 		})
 	}
 }
+
+func TestNewYAMLGrantTypeStore_ExtendPolicyAndAdmins(t *testing.T) {
+	configs := []config.GrantTypeConfig{
+		{
+			Name:         "admin-access",
+			Tags:         []string{"tag:admin"},
+			MaxDuration:  "1h",
+			RiskLevel:    "high",
+			Approvers:    []string{"approver@example.com"},
+			ExtendPolicy: "approver",
+		},
+		{
+			Name:        "ssh-access",
+			Tags:        []string{"tag:ssh"},
+			MaxDuration: "1h",
+			RiskLevel:   "low",
+		},
+	}
+
+	store, err := NewYAMLGrantTypeStore(configs, []string{"root@example.com"})
+	if err != nil {
+		t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
+	}
+
+	gt, _ := store.Get("admin-access")
+	if gt.ExtendPolicy != ExtendApprover {
+		t.Errorf("ExtendPolicy = %q, want %q", gt.ExtendPolicy, ExtendApprover)
+	}
+	if len(gt.Admins) != 1 || gt.Admins[0] != "root@example.com" {
+		t.Errorf("Admins = %v, want [root@example.com]", gt.Admins)
+	}
+
+	gt, _ = store.Get("ssh-access")
+	if gt.ExtendPolicy != ExtendRequesterOrApprover {
+		t.Errorf("ExtendPolicy = %q, want default %q", gt.ExtendPolicy, ExtendRequesterOrApprover)
+	}
+}
+
+func TestNewYAMLGrantTypeStore_InvalidExtendPolicy(t *testing.T) {
+	configs := []config.GrantTypeConfig{
+		{
+			Name:         "bad-extend",
+			Tags:         []string{"tag:test"},
+			MaxDuration:  "1h",
+			RiskLevel:    "low",
+			ExtendPolicy: "anyone",
+		},
+	}
+
+	_, err := NewYAMLGrantTypeStore(configs, nil)
+	if err == nil {
+		t.Fatal("expected error for invalid extendPolicy")
+	}
+	if !strings.Contains(err.Error(), "invalid extendPolicy") {
+		t.Errorf("error = %q, want to contain 'invalid extendPolicy'", err.Error())
+	}
+}
+
+func TestNewYAMLGrantTypeStore_RequiredApprovals(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.GrantTypeConfig
+		wantErr string
+	}{
+		{
+			name: "valid quorum",
+			cfg: config.GrantTypeConfig{
+				Name: "q", Tags: []string{"tag:q"}, MaxDuration: "1h", RiskLevel: "high",
+				Approvers: []string{"a@example.com", "b@example.com"}, RequiredApprovals: 2,
+			},
+		},
+		{
+			name: "more than approvers",
+			cfg: config.GrantTypeConfig{
+				Name: "q", Tags: []string{"tag:q"}, MaxDuration: "1h", RiskLevel: "high",
+				Approvers: []string{"a@example.com"}, RequiredApprovals: 2,
+			},
+			wantErr: "exceeds",
+		},
+		{
+			name: "group approvers",
+			cfg: config.GrantTypeConfig{
+				Name: "q", Tags: []string{"tag:q"}, MaxDuration: "1h", RiskLevel: "high",
+				Approvers: []string{"group:secops"}, RequiredApprovals: 2,
+			},
+		},
+		{
+			name: "unsupported autogroup",
+			cfg: config.GrantTypeConfig{
+				Name: "q", Tags: []string{"tag:q"}, MaxDuration: "1h", RiskLevel: "high",
+				Approvers: []string{"autogroup:tagged"},
+			},
+			wantErr: "unsupported autogroup",
+		},
+		{
+			name: "low risk",
+			cfg: config.GrantTypeConfig{
+				Name: "q", Tags: []string{"tag:q"}, MaxDuration: "1h", RiskLevel: "low",
+				Approvers: []string{"a@example.com", "b@example.com"}, RequiredApprovals: 2,
+			},
+			wantErr: "low risk",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{tt.cfg}, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
+			}
+			gt, _ := store.Get("q")
+			if want := max(tt.cfg.RequiredApprovals, 1); gt.ApprovalQuorum() != want {
+				t.Errorf("ApprovalQuorum() = %d, want %d", gt.ApprovalQuorum(), want)
+			}
+		})
+	}
+}
+
+func TestNewYAMLGrantTypeStore_ApprovalStages(t *testing.T) {
+	stage := func(name, timeout string, approvers ...string) config.ApprovalStageConfig {
+		return config.ApprovalStageConfig{Name: name, Approvers: approvers, Timeout: timeout}
+	}
+	base := func(stages ...config.ApprovalStageConfig) config.GrantTypeConfig {
+		return config.GrantTypeConfig{
+			Name: "esc", Tags: []string{"tag:esc"}, MaxDuration: "1h", RiskLevel: "high",
+			Approval: &config.ApprovalConfig{Stages: stages},
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		store, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{base(
+			stage("on-call", "15m", "oncall@example.com"),
+			stage("leads", "1h", "lead@example.com", "oncall@example.com"),
+		)}, nil)
+		if err != nil {
+			t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
+		}
+		gt, _ := store.Get("esc")
+		if len(gt.ApprovalStages) != 2 {
+			t.Fatalf("expected 2 stages, got %d", len(gt.ApprovalStages))
+		}
+		if time.Duration(gt.ApprovalStages[0].Timeout) != 15*time.Minute {
+			t.Errorf("stage 0 timeout = %v, want 15m", time.Duration(gt.ApprovalStages[0].Timeout))
+		}
+		want := []string{"oncall@example.com", "lead@example.com"}
+		if !slices.Equal(gt.Approvers, want) {
+			t.Errorf("Approvers = %v, want %v", gt.Approvers, want)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		cfg     config.GrantTypeConfig
+		wantErr string
+	}{
+		{"missing approvers", base(stage("a", "15m")), "at least one approver"},
+		{"bad timeout", base(stage("a", "soon", "a@example.com")), "invalid timeout"},
+		{"zero timeout", base(stage("a", "0s", "a@example.com")), "must be positive"},
+		{"bad principal", base(stage("a", "15m", "autogroup:nope")), "unsupported autogroup"},
+		{"top-level approvers too", func() config.GrantTypeConfig {
+			c := base(stage("a", "15m", "a@example.com"))
+			c.Approvers = []string{"b@example.com"}
+			return c
+		}(), "per stage"},
+		{"low risk", func() config.GrantTypeConfig {
+			c := base(stage("a", "15m", "a@example.com"))
+			c.RiskLevel = "low"
+			return c
+		}(), "low risk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{tt.cfg}, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluatePolicy_Rules(t *testing.T) {
+	grantType := &GrantType{
+		Name:      "db-access",
+		RiskLevel: RiskHigh,
+		Approvers: []string{"dba@example.com"},
+		Policy: []PolicyRule{
+			{When: `request.duration > 4h`, Decision: DecisionDeny, Message: "too long"},
+			{When: `"tag:oncall" in requester.tags && time.hour >= 9 && time.hour < 17`, Decision: DecisionAllow},
+			{When: `target.os == "windows"`, Decision: DecisionDeny},
+		},
+	}
+	workday := time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC)
+	night := time.Date(2025, 6, 2, 23, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		in       PolicyInput
+		want     Decision
+		wantRule int
+	}{
+		{"too long", PolicyInput{Duration: 5 * time.Hour, RequesterTags: []string{"tag:oncall"}, Time: workday}, DecisionDeny, 1},
+		{"on-call in hours", PolicyInput{Duration: time.Hour, RequesterTags: []string{"tag:oncall"}, Time: workday}, DecisionAllow, 2},
+		{"on-call at night", PolicyInput{Duration: time.Hour, RequesterTags: []string{"tag:oncall"}, Time: night}, DecisionRequireApproval, 0},
+		{"windows target", PolicyInput{Duration: time.Hour, TargetOS: "windows", Time: night}, DecisionDeny, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EvaluatePolicy(grantType, tt.in)
+			if err != nil {
+				t.Fatalf("EvaluatePolicy failed: %v", err)
+			}
+			if got.Decision != tt.want || got.Rule != tt.wantRule {
+				t.Errorf("EvaluatePolicy = %+v, want decision %q rule %d", got, tt.want, tt.wantRule)
+			}
+		})
+	}
+
+	broken := &GrantType{Policy: []PolicyRule{{When: `nope == 1`, Decision: DecisionAllow}}}
+	got, err := EvaluatePolicy(broken, PolicyInput{})
+	if err == nil || got.Decision != DecisionDeny {
+		t.Errorf("broken rule: got %+v, %v; want deny with error", got, err)
+	}
+}
+
+func TestNewYAMLGrantTypeStore_Policy(t *testing.T) {
+	base := func(risk string, approvers []string, rules ...config.PolicyRuleConfig) config.GrantTypeConfig {
+		return config.GrantTypeConfig{
+			Name: "p", Tags: []string{"tag:p"}, MaxDuration: "1h", RiskLevel: risk,
+			Approvers: approvers, Policy: rules,
+		}
+	}
+	rule := func(when, decision string) config.PolicyRuleConfig {
+		return config.PolicyRuleConfig{When: when, Decision: decision}
+	}
+
+	store, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{
+		base("high", []string{"a@example.com"}, rule(`"tag:oncall" in requester.tags`, "Allow")),
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
+	}
+	gt, _ := store.Get("p")
+	if len(gt.Policy) != 1 || gt.Policy[0].Decision != DecisionAllow {
+		t.Errorf("Policy = %+v, want one allow rule", gt.Policy)
+	}
+	if len(gt.Policy) == 1 && gt.Policy[0].expr == nil {
+		t.Error("policy rule not compiled at load")
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.GrantTypeConfig
+		wantErr string
+	}{
+		{"invalid decision", base("low", nil, rule(`true`, "maybe")), "invalid decision"},
+		{"syntax error", base("low", nil, rule(`time.hour >`, "deny")), "policy rule 1"},
+		{"unknown variable", base("low", nil, rule(`requester.team == "x"`, "deny")), "unknown variable"},
+		{"type error", base("low", nil, rule(`request.duration > 4`, "deny")), "cannot compare"},
+		{"approval without approvers", base("low", nil, rule(`true`, "require_approval")), "need at least one approver"},
+		{"bad eligible requester", func() config.GrantTypeConfig {
+			c := base("low", nil)
+			c.EligibleRequesters = []string{"autogroup:nope"}
+			return c
+		}(), "eligibleRequesters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{tt.cfg}, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package grant
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/tsapi"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// PolicyEditorWorkflowID is the ID of the singleton PolicyEditorWorkflow.
+const PolicyEditorWorkflowID = "policy-editor"
+
+const (
+	policyEditorContinueAsNewThreshold = 1000
+	// policyEditorRetryInterval is how long the editor waits before
+	// retrying a policy file write that failed.
+	policyEditorRetryInterval = 5 * time.Minute
+)
+
+// errTypeInvalidPolicy is the application error type of activities that
+// fail because the policy validate endpoint rejected the policy file.
+const errTypeInvalidPolicy = "InvalidPolicy"
+
+// PolicyEditorState tracks the group memberships and grants entries granted
+// through the policy file. The policy file is fetched before every write,
+// so edits made outside TailGrant are kept.
+type PolicyEditorState struct {
+	ActiveGrants map[string]GroupMembership
+	// Added are the memberships the editor added to the policy file. Each
+	// is removed again once no active grant needs it. Memberships that were
+	// already in the policy file are never removed.
+	Added []GroupMembership
+	// PolicyGrants are the grants entries of active policy_grant grants,
+	// keyed by grant ID. Each is marked with its grant ID in the policy
+	// file, and marked entries of other grant IDs are removed.
+	PolicyGrants map[string]tsapi.PolicyGrant
+	// Pending are the grant IDs of PolicyGrants entries not yet written,
+	// whose grant workflows wait for a "policy-grant-result" signal.
+	Pending []string
+}
+
+// PolicyEditorWorkflow serializes all edits TailGrant makes to the tailnet
+// policy file, so concurrent grants cannot overwrite each other's changes.
+func PolicyEditorWorkflow(ctx workflow.Context, state PolicyEditorState) error {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("PolicyEditorWorkflow started")
+
+	if state.ActiveGrants == nil {
+		state.ActiveGrants = make(map[string]GroupMembership)
+	}
+	if state.PolicyGrants == nil {
+		state.PolicyGrants = make(map[string]tsapi.PolicyGrant)
+	}
+
+	if err := workflow.SetQueryHandler(ctx, "memberships", func() (PolicyEditorState, error) {
+		return state, nil
+	}); err != nil {
+		return fmt.Errorf("register memberships query: %w", err)
+	}
+	if err := workflow.SetQueryHandler(ctx, "policy-grants", func() (map[string]tsapi.PolicyGrant, error) {
+		return state.PolicyGrants, nil
+	}); err != nil {
+		return fmt.Errorf("register policy-grants query: %w", err)
+	}
+
+	actCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: 30 * time.Second,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 5,
+		},
+	})
+
+	var activities *Activities
+	signalCount := 0
+	// groupsFailed and grantsFailed are set while that part of the policy
+	// file is out of step with state.
+	groupsFailed, grantsFailed := false, false
+
+	addCh := workflow.GetSignalChannel(ctx, "add-membership")
+	removeCh := workflow.GetSignalChannel(ctx, "remove-membership")
+	addGrantCh := workflow.GetSignalChannel(ctx, "add-policy-grant")
+	removeGrantCh := workflow.GetSignalChannel(ctx, "remove-policy-grant")
+	syncCh := workflow.GetSignalChannel(ctx, "sync")
+
+	applyGroups := func() {
+		if err := applyMemberships(ctx, actCtx, activities, &state); err != nil {
+			logger.Error("Failed to update policy file groups", "error", err)
+			groupsFailed = true
+			return
+		}
+		groupsFailed = false
+	}
+	replyPending := func(rejected string) {
+		for _, id := range state.Pending {
+			err := workflow.SignalExternalWorkflow(ctx, fmt.Sprintf("grant-%s", id), "", "policy-grant-result", PolicyGrantResult{
+				GrantID:  id,
+				Rejected: rejected,
+			}).Get(ctx, nil)
+			if err != nil {
+				logger.Warn("Failed to signal policy grant result", "grantID", id, "error", err)
+			}
+		}
+		state.Pending = nil
+	}
+	applyGrants := func() {
+		err := workflow.ExecuteActivity(actCtx, activities.SyncPolicyGrants, state.PolicyGrants).Get(ctx, nil)
+		if isPolicyRejection(err) && len(state.Pending) > 0 {
+			// Retrying would be rejected again: drop the entries not yet
+			// written, fail their grants, and write the rest without them.
+			logger.Error("Policy file rejected new grants entries, dropping them", "grantIDs", state.Pending, "error", err)
+			for _, id := range state.Pending {
+				delete(state.PolicyGrants, id)
+			}
+			replyPending(err.Error())
+			err = workflow.ExecuteActivity(actCtx, activities.SyncPolicyGrants, state.PolicyGrants).Get(ctx, nil)
+		}
+		if err != nil {
+			logger.Error("Failed to update policy file grants", "error", err)
+			grantsFailed = true
+			return
+		}
+		grantsFailed = false
+		replyPending("")
+	}
+
+	for {
+		sel := workflow.NewSelector(ctx)
+
+		sel.AddReceive(addCh, func(ch workflow.ReceiveChannel, more bool) {
+			var sig AddMembershipSignal
+			ch.Receive(ctx, &sig)
+			signalCount++
+
+			state.ActiveGrants[sig.GrantID] = sig.Membership
+			applyGroups()
+		})
+
+		sel.AddReceive(removeCh, func(ch workflow.ReceiveChannel, more bool) {
+			var sig RemoveGrantSignal
+			ch.Receive(ctx, &sig)
+			signalCount++
+
+			delete(state.ActiveGrants, sig.GrantID)
+			applyGroups()
+		})
+
+		sel.AddReceive(addGrantCh, func(ch workflow.ReceiveChannel, more bool) {
+			var sig AddPolicyGrantSignal
+			ch.Receive(ctx, &sig)
+			signalCount++
+
+			state.PolicyGrants[sig.GrantID] = sig.Grant
+			if !slices.Contains(state.Pending, sig.GrantID) {
+				state.Pending = append(state.Pending, sig.GrantID)
+			}
+			applyGrants()
+		})
+
+		sel.AddReceive(removeGrantCh, func(ch workflow.ReceiveChannel, more bool) {
+			var sig RemoveGrantSignal
+			ch.Receive(ctx, &sig)
+			signalCount++
+
+			delete(state.PolicyGrants, sig.GrantID)
+			state.Pending = slices.DeleteFunc(state.Pending, func(id string) bool { return id == sig.GrantID })
+			applyGrants()
+		})
+
+		sel.AddReceive(syncCh, func(ch workflow.ReceiveChannel, more bool) {
+			var sig SyncSignal
+			ch.Receive(ctx, &sig)
+			signalCount++
+
+			applyGroups()
+			applyGrants()
+		})
+
+		timerCtx, cancelTimer := workflow.WithCancel(ctx)
+		if groupsFailed || grantsFailed {
+			sel.AddFuture(workflow.NewTimer(timerCtx, policyEditorRetryInterval), func(f workflow.Future) {
+				if f.Get(ctx, nil) != nil {
+					return
+				}
+				if groupsFailed {
+					applyGroups()
+				}
+				if grantsFailed {
+					applyGrants()
+				}
+			})
+		}
+
+		sel.Select(ctx)
+		cancelTimer()
+
+		// A removal that failed keeps the workflow open for the retry: a
+		// membership stays in Added, and a grants entry sets grantsFailed.
+		if len(state.ActiveGrants) == 0 && len(state.Added) == 0 && len(state.PolicyGrants) == 0 && !grantsFailed {
+			logger.Info("Nothing remaining in the policy file, completing")
+			return nil
+		}
+
+		if signalCount >= policyEditorContinueAsNewThreshold {
+			logger.Info("ContinueAsNew after processing signals", "signalCount", signalCount)
+			return workflow.NewContinueAsNewError(ctx, PolicyEditorWorkflow, state)
+		}
+	}
+}
+
+// applyMemberships brings the policy file in line with state in one write:
+// every active grant's membership is added, and memberships the editor
+// added that no active grant needs any more are removed.
+func applyMemberships(ctx workflow.Context, actCtx workflow.Context, activities *Activities, state *PolicyEditorState) error {
+	var add []GroupMembership
+	for _, m := range state.ActiveGrants {
+		if !slices.Contains(add, m) {
+			add = append(add, m)
+		}
+	}
+	// Map iteration order is random; sort for deterministic activity input.
+	slices.SortFunc(add, compareMemberships)
+
+	var remove, keep []GroupMembership
+	for _, m := range state.Added {
+		if slices.Contains(add, m) {
+			keep = append(keep, m)
+		} else {
+			remove = append(remove, m)
+		}
+	}
+
+	var added []GroupMembership
+	if err := workflow.ExecuteActivity(actCtx, activities.UpdatePolicyGroups, add, remove).Get(ctx, &added); err != nil {
+		return err
+	}
+	for _, m := range added {
+		if !slices.Contains(keep, m) {
+			keep = append(keep, m)
+		}
+	}
+	state.Added = keep
+	return nil
+}
+
+// isPolicyRejection reports whether an activity failed because the policy
+// validate endpoint rejected the policy file.
+func isPolicyRejection(err error) bool {
+	var appErr *temporal.ApplicationError
+	return errors.As(err, &appErr) && appErr.Type() == errTypeInvalidPolicy
+}
+
+func compareMemberships(a, b GroupMembership) int {
+	return cmp.Or(strings.Compare(a.Group, b.Group), strings.Compare(a.Member, b.Member))
+}
@@ -0,0 +1,234 @@
+package grant
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/tsapi"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func setupPolicyEditorTestEnv() *testsuite.TestWorkflowEnvironment {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	activities := &Activities{}
+	env.RegisterActivity(activities.UpdatePolicyGroups)
+	env.RegisterActivity(activities.SyncPolicyGrants)
+
+	return env
+}
+
+// policyGroupsCall records one UpdatePolicyGroups call.
+type policyGroupsCall struct {
+	add, remove []GroupMembership
+}
+
+func TestPolicyEditor_SharedMembership(t *testing.T) {
+	env := setupPolicyEditorTestEnv()
+
+	dba := GroupMembership{Group: "group:db-admins", Member: "alice@example.com"}
+	eng := GroupMembership{Group: "group:eng", Member: "alice@example.com"}
+
+	// alice is already in group:eng, so only group:db-admins is added.
+	var calls []policyGroupsCall
+	env.OnActivity("UpdatePolicyGroups", mock.Anything, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, add, remove []GroupMembership) ([]GroupMembership, error) {
+			calls = append(calls, policyGroupsCall{add, remove})
+			var added []GroupMembership
+			for _, m := range add {
+				if m == dba && len(calls) == 1 {
+					added = append(added, m)
+				}
+			}
+			return added, nil
+		})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-membership", AddMembershipSignal{GrantID: "grant-1", Membership: dba})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-membership", AddMembershipSignal{GrantID: "grant-2", Membership: dba})
+	}, 2*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-membership", AddMembershipSignal{GrantID: "grant-3", Membership: eng})
+	}, 3*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-membership", RemoveGrantSignal{GrantID: "grant-1"})
+	}, 4*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-membership", RemoveGrantSignal{GrantID: "grant-3"})
+	}, 5*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-membership", RemoveGrantSignal{GrantID: "grant-2"})
+	}, 6*time.Minute)
+
+	env.ExecuteWorkflow(PolicyEditorWorkflow, PolicyEditorState{})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.Len(t, calls, 6)
+	// group:db-admins stays while grant-2 still needs it, and group:eng,
+	// which alice already had, is never removed.
+	for i := 0; i < 5; i++ {
+		require.Empty(t, calls[i].remove, "call %d", i)
+	}
+	require.Equal(t, []GroupMembership{dba, eng}, calls[2].add)
+	require.Empty(t, calls[5].add)
+	require.Equal(t, []GroupMembership{dba}, calls[5].remove)
+}
+
+func TestPolicyEditor_RemoveRetried(t *testing.T) {
+	env := setupPolicyEditorTestEnv()
+
+	m := GroupMembership{Group: "group:db-admins", Member: "alice@example.com"}
+
+	env.OnActivity("UpdatePolicyGroups", mock.Anything, []GroupMembership{m}, mock.Anything).Return([]GroupMembership{m}, nil).Once()
+	removes := 0
+	env.OnActivity("UpdatePolicyGroups", mock.Anything, mock.Anything, []GroupMembership{m}).Return(
+		func(_ context.Context, _, _ []GroupMembership) ([]GroupMembership, error) {
+			removes++
+			if removes == 1 {
+				return nil, errors.New("precondition failed")
+			}
+			return nil, nil
+		})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-membership", AddMembershipSignal{GrantID: "grant-1", Membership: m})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-membership", RemoveGrantSignal{GrantID: "grant-1"})
+	}, 2*time.Minute)
+
+	env.ExecuteWorkflow(PolicyEditorWorkflow, PolicyEditorState{})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	// The failed removal was retried on the editor's timer.
+	require.Equal(t, 2, removes)
+}
+
+func TestPolicyEditor_PolicyGrants(t *testing.T) {
+	env := setupPolicyEditorTestEnv()
+
+	ssh := tsapi.PolicyGrant{Src: []string{"alice@example.com"}, Dst: []string{"100.64.0.1"}, IP: []string{"tcp:22"}}
+	web := tsapi.PolicyGrant{Src: []string{"bob@example.com"}, Dst: []string{"100.64.0.2"}, IP: []string{"tcp:443"}}
+
+	var calls []map[string]tsapi.PolicyGrant
+	env.OnActivity("SyncPolicyGrants", mock.Anything, mock.Anything).Return(
+		func(_ context.Context, grants map[string]tsapi.PolicyGrant) error {
+			calls = append(calls, grants)
+			if len(calls) == 3 {
+				return errors.New("precondition failed")
+			}
+			return nil
+		})
+	var written []PolicyGrantResult
+	env.OnSignalExternalWorkflow(mock.Anything, mock.Anything, "", "policy-grant-result", mock.Anything).Return(
+		func(_, _, _, _ string, arg interface{}) error {
+			written = append(written, arg.(PolicyGrantResult))
+			return nil
+		})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-policy-grant", AddPolicyGrantSignal{GrantID: "grant-1", Grant: ssh})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-policy-grant", AddPolicyGrantSignal{GrantID: "grant-2", Grant: web})
+	}, 2*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-policy-grant", RemoveGrantSignal{GrantID: "grant-1"})
+	}, 3*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-policy-grant", RemoveGrantSignal{GrantID: "grant-2"})
+	}, 10*time.Minute)
+
+	env.ExecuteWorkflow(PolicyEditorWorkflow, PolicyEditorState{})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	// The failed removal of grant-1 was retried on the editor's timer.
+	require.Len(t, calls, 5)
+	require.Equal(t, map[string]tsapi.PolicyGrant{"grant-1": ssh, "grant-2": web}, calls[1])
+	require.Equal(t, map[string]tsapi.PolicyGrant{"grant-2": web}, calls[2])
+	require.Equal(t, map[string]tsapi.PolicyGrant{"grant-2": web}, calls[3])
+	require.Empty(t, calls[4])
+	require.Equal(t, []PolicyGrantResult{{GrantID: "grant-1"}, {GrantID: "grant-2"}}, written)
+}
+
+func TestPolicyEditor_PolicyGrantRejected(t *testing.T) {
+	env := setupPolicyEditorTestEnv()
+
+	ssh := tsapi.PolicyGrant{Src: []string{"alice@example.com"}, Dst: []string{"100.64.0.1"}, IP: []string{"tcp:22"}}
+	bad := tsapi.PolicyGrant{Src: []string{"bob@example.com"}, Dst: []string{"100.64.0.2"}, App: map[string][]map[string]any{"example.com/cap/unknown": {{}}}}
+
+	var calls []map[string]tsapi.PolicyGrant
+	env.OnActivity("SyncPolicyGrants", mock.Anything, mock.Anything).Return(
+		func(_ context.Context, grants map[string]tsapi.PolicyGrant) error {
+			calls = append(calls, grants)
+			if _, ok := grants["grant-2"]; ok {
+				return temporal.NewNonRetryableApplicationError("policy file rejected: unknown capability", "InvalidPolicy", nil)
+			}
+			return nil
+		})
+	results := make(map[string]PolicyGrantResult)
+	env.OnSignalExternalWorkflow(mock.Anything, mock.Anything, "", "policy-grant-result", mock.Anything).Return(
+		func(_, workflowID, _, _ string, arg interface{}) error {
+			results[workflowID] = arg.(PolicyGrantResult)
+			return nil
+		})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-policy-grant", AddPolicyGrantSignal{GrantID: "grant-1", Grant: ssh})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-policy-grant", AddPolicyGrantSignal{GrantID: "grant-2", Grant: bad})
+	}, 2*time.Minute)
+	var pending map[string]tsapi.PolicyGrant
+	env.RegisterDelayedCallback(func() {
+		v, err := env.QueryWorkflow("policy-grants")
+		require.NoError(t, err)
+		require.NoError(t, v.Get(&pending))
+		env.SignalWorkflow("remove-policy-grant", RemoveGrantSignal{GrantID: "grant-1"})
+	}, time.Hour)
+
+	env.ExecuteWorkflow(PolicyEditorWorkflow, PolicyEditorState{})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	// The rejected entry was dropped rather than retried, and the others
+	// were written without it.
+	require.Len(t, calls, 4)
+	require.Equal(t, map[string]tsapi.PolicyGrant{"grant-1": ssh}, calls[2])
+	require.Equal(t, map[string]tsapi.PolicyGrant{"grant-1": ssh}, pending)
+	require.Empty(t, results["grant-grant-1"].Rejected)
+	require.Contains(t, results["grant-grant-2"].Rejected, "unknown capability")
+}
+
+func TestPolicyEditor_SyncStripsOrphans(t *testing.T) {
+	env := setupPolicyEditorTestEnv()
+
+	env.OnActivity("UpdatePolicyGroups", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	synced := false
+	env.OnActivity("SyncPolicyGrants", mock.Anything, mock.Anything).Return(
+		func(_ context.Context, grants map[string]tsapi.PolicyGrant) error {
+			synced = len(grants) == 0
+			return nil
+		})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("sync", SyncSignal{})
+	}, time.Minute)
+
+	env.ExecuteWorkflow(PolicyEditorWorkflow, PolicyEditorState{})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.True(t, synced, "expected a sync with no grants entries")
+}
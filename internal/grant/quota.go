@@ -0,0 +1,420 @@
+package grant
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	quotaDay                    = 24 * time.Hour
+	defaultActiveTimeWindow     = 24 * time.Hour
+	quotaContinueAsNewThreshold = 1000
+	quotaStaleCheckInterval     = time.Hour
+)
+
+// Application error types for rejected quota reservations. Handlers map
+// ErrTypeConcurrencyLimit to 409 and ErrTypeRateLimit to 429.
+const (
+	ErrTypeConcurrencyLimit = "ConcurrencyLimitExceeded"
+	ErrTypeRateLimit        = "RateLimitExceeded"
+)
+
+// QuotaWorkflowID returns the ID of the UserQuotaWorkflow for a login.
+func QuotaWorkflowID(login string) string {
+	return "user-quota-" + login
+}
+
+// activeTimeWindow returns the rolling window MaxActiveTime applies to.
+func (q Quota) activeTimeWindow() time.Duration {
+	if q.ActiveTimeWindow > 0 {
+		return time.Duration(q.ActiveTimeWindow)
+	}
+	return defaultActiveTimeWindow
+}
+
+// QuotaReservation is the argument of the "reserve" update, sent before a
+// grant workflow is started.
+type QuotaReservation struct {
+	GrantID   string        `json:"grantID"`
+	GrantType string        `json:"grantType"`
+	Quota     Quota         `json:"quota"`
+	Duration  time.Duration `json:"duration"`
+	StartAt   time.Time     `json:"startAt"`
+}
+
+// QuotaRelease is signaled by GrantWorkflow when a grant ends, however it
+// ends. ActivatedAt is zero for grants that never activated.
+type QuotaRelease struct {
+	GrantID     string    `json:"grantID"`
+	ActivatedAt time.Time `json:"activatedAt"`
+	EndedAt     time.Time `json:"endedAt"`
+}
+
+// QuotaExtension is signaled by GrantWorkflow when an active grant is
+// extended or renewed, so the extra time counts against MaxActiveTime.
+type QuotaExtension struct {
+	GrantID   string    `json:"grantID"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// QuotaEntry is one grant counted against a user's quotas. While the grant
+// is open its full requested duration counts as active time; once released
+// only the time it was actually active does.
+type QuotaEntry struct {
+	GrantID     string        `json:"grantID"`
+	GrantType   string        `json:"grantType"`
+	RequestedAt time.Time     `json:"requestedAt"`
+	Start       time.Time     `json:"start"`
+	End         time.Time     `json:"end"`
+	Window      time.Duration `json:"window"`
+	Open        bool          `json:"open"`
+}
+
+// UserQuotaState is the state of a user's UserQuotaWorkflow.
+type UserQuotaState struct {
+	Login   string       `json:"login"`
+	Entries []QuotaEntry `json:"entries"`
+}
+
+// check returns an application error naming the limit r would exceed, or
+// nil if it fits within the grant type's quota.
+func (s *UserQuotaState) check(r QuotaReservation, now time.Time) error {
+	q := r.Quota
+	window := q.activeTimeWindow()
+	var open, today int
+	var used time.Duration
+	for _, e := range s.Entries {
+		if e.GrantType != r.GrantType {
+			continue
+		}
+		if e.Open {
+			open++
+		}
+		if now.Sub(e.RequestedAt) < quotaDay {
+			today++
+		}
+		if from := now.Add(-window); e.End.After(from) {
+			if e.Start.After(from) {
+				from = e.Start
+			}
+			used += e.End.Sub(from)
+		}
+	}
+
+	if q.MaxConcurrentPerUser > 0 && open >= q.MaxConcurrentPerUser {
+		return temporal.NewApplicationError(fmt.Sprintf("quota exceeded: %s already has %d open %q grants (maxConcurrentPerUser %d)",
+			s.Login, open, r.GrantType, q.MaxConcurrentPerUser), ErrTypeConcurrencyLimit)
+	}
+	if q.MaxGrantsPerUserPerDay > 0 && today >= q.MaxGrantsPerUserPerDay {
+		return temporal.NewApplicationError(fmt.Sprintf("quota exceeded: %s requested %d %q grants in the last 24h (maxGrantsPerUserPerDay %d)",
+			s.Login, today, r.GrantType, q.MaxGrantsPerUserPerDay), ErrTypeRateLimit)
+	}
+	if limit := time.Duration(q.MaxActiveTime); limit > 0 && used+r.Duration > limit {
+		return temporal.NewApplicationError(fmt.Sprintf("quota exceeded: %s has used %s of %s %q time in the last %s and requested %s (maxActiveTime)",
+			s.Login, used.Round(time.Minute), limit, r.GrantType, window, r.Duration), ErrTypeRateLimit)
+	}
+	return nil
+}
+
+func (s *UserQuotaState) reserve(r QuotaReservation, now time.Time) {
+	start := now
+	if r.StartAt.After(now) {
+		start = r.StartAt
+	}
+	s.Entries = append(s.Entries, QuotaEntry{
+		GrantID:     r.GrantID,
+		GrantType:   r.GrantType,
+		RequestedAt: now,
+		Start:       start,
+		End:         start.Add(r.Duration),
+		Window:      r.Quota.activeTimeWindow(),
+		Open:        true,
+	})
+}
+
+func (s *UserQuotaState) release(rel QuotaRelease) {
+	for i := range s.Entries {
+		e := &s.Entries[i]
+		if e.GrantID != rel.GrantID || !e.Open {
+			continue
+		}
+		e.Open = false
+		if rel.ActivatedAt.IsZero() {
+			e.Start, e.End = time.Time{}, time.Time{}
+		} else {
+			e.Start, e.End = rel.ActivatedAt, rel.EndedAt
+		}
+	}
+}
+
+func (s *UserQuotaState) extend(x QuotaExtension) {
+	for i := range s.Entries {
+		e := &s.Entries[i]
+		if e.GrantID == x.GrantID && e.Open && x.ExpiresAt.After(e.End) {
+			e.End = x.ExpiresAt
+		}
+	}
+}
+
+// stale returns the IDs of open entries reserved more than
+// quotaStaleCheckInterval ago. Newer ones may belong to grants whose
+// workflow has not started yet.
+func (s *UserQuotaState) stale(now time.Time) []string {
+	var ids []string
+	for _, e := range s.Entries {
+		if e.Open && now.Sub(e.RequestedAt) > quotaStaleCheckInterval {
+			ids = append(ids, e.GrantID)
+		}
+	}
+	return ids
+}
+
+// expire closes an open entry whose grant workflow is gone without having
+// released it. Its active time is counted up to now, since when it really
+// ended is unknown.
+func (s *UserQuotaState) expire(grantID string, now time.Time) {
+	for i := range s.Entries {
+		e := &s.Entries[i]
+		if e.GrantID != grantID || !e.Open {
+			continue
+		}
+		e.Open = false
+		if e.Start.After(now) {
+			e.Start, e.End = time.Time{}, time.Time{}
+		} else if e.End.After(now) {
+			e.End = now
+		}
+	}
+}
+
+// expiry returns when a released entry stops counting against any quota.
+func (e QuotaEntry) expiry() time.Time {
+	t := e.RequestedAt.Add(quotaDay)
+	if end := e.End.Add(e.Window); end.After(t) {
+		t = end
+	}
+	return t
+}
+
+// prune drops released entries that no longer count against any quota and
+// returns how long until the next one does, or zero if none will.
+func (s *UserQuotaState) prune(now time.Time) time.Duration {
+	var next time.Duration
+	kept := s.Entries[:0]
+	for _, e := range s.Entries {
+		if !e.Open {
+			wait := e.expiry().Sub(now)
+			if wait <= 0 {
+				continue
+			}
+			if next == 0 || wait < next {
+				next = wait
+			}
+		}
+		kept = append(kept, e)
+	}
+	s.Entries = kept
+	return next
+}
+
+// UserQuotaWorkflow serializes quota checks for one user, so concurrent
+// requests cannot both slip under a limit. HandleCreateGrant reserves a
+// slot with the "reserve" update (update-with-start) before starting
+// GrantWorkflow, which sends "extend" when the grant is extended and
+// "release" when it ends. Grants that end without releasing, because they
+// were terminated or timed out, are found by checking every
+// quotaStaleCheckInterval that the grant workflows of open entries are
+// still running. The workflow completes once no entries count against any
+// quota.
+func UserQuotaWorkflow(ctx workflow.Context, state UserQuotaState) error {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("UserQuotaWorkflow started", "login", state.Login)
+
+	if err := workflow.SetQueryHandler(ctx, "quota", func() ([]QuotaEntry, error) {
+		return state.Entries, nil
+	}); err != nil {
+		return fmt.Errorf("register quota query: %w", err)
+	}
+
+	events := 0
+	changed := false
+
+	// The handler does not block, so each reservation is checked and
+	// recorded before any other update or signal is processed.
+	if err := workflow.SetUpdateHandler(ctx, "reserve", func(ctx workflow.Context, r QuotaReservation) error {
+		events++
+		changed = true
+		now := workflow.Now(ctx)
+		state.prune(now)
+		if err := state.check(r, now); err != nil {
+			logger.Info("Quota reservation rejected", "login", state.Login, "grantID", r.GrantID, "error", err)
+			return err
+		}
+		state.reserve(r, now)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("register reserve update: %w", err)
+	}
+
+	releaseCh := workflow.GetSignalChannel(ctx, "release")
+	receiveRelease := func(rel QuotaRelease) {
+		events++
+		changed = true
+		state.release(rel)
+	}
+	workflow.Go(ctx, func(ctx workflow.Context) {
+		for {
+			var rel QuotaRelease
+			releaseCh.Receive(ctx, &rel)
+			receiveRelease(rel)
+		}
+	})
+
+	extendCh := workflow.GetSignalChannel(ctx, "extend")
+	receiveExtension := func(x QuotaExtension) {
+		events++
+		state.extend(x)
+	}
+	workflow.Go(ctx, func(ctx workflow.Context) {
+		for {
+			var x QuotaExtension
+			extendCh.Receive(ctx, &x)
+			receiveExtension(x)
+		}
+	})
+
+	// Expire reservations of grants that ended without releasing them.
+	actCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: 30 * time.Second,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 5,
+		},
+	})
+	var activities *Activities
+	lastStaleCheck := workflow.Now(ctx)
+	expireStale := func() {
+		lastStaleCheck = workflow.Now(ctx)
+		ids := state.stale(lastStaleCheck)
+		futures := make([]workflow.Future, len(ids))
+		for i, id := range ids {
+			futures[i] = workflow.ExecuteActivity(actCtx, activities.CheckWorkflowExists, fmt.Sprintf("grant-%s", id))
+		}
+		for i, f := range futures {
+			var running bool
+			if err := f.Get(ctx, &running); err != nil {
+				logger.Warn("Failed to check grant workflow", "login", state.Login, "grantID", ids[i], "error", err)
+				continue
+			}
+			if !running {
+				logger.Warn("Expiring quota reservation of ended grant", "login", state.Login, "grantID", ids[i])
+				events++
+				state.expire(ids[i], workflow.Now(ctx))
+			}
+		}
+	}
+
+	for {
+		changed = false
+		wait := state.prune(workflow.Now(ctx))
+		if wait == 0 {
+			// Only open entries, or none yet: wait for a reservation or release.
+			wait = quotaDay
+		}
+		if wait > quotaStaleCheckInterval && slices.ContainsFunc(state.Entries, func(e QuotaEntry) bool { return e.Open }) {
+			wait = quotaStaleCheckInterval
+		}
+		if _, err := workflow.AwaitWithTimeout(ctx, wait, func() bool { return changed }); err != nil {
+			return err
+		}
+		if workflow.Now(ctx).Sub(lastStaleCheck) >= quotaStaleCheckInterval {
+			expireStale()
+		}
+		state.prune(workflow.Now(ctx))
+
+		if len(state.Entries) == 0 || events >= quotaContinueAsNewThreshold {
+			if err := workflow.Await(ctx, func() bool { return workflow.AllHandlersFinished(ctx) }); err != nil {
+				return err
+			}
+			var rel QuotaRelease
+			for releaseCh.ReceiveAsync(&rel) {
+				receiveRelease(rel)
+			}
+			var x QuotaExtension
+			for extendCh.ReceiveAsync(&x) {
+				receiveExtension(x)
+			}
+			if len(state.Entries) == 0 {
+				logger.Info("No quota entries remaining, completing", "login", state.Login)
+				return nil
+			}
+			logger.Info("ContinueAsNew after processing events", "login", state.Login, "events", events)
+			return workflow.NewContinueAsNewError(ctx, UserQuotaWorkflow, state)
+		}
+	}
+}
+
+// extendQuota tells the requester's UserQuotaWorkflow that a grant now
+// runs until state.ExpiresAt.
+func extendQuota(ctx workflow.Context, request GrantRequest, state GrantState) {
+	x := QuotaExtension{GrantID: request.ID, ExpiresAt: state.ExpiresAt}
+	if err := workflow.SignalExternalWorkflow(ctx, QuotaWorkflowID(request.Requester), "", "extend", x).Get(ctx, nil); err != nil {
+		workflow.GetLogger(ctx).Error("Failed to extend quota", "grantID", request.ID, "error", err)
+	}
+}
+
+// releaseQuota tells the requester's UserQuotaWorkflow that a grant has
+// ended. It uses a disconnected context so it also runs when the grant
+// workflow is cancelled.
+func releaseQuota(ctx workflow.Context, request GrantRequest, state GrantState) {
+	ctx, _ = workflow.NewDisconnectedContext(ctx)
+	rel := QuotaRelease{GrantID: request.ID}
+	if !state.ActivatedAt.IsZero() {
+		rel.ActivatedAt = state.ActivatedAt
+		rel.EndedAt = workflow.Now(ctx)
+	}
+	if err := workflow.SignalExternalWorkflow(ctx, QuotaWorkflowID(request.Requester), "", "release", rel).Get(ctx, nil); err != nil {
+		workflow.GetLogger(ctx).Error("Failed to release quota", "grantID", request.ID, "error", err)
+	}
+}
+
+func parseQuota(c *config.QuotaConfig) (*Quota, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.MaxConcurrentPerUser < 0 || c.MaxGrantsPerUserPerDay < 0 {
+		return nil, fmt.Errorf("quota: limits must not be negative")
+	}
+	q := &Quota{
+		MaxConcurrentPerUser:   c.MaxConcurrentPerUser,
+		MaxGrantsPerUserPerDay: c.MaxGrantsPerUserPerDay,
+	}
+	if c.MaxActiveTime != "" {
+		d, err := time.ParseDuration(c.MaxActiveTime)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("quota: invalid maxActiveTime %q", c.MaxActiveTime)
+		}
+		q.MaxActiveTime = JSONDuration(d)
+	}
+	if c.ActiveTimeWindow != "" {
+		if q.MaxActiveTime == 0 {
+			return nil, fmt.Errorf("quota: activeTimeWindow requires maxActiveTime")
+		}
+		d, err := time.ParseDuration(c.ActiveTimeWindow)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("quota: invalid activeTimeWindow %q", c.ActiveTimeWindow)
+		}
+		q.ActiveTimeWindow = JSONDuration(d)
+	}
+	if time.Duration(q.MaxActiveTime) > q.activeTimeWindow() {
+		return nil, fmt.Errorf("quota: maxActiveTime %s exceeds its %s window", time.Duration(q.MaxActiveTime), q.activeTimeWindow())
+	}
+	if *q == (Quota{}) {
+		return nil, nil
+	}
+	return q, nil
+}
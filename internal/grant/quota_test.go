@@ -0,0 +1,298 @@
+package grant
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestUserQuotaState_Check(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	open := func(id string, start time.Time, d time.Duration) QuotaEntry {
+		return QuotaEntry{GrantID: id, GrantType: "temp-admin", RequestedAt: start, Start: start, End: start.Add(d), Window: quotaDay, Open: true}
+	}
+	closed := func(id string, start time.Time, d time.Duration) QuotaEntry {
+		e := open(id, start, d)
+		e.Open = false
+		return e
+	}
+
+	tests := []struct {
+		name     string
+		quota    Quota
+		entries  []QuotaEntry
+		duration time.Duration
+		wantType string
+	}{
+		{"no entries", Quota{MaxConcurrentPerUser: 1}, nil, time.Hour, ""},
+		{"concurrent limit", Quota{MaxConcurrentPerUser: 1},
+			[]QuotaEntry{open("a", now.Add(-time.Hour), 2*time.Hour)}, time.Hour, ErrTypeConcurrencyLimit},
+		{"released grant is not concurrent", Quota{MaxConcurrentPerUser: 1},
+			[]QuotaEntry{closed("a", now.Add(-2*time.Hour), time.Hour)}, time.Hour, ""},
+		{"other grant types don't count", Quota{MaxConcurrentPerUser: 1},
+			[]QuotaEntry{{GrantID: "a", GrantType: "ssh", RequestedAt: now, Open: true}}, time.Hour, ""},
+		{"daily limit", Quota{MaxGrantsPerUserPerDay: 2},
+			[]QuotaEntry{closed("a", now.Add(-20*time.Hour), time.Hour), closed("b", now.Add(-3*time.Hour), time.Hour)}, time.Hour, ErrTypeRateLimit},
+		{"daily limit is rolling", Quota{MaxGrantsPerUserPerDay: 2},
+			[]QuotaEntry{closed("a", now.Add(-25*time.Hour), time.Hour), closed("b", now.Add(-3*time.Hour), time.Hour)}, time.Hour, ""},
+		{"active time within cap", Quota{MaxActiveTime: JSONDuration(4 * time.Hour)},
+			[]QuotaEntry{closed("a", now.Add(-5*time.Hour), 2*time.Hour)}, 2 * time.Hour, ""},
+		{"active time over cap", Quota{MaxActiveTime: JSONDuration(4 * time.Hour)},
+			[]QuotaEntry{closed("a", now.Add(-5*time.Hour), 2*time.Hour)}, 3 * time.Hour, ErrTypeRateLimit},
+		{"open grants count their full duration", Quota{MaxActiveTime: JSONDuration(4 * time.Hour)},
+			[]QuotaEntry{open("a", now.Add(-time.Hour), 3*time.Hour)}, 2 * time.Hour, ErrTypeRateLimit},
+		{"only time inside the window counts", Quota{MaxActiveTime: JSONDuration(4 * time.Hour)},
+			[]QuotaEntry{closed("a", now.Add(-26*time.Hour), 4*time.Hour)}, 2 * time.Hour, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &UserQuotaState{Login: "user@example.com", Entries: tt.entries}
+			err := s.check(QuotaReservation{GrantID: "new", GrantType: "temp-admin", Quota: tt.quota, Duration: tt.duration}, now)
+			if tt.wantType == "" {
+				require.NoError(t, err)
+				return
+			}
+			var appErr *temporal.ApplicationError
+			require.True(t, errors.As(err, &appErr), "error = %v", err)
+			require.Equal(t, tt.wantType, appErr.Type())
+		})
+	}
+}
+
+func TestUserQuotaWorkflow(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	quota := Quota{MaxConcurrentPerUser: 1, MaxGrantsPerUserPerDay: 2}
+	reserve := func(id string) QuotaReservation {
+		return QuotaReservation{GrantID: id, GrantType: "temp-admin", Quota: quota, Duration: time.Hour}
+	}
+	results := map[string]error{}
+	update := func(id string) {
+		env.UpdateWorkflow("reserve", id, &testsuite.TestUpdateCallback{
+			OnReject:   func(err error) { results[id] = err },
+			OnAccept:   func() {},
+			OnComplete: func(_ any, err error) { results[id] = err },
+		}, reserve(id))
+	}
+
+	env.RegisterDelayedCallback(func() {
+		update("g1")
+		update("g2")
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("release", QuotaRelease{GrantID: "g1"})
+	}, 30*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		update("g3")
+		update("g4")
+	}, time.Hour)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("release", QuotaRelease{GrantID: "g3"})
+	}, 2*time.Hour)
+
+	activities := &Activities{}
+	env.RegisterActivity(activities.CheckWorkflowExists)
+	env.OnActivity("CheckWorkflowExists", mock.Anything, mock.Anything).Return(true, nil)
+
+	env.ExecuteWorkflow(UserQuotaWorkflow, UserQuotaState{Login: "user@example.com"})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	require.NoError(t, results["g1"])
+	require.ErrorContains(t, results["g2"], "maxConcurrentPerUser")
+	require.NoError(t, results["g3"], "slot freed by release")
+	require.ErrorContains(t, results["g4"], "maxConcurrentPerUser")
+}
+
+func TestUserQuotaWorkflow_ExpiresStaleReservation(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	quota := Quota{MaxConcurrentPerUser: 1}
+	results := map[string]error{}
+	update := func(id string) {
+		env.UpdateWorkflow("reserve", id, &testsuite.TestUpdateCallback{
+			OnReject:   func(err error) { results[id] = err },
+			OnAccept:   func() {},
+			OnComplete: func(_ any, err error) { results[id] = err },
+		}, QuotaReservation{GrantID: id, GrantType: "temp-admin", Quota: quota, Duration: 8 * time.Hour})
+	}
+
+	activities := &Activities{}
+	env.RegisterActivity(activities.CheckWorkflowExists)
+	// g1's grant workflow was terminated without releasing its slot.
+	env.OnActivity("CheckWorkflowExists", mock.Anything, "grant-g1").Return(false, nil)
+
+	env.RegisterDelayedCallback(func() { update("g1") }, time.Minute)
+	env.RegisterDelayedCallback(func() { update("g2") }, 30*time.Minute)
+	env.RegisterDelayedCallback(func() { update("g3") }, 3*time.Hour)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("release", QuotaRelease{GrantID: "g3"})
+	}, 4*time.Hour)
+
+	env.ExecuteWorkflow(UserQuotaWorkflow, UserQuotaState{Login: "user@example.com"})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	require.NoError(t, results["g1"])
+	require.ErrorContains(t, results["g2"], "maxConcurrentPerUser")
+	require.NoError(t, results["g3"], "slot freed once g1 was found gone")
+}
+
+func TestUserQuotaWorkflow_ChargesExtension(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	quota := Quota{MaxActiveTime: JSONDuration(3 * time.Hour)}
+	results := map[string]error{}
+	update := func(id string, d time.Duration) {
+		env.UpdateWorkflow("reserve", id, &testsuite.TestUpdateCallback{
+			OnReject:   func(err error) { results[id] = err },
+			OnAccept:   func() {},
+			OnComplete: func(_ any, err error) { results[id] = err },
+		}, QuotaReservation{GrantID: id, GrantType: "temp-admin", Quota: quota, Duration: d})
+	}
+
+	activities := &Activities{}
+	env.RegisterActivity(activities.CheckWorkflowExists)
+	env.OnActivity("CheckWorkflowExists", mock.Anything, mock.Anything).Return(true, nil)
+
+	var start time.Time
+	env.RegisterDelayedCallback(func() {
+		start = env.Now()
+		update("g1", time.Hour)
+		update("g2", time.Hour)
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("extend", QuotaExtension{GrantID: "g1", ExpiresAt: start.Add(2 * time.Hour)})
+	}, 10*time.Minute)
+	env.RegisterDelayedCallback(func() { update("g3", time.Hour) }, 20*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("release", QuotaRelease{GrantID: "g1"})
+		env.SignalWorkflow("release", QuotaRelease{GrantID: "g2"})
+	}, 30*time.Minute)
+
+	env.ExecuteWorkflow(UserQuotaWorkflow, UserQuotaState{Login: "user@example.com"})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	require.NoError(t, results["g1"])
+	require.NoError(t, results["g2"])
+	require.ErrorContains(t, results["g3"], "maxActiveTime", "g1's extension counts against the limit")
+}
+
+func TestGrantWorkflow_ChargesQuotaForExtension(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-quota-extend",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+		Quota:     &Quota{MaxConcurrentPerUser: 1},
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnSignalExternalWorkflow(mock.Anything, QuotaWorkflowID("user@example.com"), "", "release", mock.Anything).Return(nil)
+	var extended QuotaExtension
+	env.OnSignalExternalWorkflow(mock.Anything, QuotaWorkflowID("user@example.com"), "", "extend", mock.Anything).
+		Run(func(args mock.Arguments) { extended = args.Get(4).(QuotaExtension) }).Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("extend", ExtendSignal{
+			ExtendedBy: "user@example.com",
+			Duration:   time.Hour,
+		})
+	}, 10*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, "grant-quota-extend", extended.GrantID)
+	require.True(t, extended.ExpiresAt.Equal(result.ExpiresAt))
+}
+
+func TestGrantWorkflow_ReleasesQuota(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-quota",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+		Quota:     &Quota{MaxConcurrentPerUser: 1},
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	var released QuotaRelease
+	env.OnSignalExternalWorkflow(mock.Anything, QuotaWorkflowID("user@example.com"), "", "release", mock.Anything).
+		Run(func(args mock.Arguments) { released = args.Get(4).(QuotaRelease) }).Return(nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Equal(t, "grant-quota", released.GrantID)
+	require.True(t, released.ActivatedAt.Equal(result.ActivatedAt))
+	require.Equal(t, 30*time.Minute, released.EndedAt.Sub(released.ActivatedAt))
+}
+
+func TestParseQuota(t *testing.T) {
+	q, err := parseQuota(&config.QuotaConfig{MaxConcurrentPerUser: 2, MaxActiveTime: "8h"})
+	require.NoError(t, err)
+	require.Equal(t, &Quota{MaxConcurrentPerUser: 2, MaxActiveTime: JSONDuration(8 * time.Hour)}, q)
+
+	q, err = parseQuota(&config.QuotaConfig{})
+	require.NoError(t, err)
+	require.Nil(t, q, "empty quota should mean no limits")
+
+	tests := []struct {
+		name    string
+		cfg     config.QuotaConfig
+		wantErr string
+	}{
+		{"negative", config.QuotaConfig{MaxConcurrentPerUser: -1}, "negative"},
+		{"bad duration", config.QuotaConfig{MaxActiveTime: "lots"}, "invalid maxActiveTime"},
+		{"window without cap", config.QuotaConfig{ActiveTimeWindow: "168h"}, "requires maxActiveTime"},
+		{"cap exceeds window", config.QuotaConfig{MaxActiveTime: "30h"}, "exceeds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseQuota(&tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
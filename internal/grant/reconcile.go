@@ -2,8 +2,12 @@ package grant
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/rajsinghtech/tailgrant/internal/audit"
+	"github.com/rajsinghtech/tailgrant/internal/tsapi"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
 )
@@ -24,12 +28,30 @@ type ReconciliationInput struct {
 	// GrantPostureKeys is the set of all posture attribute keys that grant types may set.
 	// Only target-device-scoped attributes are reconciled; see limitation note above.
 	GrantPostureKeys []string
+	// KeyExpiry is set when a key_expiry grant type is configured. Devices
+	// with key expiry disabled are then checked for a tag manager whose
+	// restore of the original setting has not gone through.
+	KeyExpiry bool
+	// DeviceAuthorize is set when a device_authorize grant type is
+	// configured. Authorized devices are then checked the same way for a
+	// de-authorization that has not gone through.
+	DeviceAuthorize bool
+	// PolicyGrants is set when a policy_grant grant type is configured.
+	// Grants entries TailGrant marked in the policy file are then checked
+	// against the PolicyEditorWorkflow, and entries it does not keep are
+	// stripped.
+	PolicyGrants bool
 }
 
 func ReconciliationWorkflow(ctx workflow.Context, input ReconciliationInput) error {
 	logger := workflow.GetLogger(ctx)
 	logger.Info("ReconciliationWorkflow started")
 
+	// The worker signals its input with the start; take the latest.
+	configureCh := workflow.GetSignalChannel(ctx, "configure")
+	for configureCh.ReceiveAsync(&input) {
+	}
+
 	grantTagSet := make(map[string]struct{}, len(input.GrantTags))
 	for _, t := range input.GrantTags {
 		grantTagSet[t] = struct{}{}
@@ -47,6 +69,20 @@ func ReconciliationWorkflow(ctx workflow.Context, input ReconciliationInput) err
 		},
 	})
 
+	// Record corrections to the audit log.
+	auditCorrection := func(string, string, map[string]string) {}
+	if workflow.GetVersion(ctx, "audit-events", workflow.DefaultVersion, 1) == 1 {
+		auditCorrection = func(nodeID, reason string, details map[string]string) {
+			recordAudit(ctx, audit.Event{
+				Type:    audit.EventReconciled,
+				Actor:   "reconciler",
+				Targets: []string{nodeID},
+				Reason:  reason,
+				Details: details,
+			})
+		}
+	}
+
 	var activities *Activities
 	var devices []DeviceInfo
 	if err := workflow.ExecuteActivity(actCtx, activities.ListDevices).Get(ctx, &devices); err != nil {
@@ -54,6 +90,21 @@ func ReconciliationWorkflow(ctx workflow.Context, input ReconciliationInput) err
 		return sleepAndContinue(ctx, input)
 	}
 
+	// List the running tag managers once per pass rather than describing
+	// each device's.
+	var running map[string]struct{}
+	if workflow.GetVersion(ctx, "tag-manager-list", workflow.DefaultVersion, 1) == 1 {
+		var ids []string
+		if err := workflow.ExecuteActivity(actCtx, activities.ListRunningTagManagers).Get(ctx, &ids); err != nil {
+			logger.Error("Failed to list tag managers", "error", err)
+			return sleepAndContinue(ctx, input)
+		}
+		running = make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			running[id] = struct{}{}
+		}
+	}
+
 	cleanupCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
 		StartToCloseTimeout: 30 * time.Second,
 		RetryPolicy: &temporal.RetryPolicy{
@@ -82,19 +133,34 @@ func ReconciliationWorkflow(ctx workflow.Context, input ReconciliationInput) err
 			}
 		}
 
-		if !hasGrantTags && !hasGrantPosture {
+		// Key expiry disabled outside TailGrant looks the same, so only a
+		// running tag manager can say whether it should be re-enabled.
+		keyExpiryDisabled := input.KeyExpiry && device.KeyExpiryDisabled
+		authorized := input.DeviceAuthorize && device.Authorized
+
+		if !hasGrantTags && !hasGrantPosture && !keyExpiryDisabled && !authorized {
 			continue
 		}
 
 		tagMgrID := fmt.Sprintf("device-tags-%s", device.NodeID)
 
 		var exists bool
-		if err := workflow.ExecuteActivity(actCtx, activities.CheckWorkflowExists, tagMgrID).Get(ctx, &exists); err != nil {
+		if running != nil {
+			_, exists = running[tagMgrID]
+		} else if err := workflow.ExecuteActivity(actCtx, activities.CheckWorkflowExists, tagMgrID).Get(ctx, &exists); err != nil {
 			logger.Error("Failed to check tag manager workflow", "nodeID", device.NodeID, "error", err)
 			continue
 		}
 
 		if !exists {
+			// Without a tag manager only grant tags and posture attributes
+			// are cleaned up; key expiry and authorization are left alone.
+			if !hasGrantTags && !hasGrantPosture {
+				continue
+			}
+
+			// Visibility lags, and a grant may have activated since the
+			// list; confirm before cleaning up.
 			var existsNow bool
 			if err := workflow.ExecuteActivity(actCtx, activities.CheckWorkflowExists, tagMgrID).Get(ctx, &existsNow); err != nil {
 				logger.Error("Failed to re-check tag manager workflow", "nodeID", device.NodeID, "error", err)
@@ -110,6 +176,8 @@ func ReconciliationWorkflow(ctx workflow.Context, input ReconciliationInput) err
 				logger.Info("Removing stale grant tags", "nodeID", device.NodeID, "staleTags", grantTags)
 				if err := workflow.ExecuteActivity(cleanupCtx, activities.SetDeviceTags, device.NodeID, otherTags).Get(ctx, nil); err != nil {
 					logger.Error("Failed to remove stale tags", "nodeID", device.NodeID, "error", err)
+				} else {
+					auditCorrection(device.NodeID, "removed stale grant tags", map[string]string{"tags": strings.Join(grantTags, ",")})
 				}
 			}
 
@@ -118,6 +186,8 @@ func ReconciliationWorkflow(ctx workflow.Context, input ReconciliationInput) err
 				logger.Info("Removing stale posture attribute", "nodeID", device.NodeID, "key", key)
 				if err := workflow.ExecuteActivity(cleanupCtx, activities.DeletePostureAttribute, device.NodeID, key).Get(ctx, nil); err != nil {
 					logger.Error("Failed to remove stale posture attribute", "nodeID", device.NodeID, "key", key, "error", err)
+				} else {
+					auditCorrection(device.NodeID, "removed stale posture attribute", map[string]string{"postureAttribute": key})
 				}
 			}
 			continue
@@ -161,22 +231,116 @@ func ReconciliationWorkflow(ctx workflow.Context, input ReconciliationInput) err
 			}
 		}
 
-		if tagDrift || postureDrift {
+		// Key expiry should only still be disabled while a grant asks for
+		// it or the device had it disabled before.
+		keyExpiryDrift := false
+		if keyExpiryDisabled && !keyExpiryGranted(activeGrants) {
+			var original *bool
+			if err := workflow.ExecuteActivity(actCtx, activities.QueryOriginalKeyExpiry, tagMgrID).Get(ctx, &original); err != nil {
+				logger.Warn("Failed to query original key expiry", "nodeID", device.NodeID, "error", err)
+			} else {
+				keyExpiryDrift = original != nil && !*original
+			}
+		}
+
+		// Likewise a device should only still be authorized while a grant
+		// authorizes it or it was authorized before.
+		authorizedDrift := false
+		if authorized && !authorizationGranted(activeGrants) {
+			var original *bool
+			if err := workflow.ExecuteActivity(actCtx, activities.QueryOriginalAuthorized, tagMgrID).Get(ctx, &original); err != nil {
+				logger.Warn("Failed to query original authorization", "nodeID", device.NodeID, "error", err)
+			} else {
+				authorizedDrift = original != nil && !*original
+			}
+		}
+
+		if tagDrift || postureDrift || keyExpiryDrift || authorizedDrift {
 			logger.Info("Drift detected, triggering sync",
 				"nodeID", device.NodeID,
 				"tagDrift", tagDrift,
-				"postureDrift", postureDrift)
-			_ = workflow.SignalExternalWorkflow(ctx, tagMgrID, "", "sync", SyncSignal{}).Get(ctx, nil)
+				"postureDrift", postureDrift,
+				"keyExpiryDrift", keyExpiryDrift,
+				"authorizedDrift", authorizedDrift)
+			if err := workflow.SignalExternalWorkflow(ctx, tagMgrID, "", "sync", SyncSignal{}).Get(ctx, nil); err == nil {
+				details := map[string]string{
+					"tagDrift":     strconv.FormatBool(tagDrift),
+					"postureDrift": strconv.FormatBool(postureDrift),
+				}
+				if keyExpiryDrift {
+					details["keyExpiryDrift"] = "true"
+				}
+				if authorizedDrift {
+					details["authorizedDrift"] = "true"
+				}
+				auditCorrection(device.NodeID, "drift detected, tag manager resynced", details)
+			}
 		}
 	}
 
+	if input.PolicyGrants {
+		reconcilePolicyGrants(ctx, actCtx, auditCorrection)
+	}
+
 	return sleepAndContinue(ctx, input)
 }
 
+// reconcilePolicyGrants strips marked grants entries from the policy file
+// that the PolicyEditorWorkflow does not keep, such as those left behind by
+// a grant whose removal never reached the editor. The editor does the
+// stripping, from its own state, so entries of grants activated meanwhile
+// are kept.
+func reconcilePolicyGrants(ctx, actCtx workflow.Context, auditCorrection func(string, string, map[string]string)) {
+	logger := workflow.GetLogger(ctx)
+	var activities *Activities
+
+	var markers []string
+	if err := workflow.ExecuteActivity(actCtx, activities.ListPolicyGrantMarkers).Get(ctx, &markers); err != nil {
+		logger.Error("Failed to list policy grant markers", "error", err)
+		return
+	}
+	if len(markers) == 0 {
+		return
+	}
+
+	var exists bool
+	if err := workflow.ExecuteActivity(actCtx, activities.CheckWorkflowExists, PolicyEditorWorkflowID).Get(ctx, &exists); err != nil {
+		logger.Error("Failed to check policy editor workflow", "error", err)
+		return
+	}
+	var kept map[string]tsapi.PolicyGrant
+	if exists {
+		if err := workflow.ExecuteActivity(actCtx, activities.QueryPolicyGrants).Get(ctx, &kept); err != nil {
+			logger.Warn("Failed to query policy editor", "error", err)
+			return
+		}
+	}
+
+	var orphans []string
+	for _, id := range markers {
+		if _, ok := kept[id]; !ok {
+			orphans = append(orphans, id)
+		}
+	}
+	if len(orphans) == 0 {
+		return
+	}
+
+	logger.Info("Orphaned policy grants found, triggering sync", "grantIDs", orphans)
+	taskQueue := workflow.GetInfo(ctx).TaskQueueName
+	if err := workflow.ExecuteActivity(actCtx, activities.SignalWithStartPolicyEditorSync, taskQueue).Get(ctx, nil); err != nil {
+		logger.Error("Failed to sync policy editor", "error", err)
+		return
+	}
+	auditCorrection(PolicyEditorWorkflowID, "orphaned policy grants found, policy editor resynced", map[string]string{"grantIDs": strings.Join(orphans, ",")})
+}
+
 // DeviceInfo is a minimal projection of device data for reconciliation.
 type DeviceInfo struct {
-	NodeID string   `json:"nodeId"`
-	Tags   []string `json:"tags"`
+	NodeID            string   `json:"nodeId"`
+	Tags              []string `json:"tags"`
+	KeyExpiryDisabled bool     `json:"keyExpiryDisabled"`
+	Authorized        bool     `json:"authorized"`
 }
 
 // partitionTags splits tags into those managed by grants and everything else.
@@ -204,9 +368,29 @@ func tagsMatch(actual []string, expected map[string]struct{}) bool {
 	return true
 }
 
+// sleepAndContinue waits out the interval and continues as new. An input
+// sent with the "configure" signal, as the worker does on startup, replaces
+// the current one from the next pass on.
 func sleepAndContinue(ctx workflow.Context, input ReconciliationInput) error {
-	if err := workflow.Sleep(ctx, reconcileInterval); err != nil {
-		return err
+	configureCh := workflow.GetSignalChannel(ctx, "configure")
+	timer := workflow.NewTimer(ctx, reconcileInterval)
+	var timerErr error
+	for slept := false; !slept; {
+		sel := workflow.NewSelector(ctx)
+		sel.AddFuture(timer, func(f workflow.Future) {
+			timerErr = f.Get(ctx, nil)
+			slept = true
+		})
+		sel.AddReceive(configureCh, func(ch workflow.ReceiveChannel, more bool) {
+			ch.Receive(ctx, &input)
+			workflow.GetLogger(ctx).Info("Reconciliation input updated", "grantTags", input.GrantTags)
+		})
+		sel.Select(ctx)
+	}
+	if timerErr != nil {
+		return timerErr
+	}
+	for configureCh.ReceiveAsync(&input) {
 	}
 	return workflow.NewContinueAsNewError(ctx, ReconciliationWorkflow, input)
 }
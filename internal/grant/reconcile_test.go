@@ -2,10 +2,13 @@ package grant
 
 import (
 	"testing"
+	"time"
 
+	"github.com/rajsinghtech/tailgrant/internal/tsapi"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	tailscale "tailscale.com/client/tailscale/v2"
+	"go.temporal.io/sdk/converter"
 	"go.temporal.io/sdk/testsuite"
 	"go.temporal.io/sdk/workflow"
 )
@@ -18,9 +21,16 @@ func setupReconcileTestEnv() (*testsuite.TestWorkflowEnvironment, *testsuite.Wor
 	env.RegisterActivity(activities.ListDevices)
 	env.RegisterActivity(activities.SetDeviceTags)
 	env.RegisterActivity(activities.CheckWorkflowExists)
+	env.RegisterActivity(activities.ListRunningTagManagers)
 	env.RegisterActivity(activities.QueryActiveGrants)
+	env.RegisterActivity(activities.QueryOriginalKeyExpiry)
+	env.RegisterActivity(activities.QueryOriginalAuthorized)
+	env.RegisterActivity(activities.ListPolicyGrantMarkers)
+	env.RegisterActivity(activities.QueryPolicyGrants)
+	env.RegisterActivity(activities.SignalWithStartPolicyEditorSync)
 	env.RegisterActivity(activities.GetPostureAttributes)
 	env.RegisterActivity(activities.DeletePostureAttribute)
+	env.RegisterActivity(activities.RecordAuditEvent)
 
 	return env, testSuite
 }
@@ -36,7 +46,7 @@ func TestReconciliationWorkflow_StaleOrphanedTags(t *testing.T) {
 
 	env.OnActivity("ListDevices", mock.Anything).Return(devices, nil)
 	env.OnActivity("CheckWorkflowExists", mock.Anything, "device-tags-node-1").Return(false, nil)
-	env.OnActivity("CheckWorkflowExists", mock.Anything, "device-tags-node-3").Return(true, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string{"device-tags-node-3"}, nil)
 	env.OnActivity("SetDeviceTags", mock.Anything, "node-1", []string{"tag:server"}).Return(nil)
 	env.OnActivity("QueryActiveGrants", mock.Anything, "device-tags-node-3").Return(
 		map[string]GrantAssets{"g1": {Tags: []string{"tag:admin-granted"}}}, nil)
@@ -54,6 +64,30 @@ func TestReconciliationWorkflow_StaleOrphanedTags(t *testing.T) {
 	env.AssertExpectations(t)
 }
 
+func TestReconciliationWorkflow_ConfigureSignal(t *testing.T) {
+	env, _ := setupReconcileTestEnv()
+
+	env.OnActivity("ListDevices", mock.Anything).Return([]tailscale.Device{}, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string(nil), nil)
+
+	// A worker started with new grant types hands the running reconciler
+	// its input; the next pass uses it.
+	updated := ReconciliationInput{GrantTags: []string{"tag:ssh-granted", "tag:db-granted"}, KeyExpiry: true}
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("configure", updated)
+	}, time.Minute)
+
+	env.ExecuteWorkflow(ReconciliationWorkflow, ReconciliationInput{GrantTags: []string{"tag:ssh-granted"}})
+
+	require.True(t, env.IsWorkflowCompleted())
+
+	var continueAsNewErr *workflow.ContinueAsNewError
+	require.ErrorAs(t, env.GetWorkflowError(), &continueAsNewErr)
+	var next ReconciliationInput
+	require.NoError(t, converter.GetDefaultDataConverter().FromPayloads(continueAsNewErr.Input, &next))
+	require.Equal(t, updated, next)
+}
+
 func TestReconciliationWorkflow_NoStaleGrantTags(t *testing.T) {
 	env, _ := setupReconcileTestEnv()
 
@@ -63,6 +97,7 @@ func TestReconciliationWorkflow_NoStaleGrantTags(t *testing.T) {
 	}
 
 	env.OnActivity("ListDevices", mock.Anything).Return(devices, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string(nil), nil)
 
 	input := ReconciliationInput{GrantTags: []string{"tag:ssh-granted", "tag:admin-granted"}}
 	env.ExecuteWorkflow(ReconciliationWorkflow, input)
@@ -85,7 +120,7 @@ func TestReconciliationWorkflow_GrantTagsWithActiveManager(t *testing.T) {
 	}
 
 	env.OnActivity("ListDevices", mock.Anything).Return(devices, nil)
-	env.OnActivity("CheckWorkflowExists", mock.Anything, "device-tags-node-managed").Return(true, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string{"device-tags-node-managed"}, nil)
 	env.OnActivity("QueryActiveGrants", mock.Anything, "device-tags-node-managed").Return(
 		map[string]GrantAssets{
 			"g1": {Tags: []string{"tag:ssh-granted"}},
@@ -103,6 +138,31 @@ func TestReconciliationWorkflow_GrantTagsWithActiveManager(t *testing.T) {
 	require.ErrorAs(t, err, &continueAsNewErr)
 
 	env.AssertExpectations(t)
+	env.AssertNotCalled(t, "CheckWorkflowExists", mock.Anything, "device-tags-node-managed")
+}
+
+func TestReconciliationWorkflow_TagManagerNotYetListed(t *testing.T) {
+	env, _ := setupReconcileTestEnv()
+
+	devices := []tailscale.Device{
+		{NodeID: "node-new", Tags: []string{"tag:server", "tag:ssh-granted"}},
+	}
+
+	// The tag manager started after the visibility list was read.
+	env.OnActivity("ListDevices", mock.Anything).Return(devices, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string(nil), nil)
+	env.OnActivity("CheckWorkflowExists", mock.Anything, "device-tags-node-new").Return(true, nil)
+
+	input := ReconciliationInput{GrantTags: []string{"tag:ssh-granted"}}
+	env.ExecuteWorkflow(ReconciliationWorkflow, input)
+
+	require.True(t, env.IsWorkflowCompleted())
+
+	var continueAsNewErr *workflow.ContinueAsNewError
+	require.ErrorAs(t, env.GetWorkflowError(), &continueAsNewErr)
+
+	env.AssertExpectations(t)
+	env.AssertNotCalled(t, "SetDeviceTags", mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestReconciliationWorkflow_MultipleStaleDevices(t *testing.T) {
@@ -115,6 +175,7 @@ func TestReconciliationWorkflow_MultipleStaleDevices(t *testing.T) {
 	}
 
 	env.OnActivity("ListDevices", mock.Anything).Return(devices, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string(nil), nil)
 	env.OnActivity("CheckWorkflowExists", mock.Anything, "device-tags-node-stale-1").Return(false, nil)
 	env.OnActivity("CheckWorkflowExists", mock.Anything, "device-tags-node-stale-2").Return(false, nil)
 	env.OnActivity("SetDeviceTags", mock.Anything, "node-stale-1", []string{"tag:server"}).Return(nil)
@@ -142,6 +203,7 @@ func TestReconciliationWorkflow_StalePostureAttributes(t *testing.T) {
 	}
 
 	env.OnActivity("ListDevices", mock.Anything).Return(devices, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string(nil), nil)
 	env.OnActivity("GetPostureAttributes", mock.Anything, "node-posture").Return(
 		map[string]any{"custom:jit-ssh": "granted", "node:os": "linux"}, nil)
 	env.OnActivity("CheckWorkflowExists", mock.Anything, "device-tags-node-posture").Return(false, nil)
@@ -173,7 +235,7 @@ func TestReconciliationWorkflow_PostureDriftTriggersSync(t *testing.T) {
 	env.OnActivity("ListDevices", mock.Anything).Return(devices, nil)
 	env.OnActivity("GetPostureAttributes", mock.Anything, "node-drift").Return(
 		map[string]any{"custom:jit-ssh": "granted"}, nil)
-	env.OnActivity("CheckWorkflowExists", mock.Anything, "device-tags-node-drift").Return(true, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string{"device-tags-node-drift"}, nil)
 	// Active grants have no target-scoped posture attributes.
 	env.OnActivity("QueryActiveGrants", mock.Anything, "device-tags-node-drift").Return(
 		map[string]GrantAssets{
@@ -208,7 +270,7 @@ func TestReconciliationWorkflow_PostureMatchNoSync(t *testing.T) {
 	env.OnActivity("ListDevices", mock.Anything).Return(devices, nil)
 	env.OnActivity("GetPostureAttributes", mock.Anything, "node-ok").Return(
 		map[string]any{"custom:jit-access": "true"}, nil)
-	env.OnActivity("CheckWorkflowExists", mock.Anything, "device-tags-node-ok").Return(true, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string{"device-tags-node-ok"}, nil)
 	env.OnActivity("QueryActiveGrants", mock.Anything, "device-tags-node-ok").Return(
 		map[string]GrantAssets{
 			"g1": {PostureAttributes: []PostureAttribute{
@@ -230,6 +292,122 @@ func TestReconciliationWorkflow_PostureMatchNoSync(t *testing.T) {
 	env.AssertExpectations(t)
 }
 
+func TestReconciliationWorkflow_KeyExpiryNotRestored(t *testing.T) {
+	env, _ := setupReconcileTestEnv()
+
+	// node-stuck's tag manager failed to re-enable key expiry after its
+	// last grant. node-admin had key expiry disabled before its grant.
+	// node-granted still has an active key_expiry grant, and node-manual
+	// has no tag manager at all.
+	devices := []tailscale.Device{
+		{NodeID: "node-stuck", KeyExpiryDisabled: true},
+		{NodeID: "node-admin", KeyExpiryDisabled: true},
+		{NodeID: "node-granted", KeyExpiryDisabled: true},
+		{NodeID: "node-manual", KeyExpiryDisabled: true},
+		{NodeID: "node-expiring"},
+	}
+	disabled, enabled := true, false
+
+	env.OnActivity("ListDevices", mock.Anything).Return(devices, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string{"device-tags-node-stuck", "device-tags-node-admin", "device-tags-node-granted"}, nil)
+	env.OnActivity("QueryActiveGrants", mock.Anything, "device-tags-node-stuck").Return(map[string]GrantAssets{}, nil)
+	env.OnActivity("QueryActiveGrants", mock.Anything, "device-tags-node-admin").Return(
+		map[string]GrantAssets{"g1": {Tags: []string{"tag:ssh-granted"}}}, nil)
+	env.OnActivity("QueryActiveGrants", mock.Anything, "device-tags-node-granted").Return(
+		map[string]GrantAssets{"g2": {DisableKeyExpiry: true}}, nil)
+	env.OnActivity("QueryOriginalKeyExpiry", mock.Anything, "device-tags-node-stuck").Return(&enabled, nil)
+	env.OnActivity("QueryOriginalKeyExpiry", mock.Anything, "device-tags-node-admin").Return(&disabled, nil)
+	env.OnSignalExternalWorkflow(mock.Anything, "device-tags-node-stuck", "", "sync", mock.Anything).Return(nil).Once()
+
+	env.ExecuteWorkflow(ReconciliationWorkflow, ReconciliationInput{KeyExpiry: true})
+
+	require.True(t, env.IsWorkflowCompleted())
+	err := env.GetWorkflowError()
+	var continueAsNewErr *workflow.ContinueAsNewError
+	require.ErrorAs(t, err, &continueAsNewErr)
+
+	env.AssertExpectations(t)
+	env.AssertNotCalled(t, "CheckWorkflowExists", mock.Anything, "device-tags-node-expiring")
+	// Without a tag manager there is nothing to clean up on node-manual.
+	env.AssertNotCalled(t, "CheckWorkflowExists", mock.Anything, "device-tags-node-manual")
+}
+
+func TestReconciliationWorkflow_StillAuthorized(t *testing.T) {
+	env, _ := setupReconcileTestEnv()
+
+	// node-contractor's grant ended but de-authorizing it failed.
+	// node-laptop was authorized before its grant, node-server was never
+	// granted anything, and node-pending is still awaiting approval.
+	devices := []tailscale.Device{
+		{NodeID: "node-contractor", Authorized: true},
+		{NodeID: "node-laptop", Authorized: true},
+		{NodeID: "node-server", Authorized: true},
+		{NodeID: "node-pending"},
+	}
+	authorized, unauthorized := true, false
+
+	env.OnActivity("ListDevices", mock.Anything).Return(devices, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string{"device-tags-node-contractor", "device-tags-node-laptop"}, nil)
+	env.OnActivity("QueryActiveGrants", mock.Anything, mock.Anything).Return(map[string]GrantAssets{}, nil)
+	env.OnActivity("QueryOriginalAuthorized", mock.Anything, "device-tags-node-contractor").Return(&unauthorized, nil)
+	env.OnActivity("QueryOriginalAuthorized", mock.Anything, "device-tags-node-laptop").Return(&authorized, nil)
+	env.OnSignalExternalWorkflow(mock.Anything, "device-tags-node-contractor", "", "sync", mock.Anything).Return(nil).Once()
+
+	env.ExecuteWorkflow(ReconciliationWorkflow, ReconciliationInput{DeviceAuthorize: true})
+
+	require.True(t, env.IsWorkflowCompleted())
+	err := env.GetWorkflowError()
+	var continueAsNewErr *workflow.ContinueAsNewError
+	require.ErrorAs(t, err, &continueAsNewErr)
+
+	env.AssertExpectations(t)
+	env.AssertNotCalled(t, "CheckWorkflowExists", mock.Anything, "device-tags-node-pending")
+	env.AssertNotCalled(t, "CheckWorkflowExists", mock.Anything, "device-tags-node-server")
+}
+
+func TestReconciliationWorkflow_OrphanedPolicyGrants(t *testing.T) {
+	env, _ := setupReconcileTestEnv()
+
+	// grant-old's removal never reached the editor, which only keeps
+	// grant-live.
+	env.OnActivity("ListDevices", mock.Anything).Return([]tailscale.Device{}, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string(nil), nil)
+	env.OnActivity("ListPolicyGrantMarkers", mock.Anything).Return([]string{"grant-old", "grant-live"}, nil)
+	env.OnActivity("CheckWorkflowExists", mock.Anything, PolicyEditorWorkflowID).Return(true, nil)
+	env.OnActivity("QueryPolicyGrants", mock.Anything).Return(map[string]tsapi.PolicyGrant{
+		"grant-live": {Src: []string{"user@example.com"}, Dst: []string{"100.64.0.5"}, IP: []string{"tcp:22"}},
+	}, nil)
+	env.OnActivity("SignalWithStartPolicyEditorSync", mock.Anything, mock.Anything).Return(nil).Once()
+
+	env.ExecuteWorkflow(ReconciliationWorkflow, ReconciliationInput{PolicyGrants: true})
+
+	require.True(t, env.IsWorkflowCompleted())
+	err := env.GetWorkflowError()
+	var continueAsNewErr *workflow.ContinueAsNewError
+	require.ErrorAs(t, err, &continueAsNewErr)
+
+	env.AssertExpectations(t)
+}
+
+func TestReconciliationWorkflow_PolicyGrantsKept(t *testing.T) {
+	env, _ := setupReconcileTestEnv()
+
+	env.OnActivity("ListDevices", mock.Anything).Return([]tailscale.Device{}, nil)
+	env.OnActivity("ListRunningTagManagers", mock.Anything).Return([]string(nil), nil)
+	env.OnActivity("ListPolicyGrantMarkers", mock.Anything).Return([]string{"grant-live"}, nil)
+	env.OnActivity("CheckWorkflowExists", mock.Anything, PolicyEditorWorkflowID).Return(true, nil)
+	env.OnActivity("QueryPolicyGrants", mock.Anything).Return(map[string]tsapi.PolicyGrant{"grant-live": {}}, nil)
+
+	env.ExecuteWorkflow(ReconciliationWorkflow, ReconciliationInput{PolicyGrants: true})
+
+	require.True(t, env.IsWorkflowCompleted())
+	err := env.GetWorkflowError()
+	var continueAsNewErr *workflow.ContinueAsNewError
+	require.ErrorAs(t, err, &continueAsNewErr)
+
+	env.AssertNotCalled(t, "SignalWithStartPolicyEditorSync", mock.Anything, mock.Anything)
+}
+
 func TestPartitionTags(t *testing.T) {
 	grantTagSet := map[string]struct{}{
 		"tag:ssh-granted":   {},
@@ -0,0 +1,108 @@
+package grant
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/operatorservice/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Custom search attributes GrantWorkflow keeps current, so grants can be
+// listed and filtered with a single visibility query.
+var (
+	SearchAttrRequester = temporal.NewSearchAttributeKeyKeyword("TailgrantRequester")
+	SearchAttrGrantType = temporal.NewSearchAttributeKeyKeyword("TailgrantGrantType")
+	SearchAttrTarget    = temporal.NewSearchAttributeKeyKeywordList("TailgrantTarget")
+	SearchAttrStatus    = temporal.NewSearchAttributeKeyKeyword("TailgrantStatus")
+	SearchAttrExpiresAt = temporal.NewSearchAttributeKeyTime("TailgrantExpiresAt")
+)
+
+// GrantMemoKey is the memo field holding a snapshot of the GrantState, so
+// listings don't need to query each workflow.
+const GrantMemoKey = "grant"
+
+// searchAttributeTypes lists every custom search attribute with its type,
+// for registration.
+var searchAttributeTypes = map[string]enumspb.IndexedValueType{
+	SearchAttrRequester.GetName(): enumspb.INDEXED_VALUE_TYPE_KEYWORD,
+	SearchAttrGrantType.GetName(): enumspb.INDEXED_VALUE_TYPE_KEYWORD,
+	SearchAttrTarget.GetName():    enumspb.INDEXED_VALUE_TYPE_KEYWORD_LIST,
+	SearchAttrStatus.GetName():    enumspb.INDEXED_VALUE_TYPE_KEYWORD,
+	SearchAttrExpiresAt.GetName(): enumspb.INDEXED_VALUE_TYPE_DATETIME,
+}
+
+// EnsureSearchAttributes registers any of TailGrant's custom search
+// attributes missing from the namespace. GrantWorkflow cannot make
+// progress if they are not registered.
+func EnsureSearchAttributes(ctx context.Context, c client.Client, namespace string) error {
+	resp, err := c.OperatorService().ListSearchAttributes(ctx, &operatorservice.ListSearchAttributesRequest{
+		Namespace: namespace,
+	})
+	if err != nil {
+		return fmt.Errorf("list search attributes: %w", err)
+	}
+	missing := make(map[string]enumspb.IndexedValueType)
+	for name, typ := range searchAttributeTypes {
+		if _, ok := resp.CustomAttributes[name]; !ok {
+			missing[name] = typ
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if _, err := c.OperatorService().AddSearchAttributes(ctx, &operatorservice.AddSearchAttributesRequest{
+		Namespace:        namespace,
+		SearchAttributes: missing,
+	}); err != nil {
+		return fmt.Errorf("add search attributes: %w", err)
+	}
+	return nil
+}
+
+// GrantTargets returns the values indexed as TailgrantTarget: the target
+// user, the requested or resolved devices, and the target tag.
+func GrantTargets(state GrantState) []string {
+	var targets []string
+	add := func(v string) {
+		if v != "" && !slices.Contains(targets, v) {
+			targets = append(targets, v)
+		}
+	}
+	add(state.Request.TargetUserID)
+	add(state.Request.TargetTag)
+	for _, id := range state.Request.NodeIDs() {
+		add(id)
+	}
+	for _, t := range state.Targets {
+		add(t.NodeID)
+	}
+	return targets
+}
+
+// publishState upserts the grant's search attributes and memo. Failures
+// are logged rather than returned; the status query stays authoritative.
+func publishState(ctx workflow.Context, state GrantState) {
+	logger := workflow.GetLogger(ctx)
+	updates := []temporal.SearchAttributeUpdate{
+		SearchAttrRequester.ValueSet(state.Request.Requester),
+		SearchAttrGrantType.ValueSet(state.Request.GrantTypeName),
+		SearchAttrTarget.ValueSet(GrantTargets(state)),
+		SearchAttrStatus.ValueSet(string(state.Status)),
+	}
+	if state.ExpiresAt.IsZero() {
+		updates = append(updates, SearchAttrExpiresAt.ValueUnset())
+	} else {
+		updates = append(updates, SearchAttrExpiresAt.ValueSet(state.ExpiresAt))
+	}
+	if err := workflow.UpsertTypedSearchAttributes(ctx, updates...); err != nil {
+		logger.Error("Failed to upsert search attributes", "grantID", state.Request.ID, "error", err)
+	}
+	if err := workflow.UpsertMemo(ctx, map[string]any{GrantMemoKey: state}); err != nil {
+		logger.Error("Failed to upsert memo", "grantID", state.Request.ID, "error", err)
+	}
+}
@@ -0,0 +1,90 @@
+package grant
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+)
+
+func TestGrantTargets(t *testing.T) {
+	tests := []struct {
+		name  string
+		state GrantState
+		want  []string
+	}{
+		{"user grant", GrantState{Request: GrantRequest{TargetUserID: "user-1"}}, []string{"user-1"}},
+		{"single device", GrantState{Request: GrantRequest{TargetNodeID: "node-1"}}, []string{"node-1"}},
+		{"device list", GrantState{Request: GrantRequest{TargetNodeIDs: []string{"node-1", "node-2"}}}, []string{"node-1", "node-2"}},
+		{"tag with resolved devices", GrantState{
+			Request: GrantRequest{TargetTag: "tag:web"},
+			Targets: []TargetStatus{{NodeID: "node-1"}, {NodeID: "node-2"}},
+		}, []string{"tag:web", "node-1", "node-2"}},
+		{"no duplicates", GrantState{
+			Request: GrantRequest{TargetNodeID: "node-1"},
+			Targets: []TargetStatus{{NodeID: "node-1"}},
+		}, []string{"node-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, GrantTargets(tt.state))
+		})
+	}
+}
+
+func TestGrantWorkflow_PublishesState(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:            "grant-search",
+		Requester:     "user@example.com",
+		GrantTypeName: "high-risk-access",
+		TargetNodeID:  "node-456",
+		Duration:      30 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:      "high-risk-access",
+		Tags:      []string{"tag:jit-admin"},
+		RiskLevel: RiskHigh,
+		Approvers: []string{"approver@example.com"},
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	var statuses []GrantStatus
+	env.OnUpsertMemo(mock.Anything).Run(func(args mock.Arguments) {
+		state := args.Get(0).(map[string]interface{})[GrantMemoKey].(GrantState)
+		if len(statuses) == 0 || statuses[len(statuses)-1] != state.Status {
+			statuses = append(statuses, state.Status)
+		}
+	}).Return(nil)
+	var last temporal.SearchAttributes
+	env.OnUpsertTypedSearchAttributes(mock.Anything).Run(func(args mock.Arguments) {
+		last = args.Get(0).(temporal.SearchAttributes)
+	}).Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflowByID("approval-grant-search", "approve", ApproveSignal{ApprovedBy: "approver@example.com"})
+	}, time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	require.Equal(t, []GrantStatus{StatusPendingApproval, StatusActive, StatusExpired}, statuses)
+
+	status, _ := last.GetKeyword(SearchAttrStatus)
+	require.Equal(t, string(StatusExpired), status)
+	requester, _ := last.GetKeyword(SearchAttrRequester)
+	require.Equal(t, "user@example.com", requester)
+	grantTypeName, _ := last.GetKeyword(SearchAttrGrantType)
+	require.Equal(t, "high-risk-access", grantTypeName)
+	targets, _ := last.GetKeywordList(SearchAttrTarget)
+	require.Equal(t, []string{"node-456"}, targets)
+	_, hasExpiry := last.GetTime(SearchAttrExpiresAt)
+	require.True(t, hasExpiry)
+}
@@ -0,0 +1,64 @@
+package grant
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rajsinghtech/tailgrant/internal/notify"
+	"go.temporal.io/sdk/activity"
+)
+
+// PostApprovalMessage posts an approval request with Approve and Deny
+// buttons to Slack. It returns nil when Slack is not configured.
+func (a *Activities) PostApprovalMessage(ctx context.Context, msg notify.ApprovalMessage) (*notify.SlackMessage, error) {
+	if a.Slack == nil {
+		return nil, nil
+	}
+	a.describeGrant(ctx, &msg)
+	m, err := a.Slack.PostApproval(ctx, msg)
+	if err != nil {
+		return nil, fmt.Errorf("post approval message for %s: %w", msg.GrantID, err)
+	}
+	return &m, nil
+}
+
+// UpdateApprovalMessage rewrites a posted approval request in place with
+// its progress or outcome.
+func (a *Activities) UpdateApprovalMessage(ctx context.Context, m notify.SlackMessage, msg notify.ApprovalMessage) error {
+	if a.Slack == nil {
+		return nil
+	}
+	a.describeGrant(ctx, &msg)
+	if err := a.Slack.UpdateApproval(ctx, m, msg); err != nil {
+		return fmt.Errorf("update approval message for %s: %w", msg.GrantID, err)
+	}
+	return nil
+}
+
+// describeGrant adds the request details approvers need to msg from the
+// grant's status query. ApprovalWorkflow only knows the grant's ID, type
+// and requester; if the query fails the message goes out without them.
+func (a *Activities) describeGrant(ctx context.Context, msg *notify.ApprovalMessage) {
+	if a.Temporal == nil {
+		return
+	}
+	resp, err := a.Temporal.QueryWorkflow(ctx, fmt.Sprintf("grant-%s", msg.GrantID), "", "status")
+	var state GrantState
+	if err == nil {
+		err = resp.Get(&state)
+	}
+	if err != nil {
+		activity.GetLogger(ctx).Warn("Failed to query grant for approval message", "grantID", msg.GrantID, "error", err)
+		return
+	}
+	msg.Reason = state.Request.Reason
+	msg.Duration = state.Request.Duration.String()
+	msg.Targets = GrantTargets(state)
+	if r := state.Renewal; r != nil {
+		msg.Reason = "Renewal"
+		if r.Reason != "" {
+			msg.Reason += ": " + r.Reason
+		}
+		msg.Duration = r.Duration.String()
+	}
+}
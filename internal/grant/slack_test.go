@@ -0,0 +1,85 @@
+package grant
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/notify"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestApprovalWorkflow_SlackMessage(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+	captureNotifications(env)
+
+	grantType := GrantType{
+		Name:              "prod-db",
+		RiskLevel:         RiskHigh,
+		Approvers:         []string{"a@example.com", "b@example.com"},
+		RequiredApprovals: 2,
+	}
+	posted := &notify.SlackMessage{Channel: "C42", TS: "1750000000.000100"}
+
+	var first notify.ApprovalMessage
+	env.OnActivity("PostApprovalMessage", mock.Anything, mock.Anything).Return(
+		func(_ context.Context, msg notify.ApprovalMessage) (*notify.SlackMessage, error) {
+			first = msg
+			return posted, nil
+		})
+	var updates []notify.ApprovalMessage
+	env.OnActivity("UpdateApprovalMessage", mock.Anything, *posted, mock.Anything).Return(
+		func(_ context.Context, _ notify.SlackMessage, msg notify.ApprovalMessage) error {
+			updates = append(updates, msg)
+			return nil
+		})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "a@example.com"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approve", ApproveSignal{ApprovedBy: "b@example.com"})
+	}, 2*time.Minute)
+
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-1", grantType, "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.Equal(t, "grant-1", first.GrantID)
+	require.Equal(t, "user@example.com", first.Requester)
+	require.Equal(t, 2, first.Required)
+	require.Empty(t, first.Outcome)
+
+	// One update for the partial approval, one for the outcome.
+	require.Len(t, updates, 2)
+	require.Equal(t, []string{"a@example.com"}, updates[0].Approvals)
+	require.Empty(t, updates[0].Outcome)
+	require.Equal(t, notify.OutcomeApproved, updates[1].Outcome)
+	require.Equal(t, "b@example.com", updates[1].DecidedBy)
+}
+
+func TestApprovalWorkflow_SlackMessageTimedOut(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	registerNotifications(env)
+	captureNotifications(env)
+
+	posted := &notify.SlackMessage{Channel: "C42", TS: "1750000000.000100"}
+	env.OnActivity("PostApprovalMessage", mock.Anything, mock.Anything).Return(posted, nil)
+	var final notify.ApprovalMessage
+	env.OnActivity("UpdateApprovalMessage", mock.Anything, *posted, mock.Anything).Return(
+		func(_ context.Context, _ notify.SlackMessage, msg notify.ApprovalMessage) error {
+			final = msg
+			return nil
+		})
+
+	grantType := GrantType{Name: "prod-db", RiskLevel: RiskHigh, Approvers: []string{"a@example.com"}}
+	env.ExecuteWorkflow(ApprovalWorkflow, "grant-1", grantType, "user@example.com", "")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.Equal(t, notify.OutcomeTimedOut, final.Outcome)
+}
@@ -2,12 +2,14 @@ package grant
 
 import (
 	"fmt"
+	"slices"
 	"sort"
 	"time"
 
 	"go.temporal.io/sdk/log"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
+	tailscale "tailscale.com/client/tailscale/v2"
 )
 
 const tagManagerContinueAsNewThreshold = 1000
@@ -18,6 +20,19 @@ const tagManagerContinueAsNewThreshold = 1000
 type DeviceTagManagerState struct {
 	NodeID       string
 	ActiveGrants map[string]GrantAssets
+	// OriginalRoutes are the routes enabled on the device before the first
+	// routes grant, restored once the last one is removed. It is nil while
+	// no routes grant is active.
+	OriginalRoutes []string
+	// OriginalKeyExpiryDisabled is the device's key expiry setting before
+	// the first key_expiry grant, restored once the last one is removed. It
+	// stays set until the restore succeeds, keeping the workflow running so
+	// reconciliation can retry it with a sync.
+	OriginalKeyExpiryDisabled *bool
+	// OriginalAuthorized is whether the device was authorized before the
+	// first device_authorize grant. Like OriginalKeyExpiryDisabled, it
+	// stays set until the restore succeeds.
+	OriginalAuthorized *bool
 }
 
 func DeviceTagManagerWorkflow(ctx workflow.Context, state DeviceTagManagerState) error {
@@ -33,6 +48,21 @@ func DeviceTagManagerWorkflow(ctx workflow.Context, state DeviceTagManagerState)
 	}); err != nil {
 		return fmt.Errorf("register active-grants query: %w", err)
 	}
+	if err := workflow.SetQueryHandler(ctx, "original-routes", func() ([]string, error) {
+		return state.OriginalRoutes, nil
+	}); err != nil {
+		return fmt.Errorf("register original-routes query: %w", err)
+	}
+	if err := workflow.SetQueryHandler(ctx, "original-key-expiry", func() (*bool, error) {
+		return state.OriginalKeyExpiryDisabled, nil
+	}); err != nil {
+		return fmt.Errorf("register original-key-expiry query: %w", err)
+	}
+	if err := workflow.SetQueryHandler(ctx, "original-authorized", func() (*bool, error) {
+		return state.OriginalAuthorized, nil
+	}); err != nil {
+		return fmt.Errorf("register original-authorized query: %w", err)
+	}
 
 	actCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
 		StartToCloseTimeout: 30 * time.Second,
@@ -60,6 +90,9 @@ func DeviceTagManagerWorkflow(ctx workflow.Context, state DeviceTagManagerState)
 				Tags:              sig.Tags,
 				PostureAttributes: sig.PostureAttributes,
 				RequesterNodeID:   sig.RequesterNodeID,
+				Routes:            sig.Routes,
+				DisableKeyExpiry:  sig.DisableKeyExpiry,
+				Authorize:         sig.Authorize,
 			}
 
 			if err := applyTags(ctx, actCtx, activities, state, nil, logger); err != nil {
@@ -68,6 +101,15 @@ func DeviceTagManagerWorkflow(ctx workflow.Context, state DeviceTagManagerState)
 			if err := applyPostureAttributes(ctx, actCtx, activities, state.NodeID, sig.PostureAttributes, sig.RequesterNodeID, logger); err != nil {
 				logger.Error("Failed to set posture attributes after add", "nodeID", state.NodeID, "grantID", sig.GrantID, "error", err)
 			}
+			if err := applyRoutes(ctx, actCtx, activities, &state); err != nil {
+				logger.Error("Failed to enable routes after add", "nodeID", state.NodeID, "grantID", sig.GrantID, "error", err)
+			}
+			if err := applyKeyExpiry(ctx, actCtx, activities, &state); err != nil {
+				logger.Error("Failed to disable key expiry after add", "nodeID", state.NodeID, "grantID", sig.GrantID, "error", err)
+			}
+			if err := applyAuthorization(ctx, actCtx, activities, &state); err != nil {
+				logger.Error("Failed to authorize device after add", "nodeID", state.NodeID, "grantID", sig.GrantID, "error", err)
+			}
 		})
 
 		sel.AddReceive(removeCh, func(ch workflow.ReceiveChannel, more bool) {
@@ -86,6 +128,15 @@ func DeviceTagManagerWorkflow(ctx workflow.Context, state DeviceTagManagerState)
 			if err := removePostureAttributes(ctx, actCtx, activities, state.NodeID, orphaned, assets.RequesterNodeID, logger); err != nil {
 				logger.Error("Failed to delete posture attributes after remove", "nodeID", state.NodeID, "grantID", sig.GrantID, "error", err)
 			}
+			if err := applyRoutes(ctx, actCtx, activities, &state); err != nil {
+				logger.Error("Failed to restore routes after remove", "nodeID", state.NodeID, "grantID", sig.GrantID, "error", err)
+			}
+			if err := applyKeyExpiry(ctx, actCtx, activities, &state); err != nil {
+				logger.Error("Failed to restore key expiry after remove", "nodeID", state.NodeID, "grantID", sig.GrantID, "error", err)
+			}
+			if err := applyAuthorization(ctx, actCtx, activities, &state); err != nil {
+				logger.Error("Failed to restore authorization after remove", "nodeID", state.NodeID, "grantID", sig.GrantID, "error", err)
+			}
 		})
 
 		sel.AddReceive(syncCh, func(ch workflow.ReceiveChannel, more bool) {
@@ -99,12 +150,23 @@ func DeviceTagManagerWorkflow(ctx workflow.Context, state DeviceTagManagerState)
 			if err := syncPostureAttributes(ctx, actCtx, activities, state, logger); err != nil {
 				logger.Error("Failed to sync posture attributes", "nodeID", state.NodeID, "error", err)
 			}
-			logger.Info("Tags and posture attributes resynced via reconciliation", "nodeID", state.NodeID)
+			if err := applyRoutes(ctx, actCtx, activities, &state); err != nil {
+				logger.Error("Failed to sync routes", "nodeID", state.NodeID, "error", err)
+			}
+			if err := applyKeyExpiry(ctx, actCtx, activities, &state); err != nil {
+				logger.Error("Failed to sync key expiry", "nodeID", state.NodeID, "error", err)
+			}
+			if err := applyAuthorization(ctx, actCtx, activities, &state); err != nil {
+				logger.Error("Failed to sync authorization", "nodeID", state.NodeID, "error", err)
+			}
+			logger.Info("Device settings resynced via reconciliation", "nodeID", state.NodeID)
 		})
 
 		sel.Select(ctx)
 
-		if len(state.ActiveGrants) == 0 {
+		// A routes, key expiry or authorization restore that failed keeps
+		// the workflow open for the reconciler's next sync.
+		if len(state.ActiveGrants) == 0 && state.OriginalRoutes == nil && state.OriginalKeyExpiryDisabled == nil && state.OriginalAuthorized == nil {
 			logger.Info("No active grants remaining, completing", "nodeID", state.NodeID)
 			return nil
 		}
@@ -174,6 +236,131 @@ func computeDesiredTags(currentTags []string, activeGrants map[string]GrantAsset
 	return result
 }
 
+// applyRoutes enables the device's original routes plus those of every
+// active grant. The original routes are recorded before the first routes
+// grant changes them, and restored exactly once no active grant has routes.
+func applyRoutes(ctx workflow.Context, actCtx workflow.Context, activities *Activities, state *DeviceTagManagerState) error {
+	granted := grantedRoutes(state.ActiveGrants)
+	if len(granted) == 0 && state.OriginalRoutes == nil {
+		return nil
+	}
+
+	if state.OriginalRoutes == nil {
+		var routes tailscale.DeviceRoutes
+		if err := workflow.ExecuteActivity(actCtx, activities.GetDeviceRoutes, state.NodeID).Get(ctx, &routes); err != nil {
+			return fmt.Errorf("get current routes for %s: %w", state.NodeID, err)
+		}
+		// Non-nil even when empty, so the baseline counts as recorded.
+		state.OriginalRoutes = append([]string{}, routes.Enabled...)
+	}
+
+	if len(granted) == 0 {
+		if err := workflow.ExecuteActivity(actCtx, activities.SetDeviceRoutes, state.NodeID, state.OriginalRoutes).Get(ctx, nil); err != nil {
+			return fmt.Errorf("restore routes for %s: %w", state.NodeID, err)
+		}
+		state.OriginalRoutes = nil
+		return nil
+	}
+
+	desired := slices.Clone(state.OriginalRoutes)
+	for _, r := range granted {
+		if !slices.Contains(desired, r) {
+			desired = append(desired, r)
+		}
+	}
+	sort.Strings(desired)
+	if err := workflow.ExecuteActivity(actCtx, activities.SetDeviceRoutes, state.NodeID, desired).Get(ctx, nil); err != nil {
+		return fmt.Errorf("set routes for %s: %w", state.NodeID, err)
+	}
+	return nil
+}
+
+// applyKeyExpiry disables key expiry on the device while any active grant
+// asks for it. The setting from before the first such grant is recorded and
+// restored once none remain.
+func applyKeyExpiry(ctx workflow.Context, actCtx workflow.Context, activities *Activities, state *DeviceTagManagerState) error {
+	granted := keyExpiryGranted(state.ActiveGrants)
+	if !granted && state.OriginalKeyExpiryDisabled == nil {
+		return nil
+	}
+
+	if state.OriginalKeyExpiryDisabled == nil {
+		var device tailscale.Device
+		if err := workflow.ExecuteActivity(actCtx, activities.GetDevice, state.NodeID).Get(ctx, &device); err != nil {
+			return fmt.Errorf("get key expiry for %s: %w", state.NodeID, err)
+		}
+		state.OriginalKeyExpiryDisabled = &device.KeyExpiryDisabled
+	}
+
+	disabled := granted || *state.OriginalKeyExpiryDisabled
+	if err := workflow.ExecuteActivity(actCtx, activities.SetDeviceKeyExpiryDisabled, state.NodeID, disabled).Get(ctx, nil); err != nil {
+		return fmt.Errorf("set key expiry for %s: %w", state.NodeID, err)
+	}
+	if !granted {
+		state.OriginalKeyExpiryDisabled = nil
+	}
+	return nil
+}
+
+// keyExpiryGranted reports whether any active grant disables key expiry.
+func keyExpiryGranted(activeGrants map[string]GrantAssets) bool {
+	for _, assets := range activeGrants {
+		if assets.DisableKeyExpiry {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAuthorization authorizes the device while any active grant asks for
+// it. Whether it was authorized before the first such grant is recorded and
+// restored once none remain.
+func applyAuthorization(ctx workflow.Context, actCtx workflow.Context, activities *Activities, state *DeviceTagManagerState) error {
+	granted := authorizationGranted(state.ActiveGrants)
+	if !granted && state.OriginalAuthorized == nil {
+		return nil
+	}
+
+	if state.OriginalAuthorized == nil {
+		var device tailscale.Device
+		if err := workflow.ExecuteActivity(actCtx, activities.GetDevice, state.NodeID).Get(ctx, &device); err != nil {
+			return fmt.Errorf("get authorization for %s: %w", state.NodeID, err)
+		}
+		state.OriginalAuthorized = &device.Authorized
+	}
+
+	authorized := granted || *state.OriginalAuthorized
+	if err := workflow.ExecuteActivity(actCtx, activities.SetDeviceAuthorized, state.NodeID, authorized).Get(ctx, nil); err != nil {
+		return fmt.Errorf("set authorized for %s: %w", state.NodeID, err)
+	}
+	if !granted {
+		state.OriginalAuthorized = nil
+	}
+	return nil
+}
+
+// authorizationGranted reports whether any active grant authorizes the
+// device.
+func authorizationGranted(activeGrants map[string]GrantAssets) bool {
+	for _, assets := range activeGrants {
+		if assets.Authorize {
+			return true
+		}
+	}
+	return false
+}
+
+// grantedRoutes returns the routes of every active grant, sorted and
+// without duplicates.
+func grantedRoutes(activeGrants map[string]GrantAssets) []string {
+	var routes []string
+	for _, assets := range activeGrants {
+		routes = append(routes, assets.Routes...)
+	}
+	sort.Strings(routes)
+	return slices.Compact(routes)
+}
+
 // resolvePostureTarget determines which device a posture attribute should be set on.
 func resolvePostureTarget(targetNodeID string, pa PostureAttribute, requesterNodeID string) string {
 	if pa.Target == "target" {
@@ -1,11 +1,15 @@
 package grant
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.temporal.io/sdk/testsuite"
+	tailscale "tailscale.com/client/tailscale/v2"
 )
 
 func setupTagManagerTestEnv() (*testsuite.TestWorkflowEnvironment, *testsuite.WorkflowTestSuite) {
@@ -17,6 +21,11 @@ func setupTagManagerTestEnv() (*testsuite.TestWorkflowEnvironment, *testsuite.Wo
 	env.RegisterActivity(activities.SetDeviceTags)
 	env.RegisterActivity(activities.SetPostureAttribute)
 	env.RegisterActivity(activities.DeletePostureAttribute)
+	env.RegisterActivity(activities.GetDeviceRoutes)
+	env.RegisterActivity(activities.SetDeviceRoutes)
+	env.RegisterActivity(activities.GetDevice)
+	env.RegisterActivity(activities.SetDeviceKeyExpiryDisabled)
+	env.RegisterActivity(activities.SetDeviceAuthorized)
 
 	return env, testSuite
 }
@@ -402,3 +411,196 @@ func TestOrphanedPostureAttributes(t *testing.T) {
 		require.Len(t, orphaned, 2)
 	})
 }
+
+func TestDeviceTagManager_Routes(t *testing.T) {
+	env, _ := setupTagManagerTestEnv()
+
+	state := DeviceTagManagerState{
+		NodeID:       "node-router",
+		ActiveGrants: make(map[string]GrantAssets),
+	}
+
+	// The device already has one of the granted routes enabled.
+	env.OnActivity("GetDeviceRoutes", mock.Anything, "node-router").Return(&tailscale.DeviceRoutes{
+		Advertised: []string{"10.0.0.0/24", "10.1.0.0/24", "0.0.0.0/0", "::/0"},
+		Enabled:    []string{"10.0.0.0/24"},
+	}, nil).Once()
+	var set [][]string
+	env.OnActivity("SetDeviceRoutes", mock.Anything, "node-router", mock.Anything).Return(
+		func(_ context.Context, _ string, routes []string) error {
+			set = append(set, routes)
+			return nil
+		})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-grant", AddGrantSignal{GrantID: "grant-1", Routes: []string{"10.0.0.0/24", "10.1.0.0/24"}})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-grant", AddGrantSignal{GrantID: "grant-2", Routes: []string{"0.0.0.0/0", "::/0"}})
+	}, 2*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-grant", RemoveGrantSignal{GrantID: "grant-1"})
+	}, 3*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-grant", RemoveGrantSignal{GrantID: "grant-2"})
+	}, 4*time.Minute)
+
+	env.ExecuteWorkflow(DeviceTagManagerWorkflow, state)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.Equal(t, [][]string{
+		{"10.0.0.0/24", "10.1.0.0/24"},
+		{"0.0.0.0/0", "10.0.0.0/24", "10.1.0.0/24", "::/0"},
+		// The originally enabled route stays when grant-1 is removed.
+		{"0.0.0.0/0", "10.0.0.0/24", "::/0"},
+		{"10.0.0.0/24"},
+	}, set)
+	env.AssertNotCalled(t, "GetDeviceTags", mock.Anything, mock.Anything)
+}
+
+func TestDeviceTagManager_RoutesRestoreRetriedOnSync(t *testing.T) {
+	env, _ := setupTagManagerTestEnv()
+
+	state := DeviceTagManagerState{
+		NodeID:       "node-router",
+		ActiveGrants: make(map[string]GrantAssets),
+	}
+
+	env.OnActivity("GetDeviceRoutes", mock.Anything, "node-router").Return(&tailscale.DeviceRoutes{
+		Advertised: []string{"10.0.0.0/24", "10.1.0.0/24"},
+		Enabled:    []string{"10.0.0.0/24"},
+	}, nil).Once()
+	env.OnActivity("SetDeviceRoutes", mock.Anything, "node-router", []string{"10.0.0.0/24", "10.1.0.0/24"}).Return(nil)
+	restore := env.OnActivity("SetDeviceRoutes", mock.Anything, "node-router", []string{"10.0.0.0/24"}).Return(errors.New("api unavailable"))
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-grant", AddGrantSignal{GrantID: "grant-1", Routes: []string{"10.1.0.0/24"}})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-grant", RemoveGrantSignal{GrantID: "grant-1"})
+	}, 2*time.Minute)
+	var pending []string
+	env.RegisterDelayedCallback(func() {
+		v, err := env.QueryWorkflow("original-routes")
+		require.NoError(t, err)
+		require.NoError(t, v.Get(&pending))
+		restore.Return(nil)
+		env.SignalWorkflow("sync", SyncSignal{})
+	}, time.Hour)
+
+	env.ExecuteWorkflow(DeviceTagManagerWorkflow, state)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.Equal(t, []string{"10.0.0.0/24"}, pending)
+}
+
+func TestDeviceTagManager_KeyExpiry(t *testing.T) {
+	env, _ := setupTagManagerTestEnv()
+
+	state := DeviceTagManagerState{
+		NodeID:       "node-build",
+		ActiveGrants: make(map[string]GrantAssets),
+	}
+
+	env.OnActivity("GetDevice", mock.Anything, "node-build").Return(&tailscale.Device{NodeID: "node-build"}, nil).Once()
+	var set []bool
+	env.OnActivity("SetDeviceKeyExpiryDisabled", mock.Anything, "node-build", mock.Anything).Return(
+		func(_ context.Context, _ string, disabled bool) error {
+			set = append(set, disabled)
+			return nil
+		})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-grant", AddGrantSignal{GrantID: "grant-1", DisableKeyExpiry: true})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-grant", AddGrantSignal{GrantID: "grant-2", DisableKeyExpiry: true})
+	}, 2*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-grant", RemoveGrantSignal{GrantID: "grant-1"})
+	}, 3*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-grant", RemoveGrantSignal{GrantID: "grant-2"})
+	}, 4*time.Minute)
+
+	env.ExecuteWorkflow(DeviceTagManagerWorkflow, state)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	// Key expiry stays disabled until the last grant is removed.
+	require.Equal(t, []bool{true, true, true, false}, set)
+}
+
+func TestDeviceTagManager_KeyExpiryRestoreRetriedOnSync(t *testing.T) {
+	env, _ := setupTagManagerTestEnv()
+
+	state := DeviceTagManagerState{
+		NodeID:       "node-build",
+		ActiveGrants: make(map[string]GrantAssets),
+	}
+
+	env.OnActivity("GetDevice", mock.Anything, "node-build").Return(&tailscale.Device{NodeID: "node-build"}, nil)
+	env.OnActivity("SetDeviceKeyExpiryDisabled", mock.Anything, "node-build", true).Return(nil)
+	restore := env.OnActivity("SetDeviceKeyExpiryDisabled", mock.Anything, "node-build", false).Return(errors.New("api unavailable"))
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-grant", AddGrantSignal{GrantID: "grant-1", DisableKeyExpiry: true})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-grant", RemoveGrantSignal{GrantID: "grant-1"})
+	}, 2*time.Minute)
+	var pending *bool
+	env.RegisterDelayedCallback(func() {
+		v, err := env.QueryWorkflow("original-key-expiry")
+		require.NoError(t, err)
+		require.NoError(t, v.Get(&pending))
+		restore.Return(nil)
+		env.SignalWorkflow("sync", SyncSignal{})
+	}, time.Hour)
+
+	env.ExecuteWorkflow(DeviceTagManagerWorkflow, state)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.NotNil(t, pending)
+	require.False(t, *pending)
+}
+
+func TestDeviceTagManager_DeviceAuthorize(t *testing.T) {
+	env, _ := setupTagManagerTestEnv()
+
+	state := DeviceTagManagerState{
+		NodeID:       "node-contractor",
+		ActiveGrants: make(map[string]GrantAssets),
+	}
+
+	env.OnActivity("GetDevice", mock.Anything, "node-contractor").Return(&tailscale.Device{NodeID: "node-contractor"}, nil).Once()
+	env.OnActivity("SetDeviceAuthorized", mock.Anything, "node-contractor", true).Return(nil).Once()
+	deauthorize := env.OnActivity("SetDeviceAuthorized", mock.Anything, "node-contractor", false).Return(errors.New("api unavailable"))
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add-grant", AddGrantSignal{GrantID: "grant-1", Authorize: true})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("remove-grant", RemoveGrantSignal{GrantID: "grant-1"})
+	}, 2*time.Minute)
+	var pending *bool
+	env.RegisterDelayedCallback(func() {
+		v, err := env.QueryWorkflow("original-authorized")
+		require.NoError(t, err)
+		require.NoError(t, v.Get(&pending))
+		deauthorize.Return(nil)
+		env.SignalWorkflow("sync", SyncSignal{})
+	}, time.Hour)
+
+	env.ExecuteWorkflow(DeviceTagManagerWorkflow, state)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	// The failed de-authorization kept the workflow open until the sync.
+	require.NotNil(t, pending)
+	require.False(t, *pending)
+	env.AssertExpectations(t)
+}
@@ -0,0 +1,67 @@
+package grant
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+	tailscale "tailscale.com/client/tailscale/v2"
+)
+
+// TargetSelector restricts which devices a tag grant may be applied to.
+// Every non-empty criterion must match; within a criterion any entry may
+// match.
+type TargetSelector struct {
+	Tags           []string `json:"tags,omitempty"`
+	Hostnames      []string `json:"hostnames,omitempty"` // path.Match globs, e.g. "db-*"
+	OS             []string `json:"os,omitempty"`
+	RequesterOwned bool     `json:"requesterOwned,omitempty"`
+}
+
+// Check reports why dev is not a valid target for a grant requested by
+// requester, or nil if it is.
+func (s *TargetSelector) Check(dev *tailscale.Device, requester string) error {
+	if s == nil {
+		return nil
+	}
+	if len(s.Tags) > 0 && !slices.ContainsFunc(dev.Tags, func(t string) bool { return slices.Contains(s.Tags, t) }) {
+		return fmt.Errorf("device %s has none of the allowed tags %v", dev.Hostname, s.Tags)
+	}
+	if len(s.Hostnames) > 0 && !slices.ContainsFunc(s.Hostnames, func(glob string) bool {
+		ok, _ := path.Match(glob, dev.Hostname)
+		return ok
+	}) {
+		return fmt.Errorf("device hostname %q does not match %v", dev.Hostname, s.Hostnames)
+	}
+	if len(s.OS) > 0 && !slices.ContainsFunc(s.OS, func(os string) bool { return strings.EqualFold(os, dev.OS) }) {
+		return fmt.Errorf("device %s runs %q, not one of %v", dev.Hostname, dev.OS, s.OS)
+	}
+	if s.RequesterOwned && (len(dev.Tags) > 0 || !strings.EqualFold(dev.User, requester)) {
+		return fmt.Errorf("device %s is not owned by %s", dev.Hostname, requester)
+	}
+	return nil
+}
+
+func parseTargetSelector(c *config.TargetsConfig) (*TargetSelector, error) {
+	if c == nil {
+		return nil, nil
+	}
+	for _, tag := range c.Tags {
+		if err := validateTag(tag); err != nil {
+			return nil, fmt.Errorf("targets: %w", err)
+		}
+	}
+	for _, glob := range c.Hostnames {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("targets: invalid hostname glob %q: %w", glob, err)
+		}
+	}
+	return &TargetSelector{
+		Tags:           c.Tags,
+		Hostnames:      c.Hostnames,
+		OS:             c.OS,
+		RequesterOwned: c.RequesterOwned,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package grant
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+	tailscale "tailscale.com/client/tailscale/v2"
+)
+
+func TestTargetSelector_Check(t *testing.T) {
+	dbServer := &tailscale.Device{Hostname: "db-prod-1", OS: "linux", Tags: []string{"tag:db", "tag:prod"}}
+	laptop := &tailscale.Device{Hostname: "alice-mbp", OS: "macOS", User: "alice@example.com"}
+
+	tests := []struct {
+		name      string
+		selector  *TargetSelector
+		dev       *tailscale.Device
+		requester string
+		wantErr   bool
+	}{
+		{"nil selector", nil, dbServer, "alice@example.com", false},
+		{"any tag matches", &TargetSelector{Tags: []string{"tag:web", "tag:db"}}, dbServer, "", false},
+		{"no tag matches", &TargetSelector{Tags: []string{"tag:web"}}, dbServer, "", true},
+		{"untagged device", &TargetSelector{Tags: []string{"tag:db"}}, laptop, "", true},
+		{"hostname glob", &TargetSelector{Hostnames: []string{"web-*", "db-*"}}, dbServer, "", false},
+		{"hostname glob mismatch", &TargetSelector{Hostnames: []string{"web-*"}}, dbServer, "", true},
+		{"os case-insensitive", &TargetSelector{OS: []string{"macos"}}, laptop, "", false},
+		{"os mismatch", &TargetSelector{OS: []string{"linux"}}, laptop, "", true},
+		{"own device", &TargetSelector{RequesterOwned: true}, laptop, "alice@example.com", false},
+		{"someone else's device", &TargetSelector{RequesterOwned: true}, laptop, "bob@example.com", true},
+		{"tagged device is not owned", &TargetSelector{RequesterOwned: true}, dbServer, "alice@example.com", true},
+		{"all criteria must match", &TargetSelector{Tags: []string{"tag:db"}, OS: []string{"windows"}}, dbServer, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.selector.Check(tt.dev, tt.requester)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewYAMLGrantTypeStore_Targets(t *testing.T) {
+	base := func(action string, targets *config.TargetsConfig) config.GrantTypeConfig {
+		c := config.GrantTypeConfig{
+			Name: "t", Tags: []string{"tag:t"}, MaxDuration: "1h", RiskLevel: "low",
+			Action: action, Targets: targets,
+		}
+		if action == "user_role" {
+			c.UserAction = &config.UserActionConfig{Role: "admin"}
+		}
+		return c
+	}
+
+	store, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{
+		base("", &config.TargetsConfig{Tags: []string{"tag:db"}, Hostnames: []string{"db-*"}, RequesterOwned: false}),
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewYAMLGrantTypeStore failed: %v", err)
+	}
+	gt, _ := store.Get("t")
+	if gt.Targets == nil || gt.Targets.Tags[0] != "tag:db" || gt.Targets.Hostnames[0] != "db-*" {
+		t.Errorf("Targets = %+v, want tag:db and db-*", gt.Targets)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.GrantTypeConfig
+		wantErr string
+	}{
+		{"user action", base("user_role", &config.TargetsConfig{RequesterOwned: true}), "only apply to actions on devices"},
+		{"invalid tag", base("tag", &config.TargetsConfig{Tags: []string{"db"}}), "targets"},
+		{"invalid glob", base("tag", &config.TargetsConfig{Hostnames: []string{"db-["}}), "invalid hostname glob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewYAMLGrantTypeStore([]config.GrantTypeConfig{tt.cfg}, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,8 +2,11 @@ package grant
 
 import (
 	"encoding/json"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/tsapi"
 )
 
 type RiskLevel int
@@ -76,28 +79,137 @@ const (
 	ActionTag         ActionType = "tag"
 	ActionUserRole    ActionType = "user_role"
 	ActionUserRestore ActionType = "user_restore"
+	ActionRoutes      ActionType = "routes"
+	ActionKeyExpiry   ActionType = "key_expiry"
+	// ActionDeviceAuthorize authorizes a device awaiting approval for the
+	// grant's duration, in tailnets with device approval enabled.
+	ActionDeviceAuthorize ActionType = "device_authorize"
+	// ActionGroupMembership adds a user to a group in the tailnet policy
+	// file for the grant's duration.
+	ActionGroupMembership ActionType = "group_membership"
+	// ActionPolicyGrant inserts a grants entry from the requester to the
+	// target devices into the tailnet policy file for the grant's duration.
+	ActionPolicyGrant ActionType = "policy_grant"
 )
 
+// TargetsDevices reports whether grants of this action apply to devices,
+// and so are requested with targetNodeID, targetNodeIDs or targetTag. The
+// empty action is the tag action.
+func (a ActionType) TargetsDevices() bool {
+	switch a {
+	case "", ActionTag, ActionRoutes, ActionKeyExpiry, ActionDeviceAuthorize, ActionPolicyGrant:
+		return true
+	}
+	return false
+}
+
+// TargetsUser reports whether grants of this type are requested with
+// targetUserID.
+func (gt GrantType) TargetsUser() bool {
+	switch gt.Action {
+	case ActionUserRole, ActionUserRestore:
+		return true
+	case ActionGroupMembership:
+		return gt.GroupAction != nil && gt.GroupAction.Member == GroupMemberTarget
+	}
+	return false
+}
+
 type UserAction struct {
 	Role string `json:"role,omitempty"`
 }
 
+// Who a group_membership grant adds to its group.
+const (
+	GroupMemberRequester = "requester"
+	GroupMemberTarget    = "target" // the grant's target user
+)
+
+// GroupAction is the policy file group a group_membership grant adds a user
+// to.
+type GroupAction struct {
+	Group  string `json:"group"`            // e.g. "group:db-admins"
+	Member string `json:"member,omitempty"` // GroupMemberRequester (default) or GroupMemberTarget
+}
+
+// GroupMembership is one login's membership of a policy file group.
+type GroupMembership struct {
+	Group  string `json:"group"`
+	Member string `json:"member"` // login name
+}
+
+// PolicyGrantAction is the access a policy_grant grant gives its requester
+// to the target devices, as the ip and app fields of a policy file grants
+// entry.
+type PolicyGrantAction struct {
+	IP  []string                    `json:"ip,omitempty"`  // e.g. "tcp:22", "*"
+	App map[string][]map[string]any `json:"app,omitempty"` // application capabilities
+}
+
+// exitNodeRoutes are the routes a device advertises to offer itself as an
+// exit node.
+var exitNodeRoutes = []string{"0.0.0.0/0", "::/0"}
+
+// RouteAction is the subnet routes a routes grant enables on its target
+// devices. The routes must be advertised by the device.
+type RouteAction struct {
+	Routes   []string `json:"routes,omitempty"`
+	ExitNode bool     `json:"exitNode,omitempty"` // also enable the device as an exit node
+}
+
+// EnabledRoutes returns every route the grant enables, including the exit
+// node routes if ExitNode is set.
+func (r *RouteAction) EnabledRoutes() []string {
+	if r == nil {
+		return nil
+	}
+	routes := slices.Clone(r.Routes)
+	if r.ExitNode {
+		for _, route := range exitNodeRoutes {
+			if !slices.Contains(routes, route) {
+				routes = append(routes, route)
+			}
+		}
+	}
+	return routes
+}
+
 type UserInfo struct {
-	ID     string `json:"id"`
-	Role   string `json:"role"`
-	Status string `json:"status"`
+	ID        string `json:"id"`
+	LoginName string `json:"loginName,omitempty"`
+	Role      string `json:"role"`
+	Status    string `json:"status"`
 }
 
 type GrantStatus string
 
 const (
-	StatusPendingApproval GrantStatus = "pending_approval"
-	StatusActive          GrantStatus = "active"
-	StatusExpired         GrantStatus = "expired"
-	StatusRevoked         GrantStatus = "revoked"
-	StatusDenied          GrantStatus = "denied"
+	StatusPendingApproval   GrantStatus = "pending_approval"
+	StatusPartiallyApproved GrantStatus = "partially_approved"
+	StatusScheduled         GrantStatus = "scheduled"
+	StatusActive            GrantStatus = "active"
+	StatusExpired           GrantStatus = "expired"
+	StatusRevoked           GrantStatus = "revoked"
+	StatusDenied            GrantStatus = "denied"
+	StatusFailed            GrantStatus = "failed"
+	StatusCancelled         GrantStatus = "cancelled"
 )
 
+// Valid reports whether s is a known grant status.
+func (s GrantStatus) Valid() bool {
+	switch s {
+	case StatusPendingApproval, StatusPartiallyApproved, StatusScheduled, StatusActive,
+		StatusExpired, StatusRevoked, StatusDenied, StatusFailed, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// AwaitingApproval reports whether the grant is still collecting approvals.
+func (s GrantStatus) AwaitingApproval() bool {
+	return s == StatusPendingApproval || s == StatusPartiallyApproved
+}
+
 type PostureAttribute struct {
 	Key    string `json:"key"`
 	Value  any    `json:"value"`
@@ -105,15 +217,61 @@ type PostureAttribute struct {
 }
 
 type GrantType struct {
-	Name              string             `json:"name"`
-	Description       string             `json:"description"`
-	Tags              []string           `json:"tags,omitempty"`
-	PostureAttributes []PostureAttribute `json:"postureAttributes,omitempty"`
-	MaxDuration       JSONDuration       `json:"maxDuration"`
-	RiskLevel         RiskLevel          `json:"riskLevel"`
-	Approvers         []string           `json:"approvers"`
-	Action            ActionType         `json:"action"`
-	UserAction        *UserAction        `json:"userAction,omitempty"`
+	Name               string             `json:"name"`
+	Description        string             `json:"description"`
+	Tags               []string           `json:"tags,omitempty"`
+	PostureAttributes  []PostureAttribute `json:"postureAttributes,omitempty"`
+	MaxDuration        JSONDuration       `json:"maxDuration"`
+	RiskLevel          RiskLevel          `json:"riskLevel"`
+	Approvers          []string           `json:"approvers"`
+	RequiredApprovals  int                `json:"requiredApprovals,omitempty"`
+	Action             ActionType         `json:"action"`
+	UserAction         *UserAction        `json:"userAction,omitempty"`
+	RouteAction        *RouteAction       `json:"routeAction,omitempty"`
+	GroupAction        *GroupAction       `json:"groupAction,omitempty"`
+	PolicyGrant        *PolicyGrantAction `json:"policyGrant,omitempty"`
+	ExtendPolicy       ExtendPolicy       `json:"extendPolicy,omitempty"`
+	Admins             []string           `json:"admins,omitempty"`
+	ApprovalStages     []ApprovalStage    `json:"approvalStages,omitempty"`
+	Policy             []PolicyRule       `json:"policy,omitempty"`
+	EligibleRequesters []string           `json:"eligibleRequesters,omitempty"`
+	Targets            *TargetSelector    `json:"targets,omitempty"`
+	Quota              *Quota             `json:"quota,omitempty"`
+	ExpiryWarning      JSONDuration       `json:"expiryWarning,omitempty"` // lead time for the expiring_soon notification
+
+	// Extension limits. Zero values mean no limit.
+	MaxTotalDuration          JSONDuration `json:"maxTotalDuration,omitempty"` // from activation to the latest allowed expiry
+	MaxExtensions             int          `json:"maxExtensions,omitempty"`
+	ExtensionRequiresApproval bool         `json:"extensionRequiresApproval,omitempty"` // every extension goes through approval, whatever the risk level
+
+	BreakGlass bool `json:"breakGlass,omitempty"` // requests may skip approval for post-hoc review
+}
+
+// Quota limits how much of a grant type each user may hold. Zero values
+// mean no limit. Quotas are enforced by UserQuotaWorkflow.
+type Quota struct {
+	MaxConcurrentPerUser   int          `json:"maxConcurrentPerUser,omitempty"`
+	MaxGrantsPerUserPerDay int          `json:"maxGrantsPerUserPerDay,omitempty"`
+	MaxActiveTime          JSONDuration `json:"maxActiveTime,omitempty"`
+	ActiveTimeWindow       JSONDuration `json:"activeTimeWindow,omitempty"`
+}
+
+// ApprovalStage is one step of an escalation chain. When a stage times out
+// without a decision its approvers stay eligible and the next stage's
+// approvers are added; the last stage timing out denies the grant.
+type ApprovalStage struct {
+	Name      string       `json:"name,omitempty"`
+	Approvers []string     `json:"approvers"`
+	Timeout   JSONDuration `json:"timeout"`
+}
+
+// ApprovalStageStatus describes the escalation stage a pending grant is in.
+type ApprovalStageStatus struct {
+	Index     int       `json:"index"`
+	Total     int       `json:"total"`
+	Name      string    `json:"name,omitempty"`
+	Approvers []string  `json:"approvers"`
+	Deadline  time.Time `json:"deadline"`
 }
 
 type GrantRequest struct {
@@ -122,22 +280,126 @@ type GrantRequest struct {
 	RequesterNode string        `json:"requesterNode"`
 	GrantTypeName string        `json:"grantTypeName"`
 	TargetNodeID  string        `json:"targetNodeID,omitempty"`
+	TargetNodeIDs []string      `json:"targetNodeIDs,omitempty"` // multi-device grants
+	TargetTag     string        `json:"targetTag,omitempty"`     // every device with this tag, resolved at activation
 	TargetUserID  string        `json:"targetUserID,omitempty"`
 	Duration      time.Duration `json:"duration"`
 	Reason        string        `json:"reason"`
 	RequestedAt   time.Time     `json:"requestedAt"`
+	// StartAt optionally defers activation until an approved grant's
+	// change window opens. Zero means activate as soon as approved.
+	StartAt time.Time `json:"startAt"`
+	// BreakGlass skips approval on grant types that allow it. The grant
+	// activates at once and is reviewed by the approvers afterwards.
+	BreakGlass bool `json:"breakGlass,omitempty"`
+}
+
+// NodeIDs returns the devices a tag grant names explicitly, whether as a
+// single target or a list. Grants using TargetTag have none until their
+// targets are resolved at activation.
+func (r GrantRequest) NodeIDs() []string {
+	if len(r.TargetNodeIDs) > 0 {
+		return r.TargetNodeIDs
+	}
+	if r.TargetNodeID != "" {
+		return []string{r.TargetNodeID}
+	}
+	return nil
 }
 
 type GrantState struct {
-	Request      GrantRequest `json:"request"`
-	Status       GrantStatus  `json:"status"`
-	ApprovedBy   string       `json:"approvedBy"`
-	ActivatedAt  time.Time    `json:"activatedAt"`
-	ExpiresAt    time.Time    `json:"expiresAt"`
-	RevokedBy    string       `json:"revokedBy"`
-	RevokedAt    time.Time    `json:"revokedAt"`
-	OriginalTags []string     `json:"originalTags,omitempty"`
-	OriginalRole string       `json:"originalRole,omitempty"`
+	Request           GrantRequest         `json:"request"`
+	Status            GrantStatus          `json:"status"`
+	ApprovedBy        string               `json:"approvedBy"`
+	DeniedBy          string               `json:"deniedBy,omitempty"`
+	DenyReason        string               `json:"denyReason,omitempty"`
+	Approvals         []string             `json:"approvals,omitempty"`
+	RequiredApprovals int                  `json:"requiredApprovals,omitempty"`
+	ApprovalStage     *ApprovalStageStatus `json:"approvalStage,omitempty"` // current escalation stage while awaiting approval
+	ActivatedAt       time.Time            `json:"activatedAt"`
+	ExpiresAt         time.Time            `json:"expiresAt"`
+	RevokedBy         string               `json:"revokedBy"`
+	RevokedAt         time.Time            `json:"revokedAt"`
+	CancelledBy       string               `json:"cancelledBy,omitempty"`
+	CancelledAt       time.Time            `json:"cancelledAt,omitzero"`
+	OriginalTags      []string             `json:"originalTags,omitempty"`
+	OriginalRole      string               `json:"originalRole,omitempty"`
+	Targets           []TargetStatus       `json:"targets,omitempty"`      // per-device status of tag grants
+	ExpiringSoon      bool                 `json:"expiringSoon,omitempty"` // within the grant type's expiryWarning of ExpiresAt
+	Renewal           *RenewalStatus       `json:"renewal,omitempty"`      // renewal awaiting approval
+	Extensions        []Extension          `json:"extensions,omitempty"`
+	BreakGlass        *BreakGlassReview    `json:"breakGlass,omitempty"`      // set on break-glass grants
+	GroupMembership   *GroupMembership     `json:"groupMembership,omitempty"` // set on group_membership grants once activated
+	PolicyGrant       *tsapi.PolicyGrant   `json:"policyGrant,omitempty"`     // set on policy_grant grants once activated
+}
+
+// ReviewStatus is where a break-glass grant's post-hoc review stands.
+type ReviewStatus string
+
+const (
+	ReviewPending      ReviewStatus = "pending"
+	ReviewAcknowledged ReviewStatus = "acknowledged"
+	ReviewRejected     ReviewStatus = "rejected"
+	ReviewUnreviewed   ReviewStatus = "unreviewed" // nobody reviewed it before the deadline
+)
+
+// BreakGlassReview tracks the approvers' review of a grant that activated
+// without approval. The review stays open after the grant ends, until
+// Deadline.
+type BreakGlassReview struct {
+	Status     ReviewStatus `json:"status"`
+	Approvers  []string     `json:"approvers"`
+	Deadline   time.Time    `json:"deadline"`
+	ReviewedBy string       `json:"reviewedBy,omitempty"`
+	ReviewedAt time.Time    `json:"reviewedAt,omitzero"`
+	Note       string       `json:"note,omitempty"`
+}
+
+// Extension records one accepted extension of an active grant.
+type Extension struct {
+	By         string        `json:"by"`
+	At         time.Time     `json:"at"`
+	Duration   time.Duration `json:"duration"` // from At to the new expiry
+	ApprovedBy string        `json:"approvedBy,omitempty"`
+}
+
+// RenewalStatus is a renewal of an active grant that is waiting for
+// approval. Approvals and ApprovalStage track the renewal's
+// ApprovalWorkflow the way the grant's own fields track the original
+// request.
+type RenewalStatus struct {
+	RequestedBy   string               `json:"requestedBy"`
+	RequestedAt   time.Time            `json:"requestedAt"`
+	Duration      time.Duration        `json:"duration"`
+	Reason        string               `json:"reason,omitempty"`
+	Approvals     []string             `json:"approvals,omitempty"`
+	ApprovalStage *ApprovalStageStatus `json:"approvalStage,omitempty"`
+}
+
+// TargetState is the state of one device of a tag grant.
+type TargetState string
+
+const (
+	TargetPending      TargetState = "pending"
+	TargetActive       TargetState = "active"
+	TargetFailed       TargetState = "failed"
+	TargetRemoved      TargetState = "removed"
+	TargetRemoveFailed TargetState = "remove_failed"
+)
+
+// TargetStatus reports how a tag grant's activation and removal went on
+// one device.
+type TargetStatus struct {
+	NodeID string      `json:"nodeID"`
+	Name   string      `json:"name,omitempty"`
+	State  TargetState `json:"state"`
+	Error  string      `json:"error,omitempty"`
+	// KeyExpiryDisabled is the device's key expiry setting before a
+	// key_expiry grant activated.
+	KeyExpiryDisabled *bool `json:"keyExpiryDisabled,omitempty"`
+	// Authorized is whether the device was authorized before a
+	// device_authorize grant activated.
+	Authorized *bool `json:"authorized,omitempty"`
 }
 
 // Workflow signal types
@@ -156,11 +418,52 @@ type RevokeSignal struct {
 	Reason    string `json:"reason"`
 }
 
+// ReviewSignal acknowledges or rejects a break-glass grant, sent as the
+// "acknowledge" or "reject" signal. Rejecting revokes the grant if it is
+// still active.
+type ReviewSignal struct {
+	ReviewedBy string `json:"reviewedBy"`
+	Note       string `json:"note,omitempty"`
+}
+
+// CancelSignal withdraws a grant before it activates. It is sent to both
+// the grant's ApprovalWorkflow and its GrantWorkflow.
+type CancelSignal struct {
+	CancelledBy string `json:"cancelledBy"`
+}
+
 type ExtendSignal struct {
 	ExtendedBy string        `json:"extendedBy"`
 	Duration   time.Duration `json:"duration"`
 }
 
+// RenewSignal asks for an active grant to be extended. Renewals of medium
+// and high risk grant types go through ApprovalWorkflow first; low risk
+// renewals apply at once, like an extension.
+type RenewSignal struct {
+	RequestedBy string        `json:"requestedBy"`
+	Duration    time.Duration `json:"duration"`
+	Reason      string        `json:"reason"`
+}
+
+// Tailscale webhook event types GrantWorkflow reacts to.
+const (
+	TailnetNodeDeleted     = "nodeDeleted"
+	TailnetUserSuspended   = "userSuspended"
+	TailnetUserDeleted     = "userDeleted"
+	TailnetUserRoleUpdated = "userRoleUpdated"
+)
+
+// TailnetEventSignal relays a Tailscale webhook event about one of the
+// grant's targets or its requester. Actor is the admin who made the change,
+// if the event names one.
+type TailnetEventSignal struct {
+	Type   string `json:"type"`
+	NodeID string `json:"nodeID,omitempty"`
+	User   string `json:"user,omitempty"`
+	Actor  string `json:"actor,omitempty"`
+}
+
 // DeviceTagManager signal types
 
 type AddGrantSignal struct {
@@ -168,26 +471,67 @@ type AddGrantSignal struct {
 	Tags              []string           `json:"tags"`
 	PostureAttributes []PostureAttribute `json:"postureAttributes,omitempty"`
 	RequesterNodeID   string             `json:"requesterNodeID,omitempty"`
+	Routes            []string           `json:"routes,omitempty"` // subnet routes to enable
+	DisableKeyExpiry  bool               `json:"disableKeyExpiry,omitempty"`
+	Authorize         bool               `json:"authorize,omitempty"`
 }
 
-// GrantAssets tracks the tags and posture attributes applied by a single grant.
+// GrantAssets tracks the tags, posture attributes and routes applied by a
+// single grant.
 type GrantAssets struct {
 	Tags              []string           `json:"tags"`
 	PostureAttributes []PostureAttribute `json:"postureAttributes,omitempty"`
 	RequesterNodeID   string             `json:"requesterNodeID,omitempty"`
+	Routes            []string           `json:"routes,omitempty"`
+	DisableKeyExpiry  bool               `json:"disableKeyExpiry,omitempty"`
+	Authorize         bool               `json:"authorize,omitempty"`
 }
 
 type RemoveGrantSignal struct {
 	GrantID string `json:"grantID"`
 }
 
+// AddMembershipSignal asks the PolicyEditorWorkflow to add a grant's group
+// membership to the policy file.
+type AddMembershipSignal struct {
+	GrantID    string          `json:"grantID"`
+	Membership GroupMembership `json:"membership"`
+}
+
+// AddPolicyGrantSignal asks the PolicyEditorWorkflow to insert a grant's
+// entry into the grants section of the policy file.
+type AddPolicyGrantSignal struct {
+	GrantID string            `json:"grantID"`
+	Grant   tsapi.PolicyGrant `json:"grant"`
+}
+
+// PolicyGrantResult is signaled by the PolicyEditorWorkflow to a grant's
+// workflow once the grant's entry is written to the policy file, or with
+// Rejected set if the policy validate endpoint rejected it.
+type PolicyGrantResult struct {
+	GrantID  string `json:"grantID"`
+	Rejected string `json:"rejected,omitempty"`
+}
+
 // SyncSignal triggers the tag manager to re-read current device tags
 // and reapply the desired state. Used by reconciliation to fix drift.
 type SyncSignal struct{}
 
 type ApprovalResult struct {
-	Approved   bool   `json:"approved"`
-	ApprovedBy string `json:"approvedBy"`
-	DeniedBy   string `json:"deniedBy"`
-	Reason     string `json:"reason"`
+	Approved   bool     `json:"approved"`
+	ApprovedBy string   `json:"approvedBy"`
+	Approvals  []string `json:"approvals,omitempty"`
+	DeniedBy   string   `json:"deniedBy"`
+	Reason     string   `json:"reason"`
+	// CancelledBy is set when the requester withdrew the request.
+	CancelledBy string `json:"cancelledBy,omitempty"`
+}
+
+// ApprovalProgress is signaled from ApprovalWorkflow to its parent
+// GrantWorkflow each time a quorum approval is recorded but not yet met,
+// and each time the request escalates to a new stage.
+type ApprovalProgress struct {
+	Approvals []string            `json:"approvals"`
+	Required  int                 `json:"required"`
+	Stage     ApprovalStageStatus `json:"stage"`
 }
@@ -1,13 +1,25 @@
 package grant
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/rajsinghtech/tailgrant/internal/audit"
+	"github.com/rajsinghtech/tailgrant/internal/notify"
+	"github.com/rajsinghtech/tailgrant/internal/tsapi"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
+	tailscale "tailscale.com/client/tailscale/v2"
 )
 
+// breakGlassReviewWindow is how long approvers have, from activation, to
+// review a break-glass grant before it is flagged as unreviewed.
+const breakGlassReviewWindow = 72 * time.Hour
+
 func GrantWorkflow(ctx workflow.Context, request GrantRequest, grantType GrantType) (GrantState, error) {
 	logger := workflow.GetLogger(ctx)
 	logger.Info("GrantWorkflow started", "grantID", request.ID, "grantType", grantType.Name)
@@ -30,24 +42,365 @@ func GrantWorkflow(ctx workflow.Context, request GrantRequest, grantType GrantTy
 		},
 	})
 
-	// Approval gate for non-low-risk grants
-	if grantType.RiskLevel > RiskLow {
+	var activities *Activities
+
+	// Keep search attributes and the memo snapshot current so grants can be
+	// listed from visibility.
+	publish := func() {}
+	if workflow.GetVersion(ctx, "search-attributes", workflow.DefaultVersion, 1) == 1 {
+		publish = func() { publishState(ctx, state) }
+		publish()
+		defer publish()
+	}
+
+	// HandleCreateGrant reserved quota for this grant; give it back however
+	// the grant ends. Break-glass grants give it back as soon as the grant
+	// ends, before waiting out their review.
+	quotaHeld := grantType.Quota != nil
+	if quotaHeld {
+		defer func() {
+			if quotaHeld {
+				releaseQuota(ctx, request, state)
+			}
+		}()
+	}
+
+	// Record lifecycle events to the audit log.
+	auditEvent := func(audit.EventType, string, string, map[string]string) {}
+	if workflow.GetVersion(ctx, "audit-events", workflow.DefaultVersion, 1) == 1 {
+		auditEvent = func(typ audit.EventType, actor, reason string, details map[string]string) {
+			recordAudit(ctx, audit.Event{
+				Type:      typ,
+				GrantID:   request.ID,
+				GrantType: grantType.Name,
+				Requester: request.Requester,
+				Actor:     actor,
+				Targets:   GrantTargets(state),
+				Reason:    reason,
+				Details:   details,
+			})
+		}
+	}
+	// Notify subscribed channels of lifecycle events.
+	notifying := workflow.GetVersion(ctx, "notifications", workflow.DefaultVersion, 1) == 1
+	notifyEvent := func(event notify.EventType, actor, reason string) {
+		if !notifying {
+			return
+		}
+		sendNotification(ctx, notify.Notification{
+			Event:     event,
+			GrantID:   request.ID,
+			GrantType: grantType.Name,
+			Requester: request.Requester,
+			Actor:     actor,
+			Reason:    reason,
+			Targets:   GrantTargets(state),
+			ExpiresAt: state.ExpiresAt,
+		})
+	}
+
+	requested := map[string]string{"duration": request.Duration.String()}
+	if !request.StartAt.IsZero() {
+		requested["startAt"] = request.StartAt.Format(time.RFC3339)
+	}
+	auditEvent(audit.EventRequested, request.Requester, request.Reason, requested)
+
+	// Request policy: rules see device facts fetched through an activity and
+	// the workflow's clock, so the decision is stable across replays. Each
+	// target device is evaluated on its own.
+	policyInputs := []PolicyInput{{
+		RequesterLogin: request.Requester,
+		Duration:       request.Duration,
+		Reason:         request.Reason,
+	}}
+	if len(grantType.Policy) > 0 {
+		if err := workflow.ExecuteActivity(actCtx, activities.LoadPolicyInputs, grantType, request).Get(ctx, &policyInputs); err != nil {
+			return state, fmt.Errorf("load policy input: %w", err)
+		}
+	}
+	for i := range policyInputs {
+		policyInputs[i].Time = workflow.Now(ctx)
+	}
+	decision, err := EvaluatePolicyTargets(&grantType, policyInputs)
+	if err != nil {
+		logger.Error("Policy evaluation failed, denying", "grantID", request.ID, "error", err)
+		decision.Message = "policy evaluation failed"
+	}
+	if decision.Decision == DecisionDeny {
+		state.Status = StatusDenied
+		state.DenyReason = decision.Message
+		if state.DenyReason == "" {
+			state.DenyReason = "denied by policy"
+		}
+		logger.Info("Grant denied by policy", "grantID", request.ID, "rule", decision.Rule)
+		var rule map[string]string
+		if decision.Rule > 0 {
+			rule = map[string]string{"rule": strconv.Itoa(decision.Rule)}
+		}
+		auditEvent(audit.EventDenied, "", state.DenyReason, rule)
+		notifyEvent(notify.EventDenied, "", state.DenyReason)
+		return state, nil
+	}
+
+	// The requester may cancel the grant until it activates.
+	cancelCh := workflow.GetSignalChannel(ctx, "cancel")
+	receiveCancel := func(ch workflow.ReceiveChannel) bool {
+		var sig CancelSignal
+		ch.Receive(ctx, &sig)
+		if !CanCancel(request, Caller{Login: sig.CancelledBy}) {
+			logger.Warn("Unauthorized cancel attempt", "grantID", request.ID, "attemptedBy", sig.CancelledBy)
+			return false
+		}
+		state.Status = StatusCancelled
+		state.CancelledBy = sig.CancelledBy
+		state.CancelledAt = workflow.Now(ctx)
+		logger.Info("Grant cancelled", "grantID", request.ID, "cancelledBy", sig.CancelledBy)
+		return true
+	}
+	cancelled := func() (GrantState, error) {
+		auditEvent(audit.EventCancelled, state.CancelledBy, "", nil)
+		notifyEvent(notify.EventCancelled, state.CancelledBy, "")
+		return state, nil
+	}
+
+	// Break-glass requests skip approval on grant types that allow it. The
+	// approvers are told once the grant is active and review it afterwards.
+	if request.BreakGlass && grantType.BreakGlass && decision.Decision == DecisionRequireApproval {
+		decision.Decision = DecisionAllow
+		state.BreakGlass = &BreakGlassReview{
+			Status:    ReviewPending,
+			Approvers: grantType.ForLastStage().Approvers,
+		}
+		logger.Warn("Break-glass grant, skipping approval", "grantID", request.ID, "requester", request.Requester)
+		auditEvent(audit.EventBreakGlass, request.Requester, request.Reason, nil)
+	}
+
+	// Approval gate
+	if decision.Decision == DecisionRequireApproval {
 		childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
 			WorkflowID: fmt.Sprintf("approval-%s", request.ID),
 		})
+		firstStage := grantType.Stages()[0]
+		stage := grantType.StageStatus(0, workflow.Now(ctx).Add(time.Duration(firstStage.Timeout)))
+		state.ApprovalStage = &stage
+		state.RequiredApprovals = grantType.ApprovalQuorum()
+		approvalFuture := workflow.ExecuteChildWorkflow(childCtx, ApprovalWorkflow, request.ID, grantType, request.Requester, "")
+		progressCh := workflow.GetSignalChannel(ctx, "approval-progress")
+
+		// Wait for the approval decision, surfacing partial quorum
+		// approvals and escalations through the status query in the
+		// meantime.
 		var result ApprovalResult
-		if err := workflow.ExecuteChildWorkflow(childCtx, ApprovalWorkflow, request.ID, grantType, request.Requester).Get(ctx, &result); err != nil {
-			return state, fmt.Errorf("approval workflow: %w", err)
+		var approvalErr error
+		decided := false
+		for !decided {
+			sel := workflow.NewSelector(ctx)
+			sel.AddFuture(approvalFuture, func(f workflow.Future) {
+				approvalErr = f.Get(ctx, &result)
+				decided = true
+			})
+			// A cancel stops the wait; the approval, signaled alongside,
+			// closes on its own or with this workflow.
+			sel.AddReceive(cancelCh, func(ch workflow.ReceiveChannel, more bool) {
+				if receiveCancel(ch) {
+					decided = true
+				}
+			})
+			sel.AddReceive(progressCh, func(ch workflow.ReceiveChannel, more bool) {
+				var progress ApprovalProgress
+				ch.Receive(ctx, &progress)
+				state.Approvals = progress.Approvals
+				state.ApprovalStage = &progress.Stage
+				if len(progress.Approvals) > 0 {
+					state.Status = StatusPartiallyApproved
+				}
+				publish()
+			})
+			sel.Select(ctx)
+		}
+		if state.Status == StatusCancelled {
+			state.ApprovalStage = nil
+			return cancelled()
+		}
+		if approvalErr != nil {
+			return state, fmt.Errorf("approval workflow: %w", approvalErr)
+		}
+		state.Approvals = result.Approvals
+		state.ApprovalStage = nil
+		if result.CancelledBy != "" {
+			state.Status = StatusCancelled
+			state.CancelledBy = result.CancelledBy
+			state.CancelledAt = workflow.Now(ctx)
+			logger.Info("Grant cancelled", "grantID", request.ID, "cancelledBy", result.CancelledBy)
+			return cancelled()
 		}
 		if !result.Approved {
 			state.Status = StatusDenied
+			state.DeniedBy = result.DeniedBy
+			state.DenyReason = result.Reason
 			logger.Info("Grant denied", "grantID", request.ID, "deniedBy", result.DeniedBy, "reason", result.Reason)
+			auditEvent(audit.EventDenied, result.DeniedBy, result.Reason, nil)
+			notifyEvent(notify.EventDenied, result.DeniedBy, result.Reason)
 			return state, nil
 		}
 		state.ApprovedBy = result.ApprovedBy
+		var approvals map[string]string
+		if len(result.Approvals) > 1 {
+			approvals = map[string]string{"approvals": strings.Join(result.Approvals, ",")}
+		}
+		auditEvent(audit.EventApproved, result.ApprovedBy, "", approvals)
+		notifyEvent(notify.EventApproved, result.ApprovedBy, "")
+	}
+
+	revokeCh := workflow.GetSignalChannel(ctx, "revoke")
+	extendCh := workflow.GetSignalChannel(ctx, "extend")
+	tailnetCh := workflow.GetSignalChannel(ctx, "tailnet-event")
+	var revokeReason string
+	roleOverridden := false
+
+	// receiveRevoke applies a revoke signal if the sender is authorized and
+	// reports whether it did. Unauthorized signals are logged and ignored.
+	receiveRevoke := func(ch workflow.ReceiveChannel) bool {
+		var sig RevokeSignal
+		ch.Receive(ctx, &sig)
+		caller, err := resolveCaller(actCtx, grantType, sig.RevokedBy)
+		if err != nil {
+			logger.Error("Failed to resolve revoker", "grantID", request.ID, "attemptedBy", sig.RevokedBy, "error", err)
+			return false
+		}
+		if !CanRevoke(request, caller) {
+			logger.Warn("Unauthorized revoke attempt", "grantID", request.ID, "attemptedBy", sig.RevokedBy)
+			return false
+		}
+		state.Status = StatusRevoked
+		state.RevokedBy = sig.RevokedBy
+		state.RevokedAt = workflow.Now(ctx)
+		revokeReason = sig.Reason
+		logger.Info("Grant revoked", "grantID", request.ID, "revokedBy", sig.RevokedBy)
+		return true
+	}
+
+	// receiveTailnetEvent applies a Tailscale webhook event relayed by the
+	// server and reports whether it ended the grant. Deleted devices are
+	// dropped from the targets, scheduled or active, and the grant ends once
+	// none are left;
+	// suspending or deleting the user ends it outright; a role grant whose
+	// role was changed by someone else ends without reverting the role.
+	receiveTailnetEvent := func(ch workflow.ReceiveChannel) bool {
+		var sig TailnetEventSignal
+		ch.Receive(ctx, &sig)
+		var reason string
+		switch sig.Type {
+		case TailnetNodeDeleted:
+			if state.Status == StatusScheduled {
+				// Not activated yet: the deleted device is no longer targeted.
+				i := slices.IndexFunc(state.Targets, func(t TargetStatus) bool { return t.NodeID == sig.NodeID })
+				if i < 0 {
+					return false
+				}
+				state.Targets = slices.Delete(state.Targets, i, i+1)
+				if len(state.Targets) > 0 {
+					logger.Info("Scheduled target device deleted", "grantID", request.ID, "nodeID", sig.NodeID, "remaining", len(state.Targets))
+					publish()
+					return false
+				}
+				reason = "all target devices deleted"
+				break
+			}
+			found, remaining := false, 0
+			for i := range state.Targets {
+				t := &state.Targets[i]
+				if t.NodeID == sig.NodeID && t.State == TargetActive {
+					t.State = TargetRemoved
+					t.Error = "device deleted"
+					found = true
+				}
+				if t.State == TargetActive {
+					remaining++
+				}
+			}
+			if !found {
+				return false
+			}
+			if remaining > 0 {
+				logger.Info("Target device deleted", "grantID", request.ID, "nodeID", sig.NodeID, "remaining", remaining)
+				publish()
+				return false
+			}
+			reason = "all target devices deleted"
+		case TailnetUserSuspended:
+			reason = "user " + sig.User + " suspended"
+		case TailnetUserDeleted:
+			reason = "user " + sig.User + " deleted"
+		case TailnetUserRoleUpdated:
+			if grantType.Action != ActionUserRole || state.Status != StatusActive {
+				return false
+			}
+			var user UserInfo
+			if err := workflow.ExecuteActivity(actCtx, activities.GetUser, request.TargetUserID).Get(ctx, &user); err != nil {
+				logger.Error("Failed to check user role", "grantID", request.ID, "userID", request.TargetUserID, "error", err)
+				return false
+			}
+			if user.Role == grantType.UserAction.Role {
+				return false
+			}
+			roleOverridden = true
+			reason = fmt.Sprintf("role changed to %s outside TailGrant", user.Role)
+		default:
+			return false
+		}
+		state.Status = StatusRevoked
+		state.RevokedBy = sig.Actor
+		if state.RevokedBy == "" {
+			state.RevokedBy = "tailscale"
+		}
+		state.RevokedAt = workflow.Now(ctx)
+		revokeReason = reason
+		logger.Info("Grant ended by tailnet event", "grantID", request.ID, "event", sig.Type, "reason", reason)
+		return true
+	}
+
+	// Scheduled grants wait for their start time after approval. The
+	// requester may cancel during the wait, and the requester or an
+	// approver may revoke.
+	if wait := request.StartAt.Sub(workflow.Now(ctx)); wait > 0 {
+		state.Status = StatusScheduled
+		// The requested devices are pending until the grant starts.
+		for _, id := range request.NodeIDs() {
+			state.Targets = append(state.Targets, TargetStatus{NodeID: id, State: TargetPending})
+		}
+		publish()
+		logger.Info("Grant scheduled", "grantID", request.ID, "startAt", request.StartAt)
+
+		startTimer := workflow.NewTimer(ctx, wait)
+		started := false
+		for !started && state.Status == StatusScheduled {
+			sel := workflow.NewSelector(ctx)
+			sel.AddFuture(startTimer, func(f workflow.Future) {
+				_ = f.Get(ctx, nil)
+				started = true
+			})
+			sel.AddReceive(revokeCh, func(ch workflow.ReceiveChannel, more bool) {
+				receiveRevoke(ch)
+			})
+			sel.AddReceive(tailnetCh, func(ch workflow.ReceiveChannel, more bool) {
+				receiveTailnetEvent(ch)
+			})
+			sel.AddReceive(cancelCh, func(ch workflow.ReceiveChannel, more bool) {
+				receiveCancel(ch)
+			})
+			sel.Select(ctx)
+		}
+		if state.Status == StatusCancelled {
+			return cancelled()
+		}
+		if state.Status == StatusRevoked {
+			auditEvent(audit.EventRevoked, state.RevokedBy, revokeReason, nil)
+			notifyEvent(notify.EventRevoked, state.RevokedBy, revokeReason)
+			return state, nil
+		}
 	}
 
-	var activities *Activities
 	taskQueue := workflow.GetInfo(ctx).TaskQueueName
 	action := grantType.Action
 	if action == "" {
@@ -55,18 +408,93 @@ func GrantWorkflow(ctx workflow.Context, request GrantRequest, grantType GrantTy
 	}
 
 	// Activate phase: apply the grant's effect based on action type.
-	var tagMgrID string
 	switch action {
-	case ActionTag:
-		if err := workflow.ExecuteActivity(actCtx, activities.SignalWithStartDeviceTagManager, request.TargetNodeID, taskQueue, AddGrantSignal{
-			GrantID:           request.ID,
-			Tags:              grantType.Tags,
-			PostureAttributes: grantType.PostureAttributes,
-			RequesterNodeID:   request.RequesterNode,
-		}).Get(ctx, nil); err != nil {
-			return state, fmt.Errorf("signal-with-start tag manager: %w", err)
+	case ActionTag, ActionRoutes, ActionKeyExpiry, ActionDeviceAuthorize, ActionPolicyGrant:
+		// Devices tagged since the request was evaluated are checked
+		// against the policy too.
+		var targetPolicy *PolicyInput
+		if len(grantType.Policy) > 0 && request.TargetTag != "" {
+			targetPolicy = &policyInputs[0]
+		}
+		// Devices deleted while the grant was scheduled are not targeted.
+		nodeIDs := request.NodeIDs()
+		if state.Status == StatusScheduled {
+			nodeIDs = nil
+			for _, t := range state.Targets {
+				nodeIDs = append(nodeIDs, t.NodeID)
+			}
+		}
+		targets, reason, err := resolveTargets(actCtx, request, nodeIDs, grantType, targetPolicy)
+		if err != nil {
+			return state, err
+		}
+		if reason != "" {
+			state.Status = StatusDenied
+			state.DenyReason = reason
+			logger.Info("Grant targets rejected", "grantID", request.ID, "reason", reason)
+			auditEvent(audit.EventDenied, "", reason, nil)
+			notifyEvent(notify.EventDenied, "", reason)
+			return state, nil
+		}
+		state.Targets = targets
+		if action == ActionPolicyGrant {
+			// Policy grants edit the policy file rather than the devices.
+			reason, err = activatePolicyGrant(ctx, actCtx, request, grantType, &state)
+			if err != nil {
+				return state, err
+			}
+			if reason != "" {
+				logger.Error("Policy grant activation failed", "grantID", request.ID, "reason", reason)
+				state.Status = StatusFailed
+				auditEvent(audit.EventFailed, "", reason, nil)
+				return state, nil
+			}
+			break
+		}
+		if action == ActionKeyExpiry || action == ActionDeviceAuthorize {
+			if err := recordDeviceSettings(actCtx, action, state.Targets); err != nil {
+				return state, err
+			}
+		}
+
+		// Fan out to every device's tag manager. Activation is all or
+		// nothing: if any device fails, the grant is removed from the
+		// devices that succeeded.
+		futures := make([]workflow.Future, len(state.Targets))
+		for i, t := range state.Targets {
+			futures[i] = workflow.ExecuteActivity(actCtx, activities.SignalWithStartDeviceTagManager, t.NodeID, taskQueue, AddGrantSignal{
+				GrantID:           request.ID,
+				Tags:              grantType.Tags,
+				PostureAttributes: grantType.PostureAttributes,
+				RequesterNodeID:   request.RequesterNode,
+				Routes:            grantType.RouteAction.EnabledRoutes(),
+				DisableKeyExpiry:  action == ActionKeyExpiry,
+				Authorize:         action == ActionDeviceAuthorize,
+			})
+		}
+		failed := 0
+		for i, f := range futures {
+			if err := f.Get(ctx, nil); err != nil {
+				state.Targets[i].State = TargetFailed
+				state.Targets[i].Error = err.Error()
+				failed++
+				continue
+			}
+			state.Targets[i].State = TargetActive
+		}
+		if failed > 0 {
+			logger.Error("Grant activation failed, rolling back", "grantID", request.ID, "failed", failed, "targets", len(state.Targets))
+			removeFromTargets(ctx, request.ID, state.Targets)
+			state.Status = StatusFailed
+			errs := make(map[string]string, failed)
+			for _, t := range state.Targets {
+				if t.Error != "" {
+					errs[t.NodeID] = t.Error
+				}
+			}
+			auditEvent(audit.EventFailed, "", fmt.Sprintf("activation failed on %d of %d devices", failed, len(state.Targets)), errs)
+			return state, nil
 		}
-		tagMgrID = fmt.Sprintf("device-tags-%s", request.TargetNodeID)
 
 	case ActionUserRole:
 		if grantType.UserAction == nil {
@@ -88,6 +516,28 @@ func GrantWorkflow(ctx workflow.Context, request GrantRequest, grantType GrantTy
 			return state, fmt.Errorf("restore user: %w", err)
 		}
 		logger.Info("User restored", "userID", request.TargetUserID)
+
+	case ActionGroupMembership:
+		if grantType.GroupAction == nil {
+			return state, fmt.Errorf("group_membership grant type %q missing groupAction config", grantType.Name)
+		}
+		member := request.Requester
+		if grantType.GroupAction.Member == GroupMemberTarget {
+			var user UserInfo
+			if err := workflow.ExecuteActivity(actCtx, activities.GetUser, request.TargetUserID).Get(ctx, &user); err != nil {
+				return state, fmt.Errorf("get user for group membership: %w", err)
+			}
+			member = user.LoginName
+		}
+		membership := GroupMembership{Group: grantType.GroupAction.Group, Member: member}
+		if err := workflow.ExecuteActivity(actCtx, activities.SignalWithStartPolicyEditor, taskQueue, AddMembershipSignal{
+			GrantID:    request.ID,
+			Membership: membership,
+		}).Get(ctx, nil); err != nil {
+			return state, fmt.Errorf("add %s to %s: %w", member, membership.Group, err)
+		}
+		state.GroupMembership = &membership
+		logger.Info("Group membership added", "group", membership.Group, "member", member)
 	}
 
 	// Activate the grant
@@ -95,16 +545,217 @@ func GrantWorkflow(ctx workflow.Context, request GrantRequest, grantType GrantTy
 	state.Status = StatusActive
 	state.ActivatedAt = now
 	state.ExpiresAt = now.Add(request.Duration)
+	publish()
 
-	remaining := request.Duration
+	// The timer is only replaced when an extension is accepted, so ignored
+	// (unauthorized) signals do not reset the remaining time.
+	timerCtx, timerCancel := workflow.WithCancel(ctx)
+	timerFuture := workflow.NewTimer(timerCtx, request.Duration)
+	auditEvent(audit.EventActivated, "", "", map[string]string{"expiresAt": state.ExpiresAt.Format(time.RFC3339)})
+	notifyEvent(notify.EventActivated, "", "")
 
-	for state.Status == StatusActive {
-		timerCtx, timerCancel := workflow.WithCancel(ctx)
-		timerFuture := workflow.NewTimer(timerCtx, remaining)
+	// Break-glass review: any approver may acknowledge the grant or reject
+	// it, which revokes it if it is still active. A review still pending at
+	// its deadline is flagged as unreviewed.
+	ackCh := workflow.GetSignalChannel(ctx, "acknowledge")
+	rejectCh := workflow.GetSignalChannel(ctx, "reject")
+	var reviewTimer workflow.Future
+	if state.BreakGlass != nil {
+		state.BreakGlass.Deadline = now.Add(breakGlassReviewWindow)
+		reviewTimer = workflow.NewTimer(ctx, breakGlassReviewWindow)
+		publish()
+		if notifying {
+			sendNotification(ctx, notify.Notification{
+				Event:         notify.EventBreakGlass,
+				GrantID:       request.ID,
+				GrantType:     grantType.Name,
+				Requester:     request.Requester,
+				Actor:         request.Requester,
+				Reason:        request.Reason,
+				Targets:       GrantTargets(state),
+				Approvers:     state.BreakGlass.Approvers,
+				StageDeadline: state.BreakGlass.Deadline,
+				ExpiresAt:     state.ExpiresAt,
+			})
+		}
+	}
+	receiveReview := func(ch workflow.ReceiveChannel, outcome ReviewStatus) bool {
+		var sig ReviewSignal
+		ch.Receive(ctx, &sig)
+		caller, err := resolveCaller(actCtx, grantType.ForLastStage(), sig.ReviewedBy)
+		if err != nil {
+			logger.Error("Failed to resolve reviewer", "grantID", request.ID, "attemptedBy", sig.ReviewedBy, "error", err)
+			return false
+		}
+		if !CanApprove(request, caller) {
+			logger.Warn("Unauthorized break-glass review", "grantID", request.ID, "attemptedBy", sig.ReviewedBy)
+			return false
+		}
+		review := state.BreakGlass
+		review.Status = outcome
+		review.ReviewedBy = sig.ReviewedBy
+		review.ReviewedAt = workflow.Now(ctx)
+		review.Note = sig.Note
+		logger.Info("Break-glass grant reviewed", "grantID", request.ID, "reviewedBy", sig.ReviewedBy, "outcome", outcome)
+		typ := audit.EventBreakGlassAcknowledged
+		if outcome == ReviewRejected {
+			typ = audit.EventBreakGlassRejected
+		}
+		auditEvent(typ, sig.ReviewedBy, sig.Note, nil)
+		publish()
+		return true
+	}
+	addReview := func(sel workflow.Selector) {
+		if state.BreakGlass == nil || state.BreakGlass.Status != ReviewPending || reviewTimer == nil {
+			return
+		}
+		sel.AddReceive(ackCh, func(ch workflow.ReceiveChannel, more bool) {
+			receiveReview(ch, ReviewAcknowledged)
+		})
+		sel.AddReceive(rejectCh, func(ch workflow.ReceiveChannel, more bool) {
+			if !receiveReview(ch, ReviewRejected) || state.Status != StatusActive {
+				return
+			}
+			state.Status = StatusRevoked
+			state.RevokedBy = state.BreakGlass.ReviewedBy
+			state.RevokedAt = state.BreakGlass.ReviewedAt
+			revokeReason = "break-glass use rejected"
+			if state.BreakGlass.Note != "" {
+				revokeReason += ": " + state.BreakGlass.Note
+			}
+			timerCancel()
+		})
+		sel.AddFuture(reviewTimer, func(f workflow.Future) {
+			if err := f.Get(ctx, nil); err != nil {
+				return
+			}
+			state.BreakGlass.Status = ReviewUnreviewed
+			logger.Warn("Break-glass grant not reviewed", "grantID", request.ID, "deadline", state.BreakGlass.Deadline)
+			auditEvent(audit.EventBreakGlassUnreviewed, "", "", map[string]string{"deadline": state.BreakGlass.Deadline.Format(time.RFC3339)})
+			publish()
+		})
+	}
+
+	// The expiring_soon notification fires the grant type's expiryWarning
+	// before the grant expires and is rearmed when it is extended.
+	var warnFuture workflow.Future
+	warnCancel := func() {}
+	armExpiryWarning := func() {
+		warnCancel()
+		warnFuture = nil
+		state.ExpiringSoon = false
+		lead := time.Duration(grantType.ExpiryWarning)
+		if !notifying || lead <= 0 {
+			return
+		}
+		wait := state.ExpiresAt.Sub(workflow.Now(ctx)) - lead
+		if wait <= 0 {
+			state.ExpiringSoon = true
+			return
+		}
+		var warnCtx workflow.Context
+		warnCtx, warnCancel = workflow.WithCancel(ctx)
+		warnFuture = workflow.NewTimer(warnCtx, wait)
+	}
+	armExpiryWarning()
+
+	// extend restarts the expiry timer to run d from now, clamped to the
+	// grant type's maxDuration and to what is left of its maxTotalDuration,
+	// which an approved renewal can run into while it waits. It does nothing
+	// once the grant type's extensions are used up.
+	extend := func(by, approvedBy string, d time.Duration, details map[string]string) {
+		now := workflow.Now(ctx)
+		if grantType.MaxExtensions > 0 && len(state.Extensions) >= grantType.MaxExtensions {
+			logger.Warn("Extension limit reached, ignoring", "grantID", request.ID, "attemptedBy", by, "maxExtensions", grantType.MaxExtensions)
+			return
+		}
+		maxDur := time.Duration(grantType.MaxDuration)
+		if maxDur > 0 && d > maxDur {
+			d = maxDur
+			logger.Info("Extend duration clamped to max", "grantID", request.ID, "maxDuration", maxDur)
+		}
+		if maxTotal := time.Duration(grantType.MaxTotalDuration); maxTotal > 0 {
+			left := state.ActivatedAt.Add(maxTotal).Sub(now)
+			if left <= 0 {
+				logger.Warn("Grant at max lifetime, ignoring extension", "grantID", request.ID, "attemptedBy", by, "maxTotalDuration", maxTotal)
+				return
+			}
+			if d > left {
+				d = left
+				logger.Info("Extend duration clamped to max lifetime", "grantID", request.ID, "maxTotalDuration", maxTotal)
+			}
+		}
 
-		revokeCh := workflow.GetSignalChannel(ctx, "revoke")
-		extendCh := workflow.GetSignalChannel(ctx, "extend")
+		timerCancel()
+		timerCtx, timerCancel = workflow.WithCancel(ctx)
+		timerFuture = workflow.NewTimer(timerCtx, d)
+		state.ExpiresAt = now.Add(d)
+		state.Extensions = append(state.Extensions, Extension{By: by, At: now, Duration: d, ApprovedBy: approvedBy})
+		armExpiryWarning()
+		publish()
+		// Extensions count against the quota too.
+		if quotaHeld {
+			extendQuota(ctx, request, state)
+		}
+		logger.Info("Grant extended", "grantID", request.ID, "newDuration", d)
+		if details == nil {
+			details = make(map[string]string)
+		}
+		if approvedBy != "" {
+			details["approvedBy"] = approvedBy
+		}
+		details["duration"] = d.String()
+		details["expiresAt"] = state.ExpiresAt.Format(time.RFC3339)
+		auditEvent(audit.EventExtended, by, "", details)
+	}
+
+	// Renewals that need approval wait for a new ApprovalWorkflow, under
+	// the same ID as the original so approvals reach it the same way, while
+	// the grant stays active. Extensions take the same path whenever
+	// renewals would.
+	renewCh := workflow.GetSignalChannel(ctx, "renew")
+	progressCh := workflow.GetSignalChannel(ctx, "approval-progress")
+	var renewalFuture workflow.Future
+	requestRenewal := func(by string, d time.Duration, reason string) {
+		if state.Renewal != nil {
+			logger.Warn("Renewal already pending, ignoring", "grantID", request.ID, "attemptedBy", by)
+			return
+		}
+		now := workflow.Now(ctx)
+		stage := grantType.StageStatus(0, now.Add(time.Duration(grantType.Stages()[0].Timeout)))
+		state.Renewal = &RenewalStatus{
+			RequestedBy:   by,
+			RequestedAt:   now,
+			Duration:      d,
+			Reason:        reason,
+			ApprovalStage: &stage,
+		}
+		childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
+			WorkflowID: fmt.Sprintf("approval-%s", request.ID),
+		})
+		renewalFuture = workflow.ExecuteChildWorkflow(childCtx, ApprovalWorkflow, request.ID, grantType, request.Requester, by)
+		publish()
+		logger.Info("Renewal requested", "grantID", request.ID, "requestedBy", by, "duration", d)
+		auditEvent(audit.EventRequested, by, reason, map[string]string{
+			"renewal":  "true",
+			"duration": d.String(),
+		})
+	}
+	// checkExtension applies the grant type's limits to a requested
+	// extension. Requests over maxDuration are clamped rather than refused,
+	// as they always have been; the API refuses them up front.
+	checkExtension := func(by string, d time.Duration) bool {
+		if maxDur := time.Duration(grantType.MaxDuration); maxDur > 0 && d > maxDur {
+			d = maxDur
+		}
+		if err := CheckExtension(grantType, state, d, workflow.Now(ctx)); err != nil {
+			logger.Warn("Extension over policy, ignoring", "grantID", request.ID, "attemptedBy", by, "error", err)
+			return false
+		}
+		return true
+	}
 
+	for state.Status == StatusActive {
 		sel := workflow.NewSelector(ctx)
 
 		sel.AddFuture(timerFuture, func(f workflow.Future) {
@@ -113,46 +764,142 @@ func GrantWorkflow(ctx workflow.Context, request GrantRequest, grantType GrantTy
 			}
 		})
 
+		if warnFuture != nil {
+			sel.AddFuture(warnFuture, func(f workflow.Future) {
+				warnFuture = nil
+				if err := f.Get(ctx, nil); err == nil {
+					state.ExpiringSoon = true
+					publish()
+					notifyEvent(notify.EventExpiringSoon, "", "")
+				}
+			})
+		}
+
 		sel.AddReceive(revokeCh, func(ch workflow.ReceiveChannel, more bool) {
-			var sig RevokeSignal
-			ch.Receive(ctx, &sig)
-			timerCancel()
-			state.Status = StatusRevoked
-			state.RevokedBy = sig.RevokedBy
-			state.RevokedAt = workflow.Now(ctx)
-			logger.Info("Grant revoked", "grantID", request.ID, "revokedBy", sig.RevokedBy)
+			if receiveRevoke(ch) {
+				timerCancel()
+			}
+		})
+
+		sel.AddReceive(tailnetCh, func(ch workflow.ReceiveChannel, more bool) {
+			if receiveTailnetEvent(ch) {
+				timerCancel()
+			}
 		})
 
 		sel.AddReceive(extendCh, func(ch workflow.ReceiveChannel, more bool) {
 			var sig ExtendSignal
 			ch.Receive(ctx, &sig)
-			timerCancel()
+			caller, err := resolveCaller(actCtx, grantType, sig.ExtendedBy)
+			if err != nil {
+				logger.Error("Failed to resolve extender", "grantID", request.ID, "attemptedBy", sig.ExtendedBy, "error", err)
+				return
+			}
+			if !CanExtend(grantType, request, caller) {
+				logger.Warn("Unauthorized extend attempt", "grantID", request.ID, "attemptedBy", sig.ExtendedBy)
+				return
+			}
+			if !checkExtension(sig.ExtendedBy, sig.Duration) {
+				return
+			}
+			// Medium and high risk extensions go through approval like
+			// renewals do.
+			if grantType.RenewalNeedsApproval() {
+				requestRenewal(sig.ExtendedBy, sig.Duration, "")
+				return
+			}
+			extend(sig.ExtendedBy, "", sig.Duration, nil)
+		})
 
-			maxDur := time.Duration(grantType.MaxDuration)
-			if maxDur > 0 && sig.Duration > maxDur {
-				sig.Duration = maxDur
-				logger.Info("Extend duration clamped to max", "grantID", request.ID, "maxDuration", maxDur)
+		sel.AddReceive(renewCh, func(ch workflow.ReceiveChannel, more bool) {
+			var sig RenewSignal
+			ch.Receive(ctx, &sig)
+			caller, err := resolveCaller(actCtx, grantType, sig.RequestedBy)
+			if err != nil {
+				logger.Error("Failed to resolve renewer", "grantID", request.ID, "attemptedBy", sig.RequestedBy, "error", err)
+				return
+			}
+			if !CanExtend(grantType, request, caller) {
+				logger.Warn("Unauthorized renewal attempt", "grantID", request.ID, "attemptedBy", sig.RequestedBy)
+				return
 			}
+			if !checkExtension(sig.RequestedBy, sig.Duration) {
+				return
+			}
+			if !grantType.RenewalNeedsApproval() {
+				extend(sig.RequestedBy, "", sig.Duration, map[string]string{"renewal": "true"})
+				return
+			}
+			requestRenewal(sig.RequestedBy, sig.Duration, sig.Reason)
+		})
 
-			remaining = sig.Duration
-			state.ExpiresAt = workflow.Now(ctx).Add(sig.Duration)
-			logger.Info("Grant extended", "grantID", request.ID, "newDuration", sig.Duration)
+		if renewalFuture != nil {
+			sel.AddFuture(renewalFuture, func(f workflow.Future) {
+				renewalFuture = nil
+				renewal := state.Renewal
+				state.Renewal = nil
+				var result ApprovalResult
+				if err := f.Get(ctx, &result); err != nil {
+					logger.Error("Renewal approval failed", "grantID", request.ID, "error", err)
+					publish()
+					return
+				}
+				if !result.Approved {
+					logger.Info("Renewal denied", "grantID", request.ID, "deniedBy", result.DeniedBy, "reason", result.Reason)
+					publish()
+					auditEvent(audit.EventDenied, result.DeniedBy, result.Reason, map[string]string{"renewal": "true"})
+					notifyEvent(notify.EventDenied, result.DeniedBy, result.Reason)
+					return
+				}
+				notifyEvent(notify.EventApproved, result.ApprovedBy, "")
+				extend(renewal.RequestedBy, result.ApprovedBy, renewal.Duration, map[string]string{"renewal": "true"})
+			})
+		}
+
+		addReview(sel)
+
+		sel.AddReceive(progressCh, func(ch workflow.ReceiveChannel, more bool) {
+			var progress ApprovalProgress
+			ch.Receive(ctx, &progress)
+			if state.Renewal == nil {
+				return
+			}
+			state.Renewal.Approvals = progress.Approvals
+			state.Renewal.ApprovalStage = &progress.Stage
+			publish()
 		})
 
 		sel.Select(ctx)
 	}
+	warnCancel()
 
 	// Deactivate phase: revert the grant's effect based on action type.
 	switch action {
-	case ActionTag:
-		if err := workflow.SignalExternalWorkflow(ctx, tagMgrID, "", "remove-grant", RemoveGrantSignal{
+	case ActionTag, ActionRoutes, ActionKeyExpiry, ActionDeviceAuthorize:
+		removeFromTargets(ctx, request.ID, state.Targets)
+
+	case ActionPolicyGrant:
+		err := workflow.SignalExternalWorkflow(ctx, PolicyEditorWorkflowID, "", "remove-policy-grant", RemoveGrantSignal{
 			GrantID: request.ID,
-		}).Get(ctx, nil); err != nil {
-			logger.Error("Failed to signal tag manager remove", "grantID", request.ID, "error", err)
+		}).Get(ctx, nil)
+		if err != nil {
+			logger.Error("Failed to signal policy editor remove", "grantID", request.ID, "error", err)
+		} else {
+			logger.Info("Policy grant removal requested", "grantID", request.ID)
+		}
+		for i := range state.Targets {
+			if err != nil {
+				state.Targets[i].State = TargetRemoveFailed
+				state.Targets[i].Error = err.Error()
+			} else {
+				state.Targets[i].State = TargetRemoved
+			}
 		}
 
 	case ActionUserRole:
-		if state.OriginalRole == "" {
+		if roleOverridden {
+			logger.Info("User role changed outside TailGrant, not reverting", "userID", request.TargetUserID)
+		} else if state.OriginalRole == "" {
 			logger.Error("Cannot revert user role: originalRole is empty, skipping", "userID", request.TargetUserID)
 		} else if err := workflow.ExecuteActivity(actCtx, activities.SetUserRole, request.TargetUserID, state.OriginalRole).Get(ctx, nil); err != nil {
 			logger.Error("Failed to revert user role", "userID", request.TargetUserID, "role", state.OriginalRole, "error", err)
@@ -166,8 +913,229 @@ func GrantWorkflow(ctx workflow.Context, request GrantRequest, grantType GrantTy
 		} else {
 			logger.Info("User re-suspended", "userID", request.TargetUserID)
 		}
+
+	case ActionGroupMembership:
+		if err := workflow.SignalExternalWorkflow(ctx, PolicyEditorWorkflowID, "", "remove-membership", RemoveGrantSignal{
+			GrantID: request.ID,
+		}).Get(ctx, nil); err != nil {
+			logger.Error("Failed to signal policy editor remove", "grantID", request.ID, "error", err)
+		} else {
+			logger.Info("Group membership removal requested", "group", state.GroupMembership.Group, "member", state.GroupMembership.Member)
+		}
+	}
+
+	switch state.Status {
+	case StatusRevoked:
+		auditEvent(audit.EventRevoked, state.RevokedBy, revokeReason, nil)
+		notifyEvent(notify.EventRevoked, state.RevokedBy, revokeReason)
+	case StatusExpired:
+		auditEvent(audit.EventExpired, "", "", nil)
+		notifyEvent(notify.EventExpired, "", "")
+	}
+
+	// The review of a break-glass grant outlives the grant itself.
+	if state.BreakGlass != nil && state.BreakGlass.Status == ReviewPending && reviewTimer != nil {
+		if quotaHeld {
+			releaseQuota(ctx, request, state)
+			quotaHeld = false
+		}
+		logger.Info("Waiting for break-glass review", "grantID", request.ID, "deadline", state.BreakGlass.Deadline)
+		for state.BreakGlass.Status == ReviewPending {
+			sel := workflow.NewSelector(ctx)
+			addReview(sel)
+			sel.Select(ctx)
+		}
 	}
 
 	logger.Info("GrantWorkflow completed", "grantID", request.ID, "status", state.Status)
 	return state, nil
 }
+
+// resolveCaller resolves the membership of a user signalling the workflow.
+// Grant types that name groups are resolved through an activity at signal
+// time, so tailnet group and role changes apply to grants already in
+// flight; plain login lists are resolved in the workflow.
+func resolveCaller(ctx workflow.Context, gt GrantType, login string) (Caller, error) {
+	if login == "" || !gt.NeedsDirectory() {
+		return staticCaller(gt, login), nil
+	}
+	var activities *Activities
+	var c Caller
+	if err := workflow.ExecuteActivity(ctx, activities.ResolveCaller, gt, login).Get(ctx, &c); err != nil {
+		return Caller{Login: login}, err
+	}
+	return c, nil
+}
+
+// resolveTargets returns the devices a tag grant applies to, checked
+// against the grant type's target selector. Devices named in ids must all
+// still be allowed; a TargetTag is resolved to the tagged devices the
+// selector allows, each of which must also pass the request policy when
+// policy is non-nil. A non-empty reason means the grant must be denied.
+func resolveTargets(ctx workflow.Context, request GrantRequest, ids []string, gt GrantType, policy *PolicyInput) (targets []TargetStatus, reason string, err error) {
+	var activities *Activities
+
+	if request.TargetTag != "" {
+		var devices []tailscale.Device
+		if err := workflow.ExecuteActivity(ctx, activities.ListDevices).Get(ctx, &devices); err != nil {
+			return nil, "", fmt.Errorf("list devices for %s: %w", request.TargetTag, err)
+		}
+		for _, d := range devices {
+			if !slices.Contains(d.Tags, request.TargetTag) || gt.Targets.Check(&d, request.Requester) != nil {
+				continue
+			}
+			if policy != nil {
+				decision, err := EvaluatePolicy(&gt, policy.ForTarget(&d))
+				if err != nil || decision.Decision == DecisionDeny {
+					msg := cmp.Or(decision.Message, "denied by policy")
+					return nil, fmt.Sprintf("target %s: %s", d.Hostname, msg), nil
+				}
+			}
+			targets = append(targets, TargetStatus{NodeID: d.NodeID, Name: d.Hostname, State: TargetPending})
+		}
+		if len(targets) == 0 {
+			return nil, fmt.Sprintf("no allowed devices have %s", request.TargetTag), nil
+		}
+		return targets, "", nil
+	}
+
+	if len(ids) == 0 {
+		return nil, "", fmt.Errorf("tag grant %s has no target devices", request.ID)
+	}
+	targets = make([]TargetStatus, len(ids))
+	for i, id := range ids {
+		targets[i] = TargetStatus{NodeID: id, State: TargetPending}
+	}
+	if gt.Targets == nil {
+		return targets, "", nil
+	}
+
+	// Devices may have changed since the request was made (retagged,
+	// renamed, reassigned), so check the target selector again.
+	futures := make([]workflow.Future, len(ids))
+	for i, id := range ids {
+		futures[i] = workflow.ExecuteActivity(ctx, activities.GetDevice, id)
+	}
+	for i, f := range futures {
+		var dev tailscale.Device
+		if err := f.Get(ctx, &dev); err != nil {
+			return nil, "", fmt.Errorf("get target device: %w", err)
+		}
+		if err := gt.Targets.Check(&dev, request.Requester); err != nil {
+			return nil, "target no longer allowed: " + err.Error(), nil
+		}
+		targets[i].Name = dev.Hostname
+	}
+	return targets, "", nil
+}
+
+// recordDeviceSettings records the setting a key_expiry or
+// device_authorize grant changes on each target device, before it does.
+func recordDeviceSettings(ctx workflow.Context, action ActionType, targets []TargetStatus) error {
+	var activities *Activities
+	futures := make([]workflow.Future, len(targets))
+	for i, t := range targets {
+		futures[i] = workflow.ExecuteActivity(ctx, activities.GetDevice, t.NodeID)
+	}
+	for i, f := range futures {
+		var dev tailscale.Device
+		if err := f.Get(ctx, &dev); err != nil {
+			return fmt.Errorf("get target device: %w", err)
+		}
+		if action == ActionKeyExpiry {
+			targets[i].KeyExpiryDisabled = &dev.KeyExpiryDisabled
+		} else {
+			targets[i].Authorized = &dev.Authorized
+		}
+		if targets[i].Name == "" {
+			targets[i].Name = dev.Hostname
+		}
+	}
+	return nil
+}
+
+// activatePolicyGrant builds a policy_grant grant's grants entry, from the
+// requester to the addresses of its target devices, and has the
+// PolicyEditorWorkflow insert it once the policy file validates with it.
+// The targets are active once the editor reports the entry written. A
+// non-empty reason means the entry was rejected and the grant failed.
+func activatePolicyGrant(ctx, actCtx workflow.Context, request GrantRequest, gt GrantType, state *GrantState) (reason string, err error) {
+	if gt.PolicyGrant == nil {
+		return "", fmt.Errorf("policy_grant grant type %q missing policyGrant config", gt.Name)
+	}
+	var activities *Activities
+
+	futures := make([]workflow.Future, len(state.Targets))
+	for i, t := range state.Targets {
+		futures[i] = workflow.ExecuteActivity(actCtx, activities.GetDevice, t.NodeID)
+	}
+	entry := tsapi.PolicyGrant{
+		Src: []string{request.Requester},
+		IP:  gt.PolicyGrant.IP,
+		App: gt.PolicyGrant.App,
+	}
+	for i, f := range futures {
+		var dev tailscale.Device
+		if err := f.Get(ctx, &dev); err != nil {
+			return "", fmt.Errorf("get target device: %w", err)
+		}
+		entry.Dst = append(entry.Dst, dev.Addresses...)
+		if state.Targets[i].Name == "" {
+			state.Targets[i].Name = dev.Hostname
+		}
+	}
+
+	if err := workflow.ExecuteActivity(actCtx, activities.ValidatePolicyGrant, request.ID, entry).Get(ctx, nil); err != nil {
+		if isPolicyRejection(err) {
+			return "policy file rejected the grant: " + err.Error(), nil
+		}
+		return "", fmt.Errorf("validate policy grant: %w", err)
+	}
+	taskQueue := workflow.GetInfo(ctx).TaskQueueName
+	if err := workflow.ExecuteActivity(actCtx, activities.SignalWithStartPolicyEditorGrant, taskQueue, AddPolicyGrantSignal{
+		GrantID: request.ID,
+		Grant:   entry,
+	}).Get(ctx, nil); err != nil {
+		return "", fmt.Errorf("add policy grant: %w", err)
+	}
+	var result PolicyGrantResult
+	workflow.GetSignalChannel(ctx, "policy-grant-result").Receive(ctx, &result)
+	if result.Rejected != "" {
+		return "policy file rejected the grant: " + result.Rejected, nil
+	}
+	state.PolicyGrant = &entry
+	for i := range state.Targets {
+		state.Targets[i].State = TargetActive
+	}
+	workflow.GetLogger(ctx).Info("Policy grant added", "grantID", request.ID, "dst", entry.Dst)
+	return "", nil
+}
+
+// removeFromTargets signals every device the grant is active on to remove
+// it, recording per-device results in targets. Failures are logged and
+// reported rather than returned so one unreachable device does not keep
+// the grant on the others.
+func removeFromTargets(ctx workflow.Context, grantID string, targets []TargetStatus) {
+	logger := workflow.GetLogger(ctx)
+	futures := make([]workflow.Future, len(targets))
+	for i, t := range targets {
+		if t.State != TargetActive {
+			continue
+		}
+		futures[i] = workflow.SignalExternalWorkflow(ctx, fmt.Sprintf("device-tags-%s", t.NodeID), "", "remove-grant", RemoveGrantSignal{
+			GrantID: grantID,
+		})
+	}
+	for i, f := range futures {
+		if f == nil {
+			continue
+		}
+		if err := f.Get(ctx, nil); err != nil {
+			logger.Error("Failed to signal tag manager remove", "grantID", grantID, "nodeID", targets[i].NodeID, "error", err)
+			targets[i].State = TargetRemoveFailed
+			targets[i].Error = err.Error()
+			continue
+		}
+		targets[i].State = TargetRemoved
+	}
+}
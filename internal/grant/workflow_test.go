@@ -4,9 +4,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/rajsinghtech/tailgrant/internal/notify"
+	"github.com/rajsinghtech/tailgrant/internal/tsapi"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/testsuite"
+	tailscale "tailscale.com/client/tailscale/v2"
 )
 
 func setupWorkflowTestEnv() (*testsuite.TestWorkflowEnvironment, *testsuite.WorkflowTestSuite) {
@@ -15,12 +19,21 @@ func setupWorkflowTestEnv() (*testsuite.TestWorkflowEnvironment, *testsuite.Work
 
 	activities := &Activities{}
 	env.RegisterActivity(activities.SignalWithStartDeviceTagManager)
+	env.RegisterActivity(activities.SignalWithStartPolicyEditor)
+	env.RegisterActivity(activities.SignalWithStartPolicyEditorGrant)
+	env.RegisterActivity(activities.ValidatePolicyGrant)
 	env.RegisterActivity(activities.GetUser)
 	env.RegisterActivity(activities.SetUserRole)
 	env.RegisterActivity(activities.SuspendUser)
 	env.RegisterActivity(activities.RestoreUser)
+	env.RegisterActivity(activities.ResolveCaller)
+	env.RegisterActivity(activities.LoadPolicyInputs)
+	env.RegisterActivity(activities.GetDevice)
+	env.RegisterActivity(activities.ListDevices)
+	env.RegisterActivity(activities.RecordAuditEvent)
 	env.RegisterWorkflow(ApprovalWorkflow)
 	env.RegisterWorkflow(DeviceTagManagerWorkflow)
+	registerNotifications(env)
 
 	env.OnSignalExternalWorkflow(mock.Anything, mock.Anything, mock.Anything, "remove-grant", mock.Anything).Return(nil)
 
@@ -77,7 +90,7 @@ func TestGrantWorkflow_RequiresApproval_Approved(t *testing.T) {
 		ApprovedBy: "approver@example.com",
 	}
 
-	env.OnWorkflow("ApprovalWorkflow", mock.Anything, "grant-789", grantType, "user@example.com").Return(approvalResult, nil)
+	env.OnWorkflow("ApprovalWorkflow", mock.Anything, "grant-789", grantType, "user@example.com", "").Return(approvalResult, nil)
 	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-999", mock.Anything, mock.Anything).Return(nil)
 
 	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
@@ -114,7 +127,7 @@ func TestGrantWorkflow_RequiresApproval_Denied(t *testing.T) {
 		Reason:   "insufficient justification",
 	}
 
-	env.OnWorkflow("ApprovalWorkflow", mock.Anything, "grant-321", grantType, "user@example.com").Return(approvalResult, nil)
+	env.OnWorkflow("ApprovalWorkflow", mock.Anything, "grant-321", grantType, "user@example.com", "").Return(approvalResult, nil)
 
 	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
 
@@ -141,6 +154,7 @@ func TestGrantWorkflow_Revoked(t *testing.T) {
 		Name:      "low-risk-access",
 		Tags:      []string{"tag:jit-read"},
 		RiskLevel: RiskLow,
+		Admins:    []string{"admin@example.com"},
 	}
 
 	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-888", mock.Anything, mock.Anything).Return(nil)
@@ -267,6 +281,195 @@ func TestGrantWorkflow_UserRole_Elevation(t *testing.T) {
 	require.Equal(t, "member", result.OriginalRole)
 }
 
+func TestGrantWorkflow_GroupMembership(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-group",
+		Requester:    "user@example.com",
+		TargetUserID: "user-456",
+		Duration:     time.Hour,
+	}
+	grantType := GrantType{
+		Name:        "db-admin",
+		RiskLevel:   RiskLow,
+		Action:      ActionGroupMembership,
+		GroupAction: &GroupAction{Group: "group:db-admins", Member: GroupMemberTarget},
+	}
+
+	env.OnActivity("GetUser", mock.Anything, "user-456").Return(&UserInfo{ID: "user-456", LoginName: "dba@example.com"}, nil)
+	env.OnActivity("SignalWithStartPolicyEditor", mock.Anything, mock.Anything, AddMembershipSignal{
+		GrantID:    "grant-group",
+		Membership: GroupMembership{Group: "group:db-admins", Member: "dba@example.com"},
+	}).Return(nil).Once()
+	removed := false
+	env.OnSignalExternalWorkflow(mock.Anything, PolicyEditorWorkflowID, "", "remove-membership", RemoveGrantSignal{GrantID: "grant-group"}).Run(func(mock.Arguments) {
+		removed = true
+	}).Return(nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Equal(t, &GroupMembership{Group: "group:db-admins", Member: "dba@example.com"}, result.GroupMembership)
+	require.True(t, removed, "membership removal not signaled")
+}
+
+func TestGrantWorkflow_PolicyGrant(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-policy",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-db",
+		Duration:     time.Hour,
+	}
+	grantType := GrantType{
+		Name:        "ssh-prod",
+		RiskLevel:   RiskLow,
+		Action:      ActionPolicyGrant,
+		PolicyGrant: &PolicyGrantAction{IP: []string{"tcp:22"}},
+	}
+	entry := tsapi.PolicyGrant{
+		Src: []string{"user@example.com"},
+		Dst: []string{"100.64.0.5", "fd7a:115c:a1e0::5"},
+		IP:  []string{"tcp:22"},
+	}
+
+	env.OnActivity("GetDevice", mock.Anything, "node-db").Return(&tailscale.Device{
+		NodeID:    "node-db",
+		Hostname:  "db",
+		Addresses: []string{"100.64.0.5", "fd7a:115c:a1e0::5"},
+	}, nil)
+	env.OnActivity("ValidatePolicyGrant", mock.Anything, "grant-policy", entry).Return(nil).Once()
+	env.OnActivity("SignalWithStartPolicyEditorGrant", mock.Anything, mock.Anything, AddPolicyGrantSignal{
+		GrantID: "grant-policy",
+		Grant:   entry,
+	}).Return(nil).Once()
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("policy-grant-result", PolicyGrantResult{GrantID: "grant-policy"})
+	}, time.Second)
+	removed := false
+	env.OnSignalExternalWorkflow(mock.Anything, PolicyEditorWorkflowID, "", "remove-policy-grant", RemoveGrantSignal{GrantID: "grant-policy"}).Run(func(mock.Arguments) {
+		removed = true
+	}).Return(nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Equal(t, &entry, result.PolicyGrant)
+	require.Len(t, result.Targets, 1)
+	require.Equal(t, "db", result.Targets[0].Name)
+	require.Equal(t, TargetRemoved, result.Targets[0].State)
+	require.True(t, removed, "policy grant removal not signaled")
+}
+
+func TestGrantWorkflow_PolicyGrant_Rejected(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-policy-bad",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-db",
+		Duration:     time.Hour,
+	}
+	grantType := GrantType{
+		Name:        "ssh-prod",
+		RiskLevel:   RiskLow,
+		Action:      ActionPolicyGrant,
+		PolicyGrant: &PolicyGrantAction{IP: []string{"tcp:22"}},
+	}
+
+	env.OnActivity("GetDevice", mock.Anything, "node-db").Return(&tailscale.Device{NodeID: "node-db", Addresses: []string{"100.64.0.5"}}, nil)
+	env.OnActivity("ValidatePolicyGrant", mock.Anything, "grant-policy-bad", mock.Anything).Return(
+		temporal.NewNonRetryableApplicationError("ACL validation failed: unknown capability", "InvalidPolicy", nil))
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusFailed, result.Status)
+	require.Nil(t, result.PolicyGrant)
+	env.AssertNotCalled(t, "SignalWithStartPolicyEditorGrant", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGrantWorkflow_PolicyGrant_ValidateUnavailable(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-policy-down",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-db",
+		Duration:     time.Hour,
+	}
+	grantType := GrantType{
+		Name:        "ssh-prod",
+		RiskLevel:   RiskLow,
+		Action:      ActionPolicyGrant,
+		PolicyGrant: &PolicyGrantAction{IP: []string{"tcp:22"}},
+	}
+
+	env.OnActivity("GetDevice", mock.Anything, "node-db").Return(&tailscale.Device{NodeID: "node-db", Addresses: []string{"100.64.0.5"}}, nil)
+	env.OnActivity("ValidatePolicyGrant", mock.Anything, "grant-policy-down", mock.Anything).Return(
+		temporal.NewNonRetryableApplicationError("tailscale API returned 503", "test", nil))
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	// Only a rejection fails the grant; other errors fail the workflow.
+	require.Error(t, env.GetWorkflowError())
+	env.AssertNotCalled(t, "SignalWithStartPolicyEditorGrant", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGrantWorkflow_PolicyGrant_WriteRejected(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-policy-late",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-db",
+		Duration:     time.Hour,
+	}
+	grantType := GrantType{
+		Name:        "ssh-prod",
+		RiskLevel:   RiskLow,
+		Action:      ActionPolicyGrant,
+		PolicyGrant: &PolicyGrantAction{IP: []string{"tcp:22"}},
+	}
+
+	env.OnActivity("GetDevice", mock.Anything, "node-db").Return(&tailscale.Device{NodeID: "node-db", Addresses: []string{"100.64.0.5"}}, nil)
+	env.OnActivity("ValidatePolicyGrant", mock.Anything, "grant-policy-late", mock.Anything).Return(nil)
+	env.OnActivity("SignalWithStartPolicyEditorGrant", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	env.RegisterDelayedCallback(func() {
+		// The policy file changed between validation and the editor's write.
+		env.SignalWorkflow("policy-grant-result", PolicyGrantResult{GrantID: "grant-policy-late", Rejected: "policy file rejected: test(s) failed"})
+	}, time.Second)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusFailed, result.Status)
+	require.Nil(t, result.PolicyGrant)
+	require.Len(t, result.Targets, 1)
+	require.NotEqual(t, TargetActive, result.Targets[0].State)
+}
+
 func TestGrantWorkflow_UserRole_Revoked(t *testing.T) {
 	env, _ := setupWorkflowTestEnv()
 
@@ -282,6 +485,7 @@ func TestGrantWorkflow_UserRole_Revoked(t *testing.T) {
 		RiskLevel:  RiskLow,
 		Action:     ActionUserRole,
 		UserAction: &UserAction{Role: "admin"},
+		Admins:     []string{"admin@example.com"},
 	}
 
 	env.OnActivity("GetUser", mock.Anything, "user-789").Return(&UserInfo{ID: "user-789", Role: "member", Status: "active"}, nil)
@@ -359,3 +563,1551 @@ func TestGrantWorkflow_UserRole_NilUserAction(t *testing.T) {
 	require.True(t, env.IsWorkflowCompleted())
 	require.Error(t, env.GetWorkflowError())
 }
+
+func TestGrantWorkflow_UnauthorizedRevokeIgnored(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-unauth-revoke",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-888",
+		Duration:     10 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-888", mock.Anything, mock.Anything).Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("revoke", RevokeSignal{RevokedBy: "mallory@example.com"})
+	}, 30*time.Second)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+
+	require.Equal(t, StatusExpired, result.Status)
+	require.Empty(t, result.RevokedBy)
+}
+
+func TestGrantWorkflow_ExtendPolicyNone(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-no-extend",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-777",
+		Duration:     1 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:         "low-risk-access",
+		Tags:         []string{"tag:jit-read"},
+		RiskLevel:    RiskLow,
+		ExtendPolicy: ExtendNone,
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-777", mock.Anything, mock.Anything).Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("extend", ExtendSignal{
+			ExtendedBy: "user@example.com",
+			Duration:   5 * time.Minute,
+		})
+	}, 30*time.Second)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+
+	require.Equal(t, StatusExpired, result.Status)
+	require.Equal(t, result.ActivatedAt.Add(time.Minute), result.ExpiresAt)
+}
+
+func TestGrantWorkflow_PartialApprovalVisibleInStatus(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-quorum",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-999",
+		Duration:     30 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:              "high-risk-access",
+		Tags:              []string{"tag:jit-admin"},
+		RiskLevel:         RiskHigh,
+		Approvers:         []string{"a@example.com", "b@example.com"},
+		RequiredApprovals: 2,
+	}
+
+	approvalResult := ApprovalResult{
+		Approved:   true,
+		ApprovedBy: "b@example.com",
+		Approvals:  []string{"a@example.com", "b@example.com"},
+	}
+
+	env.OnWorkflow("ApprovalWorkflow", mock.Anything, "grant-quorum", grantType, "user@example.com", "").Return(approvalResult, nil).After(time.Hour)
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-999", mock.Anything, mock.Anything).Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approval-progress", ApprovalProgress{
+			Approvals: []string{"a@example.com"},
+			Required:  2,
+		})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		encoded, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+
+		var state GrantState
+		require.NoError(t, encoded.Get(&state))
+		require.Equal(t, StatusPartiallyApproved, state.Status)
+		require.Equal(t, []string{"a@example.com"}, state.Approvals)
+	}, 2*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+
+	require.Equal(t, StatusExpired, result.Status)
+	require.Equal(t, []string{"a@example.com", "b@example.com"}, result.Approvals)
+}
+
+func TestGrantWorkflow_EscalationStageVisibleInStatus(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-escalate",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-999",
+		Duration:     30 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:      "high-risk-access",
+		Tags:      []string{"tag:jit-admin"},
+		RiskLevel: RiskHigh,
+		Approvers: []string{"oncall@example.com", "lead@example.com"},
+		ApprovalStages: []ApprovalStage{
+			{Name: "on-call", Approvers: []string{"oncall@example.com"}, Timeout: JSONDuration(15 * time.Minute)},
+			{Name: "leads", Approvers: []string{"lead@example.com"}, Timeout: JSONDuration(time.Hour)},
+		},
+	}
+
+	approvalResult := ApprovalResult{
+		Approved:   true,
+		ApprovedBy: "lead@example.com",
+		Approvals:  []string{"lead@example.com"},
+	}
+
+	env.OnWorkflow("ApprovalWorkflow", mock.Anything, "grant-escalate", grantType, "user@example.com", "").Return(approvalResult, nil).After(time.Hour)
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-999", mock.Anything, mock.Anything).Return(nil)
+
+	queryStatus := func() GrantState {
+		encoded, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+		var state GrantState
+		require.NoError(t, encoded.Get(&state))
+		return state
+	}
+
+	env.RegisterDelayedCallback(func() {
+		state := queryStatus()
+		require.Equal(t, StatusPendingApproval, state.Status)
+		require.NotNil(t, state.ApprovalStage)
+		require.Equal(t, 0, state.ApprovalStage.Index)
+		require.Equal(t, 2, state.ApprovalStage.Total)
+		require.Equal(t, "on-call", state.ApprovalStage.Name)
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("approval-progress", ApprovalProgress{
+			Required: 1,
+			Stage:    grantType.StageStatus(1, env.Now().Add(time.Hour)),
+		})
+	}, 15*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		state := queryStatus()
+		require.Equal(t, StatusPendingApproval, state.Status)
+		require.Equal(t, 1, state.ApprovalStage.Index)
+		require.Equal(t, "leads", state.ApprovalStage.Name)
+		require.Equal(t, []string{"oncall@example.com", "lead@example.com"}, state.ApprovalStage.Approvers)
+	}, 20*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Nil(t, result.ApprovalStage)
+}
+
+func TestGrantWorkflow_Scheduled(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	startAt := env.Now().Add(2 * time.Hour)
+	request := GrantRequest{
+		ID:           "grant-scheduled",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+		StartAt:      startAt,
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+	}
+
+	activated := false
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-456", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { activated = true }).Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		encoded, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+
+		var state GrantState
+		require.NoError(t, encoded.Get(&state))
+		require.Equal(t, StatusScheduled, state.Status)
+		require.False(t, activated, "grant activated before startAt")
+	}, time.Hour)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.True(t, result.ActivatedAt.Equal(startAt), "activatedAt = %v, want %v", result.ActivatedAt, startAt)
+	require.True(t, result.ExpiresAt.Equal(startAt.Add(30*time.Minute)))
+}
+
+func TestGrantWorkflow_ScheduledCancelled(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-scheduled-cancel",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+		StartAt:      env.Now().Add(2 * time.Hour),
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+	}
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("revoke", RevokeSignal{RevokedBy: "other@example.com"})
+	}, 10*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("revoke", RevokeSignal{RevokedBy: "user@example.com", Reason: "window moved"})
+	}, 30*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusRevoked, result.Status)
+	require.Equal(t, "user@example.com", result.RevokedBy)
+	require.True(t, result.ActivatedAt.IsZero())
+	env.AssertNotCalled(t, "SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGrantWorkflow_CancelScheduled(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	sent := captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-cancel-scheduled",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+		StartAt:      env.Now().Add(2 * time.Hour),
+	}
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+		Admins:    []string{"root@example.com"},
+	}
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("cancel", CancelSignal{CancelledBy: "root@example.com"})
+	}, 10*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("cancel", CancelSignal{CancelledBy: "user@example.com"})
+	}, 30*time.Minute)
+
+	start := env.Now()
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusCancelled, result.Status)
+	require.Equal(t, "user@example.com", result.CancelledBy)
+	require.True(t, result.CancelledAt.Equal(start.Add(30*time.Minute)))
+	require.Contains(t, notificationEvents(*sent), notify.EventCancelled)
+	env.AssertNotCalled(t, "SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGrantWorkflow_CancelPendingApproval(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-cancel-pending",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:      "high-risk-access",
+		Tags:      []string{"tag:jit-admin"},
+		RiskLevel: RiskHigh,
+		Approvers: []string{"approver@example.com"},
+	}
+
+	// The API signals the approval and the grant; either ends the wait.
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("cancel", CancelSignal{CancelledBy: "user@example.com"})
+	}, 10*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusCancelled, result.Status)
+	require.Equal(t, "user@example.com", result.CancelledBy)
+	require.Nil(t, result.ApprovalStage)
+	env.AssertNotCalled(t, "SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGrantWorkflow_ApprovalCancelled(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-approval-cancelled",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:      "high-risk-access",
+		Tags:      []string{"tag:jit-admin"},
+		RiskLevel: RiskHigh,
+	}
+
+	env.OnWorkflow("ApprovalWorkflow", mock.Anything, "grant-approval-cancelled", grantType, "user@example.com", "").Return(ApprovalResult{
+		Reason:      "cancelled by requester",
+		CancelledBy: "user@example.com",
+	}, nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusCancelled, result.Status)
+	require.Equal(t, "user@example.com", result.CancelledBy)
+	require.Empty(t, result.DeniedBy)
+}
+
+func TestGrantWorkflow_PolicyDenied(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-policy-deny",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+		Policy: []PolicyRule{
+			{When: `target.os == "windows"`, Decision: DecisionDeny, Message: "no windows targets"},
+		},
+	}
+
+	env.OnActivity("LoadPolicyInputs", mock.Anything, grantType, request).Return([]PolicyInput{{
+		RequesterLogin: "user@example.com",
+		TargetOS:       "windows",
+		Duration:       30 * time.Minute,
+	}}, nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusDenied, result.Status)
+	require.Equal(t, "no windows targets", result.DenyReason)
+	env.AssertNotCalled(t, "SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGrantWorkflow_PolicyAllowSkipsApproval(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-policy-allow",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:      "high-risk-access",
+		Tags:      []string{"tag:jit-admin"},
+		RiskLevel: RiskHigh,
+		Approvers: []string{"approver@example.com"},
+		Policy: []PolicyRule{
+			{When: `"tag:oncall" in requester.tags`, Decision: DecisionAllow},
+		},
+	}
+
+	env.OnActivity("LoadPolicyInputs", mock.Anything, grantType, request).Return([]PolicyInput{{
+		RequesterLogin: "user@example.com",
+		RequesterTags:  []string{"tag:oncall"},
+		Duration:       30 * time.Minute,
+	}}, nil)
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-456", mock.Anything, mock.Anything).Return(nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Empty(t, result.ApprovedBy)
+}
+
+func TestGrantWorkflow_PolicyDeniesTagSelectedTarget(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:        "grant-policy-fleet",
+		Requester: "user@example.com",
+		TargetTag: "tag:server",
+		Duration:  30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:      "fleet-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+		Policy: []PolicyRule{
+			{When: `target.os == "windows"`, Decision: DecisionDeny, Message: "no windows targets"},
+		},
+	}
+
+	// The tag resolves to two devices; only the second is denied.
+	env.OnActivity("LoadPolicyInputs", mock.Anything, grantType, request).Return([]PolicyInput{
+		{RequesterLogin: "user@example.com", TargetName: "web-1", TargetOS: "linux"},
+		{RequesterLogin: "user@example.com", TargetName: "win-1", TargetOS: "windows"},
+	}, nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusDenied, result.Status)
+	require.Equal(t, "no windows targets", result.DenyReason)
+	env.AssertNotCalled(t, "ListDevices", mock.Anything)
+}
+
+func TestGrantWorkflow_PolicyRecheckedForNewlyTaggedTarget(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:        "grant-policy-retag",
+		Requester: "user@example.com",
+		TargetTag: "tag:server",
+		Duration:  30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:      "fleet-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+		Policy: []PolicyRule{
+			{When: `target.os == "windows"`, Decision: DecisionDeny, Message: "no windows targets"},
+		},
+	}
+
+	// win-1 was tagged after the request was evaluated.
+	env.OnActivity("LoadPolicyInputs", mock.Anything, grantType, request).Return([]PolicyInput{
+		{RequesterLogin: "user@example.com", TargetName: "web-1", TargetOS: "linux"},
+	}, nil)
+	env.OnActivity("ListDevices", mock.Anything).Return([]tailscale.Device{
+		{NodeID: "node-web", Hostname: "web-1", OS: "linux", Tags: []string{"tag:server"}},
+		{NodeID: "node-win", Hostname: "win-1", OS: "windows", Tags: []string{"tag:server"}},
+	}, nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusDenied, result.Status)
+	require.Equal(t, "target win-1: no windows targets", result.DenyReason)
+	env.AssertNotCalled(t, "SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGrantWorkflow_TargetRecheckedBeforeActivation(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-target-changed",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:      "db-access",
+		Tags:      []string{"tag:jit-db"},
+		RiskLevel: RiskLow,
+		Targets:   &TargetSelector{Tags: []string{"tag:db"}},
+	}
+
+	// The device lost tag:db between the request and activation.
+	env.OnActivity("GetDevice", mock.Anything, "node-456").Return(&tailscale.Device{
+		NodeID:   "node-456",
+		Hostname: "db-1",
+		Tags:     []string{"tag:web"},
+	}, nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusDenied, result.Status)
+	require.Contains(t, result.DenyReason, "target no longer allowed")
+	env.AssertNotCalled(t, "SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGrantWorkflow_MultiDevice(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:            "grant-fleet",
+		Requester:     "user@example.com",
+		TargetNodeIDs: []string{"node-1", "node-2", "node-3"},
+		Duration:      30 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+	}
+
+	var activated []string
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { activated = append(activated, args.String(1)) }).Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		encoded, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+
+		var state GrantState
+		require.NoError(t, encoded.Get(&state))
+		require.Equal(t, StatusActive, state.Status)
+		require.Len(t, state.Targets, 3)
+		for _, target := range state.Targets {
+			require.Equal(t, TargetActive, target.State, "target %s", target.NodeID)
+		}
+	}, 10*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.ElementsMatch(t, []string{"node-1", "node-2", "node-3"}, activated)
+	for _, target := range result.Targets {
+		require.Equal(t, TargetRemoved, target.State, "target %s", target.NodeID)
+	}
+}
+
+func TestGrantWorkflow_Routes(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-routes",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-router",
+		Duration:     30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:        "lab-vlan",
+		Action:      ActionRoutes,
+		RiskLevel:   RiskLow,
+		RouteAction: &RouteAction{Routes: []string{"10.20.0.0/24"}, ExitNode: true},
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-router", mock.Anything, AddGrantSignal{
+		GrantID: "grant-routes",
+		Routes:  []string{"10.20.0.0/24", "0.0.0.0/0", "::/0"},
+	}).Return(nil).Once()
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Len(t, result.Targets, 1)
+	require.Equal(t, TargetRemoved, result.Targets[0].State)
+	env.AssertExpectations(t)
+}
+
+func TestGrantWorkflow_KeyExpiry(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:            "grant-key-expiry",
+		Requester:     "user@example.com",
+		TargetNodeIDs: []string{"node-build", "node-server"},
+		Duration:      8 * time.Hour,
+	}
+	grantType := GrantType{
+		Name:      "long-job",
+		Action:    ActionKeyExpiry,
+		RiskLevel: RiskLow,
+	}
+
+	env.OnActivity("GetDevice", mock.Anything, "node-build").Return(&tailscale.Device{NodeID: "node-build", Hostname: "build-1"}, nil)
+	env.OnActivity("GetDevice", mock.Anything, "node-server").Return(&tailscale.Device{NodeID: "node-server", KeyExpiryDisabled: true}, nil)
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.MatchedBy(func(sig AddGrantSignal) bool {
+		return sig.DisableKeyExpiry && len(sig.Tags) == 0
+	})).Return(nil).Twice()
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Len(t, result.Targets, 2)
+	require.Equal(t, "build-1", result.Targets[0].Name)
+	require.False(t, *result.Targets[0].KeyExpiryDisabled)
+	require.True(t, *result.Targets[1].KeyExpiryDisabled)
+	for _, target := range result.Targets {
+		require.Equal(t, TargetRemoved, target.State, "target %s", target.NodeID)
+	}
+	env.AssertExpectations(t)
+}
+
+func TestGrantWorkflow_DeviceAuthorize(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-authorize",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-contractor",
+		Duration:     4 * time.Hour,
+	}
+	grantType := GrantType{
+		Name:      "contractor-device",
+		Action:    ActionDeviceAuthorize,
+		RiskLevel: RiskLow,
+	}
+
+	env.OnActivity("GetDevice", mock.Anything, "node-contractor").Return(&tailscale.Device{NodeID: "node-contractor", Hostname: "contractor-laptop"}, nil)
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-contractor", mock.Anything, mock.MatchedBy(func(sig AddGrantSignal) bool {
+		return sig.Authorize && !sig.DisableKeyExpiry && len(sig.Tags) == 0
+	})).Return(nil).Once()
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Len(t, result.Targets, 1)
+	require.Equal(t, "contractor-laptop", result.Targets[0].Name)
+	require.False(t, *result.Targets[0].Authorized)
+	require.Nil(t, result.Targets[0].KeyExpiryDisabled)
+	require.Equal(t, TargetRemoved, result.Targets[0].State)
+	env.AssertExpectations(t)
+}
+
+func TestGrantWorkflow_TargetTag(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:        "grant-tag-fleet",
+		Requester: "user@example.com",
+		TargetTag: "tag:web",
+		Duration:  30 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+		Targets:   &TargetSelector{OS: []string{"linux"}},
+	}
+
+	env.OnActivity("ListDevices", mock.Anything).Return([]tailscale.Device{
+		{NodeID: "node-web-1", Hostname: "web-1", OS: "linux", Tags: []string{"tag:web"}},
+		{NodeID: "node-web-2", Hostname: "web-2", OS: "windows", Tags: []string{"tag:web"}},
+		{NodeID: "node-db-1", Hostname: "db-1", OS: "linux", Tags: []string{"tag:db"}},
+	}, nil)
+	var activated []string
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { activated = append(activated, args.String(1)) }).Return(nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Equal(t, []string{"node-web-1"}, activated)
+	require.Equal(t, []TargetStatus{{NodeID: "node-web-1", Name: "web-1", State: TargetRemoved}}, result.Targets)
+}
+
+func TestGrantWorkflow_MultiDevicePartialFailureRollsBack(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:            "grant-fleet-fail",
+		Requester:     "user@example.com",
+		TargetNodeIDs: []string{"node-1", "node-2"},
+		Duration:      30 * time.Minute,
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-1", mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-2", mock.Anything, mock.Anything).
+		Return(temporal.NewNonRetryableApplicationError("device unreachable", "test", nil))
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusFailed, result.Status)
+	require.True(t, result.ActivatedAt.IsZero())
+	require.Len(t, result.Targets, 2)
+	require.Equal(t, TargetRemoved, result.Targets[0].State)
+	require.Equal(t, TargetFailed, result.Targets[1].State)
+	require.Contains(t, result.Targets[1].Error, "device unreachable")
+}
+
+func TestGrantWorkflow_TailnetNodeDeleted(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:            "grant-node-deleted",
+		Requester:     "user@example.com",
+		TargetNodeIDs: []string{"node-1", "node-2"},
+		Duration:      time.Hour,
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	var afterFirst GrantState
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("tailnet-event", TailnetEventSignal{Type: TailnetNodeDeleted, NodeID: "node-1"})
+	}, 10*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		v, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+		require.NoError(t, v.Get(&afterFirst))
+		env.SignalWorkflow("tailnet-event", TailnetEventSignal{Type: TailnetNodeDeleted, NodeID: "node-2", Actor: "admin@example.com"})
+	}, 20*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	require.Equal(t, StatusActive, afterFirst.Status, "grant stays active while a target remains")
+	require.Equal(t, TargetRemoved, afterFirst.Targets[0].State)
+	require.Equal(t, TargetActive, afterFirst.Targets[1].State)
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusRevoked, result.Status)
+	require.Equal(t, "admin@example.com", result.RevokedBy)
+	for _, target := range result.Targets {
+		// Deleted devices are not signaled to remove the grant.
+		require.Equal(t, TargetRemoved, target.State)
+		require.Equal(t, "device deleted", target.Error)
+	}
+}
+
+func TestGrantWorkflow_TailnetNodeDeletedWhileScheduled(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	startAt := env.Now().Add(2 * time.Hour)
+	request := GrantRequest{
+		ID:            "grant-scheduled-deleted",
+		Requester:     "user@example.com",
+		TargetNodeIDs: []string{"node-1", "node-2"},
+		Duration:      30 * time.Minute,
+		StartAt:       startAt,
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+	}
+
+	var activated []string
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { activated = append(activated, args.String(1)) }).Return(nil)
+
+	var afterDelete GrantState
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("tailnet-event", TailnetEventSignal{Type: TailnetNodeDeleted, NodeID: "node-1"})
+	}, 10*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		v, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+		require.NoError(t, v.Get(&afterDelete))
+	}, 20*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	require.Equal(t, StatusScheduled, afterDelete.Status, "grant stays scheduled while a target remains")
+	require.Equal(t, []TargetStatus{{NodeID: "node-2", State: TargetPending}}, afterDelete.Targets)
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.True(t, result.ActivatedAt.Equal(startAt))
+	// Only the remaining device was activated.
+	require.Equal(t, []string{"node-2"}, activated)
+	require.Len(t, result.Targets, 1)
+	require.Equal(t, "node-2", result.Targets[0].NodeID)
+}
+
+func TestGrantWorkflow_TailnetNodeDeletedWhileScheduled_LastTarget(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-scheduled-gone",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-1",
+		Duration:     30 * time.Minute,
+		StartAt:      env.Now().Add(2 * time.Hour),
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+	}
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("tailnet-event", TailnetEventSignal{Type: TailnetNodeDeleted, NodeID: "node-1"})
+	}, 10*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusRevoked, result.Status)
+	require.Equal(t, "tailscale", result.RevokedBy)
+	require.Empty(t, result.Targets)
+	env.AssertNotCalled(t, "SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGrantWorkflow_TailnetUserSuspended(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-user-suspended",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-1",
+		Duration:     time.Hour,
+	}
+
+	grantType := GrantType{
+		Name:      "low-risk-access",
+		Tags:      []string{"tag:jit-read"},
+		RiskLevel: RiskLow,
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		// Unrelated node: ignored.
+		env.SignalWorkflow("tailnet-event", TailnetEventSignal{Type: TailnetNodeDeleted, NodeID: "node-9"})
+	}, 5*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("tailnet-event", TailnetEventSignal{Type: TailnetUserSuspended, User: "user@example.com"})
+	}, 10*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusRevoked, result.Status)
+	require.Equal(t, "tailscale", result.RevokedBy)
+	require.Equal(t, 10*time.Minute, result.RevokedAt.Sub(result.ActivatedAt))
+	require.Equal(t, TargetRemoved, result.Targets[0].State)
+}
+
+func TestGrantWorkflow_TailnetRoleOverridden(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-role-drift",
+		Requester:    "user@example.com",
+		TargetUserID: "user-456",
+		Duration:     time.Hour,
+	}
+
+	grantType := GrantType{
+		Name:       "temp-admin",
+		RiskLevel:  RiskLow,
+		Action:     ActionUserRole,
+		UserAction: &UserAction{Role: "admin"},
+	}
+
+	env.OnActivity("GetUser", mock.Anything, "user-456").Return(&UserInfo{ID: "user-456", Role: "member"}, nil).Once()
+	env.OnActivity("GetUser", mock.Anything, "user-456").Return(&UserInfo{ID: "user-456", Role: "admin"}, nil).Once()
+	env.OnActivity("GetUser", mock.Anything, "user-456").Return(&UserInfo{ID: "user-456", Role: "auditor"}, nil).Once()
+	env.OnActivity("SetUserRole", mock.Anything, "user-456", "admin").Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		// TailGrant's own role change: still the granted role.
+		env.SignalWorkflow("tailnet-event", TailnetEventSignal{Type: TailnetUserRoleUpdated, User: "user@example.com"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("tailnet-event", TailnetEventSignal{Type: TailnetUserRoleUpdated, User: "user@example.com", Actor: "owner@example.com"})
+	}, 10*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusRevoked, result.Status)
+	require.Equal(t, "owner@example.com", result.RevokedBy)
+	env.AssertNotCalled(t, "SetUserRole", mock.Anything, "user-456", "member")
+}
+
+func TestGrantWorkflow_ExpiringSoonFlag(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-expiring",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-777",
+		Duration:     30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:          "low-risk-access",
+		Tags:          []string{"tag:jit-read"},
+		RiskLevel:     RiskLow,
+		ExpiryWarning: JSONDuration(10 * time.Minute),
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-777", mock.Anything, mock.Anything).Return(nil)
+
+	expiringSoon := func() bool {
+		v, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+		var state GrantState
+		require.NoError(t, v.Get(&state))
+		return state.ExpiringSoon
+	}
+	var before, after, afterRenew bool
+	env.RegisterDelayedCallback(func() { before = expiringSoon() }, 15*time.Minute)
+	env.RegisterDelayedCallback(func() { after = expiringSoon() }, 25*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("renew", RenewSignal{RequestedBy: "user@example.com", Duration: time.Hour})
+	}, 26*time.Minute)
+	env.RegisterDelayedCallback(func() { afterRenew = expiringSoon() }, 27*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.False(t, before)
+	require.True(t, after)
+	require.False(t, afterRenew, "low risk renewal extends at once and clears the flag")
+}
+
+func TestGrantWorkflow_RenewalNeedsApproval(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-renew",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:      "high-risk-access",
+		Tags:      []string{"tag:jit-admin"},
+		RiskLevel: RiskHigh,
+		Approvers: []string{"approver@example.com"},
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflowByID("approval-grant-renew", "approve", ApproveSignal{ApprovedBy: "approver@example.com"})
+	}, time.Minute)
+
+	var pending GrantState
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("renew", RenewSignal{RequestedBy: "user@example.com", Duration: time.Hour, Reason: "incident ongoing"})
+	}, 20*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		v, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+		require.NoError(t, v.Get(&pending))
+		env.SignalWorkflowByID("approval-grant-renew", "approve", ApproveSignal{ApprovedBy: "approver@example.com"})
+	}, 25*time.Minute)
+
+	start := env.Now()
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	// Until approved, the renewal is pending and the expiry unchanged.
+	require.NotNil(t, pending.Renewal)
+	require.Equal(t, "user@example.com", pending.Renewal.RequestedBy)
+	require.Equal(t, time.Hour, pending.Renewal.Duration)
+	require.Equal(t, "incident ongoing", pending.Renewal.Reason)
+	require.True(t, pending.ExpiresAt.Equal(start.Add(31*time.Minute)))
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Nil(t, result.Renewal)
+	require.True(t, result.ExpiresAt.Equal(start.Add(85*time.Minute)))
+}
+
+func TestGrantWorkflow_RenewalByApprover(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-renew-approver",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:      "high-risk-access",
+		Tags:      []string{"tag:jit-admin"},
+		RiskLevel: RiskHigh,
+		Approvers: []string{"user@example.com", "approver@example.com", "second@example.com"},
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	approve := func(by string) {
+		env.SignalWorkflowByID("approval-grant-renew-approver", "approve", ApproveSignal{ApprovedBy: by})
+	}
+	env.RegisterDelayedCallback(func() { approve("approver@example.com") }, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("renew", RenewSignal{RequestedBy: "approver@example.com", Duration: time.Hour})
+	}, 20*time.Minute)
+	// Neither the grant's requester nor the renewer may approve the renewal.
+	env.RegisterDelayedCallback(func() { approve("user@example.com") }, 21*time.Minute)
+	env.RegisterDelayedCallback(func() { approve("approver@example.com") }, 22*time.Minute)
+	var pending GrantState
+	env.RegisterDelayedCallback(func() {
+		v, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+		require.NoError(t, v.Get(&pending))
+		approve("second@example.com")
+	}, 25*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	require.NotNil(t, pending.Renewal)
+	require.Equal(t, "approver@example.com", pending.Renewal.RequestedBy)
+	require.Empty(t, pending.Extensions)
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, "user@example.com", result.Request.Requester)
+	require.Len(t, result.Extensions, 1)
+	require.Equal(t, "approver@example.com", result.Extensions[0].By)
+	require.Equal(t, "second@example.com", result.Extensions[0].ApprovedBy)
+}
+
+func TestGrantWorkflow_RenewalDenied(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	sent := captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-renew-deny",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:      "medium-risk-access",
+		Tags:      []string{"tag:jit-admin"},
+		RiskLevel: RiskMedium,
+		Approvers: []string{"approver@example.com"},
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflowByID("approval-grant-renew-deny", "approve", ApproveSignal{ApprovedBy: "approver@example.com"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("renew", RenewSignal{RequestedBy: "user@example.com", Duration: time.Hour})
+	}, 10*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflowByID("approval-grant-renew-deny", "deny", DenySignal{DeniedBy: "approver@example.com", Reason: "not needed"})
+	}, 15*time.Minute)
+
+	start := env.Now()
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Nil(t, result.Renewal)
+	require.True(t, result.ExpiresAt.Equal(start.Add(31*time.Minute)))
+	require.Contains(t, notificationEvents(*sent), notify.EventDenied)
+}
+
+func TestGrantWorkflow_MaxExtensions(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-max-ext",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-777",
+		Duration:     10 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:          "low-risk-access",
+		Tags:          []string{"tag:jit-read"},
+		RiskLevel:     RiskLow,
+		MaxExtensions: 2,
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-777", mock.Anything, mock.Anything).Return(nil)
+	for _, at := range []time.Duration{5 * time.Minute, 10 * time.Minute, 15 * time.Minute} {
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow("extend", ExtendSignal{ExtendedBy: "user@example.com", Duration: 20 * time.Minute})
+		}, at)
+	}
+
+	start := env.Now()
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	// The third extension is over the limit and ignored.
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.True(t, result.ExpiresAt.Equal(start.Add(30*time.Minute)))
+	require.Len(t, result.Extensions, 2)
+	require.Equal(t, "user@example.com", result.Extensions[1].By)
+	require.True(t, result.Extensions[1].At.Equal(start.Add(10*time.Minute)))
+	require.Equal(t, 20*time.Minute, result.Extensions[1].Duration)
+}
+
+func TestGrantWorkflow_MaxTotalDuration(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-max-total",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-777",
+		Duration:     10 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:             "low-risk-access",
+		Tags:             []string{"tag:jit-read"},
+		RiskLevel:        RiskLow,
+		MaxTotalDuration: JSONDuration(time.Hour),
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-777", mock.Anything, mock.Anything).Return(nil)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("extend", ExtendSignal{ExtendedBy: "user@example.com", Duration: 40 * time.Minute})
+	}, 5*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("extend", ExtendSignal{ExtendedBy: "user@example.com", Duration: 40 * time.Minute})
+	}, 30*time.Minute)
+
+	start := env.Now()
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	// The second extension would run to 70 minutes and is ignored.
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.True(t, result.ExpiresAt.Equal(start.Add(45*time.Minute)))
+	require.Len(t, result.Extensions, 1)
+}
+
+func TestGrantWorkflow_ExtensionRequiresApproval(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-ext-approval",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-777",
+		Duration:     40 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:                      "low-risk-access",
+		Tags:                      []string{"tag:jit-read"},
+		RiskLevel:                 RiskLow,
+		Approvers:                 []string{"approver@example.com"},
+		MaxTotalDuration:          JSONDuration(time.Hour),
+		ExtensionRequiresApproval: true,
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-777", mock.Anything, mock.Anything).Return(nil)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("extend", ExtendSignal{ExtendedBy: "user@example.com", Duration: 30 * time.Minute})
+	}, 20*time.Minute)
+	var pending GrantState
+	env.RegisterDelayedCallback(func() {
+		v, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+		require.NoError(t, v.Get(&pending))
+		env.SignalWorkflowByID("approval-grant-ext-approval", "approve", ApproveSignal{ApprovedBy: "approver@example.com"})
+	}, 35*time.Minute)
+
+	start := env.Now()
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	require.NotNil(t, pending.Renewal)
+	require.Empty(t, pending.Extensions)
+
+	// Approval came 15 minutes later, so the extension is cut short at the
+	// grant type's maxTotalDuration.
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.True(t, result.ExpiresAt.Equal(start.Add(time.Hour)))
+	require.Len(t, result.Extensions, 1)
+	ext := result.Extensions[0]
+	require.Equal(t, "user@example.com", ext.By)
+	require.Equal(t, "approver@example.com", ext.ApprovedBy)
+	require.True(t, ext.At.Equal(start.Add(35*time.Minute)))
+	require.Equal(t, 25*time.Minute, ext.Duration)
+}
+
+func TestGrantWorkflow_ExtendMediumRiskNeedsApproval(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-ext-medium",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-777",
+		Duration:     30 * time.Minute,
+	}
+	grantType := GrantType{
+		Name:      "medium-risk-access",
+		Tags:      []string{"tag:jit-write"},
+		RiskLevel: RiskMedium,
+		Approvers: []string{"approver@example.com"},
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-777", mock.Anything, mock.Anything).Return(nil)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflowByID("approval-grant-ext-medium", "approve", ApproveSignal{ApprovedBy: "approver@example.com"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("extend", ExtendSignal{ExtendedBy: "user@example.com", Duration: time.Hour})
+	}, 10*time.Minute)
+	var pending GrantState
+	env.RegisterDelayedCallback(func() {
+		v, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+		require.NoError(t, v.Get(&pending))
+		env.SignalWorkflowByID("approval-grant-ext-medium", "deny", DenySignal{DeniedBy: "approver@example.com"})
+	}, 15*time.Minute)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	require.NotNil(t, pending.Renewal)
+	require.Equal(t, "user@example.com", pending.Renewal.RequestedBy)
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Empty(t, result.Extensions, "denied extension must not apply")
+	require.True(t, result.ExpiresAt.Equal(result.ActivatedAt.Add(30*time.Minute)))
+}
+
+func breakGlassGrantType() GrantType {
+	return GrantType{
+		Name:       "prod-admin",
+		Tags:       []string{"tag:jit-admin"},
+		RiskLevel:  RiskHigh,
+		Approvers:  []string{"approver@example.com"},
+		BreakGlass: true,
+	}
+}
+
+func TestGrantWorkflow_BreakGlass(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	sent := captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-break-glass",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+		Reason:       "INC-42 database down",
+		BreakGlass:   true,
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-456", mock.Anything, mock.Anything).Return(nil)
+	var active GrantState
+	env.RegisterDelayedCallback(func() {
+		v, err := env.QueryWorkflow("status")
+		require.NoError(t, err)
+		require.NoError(t, v.Get(&active))
+		// The requester cannot review their own break-glass use.
+		env.SignalWorkflow("acknowledge", ReviewSignal{ReviewedBy: "user@example.com"})
+	}, 10*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("acknowledge", ReviewSignal{ReviewedBy: "approver@example.com", Note: "confirmed in incident channel"})
+	}, 2*time.Hour)
+
+	start := env.Now()
+	env.ExecuteWorkflow(GrantWorkflow, request, breakGlassGrantType())
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	// Active without approval, and still awaiting review.
+	require.Equal(t, StatusActive, active.Status)
+	require.NotNil(t, active.BreakGlass)
+	require.Equal(t, ReviewPending, active.BreakGlass.Status)
+	require.True(t, active.BreakGlass.Deadline.Equal(start.Add(breakGlassReviewWindow)))
+
+	// The review arrived after the grant expired.
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Empty(t, result.ApprovedBy)
+	require.Equal(t, ReviewAcknowledged, result.BreakGlass.Status)
+	require.Equal(t, "approver@example.com", result.BreakGlass.ReviewedBy)
+	require.Equal(t, "confirmed in incident channel", result.BreakGlass.Note)
+	require.True(t, result.BreakGlass.ReviewedAt.Equal(start.Add(2*time.Hour)))
+
+	events := notificationEvents(*sent)
+	require.Contains(t, events, notify.EventBreakGlass)
+	require.NotContains(t, events, notify.EventPendingApproval)
+	for _, n := range *sent {
+		if n.Event == notify.EventBreakGlass {
+			require.Equal(t, []string{"approver@example.com"}, n.Approvers)
+			require.Equal(t, "INC-42 database down", n.Reason)
+		}
+	}
+}
+
+func TestGrantWorkflow_BreakGlassRejected(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-break-glass-rejected",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     time.Hour,
+		Reason:       "debugging",
+		BreakGlass:   true,
+	}
+
+	// Approvers of any escalation stage may review.
+	grantType := breakGlassGrantType()
+	grantType.Approvers = nil
+	grantType.ApprovalStages = []ApprovalStage{
+		{Name: "on-call", Approvers: []string{"oncall@example.com"}, Timeout: JSONDuration(15 * time.Minute)},
+		{Name: "leads", Approvers: []string{"lead@example.com"}, Timeout: JSONDuration(time.Hour)},
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-456", mock.Anything, mock.Anything).Return(nil)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("reject", ReviewSignal{ReviewedBy: "lead@example.com", Note: "not an emergency"})
+	}, 10*time.Minute)
+
+	start := env.Now()
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusRevoked, result.Status)
+	require.Equal(t, "lead@example.com", result.RevokedBy)
+	require.True(t, result.RevokedAt.Equal(start.Add(10*time.Minute)))
+	require.Equal(t, ReviewRejected, result.BreakGlass.Status)
+	require.Equal(t, []string{"oncall@example.com", "lead@example.com"}, result.BreakGlass.Approvers)
+}
+
+func TestGrantWorkflow_BreakGlassUnreviewed(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+	captureNotifications(env)
+
+	request := GrantRequest{
+		ID:           "grant-break-glass-unreviewed",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+		Reason:       "pager",
+		BreakGlass:   true,
+	}
+
+	env.OnActivity("SignalWithStartDeviceTagManager", mock.Anything, "node-456", mock.Anything, mock.Anything).Return(nil)
+
+	start := env.Now()
+	env.ExecuteWorkflow(GrantWorkflow, request, breakGlassGrantType())
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusExpired, result.Status)
+	require.Equal(t, ReviewUnreviewed, result.BreakGlass.Status)
+	require.Empty(t, result.BreakGlass.ReviewedBy)
+	require.True(t, result.BreakGlass.Deadline.Equal(start.Add(breakGlassReviewWindow)))
+}
+
+func TestGrantWorkflow_BreakGlassNotAllowed(t *testing.T) {
+	env, _ := setupWorkflowTestEnv()
+
+	request := GrantRequest{
+		ID:           "grant-break-glass-not-allowed",
+		Requester:    "user@example.com",
+		TargetNodeID: "node-456",
+		Duration:     30 * time.Minute,
+		BreakGlass:   true,
+	}
+	grantType := breakGlassGrantType()
+	grantType.BreakGlass = false
+
+	env.OnWorkflow("ApprovalWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		ApprovalResult{Approved: false, DeniedBy: "approver@example.com"}, nil)
+
+	env.ExecuteWorkflow(GrantWorkflow, request, grantType)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result GrantState
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, StatusDenied, result.Status)
+	require.Nil(t, result.BreakGlass)
+}
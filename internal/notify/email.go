@@ -0,0 +1,229 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"embed"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+)
+
+const (
+	emailChannel      = "email"
+	defaultSMTPPort   = 587
+	smtpTimeout       = 30 * time.Second
+	subjectLinePrefix = "Subject: "
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// emailEvents are the events sent by email. Approvers hear about pending
+// requests and break-glass grants to review; requesters hear about
+// everything else that needs their attention.
+var emailEvents = []EventType{
+	EventPendingApproval, EventApproved, EventDenied, EventActivated, EventExpiringSoon, EventBreakGlass,
+}
+
+// Email sends notifications over SMTP. Each event is rendered with the
+// text/template named "<event>.tmpl", whose first line is the subject
+// ("Subject: ...") and the rest the body.
+type Email struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     *mail.Address
+
+	templates *template.Template
+	Now       func() time.Time
+}
+
+// NewEmail validates c and loads the templates, with any in c.Templates
+// replacing the built-in template of the same name. It returns nil if c is
+// nil.
+func NewEmail(c *config.EmailConfig) (*Email, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Host == "" {
+		return nil, errors.New("email: host is required")
+	}
+	from, err := mail.ParseAddress(c.From)
+	if err != nil {
+		return nil, fmt.Errorf("email: invalid from %q: %w", c.From, err)
+	}
+	port := c.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	tmpl, err := template.New("email").Funcs(template.FuncMap{"join": strings.Join}).ParseFS(defaultTemplates, "templates/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("email: built-in templates: %w", err)
+	}
+	if c.Templates != "" {
+		matches, err := filepath.Glob(filepath.Join(c.Templates, "*.tmpl"))
+		if err != nil {
+			return nil, fmt.Errorf("email: templates: %w", err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("email: no *.tmpl files in %s", c.Templates)
+		}
+		if tmpl, err = tmpl.ParseFiles(matches...); err != nil {
+			return nil, fmt.Errorf("email: templates: %w", err)
+		}
+	}
+	return &Email{
+		Addr:      net.JoinHostPort(c.Host, strconv.Itoa(port)),
+		Username:  c.Username,
+		Password:  c.Password,
+		From:      from,
+		templates: tmpl,
+	}, nil
+}
+
+// Subscribed reports whether an event is sent by email.
+func (e *Email) Subscribed(event EventType) bool {
+	return slices.Contains(emailEvents, event)
+}
+
+// Recipients returns who is emailed about msg: the approvers on
+// pending_approval and break_glass, otherwise the requester. Group and autogroup approvers
+// are skipped since they have no address of their own.
+func Recipients(msg Notification) []string {
+	if msg.Event != EventPendingApproval && msg.Event != EventBreakGlass {
+		if msg.Requester == "" {
+			return nil
+		}
+		return []string{msg.Requester}
+	}
+	var to []string
+	for _, a := range msg.Approvers {
+		if strings.Contains(a, "@") && !strings.Contains(a, ":") && !slices.Contains(to, a) {
+			to = append(to, a)
+		}
+	}
+	return to
+}
+
+// Render returns the subject and body for msg.
+func (e *Email) Render(msg Notification) (subject, body string, err error) {
+	var buf bytes.Buffer
+	if err := e.templates.ExecuteTemplate(&buf, string(msg.Event)+".tmpl", msg); err != nil {
+		return "", "", fmt.Errorf("email: render %s: %w", msg.Event, err)
+	}
+	first, rest, _ := strings.Cut(buf.String(), "\n")
+	subject, ok := strings.CutPrefix(strings.TrimSpace(first), subjectLinePrefix)
+	if !ok {
+		return "", "", fmt.Errorf("email: template %s.tmpl must start with %q", msg.Event, subjectLinePrefix)
+	}
+	return subject, strings.TrimLeft(rest, "\n"), nil
+}
+
+// Send emails one notification. The Message-ID is derived from the
+// delivery ID, so a retried send can be recognized as a duplicate. SMTP
+// 5xx replies are wrapped in a PermanentError.
+func (e *Email) Send(ctx context.Context, deliveryID string, msg Notification) error {
+	to := Recipients(msg)
+	if len(to) == 0 {
+		return nil
+	}
+	subject, body, err := e.Render(msg)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	now := time.Now
+	if e.Now != nil {
+		now = e.Now
+	}
+	data := e.message(to, subject, body, deliveryID, now())
+
+	if err := e.send(ctx, to, data); err != nil {
+		var tpErr *textproto.Error
+		if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+			return &PermanentError{Err: fmt.Errorf("email rejected: %w", err)}
+		}
+		return fmt.Errorf("email: %w", err)
+	}
+	return nil
+}
+
+func (e *Email) message(to []string, subject, body, deliveryID string, now time.Time) []byte {
+	var b bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&b, "%s: %s\r\n", k, v) }
+	header("From", e.From.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", "<"+strings.ReplaceAll(deliveryID, "/", ".")+"@tailgrant>")
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// send delivers one message, upgrading to TLS when the server offers
+// STARTTLS. Credentials are only sent over TLS or to localhost.
+func (e *Email) send(ctx context.Context, to []string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", e.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	host, _, _ := net.SplitHostPort(e.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if e.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.Username, e.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(e.From.Address); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,283 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+)
+
+// smtpMessage is one message accepted by fakeSMTP.
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// fakeSMTP is a minimal in-process SMTP server. It accepts every message
+// unless reject is set, in which case RCPT gets that reply.
+type fakeSMTP struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	reject   string
+	messages []smtpMessage
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) config() *config.EmailConfig {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return &config.EmailConfig{Host: host, Port: p, From: "TailGrant <tailgrant@example.com>"}
+}
+
+func (s *fakeSMTP) Messages() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+func (s *fakeSMTP) Reject(reply string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject = reply
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	var msg smtpMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		switch verb := strings.ToUpper(strings.SplitN(cmd, " ", 2)[0]); verb {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case "MAIL":
+			msg = smtpMessage{From: smtpPath(cmd)}
+			reply("250 OK")
+		case "RCPT":
+			s.mu.Lock()
+			reject := s.reject
+			s.mu.Unlock()
+			if reject != "" {
+				reply(reject)
+				continue
+			}
+			msg.To = append(msg.To, smtpPath(cmd))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			msg.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// smtpPath returns the <address> argument of a MAIL or RCPT command.
+func smtpPath(cmd string) string {
+	_, rest, _ := strings.Cut(cmd, "<")
+	addr, _, _ := strings.Cut(rest, ">")
+	return addr
+}
+
+func TestNewEmail(t *testing.T) {
+	if e, err := NewEmail(nil); e != nil || err != nil {
+		t.Fatalf("NewEmail(nil) = %v, %v; want nil, nil", e, err)
+	}
+	tests := []struct {
+		name    string
+		cfg     config.EmailConfig
+		wantErr string
+	}{
+		{"missing host", config.EmailConfig{From: "tailgrant@example.com"}, "host is required"},
+		{"bad from", config.EmailConfig{Host: "smtp.example.com", From: "not an address"}, "invalid from"},
+		{"empty template dir", config.EmailConfig{Host: "smtp.example.com", From: "tailgrant@example.com", Templates: t.TempDir()}, "no *.tmpl files"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEmail(&tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	pending := Notification{
+		Event:     EventPendingApproval,
+		Requester: "user@example.com",
+		Approvers: []string{"lead@example.com", "group:sre", "autogroup:admin", "lead@example.com"},
+	}
+	if got := strings.Join(Recipients(pending), ","); got != "lead@example.com" {
+		t.Errorf("pending_approval recipients = %q", got)
+	}
+	approved := Notification{Event: EventApproved, Requester: "user@example.com", Approvers: []string{"lead@example.com"}}
+	if got := strings.Join(Recipients(approved), ","); got != "user@example.com" {
+		t.Errorf("approved recipients = %q", got)
+	}
+	breakGlass := Notification{Event: EventBreakGlass, Requester: "user@example.com", Approvers: []string{"lead@example.com", "group:sre"}}
+	if got := strings.Join(Recipients(breakGlass), ","); got != "lead@example.com" {
+		t.Errorf("break_glass recipients = %q", got)
+	}
+}
+
+func TestEmail_Send(t *testing.T) {
+	srv := newFakeSMTP(t)
+	e, err := NewEmail(srv.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Now = func() time.Time { return time.Unix(1_750_000_000, 0) }
+
+	msg := Notification{
+		Event:         EventPendingApproval,
+		GrantID:       "g1",
+		GrantType:     "prod-db",
+		Requester:     "user@example.com",
+		Approvers:     []string{"lead@example.com", "group:sre"},
+		Stage:         "team",
+		StageDeadline: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+		URL:           "https://tailgrant.example.ts.net/#grant=g1",
+	}
+	if err := e.Send(context.Background(), "approval-g1/1", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	got := srv.Messages()
+	if len(got) != 1 {
+		t.Fatalf("got %d messages, want 1", len(got))
+	}
+	m := got[0]
+	if m.From != "tailgrant@example.com" || strings.Join(m.To, ",") != "lead@example.com" {
+		t.Errorf("envelope = %s -> %v", m.From, m.To)
+	}
+	for _, want := range []string{
+		"Subject: [TailGrant] Approval needed: user@example.com requests prod-db\r\n",
+		"Message-ID: <approval-g1.1@tailgrant>\r\n",
+		"Deadline: 2025-06-01 12:00 UTC",
+		"Review it at https://tailgrant.example.ts.net/#grant=g1",
+	} {
+		if !strings.Contains(m.Data, want) {
+			t.Errorf("message missing %q:\n%s", want, m.Data)
+		}
+	}
+
+	t.Run("no recipients", func(t *testing.T) {
+		groupsOnly := msg
+		groupsOnly.Approvers = []string{"group:sre"}
+		if err := e.Send(context.Background(), "approval-g1/2", groupsOnly); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(srv.Messages()); n != 1 {
+			t.Errorf("got %d messages, want no new message", n)
+		}
+	})
+
+	t.Run("rejected recipient", func(t *testing.T) {
+		srv.Reject("550 5.1.1 No such user")
+		err := e.Send(context.Background(), "grant-g1/3", Notification{Event: EventApproved, Requester: "gone@example.com"})
+		var perm *PermanentError
+		if !errors.As(err, &perm) {
+			t.Errorf("error = %v, want PermanentError", err)
+		}
+	})
+
+	t.Run("busy server", func(t *testing.T) {
+		srv.Reject("451 4.3.0 Try again later")
+		err := e.Send(context.Background(), "grant-g1/4", Notification{Event: EventApproved, Requester: "user@example.com"})
+		var perm *PermanentError
+		if err == nil || errors.As(err, &perm) {
+			t.Errorf("error = %v, want retryable error", err)
+		}
+	})
+}
+
+func TestEmail_TemplateOverride(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := "Subject: Access granted to {{.GrantType}}\nHi {{.Requester}}, you are in until {{.ExpiresAt.UTC.Format \"15:04\"}}.\n"
+	if err := os.WriteFile(filepath.Join(dir, "activated.tmpl"), []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.EmailConfig{Host: "smtp.example.com", From: "tailgrant@example.com", Templates: dir}
+	e, err := NewEmail(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, body, err := e.Render(Notification{
+		Event:     EventActivated,
+		GrantType: "ssh",
+		Requester: "user@example.com",
+		ExpiresAt: time.Date(2025, 6, 1, 13, 30, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Access granted to ssh" || body != "Hi user@example.com, you are in until 13:30.\n" {
+		t.Errorf("rendered %q / %q", subject, body)
+	}
+
+	// Events without an override keep the built-in template.
+	subject, _, err = e.Render(Notification{Event: EventDenied, GrantType: "ssh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "[TailGrant] Denied: ssh" {
+		t.Errorf("denied subject = %q", subject)
+	}
+}
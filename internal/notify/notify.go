@@ -0,0 +1,147 @@
+// Package notify delivers grant lifecycle notifications to people and
+// systems outside TailGrant. Notifications are emitted by the workflows and
+// delivered by the worker through the notification activities, one channel
+// at a time so each is retried on its own.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+)
+
+// EventType identifies a grant lifecycle event that can be notified.
+type EventType string
+
+const (
+	EventPendingApproval EventType = "pending_approval"
+	EventApproved        EventType = "approved"
+	EventDenied          EventType = "denied"
+	EventActivated       EventType = "activated"
+	EventExpiringSoon    EventType = "expiring_soon"
+	EventExpired         EventType = "expired"
+	EventRevoked         EventType = "revoked"
+	EventCancelled       EventType = "cancelled"
+	EventBreakGlass      EventType = "break_glass"
+)
+
+// Events lists every notification event type.
+var Events = []EventType{
+	EventPendingApproval, EventApproved, EventDenied, EventActivated,
+	EventExpiringSoon, EventExpired, EventRevoked, EventCancelled, EventBreakGlass,
+}
+
+// Notification describes a grant lifecycle event. Approvers and
+// StageDeadline are only set on pending_approval and break_glass, where the
+// deadline is for the review. ExpiresAt is set once the grant is active.
+// URL is filled in at delivery from the configured base URL.
+type Notification struct {
+	Event         EventType `json:"event"`
+	Time          time.Time `json:"time"`
+	GrantID       string    `json:"grantID"`
+	GrantType     string    `json:"grantType"`
+	Requester     string    `json:"requester"`
+	Actor         string    `json:"actor,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	Targets       []string  `json:"targets,omitempty"`
+	Approvers     []string  `json:"approvers,omitempty"`
+	Stage         string    `json:"stage,omitempty"`
+	StageDeadline time.Time `json:"stageDeadline,omitzero"`
+	ExpiresAt     time.Time `json:"expiresAt,omitzero"`
+	URL           string    `json:"url,omitempty"`
+}
+
+// Notifier delivers notifications to the configured channels.
+type Notifier struct {
+	baseURL  string
+	webhooks []*Webhook
+	email    *Email
+}
+
+// New builds a Notifier from c. It returns nil if no channels are
+// configured.
+func New(c config.NotificationsConfig) (*Notifier, error) {
+	if c.BaseURL != "" {
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("notifications: invalid baseURL %q", c.BaseURL)
+		}
+	}
+	n := &Notifier{baseURL: strings.TrimRight(c.BaseURL, "/")}
+	seen := make(map[string]bool)
+	for _, wc := range c.Webhooks {
+		w, err := NewWebhook(wc)
+		if err != nil {
+			return nil, fmt.Errorf("notifications: %w", err)
+		}
+		if seen[w.Name] {
+			return nil, fmt.Errorf("notifications: duplicate webhook name %q", w.Name)
+		}
+		seen[w.Name] = true
+		n.webhooks = append(n.webhooks, w)
+	}
+	email, err := NewEmail(c.Email)
+	if err != nil {
+		return nil, fmt.Errorf("notifications: %w", err)
+	}
+	n.email = email
+	if len(n.webhooks) == 0 && n.email == nil {
+		return nil, nil
+	}
+	return n, nil
+}
+
+// Channels returns the names of the channels subscribed to an event.
+func (n *Notifier) Channels(event EventType) []string {
+	var channels []string
+	for _, w := range n.webhooks {
+		if w.Subscribed(event) {
+			channels = append(channels, webhookChannel(w.Name))
+		}
+	}
+	if n.email != nil && n.email.Subscribed(event) {
+		channels = append(channels, emailChannel)
+	}
+	return channels
+}
+
+// Deliver sends a notification to one channel. The delivery ID is stable
+// across retries so receivers can drop duplicates.
+func (n *Notifier) Deliver(ctx context.Context, channel, deliveryID string, msg Notification) error {
+	msg.URL = GrantURL(n.baseURL, msg.GrantID)
+	if channel == emailChannel && n.email != nil {
+		return n.email.Send(ctx, deliveryID, msg)
+	}
+	if name, ok := strings.CutPrefix(channel, "webhook:"); ok {
+		for _, w := range n.webhooks {
+			if w.Name == name {
+				return w.Send(ctx, deliveryID, msg)
+			}
+		}
+	}
+	return ErrUnknownChannel
+}
+
+// ErrUnknownChannel is returned by Deliver for a channel that is not
+// configured, e.g. one removed since the notification was emitted.
+var ErrUnknownChannel = errors.New("notification channel not configured")
+
+func webhookChannel(name string) string { return "webhook:" + name }
+
+// GrantURL returns the UI deep link to a grant, or "" without a base URL.
+func GrantURL(baseURL, grantID string) string {
+	if baseURL == "" || grantID == "" {
+		return ""
+	}
+	return strings.TrimRight(baseURL, "/") + "/#grant=" + url.QueryEscape(grantID)
+}
+
+func validEvent(e EventType) bool {
+	return slices.Contains(Events, e)
+}
@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.NotificationsConfig
+		wantErr string
+	}{
+		{"empty", config.NotificationsConfig{}, ""},
+		{"webhook", config.NotificationsConfig{Webhooks: []config.NotificationWebhookConfig{
+			{Name: "siem", URL: "https://siem.example.com/hook", Events: []string{"revoked", "expired"}},
+		}}, ""},
+		{"bad base URL", config.NotificationsConfig{BaseURL: "tailgrant.example.ts.net"}, "invalid baseURL"},
+		{"missing name", config.NotificationsConfig{Webhooks: []config.NotificationWebhookConfig{
+			{URL: "https://siem.example.com/hook"},
+		}}, "name is required"},
+		{"bad url", config.NotificationsConfig{Webhooks: []config.NotificationWebhookConfig{
+			{Name: "siem", URL: "siem.example.com"},
+		}}, "invalid url"},
+		{"unknown event", config.NotificationsConfig{Webhooks: []config.NotificationWebhookConfig{
+			{Name: "siem", URL: "https://siem.example.com/hook", Events: []string{"extended"}},
+		}}, `unknown event "extended"`},
+		{"duplicate", config.NotificationsConfig{Webhooks: []config.NotificationWebhookConfig{
+			{Name: "siem", URL: "https://a.example.com"},
+			{Name: "siem", URL: "https://b.example.com"},
+		}}, "duplicate webhook"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNotifier_Channels(t *testing.T) {
+	n, err := New(config.NotificationsConfig{Webhooks: []config.NotificationWebhookConfig{
+		{Name: "all", URL: "https://a.example.com"},
+		{Name: "approvals", URL: "https://b.example.com", Events: []string{"pending_approval"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(n.Channels(EventPendingApproval), ","); got != "webhook:all,webhook:approvals" {
+		t.Errorf("pending_approval channels = %q", got)
+	}
+	if got := strings.Join(n.Channels(EventExpired), ","); got != "webhook:all" {
+		t.Errorf("expired channels = %q", got)
+	}
+
+	n, err = New(config.NotificationsConfig{Email: &config.EmailConfig{Host: "smtp.example.com", From: "tailgrant@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(n.Channels(EventApproved), ","); got != "email" {
+		t.Errorf("approved channels = %q", got)
+	}
+	if got := n.Channels(EventRevoked); len(got) != 0 {
+		t.Errorf("revoked channels = %q, want none", got)
+	}
+}
+
+func TestWebhook_Send(t *testing.T) {
+	now := time.Unix(1_750_000_000, 0)
+	tests := []struct {
+		status    int
+		wantErr   bool
+		permanent bool
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusAccepted, false, false},
+		{http.StatusBadRequest, true, true},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusServiceUnavailable, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var sig, delivery string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sig = r.Header.Get(SignatureHeader)
+				delivery = r.Header.Get(DeliveryHeader)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			w := &Webhook{Name: "test", URL: srv.URL, Secret: "s3cret", Now: func() time.Time { return now }}
+			err := w.Send(context.Background(), "run/1", Notification{Event: EventRevoked, GrantID: "g1"})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			var perm *PermanentError
+			if errors.As(err, &perm) != tt.permanent {
+				t.Errorf("permanent = %v, want %v (err %v)", !tt.permanent, tt.permanent, err)
+			}
+			if !strings.HasPrefix(sig, "t=1750000000,v1=") {
+				t.Errorf("signature header = %q", sig)
+			}
+			if delivery != "run/1" {
+				t.Errorf("delivery header = %q", delivery)
+			}
+		})
+	}
+}
+
+func TestGrantURL(t *testing.T) {
+	if got := GrantURL("https://tailgrant.example.ts.net/", "grant-1"); got != "https://tailgrant.example.ts.net/#grant=grant-1" {
+		t.Errorf("GrantURL = %q", got)
+	}
+	if got := GrantURL("", "grant-1"); got != "" {
+		t.Errorf("GrantURL without base = %q, want empty", got)
+	}
+}
@@ -0,0 +1,340 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+)
+
+const defaultSlackAPIURL = "https://slack.com/api"
+
+// Slack action IDs on approval message buttons. The button value is the
+// grant ID.
+const (
+	SlackActionApprove = "approve"
+	SlackActionDeny    = "deny"
+)
+
+// ApprovalOutcome is how an approval request was decided. It is empty
+// while the request is pending.
+type ApprovalOutcome string
+
+const (
+	OutcomeApproved  ApprovalOutcome = "approved"
+	OutcomeDenied    ApprovalOutcome = "denied"
+	OutcomeTimedOut  ApprovalOutcome = "timed_out"
+	OutcomeCancelled ApprovalOutcome = "cancelled"
+)
+
+// ApprovalMessage is the content of a Slack approval request. Reason,
+// Duration and Targets are optional details about the grant.
+type ApprovalMessage struct {
+	GrantID   string          `json:"grantID"`
+	GrantType string          `json:"grantType"`
+	Requester string          `json:"requester"`
+	Reason    string          `json:"reason,omitempty"`
+	Duration  string          `json:"duration,omitempty"`
+	Targets   []string        `json:"targets,omitempty"`
+	Approvers []string        `json:"approvers,omitempty"`
+	Stage     string          `json:"stage,omitempty"`
+	Deadline  time.Time       `json:"deadline,omitzero"`
+	Approvals []string        `json:"approvals,omitempty"`
+	Required  int             `json:"required,omitempty"`
+	Outcome   ApprovalOutcome `json:"outcome,omitempty"`
+	DecidedBy string          `json:"decidedBy,omitempty"`
+	Note      string          `json:"note,omitempty"` // deny reason
+}
+
+// SlackMessage identifies a posted message so it can be updated.
+type SlackMessage struct {
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+// Slack is a minimal Slack Web API client for approval messages.
+type Slack struct {
+	Token   string
+	Channel string
+	APIURL  string
+	BaseURL string // TailGrant UI, for deep links
+	Client  *http.Client
+}
+
+// NewSlack builds a Slack client from c. It returns nil if c is nil.
+func NewSlack(c *config.SlackConfig, baseURL string) (*Slack, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.BotToken == "" {
+		return nil, errors.New("slack: botToken is required (or set SLACK_BOT_TOKEN)")
+	}
+	if c.Channel == "" {
+		return nil, errors.New("slack: channel is required")
+	}
+	apiURL := c.APIURL
+	if apiURL == "" {
+		apiURL = defaultSlackAPIURL
+	}
+	return &Slack{
+		Token:   c.BotToken,
+		Channel: c.Channel,
+		APIURL:  strings.TrimRight(apiURL, "/"),
+		BaseURL: strings.TrimRight(baseURL, "/"),
+	}, nil
+}
+
+// PostApproval posts an approval request to the configured channel.
+func (s *Slack) PostApproval(ctx context.Context, msg ApprovalMessage) (SlackMessage, error) {
+	var resp struct {
+		Channel string `json:"channel"`
+		TS      string `json:"ts"`
+	}
+	err := s.call(ctx, "chat.postMessage", map[string]any{
+		"channel": s.Channel,
+		"text":    approvalText(msg),
+		"blocks":  s.approvalBlocks(msg),
+	}, &resp)
+	if err != nil {
+		return SlackMessage{}, err
+	}
+	return SlackMessage{Channel: resp.Channel, TS: resp.TS}, nil
+}
+
+// UpdateApproval replaces a posted approval request with msg, dropping
+// the buttons once it is decided.
+func (s *Slack) UpdateApproval(ctx context.Context, m SlackMessage, msg ApprovalMessage) error {
+	return s.call(ctx, "chat.update", map[string]any{
+		"channel": m.Channel,
+		"ts":      m.TS,
+		"text":    approvalText(msg),
+		"blocks":  s.approvalBlocks(msg),
+	}, nil)
+}
+
+// UserEmail returns the email address on a Slack user's profile.
+func (s *Slack) UserEmail(ctx context.Context, userID string) (string, error) {
+	var resp struct {
+		User struct {
+			Profile struct {
+				Email string `json:"email"`
+			} `json:"profile"`
+		} `json:"user"`
+	}
+	// Read methods take form arguments rather than JSON.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.APIURL+"/users.info?"+url.Values{"user": {userID}}.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("slack users.info: %w", err)
+	}
+	if err := s.do(req, "users.info", &resp); err != nil {
+		return "", err
+	}
+	if resp.User.Profile.Email == "" {
+		return "", fmt.Errorf("slack: user %s has no email (the app needs users:read.email)", userID)
+	}
+	return resp.User.Profile.Email, nil
+}
+
+// Respond sends an ephemeral reply to an interaction through its
+// response_url, visible only to the user who clicked.
+func (s *Slack) Respond(ctx context.Context, responseURL, text string) error {
+	body, err := json.Marshal(map[string]any{
+		"response_type":    "ephemeral",
+		"replace_original": false,
+		"text":             text,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("slack: respond: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack: respond: %s", resp.Status)
+	}
+	return nil
+}
+
+// call invokes a Web API write method with JSON arguments and decodes its
+// response into out.
+func (s *Slack) call(ctx context.Context, method string, args map[string]any, out any) error {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.APIURL+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("slack %s: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return s.do(req, method, out)
+}
+
+// do sends an authenticated Web API request. Slack reports most failures
+// with HTTP 200 and "ok": false.
+func (s *Slack) do(req *http.Request, method string, out any) error {
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("slack %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("slack %s: %w", method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack %s: %s", method, resp.Status)
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("slack %s: invalid response: %w", method, err)
+	}
+	if !status.OK {
+		return fmt.Errorf("slack %s: %s", method, status.Error)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("slack %s: invalid response: %w", method, err)
+		}
+	}
+	return nil
+}
+
+func (s *Slack) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return &http.Client{Timeout: webhookTimeout}
+}
+
+// approvalText is the notification fallback for clients that do not
+// render blocks.
+func approvalText(msg ApprovalMessage) string {
+	return fmt.Sprintf("%s requests %s (%s)", msg.Requester, msg.GrantType, outcomeLabel(msg))
+}
+
+func outcomeLabel(msg ApprovalMessage) string {
+	switch msg.Outcome {
+	case OutcomeApproved:
+		return "approved by " + msg.DecidedBy
+	case OutcomeDenied:
+		if msg.DecidedBy == "" {
+			return "denied"
+		}
+		return "denied by " + msg.DecidedBy
+	case OutcomeTimedOut:
+		return "approval timed out"
+	case OutcomeCancelled:
+		return "cancelled by " + msg.DecidedBy
+	}
+	return "pending approval"
+}
+
+// approvalBlocks renders an approval request as Block Kit: the request,
+// its approval progress, and either the Approve/Deny buttons or the
+// outcome.
+func (s *Slack) approvalBlocks(msg ApprovalMessage) []map[string]any {
+	title := fmt.Sprintf("*%s* requests *%s*", mrkdwnEscape(msg.Requester), mrkdwnEscape(msg.GrantType))
+	if u := GrantURL(s.BaseURL, msg.GrantID); u != "" {
+		title += fmt.Sprintf(" (<%s|view>)", u)
+	}
+	lines := []string{title}
+	if len(msg.Targets) > 0 {
+		lines = append(lines, "*Targets:* "+mrkdwnEscape(strings.Join(msg.Targets, ", ")))
+	}
+	if msg.Duration != "" {
+		lines = append(lines, "*Duration:* "+mrkdwnEscape(msg.Duration))
+	}
+	if msg.Reason != "" {
+		lines = append(lines, "*Reason:* "+mrkdwnEscape(msg.Reason))
+	}
+	blocks := []map[string]any{
+		{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": strings.Join(lines, "\n")}},
+	}
+
+	var progress []string
+	if msg.Stage != "" {
+		progress = append(progress, "Stage: "+mrkdwnEscape(msg.Stage))
+	}
+	if msg.Required > 1 {
+		progress = append(progress, fmt.Sprintf("Approvals: %d/%d", len(msg.Approvals), msg.Required))
+	}
+	if msg.Outcome == "" && !msg.Deadline.IsZero() {
+		progress = append(progress, fmt.Sprintf("Decide by <!date^%d^{date_short_pretty} {time}|%s>",
+			msg.Deadline.Unix(), msg.Deadline.UTC().Format(time.RFC3339)))
+	}
+	progress = append(progress, "ID: `"+msg.GrantID+"`")
+	blocks = append(blocks, map[string]any{
+		"type":     "context",
+		"elements": []map[string]any{{"type": "mrkdwn", "text": strings.Join(progress, "  ·  ")}},
+	})
+
+	if msg.Outcome == "" {
+		blocks = append(blocks, map[string]any{
+			"type":     "actions",
+			"block_id": "tailgrant-approval",
+			"elements": []map[string]any{
+				slackButton(SlackActionApprove, "Approve", "primary", msg.GrantID),
+				slackButton(SlackActionDeny, "Deny", "danger", msg.GrantID),
+			},
+		})
+		return blocks
+	}
+
+	outcome := map[ApprovalOutcome]string{
+		OutcomeApproved:  ":white_check_mark: ",
+		OutcomeDenied:    ":x: ",
+		OutcomeTimedOut:  ":hourglass: ",
+		OutcomeCancelled: ":leftwards_arrow_with_hook: ",
+	}[msg.Outcome] + mrkdwnEscape(capitalize(outcomeLabel(msg)))
+	if msg.Note != "" {
+		outcome += ": " + mrkdwnEscape(msg.Note)
+	}
+	blocks = append(blocks, map[string]any{
+		"type": "section",
+		"text": map[string]any{"type": "mrkdwn", "text": outcome},
+	})
+	return blocks
+}
+
+func slackButton(actionID, label, style, value string) map[string]any {
+	return map[string]any{
+		"type":      "button",
+		"action_id": actionID,
+		"text":      map[string]any{"type": "plain_text", "text": label},
+		"style":     style,
+		"value":     value,
+	}
+}
+
+// mrkdwnEscape escapes the characters Slack treats as control sequences.
+func mrkdwnEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+)
+
+// fakeSlackAPI stands in for the Slack Web API, recording the arguments
+// of each write call by method.
+type fakeSlackAPI struct {
+	calls map[string]map[string]any
+	fail  string // method that reports ok: false
+}
+
+func (f *fakeSlackAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+		_, _ = w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+		return
+	}
+	if method == f.fail {
+		_, _ = w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+		return
+	}
+	switch method {
+	case "users.info":
+		if r.URL.Query().Get("user") != "U123" {
+			_, _ = w.Write([]byte(`{"ok":false,"error":"user_not_found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"user":{"id":"U123","profile":{"email":"approver@example.com"}}}`))
+	default:
+		var args map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&args)
+		f.calls[method] = args
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C42","ts":"1750000000.000100"}`))
+	}
+}
+
+func newTestSlack(t *testing.T) (*Slack, *fakeSlackAPI) {
+	t.Helper()
+	api := &fakeSlackAPI{calls: map[string]map[string]any{}}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	s, err := NewSlack(&config.SlackConfig{BotToken: "xoxb-test", Channel: "C42", APIURL: srv.URL}, "https://tailgrant.example.ts.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, api
+}
+
+// blockTypes lists the block types in a recorded call, with the action IDs
+// of any buttons.
+func blockTypes(args map[string]any) []string {
+	var types []string
+	blocks, _ := args["blocks"].([]any)
+	for _, b := range blocks {
+		block := b.(map[string]any)
+		types = append(types, block["type"].(string))
+		elements, _ := block["elements"].([]any)
+		for _, e := range elements {
+			if id, ok := e.(map[string]any)["action_id"].(string); ok {
+				types = append(types, "button:"+id)
+			}
+		}
+	}
+	return types
+}
+
+func TestNewSlack(t *testing.T) {
+	if s, err := NewSlack(nil, ""); s != nil || err != nil {
+		t.Fatalf("NewSlack(nil) = %v, %v; want nil, nil", s, err)
+	}
+	if _, err := NewSlack(&config.SlackConfig{Channel: "C42"}, ""); err == nil || !strings.Contains(err.Error(), "botToken") {
+		t.Errorf("missing token error = %v", err)
+	}
+	if _, err := NewSlack(&config.SlackConfig{BotToken: "xoxb-test"}, ""); err == nil || !strings.Contains(err.Error(), "channel") {
+		t.Errorf("missing channel error = %v", err)
+	}
+}
+
+func TestSlack_ApprovalLifecycle(t *testing.T) {
+	s, api := newTestSlack(t)
+	ctx := context.Background()
+	msg := ApprovalMessage{
+		GrantID:   "g1",
+		GrantType: "prod-db",
+		Requester: "user@example.com",
+		Reason:    "incident <123>",
+		Targets:   []string{"node-db"},
+		Approvers: []string{"approver@example.com"},
+		Required:  2,
+	}
+
+	m, err := s.PostApproval(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != (SlackMessage{Channel: "C42", TS: "1750000000.000100"}) {
+		t.Errorf("posted message = %+v", m)
+	}
+	post := api.calls["chat.postMessage"]
+	if post["channel"] != "C42" {
+		t.Errorf("channel = %v", post["channel"])
+	}
+	if got := strings.Join(blockTypes(post), ","); got != "section,context,actions,button:approve,button:deny" {
+		t.Errorf("pending blocks = %s", got)
+	}
+	var body strings.Builder
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(post["blocks"])
+	for _, want := range []string{"incident &lt;123&gt;", "Approvals: 0/2", "<https://tailgrant.example.ts.net/#grant=g1|view>"} {
+		if !strings.Contains(body.String(), want) {
+			t.Errorf("blocks missing %q: %s", want, body.String())
+		}
+	}
+
+	msg.Approvals = []string{"approver@example.com"}
+	msg.Outcome = OutcomeDenied
+	msg.DecidedBy = "approver@example.com"
+	msg.Note = "not during freeze"
+	if err := s.UpdateApproval(ctx, m, msg); err != nil {
+		t.Fatal(err)
+	}
+	update := api.calls["chat.update"]
+	if update["ts"] != m.TS || update["channel"] != m.Channel {
+		t.Errorf("update target = %v/%v", update["channel"], update["ts"])
+	}
+	if got := strings.Join(blockTypes(update), ","); got != "section,context,section" {
+		t.Errorf("decided blocks = %s", got)
+	}
+	if !strings.Contains(update["text"].(string), "denied by approver@example.com") {
+		t.Errorf("fallback text = %v", update["text"])
+	}
+}
+
+func TestSlack_UserEmail(t *testing.T) {
+	s, _ := newTestSlack(t)
+	email, err := s.UserEmail(context.Background(), "U123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email != "approver@example.com" {
+		t.Errorf("email = %q", email)
+	}
+	if _, err := s.UserEmail(context.Background(), "U999"); err == nil || !strings.Contains(err.Error(), "user_not_found") {
+		t.Errorf("unknown user error = %v", err)
+	}
+}
+
+func TestSlack_APIError(t *testing.T) {
+	s, api := newTestSlack(t)
+	api.fail = "chat.postMessage"
+	_, err := s.PostApproval(context.Background(), ApprovalMessage{GrantID: "g1"})
+	if err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Errorf("error = %v, want channel_not_found", err)
+	}
+}
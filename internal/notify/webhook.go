@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/config"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 signature of a webhook
+	// delivery, in the same "t=<unix seconds>,v1=<hex>" form Tailscale uses
+	// for its own webhooks.
+	SignatureHeader = "TailGrant-Signature"
+
+	// EventHeader names the event type of a webhook delivery.
+	EventHeader = "TailGrant-Event"
+
+	// DeliveryHeader carries an ID that is the same for every retry of a
+	// delivery.
+	DeliveryHeader = "TailGrant-Delivery"
+
+	webhookTimeout = 15 * time.Second
+)
+
+// Webhook posts notifications as signed JSON to an HTTP endpoint.
+type Webhook struct {
+	Name   string
+	URL    string
+	Secret string
+	Events []EventType // empty delivers every event
+
+	Client *http.Client
+	Now    func() time.Time
+}
+
+// NewWebhook validates c and builds the endpoint it describes.
+func NewWebhook(c config.NotificationWebhookConfig) (*Webhook, error) {
+	if c.Name == "" {
+		return nil, errors.New("webhook name is required")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook %q: invalid url %q", c.Name, c.URL)
+	}
+	w := &Webhook{Name: c.Name, URL: c.URL, Secret: c.Secret}
+	for _, e := range c.Events {
+		if !validEvent(EventType(e)) {
+			return nil, fmt.Errorf("webhook %q: unknown event %q", c.Name, e)
+		}
+		w.Events = append(w.Events, EventType(e))
+	}
+	return w, nil
+}
+
+// Subscribed reports whether the endpoint receives an event.
+func (w *Webhook) Subscribed(event EventType) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// Send posts one notification. Responses other than 2xx are errors; 4xx
+// responses other than 408 and 429 are wrapped in a PermanentError since
+// repeating the request will not help.
+func (w *Webhook) Send(ctx context.Context, deliveryID string, msg Notification) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", w.Name, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tailgrant")
+	req.Header.Set(EventHeader, string(msg.Event))
+	req.Header.Set(DeliveryHeader, deliveryID)
+	if w.Secret != "" {
+		now := time.Now
+		if w.Now != nil {
+			now = w.Now
+		}
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body, now()))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", w.Name, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return &PermanentError{Err: fmt.Errorf("webhook %s rejected notification: %s", w.Name, resp.Status)}
+	default:
+		return fmt.Errorf("webhook %s: %s", w.Name, resp.Status)
+	}
+}
+
+// PermanentError is a delivery failure that retrying will not fix.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Sign returns the signature header value for a webhook body sent at t:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">".
+func Sign(secret string, body []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -1,16 +1,27 @@
 package server
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/rajsinghtech/tailgrant/internal/audit"
 	"github.com/rajsinghtech/tailgrant/internal/grant"
 	enumspb "go.temporal.io/api/enums/v1"
 	"go.temporal.io/api/workflowservice/v1"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/temporal"
 	tailscale "tailscale.com/client/tailscale/v2"
 )
 
@@ -18,15 +29,25 @@ type Handlers struct {
 	TemporalClient client.Client
 	TSClient       *tailscale.Client
 	GrantTypes     grant.GrantTypeStore
+	Directory      grant.Directory
 	TaskQueue      string
+	Namespace      string
+	Admins         []string
+	AuditFile      string
 }
 
 type createGrantRequest struct {
-	GrantTypeName string `json:"grantTypeName"`
-	TargetNodeID  string `json:"targetNodeID"`
-	TargetUserID  string `json:"targetUserID"`
-	Duration      string `json:"duration"`
-	Reason        string `json:"reason"`
+	GrantTypeName string   `json:"grantTypeName"`
+	TargetNodeID  string   `json:"targetNodeID"`
+	TargetNodeIDs []string `json:"targetNodeIDs"`
+	TargetTag     string   `json:"targetTag"`
+	TargetUserID  string   `json:"targetUserID"`
+	Duration      string   `json:"duration"`
+	Reason        string   `json:"reason"`
+	// StartAt optionally schedules activation for a future time (RFC 3339).
+	StartAt *time.Time `json:"startAt,omitempty"`
+	// BreakGlass activates at once without approval, for review afterwards.
+	BreakGlass bool `json:"breakGlass,omitempty"`
 }
 
 func (h *Handlers) HandleCreateGrant(w http.ResponseWriter, r *http.Request) {
@@ -48,6 +69,16 @@ func (h *Handlers) HandleCreateGrant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	eligible, err := grant.CanRequest(r.Context(), h.Directory, *gt, who.UserProfile.LoginName)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "failed to resolve eligible requesters: "+err.Error())
+		return
+	}
+	if !eligible {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("not eligible to request grant type %q", gt.Name))
+		return
+	}
+
 	dur, err := time.ParseDuration(req.Duration)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "invalid duration: "+err.Error())
@@ -62,24 +93,79 @@ func (h *Handlers) HandleCreateGrant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.BreakGlass {
+		if !gt.BreakGlass {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("grant type %q does not allow break-glass requests", gt.Name))
+			return
+		}
+		if strings.TrimSpace(req.Reason) == "" {
+			writeError(w, http.StatusBadRequest, "break-glass requests need a reason")
+			return
+		}
+		if req.StartAt != nil {
+			writeError(w, http.StatusBadRequest, "break-glass requests cannot be scheduled")
+			return
+		}
+	}
+
+	var startAt time.Time
+	if req.StartAt != nil {
+		if !req.StartAt.After(time.Now()) {
+			writeError(w, http.StatusBadRequest, "startAt must be in the future")
+			return
+		}
+		startAt = *req.StartAt
+	}
+
 	action := gt.Action
 	if action == "" {
 		action = grant.ActionTag
 	}
 
-	switch action {
-	case grant.ActionTag:
-		if req.TargetNodeID == "" {
-			writeError(w, http.StatusBadRequest, "targetNodeID is required for tag grants")
+	switch {
+	case action.TargetsDevices():
+		set := 0
+		for _, ok := range []bool{req.TargetNodeID != "", len(req.TargetNodeIDs) > 0, req.TargetTag != ""} {
+			if ok {
+				set++
+			}
+		}
+		if set == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("targetNodeID is required for %s grants", action))
 			return
 		}
-		if h.TSClient != nil {
-			if _, err := h.TSClient.Devices().Get(r.Context(), req.TargetNodeID); err != nil {
-				writeError(w, http.StatusBadRequest, "target device not found: "+err.Error())
+		if set > 1 {
+			writeError(w, http.StatusBadRequest, "only one of targetNodeID, targetNodeIDs or targetTag may be set")
+			return
+		}
+		if req.TargetTag != "" && !strings.HasPrefix(req.TargetTag, "tag:") {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("targetTag %q must start with \"tag:\"", req.TargetTag))
+			return
+		}
+		nodeIDs := req.TargetNodeIDs
+		if req.TargetNodeID != "" {
+			nodeIDs = []string{req.TargetNodeID}
+		}
+		for i, id := range nodeIDs {
+			if id == "" || slices.Contains(nodeIDs[:i], id) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid or duplicate target node ID %q", id))
 				return
 			}
 		}
-	case grant.ActionUserRole, grant.ActionUserRestore:
+		if h.TSClient != nil {
+			for _, id := range nodeIDs {
+				dev, err := h.TSClient.Devices().Get(r.Context(), id)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "target device not found: "+err.Error())
+					return
+				}
+				if err := gt.Targets.Check(dev, who.UserProfile.LoginName); err != nil {
+					writeError(w, http.StatusForbidden, fmt.Sprintf("target not allowed for grant type %q: %s", gt.Name, err))
+					return
+				}
+			}
+		}
+	case gt.TargetsUser():
 		if req.TargetUserID == "" {
 			writeError(w, http.StatusBadRequest, "targetUserID is required for user grants")
 			return
@@ -99,10 +185,56 @@ func (h *Handlers) HandleCreateGrant(w http.ResponseWriter, r *http.Request) {
 		RequesterNode: string(who.Node.StableID),
 		GrantTypeName: req.GrantTypeName,
 		TargetNodeID:  req.TargetNodeID,
+		TargetNodeIDs: req.TargetNodeIDs,
+		TargetTag:     req.TargetTag,
 		TargetUserID:  req.TargetUserID,
 		Duration:      dur,
 		Reason:        req.Reason,
 		RequestedAt:   time.Now(),
+		StartAt:       startAt,
+		BreakGlass:    req.BreakGlass,
+	}
+
+	// Evaluate request policy up front so denials fail fast; GrantWorkflow
+	// evaluates it again before approval.
+	policyInputs, err := grant.NewPolicyInputs(r.Context(), h.TSClient, gt, grantReq)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "failed to load policy input: "+err.Error())
+		return
+	}
+	for i := range policyInputs {
+		policyInputs[i].Time = grantReq.RequestedAt
+	}
+	decision, err := grant.EvaluatePolicyTargets(gt, policyInputs)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "policy evaluation failed: "+err.Error())
+		return
+	}
+	if decision.Decision == grant.DecisionDeny {
+		msg := decision.Message
+		if msg == "" {
+			msg = "request denied by policy"
+		}
+		writeError(w, http.StatusForbidden, msg)
+		return
+	}
+
+	if gt.Quota != nil {
+		if err := h.reserveQuota(r.Context(), grantReq, gt); err != nil {
+			var appErr *temporal.ApplicationError
+			if errors.As(err, &appErr) {
+				switch appErr.Type() {
+				case grant.ErrTypeConcurrencyLimit:
+					writeError(w, http.StatusConflict, appErr.Message())
+					return
+				case grant.ErrTypeRateLimit:
+					writeError(w, http.StatusTooManyRequests, appErr.Message())
+					return
+				}
+			}
+			writeError(w, http.StatusBadGateway, "failed to reserve quota: "+err.Error())
+			return
+		}
 	}
 
 	workflowID := fmt.Sprintf("grant-%s", id)
@@ -113,6 +245,11 @@ func (h *Handlers) HandleCreateGrant(w http.ResponseWriter, r *http.Request) {
 
 	_, err = h.TemporalClient.ExecuteWorkflow(r.Context(), opts, grant.GrantWorkflow, grantReq, *gt)
 	if err != nil {
+		if gt.Quota != nil {
+			if err := h.TemporalClient.SignalWorkflow(r.Context(), grant.QuotaWorkflowID(grantReq.Requester), "", "release", grant.QuotaRelease{GrantID: id}); err != nil {
+				slog.Error("failed to release quota", "grantID", id, "error", err)
+			}
+		}
 		writeError(w, http.StatusInternalServerError, "failed to start workflow: "+err.Error())
 		return
 	}
@@ -121,6 +258,7 @@ func (h *Handlers) HandleCreateGrant(w http.ResponseWriter, r *http.Request) {
 		"id":         id,
 		"workflowID": workflowID,
 		"status":     "started",
+		"decision":   string(decision.Decision),
 	})
 }
 
@@ -132,41 +270,115 @@ func (h *Handlers) HandleApproveGrant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Query the grant to check for self-approval before signaling.
-	resp, err := h.TemporalClient.QueryWorkflow(r.Context(), fmt.Sprintf("grant-%s", id), "", "status")
+	status, err := h.approve(r.Context(), id, who.UserProfile.LoginName)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to query grant: "+err.Error())
+		writeHTTPError(w, err)
 		return
 	}
-	var state grant.GrantState
-	if err := resp.Get(&state); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to decode grant state: "+err.Error())
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id":     id,
+		"status": status,
+	})
+}
+
+func (h *Handlers) HandleDenyGrant(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	who := WhoIsFromContext(r.Context())
+	if who == nil {
+		writeError(w, http.StatusUnauthorized, "missing identity")
 		return
 	}
-	if state.Status != grant.StatusPendingApproval {
-		writeError(w, http.StatusConflict, fmt.Sprintf("grant is %s, not pending approval", state.Status))
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
 		return
 	}
-	if state.Request.Requester == who.UserProfile.LoginName {
-		writeError(w, http.StatusForbidden, "cannot approve your own grant request")
+
+	if err := h.deny(r.Context(), id, who.UserProfile.LoginName, body.Reason); err != nil {
+		writeHTTPError(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id":     id,
+		"status": "denied",
+	})
+}
+
+// approve signals login's approval of grant id and returns the status the
+// grant moves to. Authorization is checked before signaling, for the API
+// and Slack alike; ApprovalWorkflow re-checks it.
+func (h *Handlers) approve(ctx context.Context, id, login string) (string, error) {
+	state, gt, err := h.loadGrant(ctx, id)
+	if err != nil {
+		return "", &httpError{http.StatusInternalServerError, err.Error()}
+	}
+	state, pending := approvalView(state)
+	if !pending {
+		return "", &httpError{http.StatusConflict, fmt.Sprintf("grant is %s, not pending approval", state.Status)}
+	}
+	if state.Request.Requester == login {
+		return "", &httpError{http.StatusForbidden, "cannot approve your own grant request"}
+	}
+	if state.Renewal != nil && state.Renewal.RequestedBy == login {
+		return "", &httpError{http.StatusForbidden, "cannot approve your own renewal request"}
+	}
+	caller, err := grant.ResolveCaller(ctx, h.Directory, approvalStageGrantType(state, gt), login)
+	if err != nil {
+		return "", &httpError{http.StatusBadGateway, "failed to resolve approvers: " + err.Error()}
+	}
+	if !grant.CanApprove(state.Request, caller) {
+		return "", &httpError{http.StatusForbidden, "not an approver for this grant type"}
+	}
+	if slices.Contains(state.Approvals, login) {
+		return "", &httpError{http.StatusConflict, "you have already approved this grant"}
+	}
 
-	err = h.TemporalClient.SignalWorkflow(r.Context(), fmt.Sprintf("approval-%s", id), "", "approve", grant.ApproveSignal{
-		ApprovedBy: who.UserProfile.LoginName,
+	err = h.TemporalClient.SignalWorkflow(ctx, fmt.Sprintf("approval-%s", id), "", "approve", grant.ApproveSignal{
+		ApprovedBy: login,
 	})
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to signal approval: "+err.Error())
-		return
+		return "", &httpError{http.StatusInternalServerError, "failed to signal approval: " + err.Error()}
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{
-		"id":     id,
-		"status": "approved",
+	if len(state.Approvals)+1 < gt.ApprovalQuorum() {
+		return string(grant.StatusPartiallyApproved), nil
+	}
+	return "approved", nil
+}
+
+// deny signals login's denial of grant id after checking that login may
+// deny it.
+func (h *Handlers) deny(ctx context.Context, id, login, reason string) error {
+	state, gt, err := h.loadGrant(ctx, id)
+	if err != nil {
+		return &httpError{http.StatusInternalServerError, err.Error()}
+	}
+	state, pending := approvalView(state)
+	if !pending {
+		return &httpError{http.StatusConflict, fmt.Sprintf("grant is %s, not pending approval", state.Status)}
+	}
+	caller, err := grant.ResolveCaller(ctx, h.Directory, approvalStageGrantType(state, gt), login)
+	if err != nil {
+		return &httpError{http.StatusBadGateway, "failed to resolve approvers: " + err.Error()}
+	}
+	if !grant.CanDeny(caller) {
+		return &httpError{http.StatusForbidden, "not an approver for this grant type"}
+	}
+
+	err = h.TemporalClient.SignalWorkflow(ctx, fmt.Sprintf("approval-%s", id), "", "deny", grant.DenySignal{
+		DeniedBy: login,
+		Reason:   reason,
 	})
+	if err != nil {
+		return &httpError{http.StatusInternalServerError, "failed to signal denial: " + err.Error()}
+	}
+	return nil
 }
 
-func (h *Handlers) HandleDenyGrant(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) HandleRevokeGrant(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	who := WhoIsFromContext(r.Context())
 	if who == nil {
@@ -182,22 +394,96 @@ func (h *Handlers) HandleDenyGrant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.TemporalClient.SignalWorkflow(r.Context(), fmt.Sprintf("approval-%s", id), "", "deny", grant.DenySignal{
-		DeniedBy: who.UserProfile.LoginName,
-		Reason:   body.Reason,
+	state, gt, err := h.loadGrant(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if state.Status != grant.StatusActive && state.Status != grant.StatusScheduled {
+		writeError(w, http.StatusConflict, fmt.Sprintf("grant is %s, not active or scheduled", state.Status))
+		return
+	}
+	caller, err := grant.ResolveCaller(r.Context(), h.Directory, *gt, who.UserProfile.LoginName)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "failed to resolve approvers: "+err.Error())
+		return
+	}
+	if !grant.CanRevoke(state.Request, caller) {
+		writeError(w, http.StatusForbidden, "only the requester, an approver or an admin can revoke this grant")
+		return
+	}
+
+	err = h.TemporalClient.SignalWorkflow(r.Context(), fmt.Sprintf("grant-%s", id), "", "revoke", grant.RevokeSignal{
+		RevokedBy: who.UserProfile.LoginName,
+		Reason:    body.Reason,
 	})
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to signal denial: "+err.Error())
+		writeError(w, http.StatusInternalServerError, "failed to signal revocation: "+err.Error())
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]string{
 		"id":     id,
-		"status": "denied",
+		"status": "revoked",
 	})
 }
 
-func (h *Handlers) HandleRevokeGrant(w http.ResponseWriter, r *http.Request) {
+// HandleCancelGrant lets the requester withdraw a grant that is still
+// awaiting approval or scheduled. The approval, if any, is closed before the
+// grant itself is cancelled.
+func (h *Handlers) HandleCancelGrant(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	who := WhoIsFromContext(r.Context())
+	if who == nil {
+		writeError(w, http.StatusUnauthorized, "missing identity")
+		return
+	}
+
+	state, _, err := h.loadGrant(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !state.Status.AwaitingApproval() && state.Status != grant.StatusScheduled {
+		writeError(w, http.StatusConflict, fmt.Sprintf("grant is %s, not pending or scheduled", state.Status))
+		return
+	}
+	if !grant.CanCancel(state.Request, grant.Caller{Login: who.UserProfile.LoginName}) {
+		writeError(w, http.StatusForbidden, "only the requester can cancel this grant")
+		return
+	}
+
+	sig := grant.CancelSignal{CancelledBy: who.UserProfile.LoginName}
+	if state.Status.AwaitingApproval() {
+		if err := h.TemporalClient.SignalWorkflow(r.Context(), fmt.Sprintf("approval-%s", id), "", "cancel", sig); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to signal approval workflow: "+err.Error())
+			return
+		}
+	}
+	if err := h.TemporalClient.SignalWorkflow(r.Context(), fmt.Sprintf("grant-%s", id), "", "cancel", sig); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to signal cancellation: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id":     id,
+		"status": "cancelled",
+	})
+}
+
+// HandleAcknowledgeGrant records an approver's review of a break-glass
+// grant as acknowledged.
+func (h *Handlers) HandleAcknowledgeGrant(w http.ResponseWriter, r *http.Request) {
+	h.reviewBreakGlass(w, r, grant.ReviewAcknowledged)
+}
+
+// HandleRejectGrant records an approver's review of a break-glass grant as
+// rejected, which revokes the grant if it is still active.
+func (h *Handlers) HandleRejectGrant(w http.ResponseWriter, r *http.Request) {
+	h.reviewBreakGlass(w, r, grant.ReviewRejected)
+}
+
+func (h *Handlers) reviewBreakGlass(w http.ResponseWriter, r *http.Request, outcome grant.ReviewStatus) {
 	id := r.PathValue("id")
 	who := WhoIsFromContext(r.Context())
 	if who == nil {
@@ -206,25 +492,52 @@ func (h *Handlers) HandleRevokeGrant(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var body struct {
-		Reason string `json:"reason"`
+		Note string `json:"note"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
 		return
 	}
 
-	err := h.TemporalClient.SignalWorkflow(r.Context(), fmt.Sprintf("grant-%s", id), "", "revoke", grant.RevokeSignal{
-		RevokedBy: who.UserProfile.LoginName,
-		Reason:    body.Reason,
+	state, gt, err := h.loadGrant(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if state.BreakGlass == nil {
+		writeError(w, http.StatusConflict, "grant is not a break-glass grant")
+		return
+	}
+	if state.BreakGlass.Status != grant.ReviewPending {
+		writeError(w, http.StatusConflict, fmt.Sprintf("break-glass review is already %s", state.BreakGlass.Status))
+		return
+	}
+	caller, err := grant.ResolveCaller(r.Context(), h.Directory, gt.ForLastStage(), who.UserProfile.LoginName)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "failed to resolve approvers: "+err.Error())
+		return
+	}
+	if !grant.CanApprove(state.Request, caller) {
+		writeError(w, http.StatusForbidden, "only an approver other than the requester can review this grant")
+		return
+	}
+
+	signal := "acknowledge"
+	if outcome == grant.ReviewRejected {
+		signal = "reject"
+	}
+	err = h.TemporalClient.SignalWorkflow(r.Context(), fmt.Sprintf("grant-%s", id), "", signal, grant.ReviewSignal{
+		ReviewedBy: who.UserProfile.LoginName,
+		Note:       body.Note,
 	})
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to signal revocation: "+err.Error())
+		writeError(w, http.StatusInternalServerError, "failed to signal review: "+err.Error())
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]string{
 		"id":     id,
-		"status": "revoked",
+		"status": string(outcome),
 	})
 }
 
@@ -246,13 +559,33 @@ func (h *Handlers) HandleGetGrant(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, state)
 }
 
+// HandleListGrantTypes lists the grant types the caller is eligible to
+// request.
 func (h *Handlers) HandleListGrantTypes(w http.ResponseWriter, r *http.Request) {
+	who := WhoIsFromContext(r.Context())
+	if who == nil {
+		writeError(w, http.StatusUnauthorized, "missing identity")
+		return
+	}
+
 	types, err := h.GrantTypes.List()
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, types)
+
+	eligible := make([]*grant.GrantType, 0, len(types))
+	for _, gt := range types {
+		ok, err := grant.CanRequest(r.Context(), h.Directory, *gt, who.UserProfile.LoginName)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, "failed to resolve eligible requesters: "+err.Error())
+			return
+		}
+		if ok {
+			eligible = append(eligible, gt)
+		}
+	}
+	writeJSON(w, http.StatusOK, eligible)
 }
 
 func (h *Handlers) HandleListDevices(w http.ResponseWriter, r *http.Request) {
@@ -260,11 +593,35 @@ func (h *Handlers) HandleListDevices(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "tailscale API client not configured")
 		return
 	}
+	// ?grantType= narrows the list to devices the caller may target with
+	// that grant type.
+	var gt *grant.GrantType
+	who := WhoIsFromContext(r.Context())
+	if name := r.URL.Query().Get("grantType"); name != "" {
+		if who == nil {
+			writeError(w, http.StatusUnauthorized, "missing identity")
+			return
+		}
+		var err error
+		if gt, err = h.GrantTypes.Get(name); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !gt.Action.TargetsDevices() {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("grant type %q does not target devices", gt.Name))
+			return
+		}
+	}
 	devices, err := h.TSClient.Devices().List(r.Context())
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to list devices: "+err.Error())
 		return
 	}
+	if gt != nil {
+		devices = slices.DeleteFunc(devices, func(d tailscale.Device) bool {
+			return gt.Targets.Check(&d, who.UserProfile.LoginName) != nil
+		})
+	}
 	writeJSON(w, http.StatusOK, devices)
 }
 
@@ -294,43 +651,111 @@ func (h *Handlers) HandleWhoAmI(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// grantFilters maps GET /api/grants query parameters to the search
+// attributes they filter on.
+var grantFilters = []struct {
+	param string
+	attr  string
+}{
+	{"status", grant.SearchAttrStatus.GetName()},
+	{"requester", grant.SearchAttrRequester.GetName()},
+	{"grantType", grant.SearchAttrGrantType.GetName()},
+	{"target", grant.SearchAttrTarget.GetName()},
+}
+
+const (
+	defaultGrantPageSize = 100
+	maxGrantPageSize     = 1000
+)
+
+type listGrantsResponse struct {
+	Grants        []grant.GrantState `json:"grants"`
+	NextPageToken string             `json:"nextPageToken,omitempty"`
+}
+
 func (h *Handlers) HandleListGrants(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	params := r.URL.Query()
+
+	query := "WorkflowType = 'GrantWorkflow'"
+	for _, f := range grantFilters {
+		v := params.Get(f.param)
+		if v == "" {
+			continue
+		}
+		if strings.ContainsAny(v, "'\"\\") {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s %q", f.param, v))
+			return
+		}
+		query += fmt.Sprintf(" AND %s = '%s'", f.attr, v)
+	}
+	if status := params.Get("status"); status != "" && !grant.GrantStatus(status).Valid() {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown status %q", status))
+		return
+	}
+
+	pageSize := defaultGrantPageSize
+	if v := params.Get("pageSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxGrantPageSize {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("pageSize must be between 1 and %d", maxGrantPageSize))
+			return
+		}
+		pageSize = n
+	}
+	pageToken, err := base64.RawURLEncoding.DecodeString(params.Get("pageToken"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid pageToken")
+		return
+	}
 
 	resp, err := h.TemporalClient.ListWorkflow(ctx, &workflowservice.ListWorkflowExecutionsRequest{
-		Namespace: "default",
-		Query:     "WorkflowType = 'GrantWorkflow'",
+		Namespace:     h.Namespace,
+		PageSize:      int32(pageSize),
+		NextPageToken: pageToken,
+		Query:         query,
 	})
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to list workflows: "+err.Error())
 		return
 	}
 
-	var grants []grant.GrantState
+	grants := []grant.GrantState{}
 	for _, exec := range resp.Executions {
-		wfID := exec.Execution.WorkflowId
 		status := exec.Status
 		if status != enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING &&
 			status != enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED {
 			continue
 		}
 
-		qResp, err := h.TemporalClient.QueryWorkflow(ctx, wfID, "", "status")
-		if err != nil {
+		var state grant.GrantState
+		if payload, ok := exec.GetMemo().GetFields()[grant.GrantMemoKey]; ok {
+			if err := converter.GetDefaultDataConverter().FromPayload(payload, &state); err != nil {
+				continue
+			}
+			grants = append(grants, state)
 			continue
 		}
 
-		var state grant.GrantState
+		// Grants started before the memo snapshot existed can only be
+		// read through the status query while they are running.
+		if status != enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING {
+			continue
+		}
+		qResp, err := h.TemporalClient.QueryWorkflow(ctx, exec.Execution.WorkflowId, "", "status")
+		if err != nil {
+			continue
+		}
 		if err := qResp.Get(&state); err != nil {
 			continue
 		}
 		grants = append(grants, state)
 	}
 
-	if grants == nil {
-		grants = []grant.GrantState{}
-	}
-	writeJSON(w, http.StatusOK, grants)
+	writeJSON(w, http.StatusOK, listGrantsResponse{
+		Grants:        grants,
+		NextPageToken: base64.RawURLEncoding.EncodeToString(resp.NextPageToken),
+	})
 }
 
 func (h *Handlers) HandleExtendGrant(w http.ResponseWriter, r *http.Request) {
@@ -359,6 +784,33 @@ func (h *Handlers) HandleExtendGrant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	state, gt, err := h.loadGrant(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if state.Status != grant.StatusActive {
+		writeError(w, http.StatusConflict, fmt.Sprintf("grant is %s, not active", state.Status))
+		return
+	}
+	caller, err := grant.ResolveCaller(r.Context(), h.Directory, *gt, who.UserProfile.LoginName)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "failed to resolve approvers: "+err.Error())
+		return
+	}
+	if !grant.CanExtend(*gt, state.Request, caller) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("extend policy %q does not allow you to extend this grant", gt.ExtendPolicy))
+		return
+	}
+	if err := grant.CheckExtension(*gt, state, dur, time.Now()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if gt.RenewalNeedsApproval() && state.Renewal != nil {
+		writeError(w, http.StatusConflict, "an extension is already pending approval")
+		return
+	}
+
 	err = h.TemporalClient.SignalWorkflow(r.Context(), fmt.Sprintf("grant-%s", id), "", "extend", grant.ExtendSignal{
 		ExtendedBy: who.UserProfile.LoginName,
 		Duration:   dur,
@@ -368,12 +820,199 @@ func (h *Handlers) HandleExtendGrant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	status := "extended"
+	if gt.RenewalNeedsApproval() {
+		status = "renewal_pending"
+	}
 	writeJSON(w, http.StatusOK, map[string]string{
 		"id":     id,
-		"status": "extended",
+		"status": status,
 	})
 }
 
+// HandleRenewGrant asks for an active grant to be extended. Renewals of
+// medium and high risk grant types, and of types with
+// extensionRequiresApproval, go back through approval, and the grant is only
+// extended once approved; other renewals apply at once.
+func (h *Handlers) HandleRenewGrant(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	who := WhoIsFromContext(r.Context())
+	if who == nil {
+		writeError(w, http.StatusUnauthorized, "missing identity")
+		return
+	}
+
+	var body struct {
+		Duration string `json:"duration"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	dur, err := time.ParseDuration(body.Duration)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid duration: "+err.Error())
+		return
+	}
+	if dur <= 0 {
+		writeError(w, http.StatusBadRequest, "duration must be positive")
+		return
+	}
+
+	state, gt, err := h.loadGrant(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if state.Status != grant.StatusActive {
+		writeError(w, http.StatusConflict, fmt.Sprintf("grant is %s, not active", state.Status))
+		return
+	}
+	if state.Renewal != nil {
+		writeError(w, http.StatusConflict, "a renewal is already pending approval")
+		return
+	}
+	caller, err := grant.ResolveCaller(r.Context(), h.Directory, *gt, who.UserProfile.LoginName)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "failed to resolve approvers: "+err.Error())
+		return
+	}
+	if !grant.CanExtend(*gt, state.Request, caller) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("extend policy %q does not allow you to renew this grant", gt.ExtendPolicy))
+		return
+	}
+	if err := grant.CheckExtension(*gt, state, dur, time.Now()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = h.TemporalClient.SignalWorkflow(r.Context(), fmt.Sprintf("grant-%s", id), "", "renew", grant.RenewSignal{
+		RequestedBy: who.UserProfile.LoginName,
+		Duration:    dur,
+		Reason:      body.Reason,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to signal renewal: "+err.Error())
+		return
+	}
+
+	status := "extended"
+	if gt.RenewalNeedsApproval() {
+		status = "renewal_pending"
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id":     id,
+		"status": status,
+	})
+}
+
+const (
+	defaultAuditLimit = 1000
+	maxAuditLimit     = 10000
+)
+
+// HandleListAudit returns events from the audit log file, filtered by
+// ?from= and ?to= (RFC 3339, to is exclusive) and ?grantID=. Only admins
+// may read the audit log.
+func (h *Handlers) HandleListAudit(w http.ResponseWriter, r *http.Request) {
+	who := WhoIsFromContext(r.Context())
+	if who == nil {
+		writeError(w, http.StatusUnauthorized, "missing identity")
+		return
+	}
+	ok, err := grant.IsAdmin(r.Context(), h.Directory, h.Admins, who.UserProfile.LoginName)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "failed to resolve admins: "+err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusForbidden, "only admins can read the audit log")
+		return
+	}
+	if h.AuditFile == "" {
+		writeError(w, http.StatusNotFound, "audit log file not configured")
+		return
+	}
+
+	params := r.URL.Query()
+	filter := audit.Filter{GrantID: params.Get("grantID"), Limit: defaultAuditLimit}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		v := params.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: must be RFC 3339", p.name))
+			return
+		}
+		*p.dst = t
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit))
+			return
+		}
+		filter.Limit = n
+	}
+
+	auditLog, err := audit.ReadFile(h.AuditFile, filter)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Nothing has been recorded yet.
+		auditLog, err = &audit.Log{Events: []audit.Event{}, Verified: true}, nil
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to read audit log: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, auditLog)
+}
+
+// loadGrant queries a grant's current state and looks up its grant type for
+// authorization checks.
+func (h *Handlers) loadGrant(ctx context.Context, id string) (grant.GrantState, *grant.GrantType, error) {
+	var state grant.GrantState
+	resp, err := h.TemporalClient.QueryWorkflow(ctx, fmt.Sprintf("grant-%s", id), "", "status")
+	if err != nil {
+		return state, nil, fmt.Errorf("failed to query grant: %w", err)
+	}
+	if err := resp.Get(&state); err != nil {
+		return state, nil, fmt.Errorf("failed to decode grant state: %w", err)
+	}
+	gt, err := h.GrantTypes.Get(state.Request.GrantTypeName)
+	if err != nil {
+		return state, nil, err
+	}
+	return state, gt, nil
+}
+
+// approvalView returns state as its pending ApprovalWorkflow sees it, and
+// whether anything is pending approval. For a renewal of an active grant,
+// the renewal's approvals and stage stand in for the original request's.
+func approvalView(state grant.GrantState) (grant.GrantState, bool) {
+	if r := state.Renewal; r != nil {
+		state.Approvals = r.Approvals
+		state.ApprovalStage = r.ApprovalStage
+		return state, true
+	}
+	return state, state.Status.AwaitingApproval()
+}
+
+// approvalStageGrantType narrows the grant type to the approvers eligible
+// at the grant's current escalation stage.
+func approvalStageGrantType(state grant.GrantState, gt *grant.GrantType) grant.GrantType {
+	if state.ApprovalStage == nil {
+		return *gt
+	}
+	return gt.ForStage(state.ApprovalStage.Index)
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -383,3 +1022,51 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 func writeError(w http.ResponseWriter, status int, msg string) {
 	writeJSON(w, status, map[string]string{"error": msg})
 }
+
+// httpError is a request failure and the status to report it with.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+// writeHTTPError writes err with its status, or 500 if it has none.
+func writeHTTPError(w http.ResponseWriter, err error) {
+	var he *httpError
+	if errors.As(err, &he) {
+		writeError(w, he.status, he.msg)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// reserveQuota records the grant against the requester's quotas through
+// their UserQuotaWorkflow, starting it if needed. A rejected reservation
+// returns the workflow's application error.
+func (h *Handlers) reserveQuota(ctx context.Context, req grant.GrantRequest, gt *grant.GrantType) error {
+	startOp := h.TemporalClient.NewWithStartWorkflowOperation(client.StartWorkflowOptions{
+		ID:                       grant.QuotaWorkflowID(req.Requester),
+		TaskQueue:                h.TaskQueue,
+		WorkflowIDConflictPolicy: enumspb.WORKFLOW_ID_CONFLICT_POLICY_USE_EXISTING,
+	}, grant.UserQuotaWorkflow, grant.UserQuotaState{Login: req.Requester})
+
+	handle, err := h.TemporalClient.UpdateWithStartWorkflow(ctx, client.UpdateWithStartWorkflowOptions{
+		StartWorkflowOperation: startOp,
+		UpdateOptions: client.UpdateWorkflowOptions{
+			UpdateName: "reserve",
+			Args: []any{grant.QuotaReservation{
+				GrantID:   req.ID,
+				GrantType: gt.Name,
+				Quota:     *gt.Quota,
+				Duration:  req.Duration,
+				StartAt:   req.StartAt,
+			}},
+			WaitForStage: client.WorkflowUpdateStageCompleted,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return handle.Get(ctx, nil)
+}
@@ -3,15 +3,32 @@ package server
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/rajsinghtech/tailgrant/internal/audit"
 	"github.com/rajsinghtech/tailgrant/internal/grant"
+	"github.com/stretchr/testify/mock"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/mocks"
+	"go.temporal.io/sdk/temporal"
 	"tailscale.com/client/tailscale/apitype"
+	tailscale "tailscale.com/client/tailscale/v2"
 	"tailscale.com/tailcfg"
 )
 
@@ -104,6 +121,7 @@ func TestHandleListGrantTypes(t *testing.T) {
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/api/grant-types", nil)
+	req = withWhoIs(req, "user@example.com", "node-123")
 	w := httptest.NewRecorder()
 
 	handlers.HandleListGrantTypes(w, req)
@@ -131,6 +149,7 @@ func TestHandleListGrantTypes_StoreError(t *testing.T) {
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/api/grant-types", nil)
+	req = withWhoIs(req, "user@example.com", "node-123")
 	w := httptest.NewRecorder()
 
 	handlers.HandleListGrantTypes(w, req)
@@ -498,6 +517,87 @@ func TestHandleCreateGrant_UserRestoreGrant_MissingTargetUserID(t *testing.T) {
 	}
 }
 
+func TestHandleCreateGrant_DeviceAuthorizeGrant_MissingTargetNodeID(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["contractor-device"] = &grant.GrantType{
+		Name:        "contractor-device",
+		MaxDuration: grant.JSONDuration(8 * time.Hour),
+		RiskLevel:   grant.RiskMedium,
+		Approvers:   []string{"admin@example.com"},
+		Action:      grant.ActionDeviceAuthorize,
+	}
+	handlers := &Handlers{
+		GrantTypes: store,
+	}
+
+	body := map[string]string{
+		"grantTypeName": "contractor-device",
+		"duration":      "4h",
+		"reason":        "Contractor onboarding",
+	}
+	bodyBytes, _ := json.Marshal(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/grants", bytes.NewReader(bodyBytes))
+	req = withWhoIs(req, "user@example.com", "node-123")
+	w := httptest.NewRecorder()
+
+	handlers.HandleCreateGrant(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var resp map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if resp["error"] != "targetNodeID is required for device_authorize grants" {
+		t.Errorf("expected error about missing targetNodeID, got %q", resp["error"])
+	}
+}
+
+func TestHandleCreateGrant_GroupMembershipGrant_MissingTargetUserID(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["db-admin-for"] = &grant.GrantType{
+		Name:        "db-admin-for",
+		MaxDuration: grant.JSONDuration(2 * time.Hour),
+		RiskLevel:   grant.RiskHigh,
+		Approvers:   []string{"admin@example.com"},
+		Action:      grant.ActionGroupMembership,
+		GroupAction: &grant.GroupAction{Group: "group:db-admins", Member: grant.GroupMemberTarget},
+	}
+	handlers := &Handlers{
+		GrantTypes: store,
+	}
+
+	body := map[string]string{
+		"grantTypeName": "db-admin-for",
+		"duration":      "1h",
+		"reason":        "Schema migration",
+	}
+	bodyBytes, _ := json.Marshal(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/grants", bytes.NewReader(bodyBytes))
+	req = withWhoIs(req, "user@example.com", "node-123")
+	w := httptest.NewRecorder()
+
+	handlers.HandleCreateGrant(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var resp map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if resp["error"] != "targetUserID is required for user grants" {
+		t.Errorf("expected error about missing targetUserID, got %q", resp["error"])
+	}
+}
+
 func TestHandleListUsers_NilClient(t *testing.T) {
 	handlers := &Handlers{}
 
@@ -612,3 +712,1196 @@ func TestWriteError(t *testing.T) {
 		})
 	}
 }
+
+// fakeEncodedValue implements converter.EncodedValue for mocked queries.
+type fakeEncodedValue struct {
+	value any
+}
+
+func (f fakeEncodedValue) HasValue() bool { return f.value != nil }
+
+func (f fakeEncodedValue) Get(valuePtr any) error {
+	b, err := json.Marshal(f.value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, valuePtr)
+}
+
+func newGrantStateClient(state grant.GrantState) *mocks.Client {
+	tc := &mocks.Client{}
+	tc.On("QueryWorkflow", mock.Anything, "grant-g1", "", "status").Return(fakeEncodedValue{value: state}, nil)
+	return tc
+}
+
+func TestHandleAuthorization(t *testing.T) {
+	active := grant.GrantState{
+		Request: grant.GrantRequest{ID: "g1", Requester: "user@example.com", GrantTypeName: "ssh-access"},
+		Status:  grant.StatusActive,
+	}
+	pending := active
+	pending.Status = grant.StatusPendingApproval
+	scheduled := active
+	scheduled.Status = grant.StatusScheduled
+
+	tests := []struct {
+		name     string
+		state    grant.GrantState
+		handler  func(h *Handlers) http.HandlerFunc
+		path     string
+		body     string
+		login    string
+		workflow string
+		signal   string
+		wantCode int
+	}{
+		{"revoke by requester", active, func(h *Handlers) http.HandlerFunc { return h.HandleRevokeGrant }, "revoke", `{}`, "user@example.com", "grant-g1", "revoke", http.StatusOK},
+		{"revoke by approver", active, func(h *Handlers) http.HandlerFunc { return h.HandleRevokeGrant }, "revoke", `{}`, "admin@example.com", "grant-g1", "revoke", http.StatusOK},
+		{"revoke by stranger", active, func(h *Handlers) http.HandlerFunc { return h.HandleRevokeGrant }, "revoke", `{}`, "other@example.com", "", "", http.StatusForbidden},
+		{"revoke scheduled grant", scheduled, func(h *Handlers) http.HandlerFunc { return h.HandleRevokeGrant }, "revoke", `{}`, "user@example.com", "grant-g1", "revoke", http.StatusOK},
+		{"revoke pending grant", pending, func(h *Handlers) http.HandlerFunc { return h.HandleRevokeGrant }, "revoke", `{}`, "user@example.com", "", "", http.StatusConflict},
+		{"deny by approver", pending, func(h *Handlers) http.HandlerFunc { return h.HandleDenyGrant }, "deny", `{}`, "admin@example.com", "approval-g1", "deny", http.StatusOK},
+		{"deny by requester", pending, func(h *Handlers) http.HandlerFunc { return h.HandleDenyGrant }, "deny", `{}`, "user@example.com", "", "", http.StatusForbidden},
+		{"approve by non-approver", pending, func(h *Handlers) http.HandlerFunc { return h.HandleApproveGrant }, "approve", "", "other@example.com", "", "", http.StatusForbidden},
+		{"extend by requester", active, func(h *Handlers) http.HandlerFunc { return h.HandleExtendGrant }, "extend", `{"duration":"30m"}`, "user@example.com", "grant-g1", "extend", http.StatusOK},
+		{"extend by stranger", active, func(h *Handlers) http.HandlerFunc { return h.HandleExtendGrant }, "extend", `{"duration":"30m"}`, "other@example.com", "", "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newGrantStateClient(tt.state)
+			if tt.signal != "" {
+				tc.On("SignalWorkflow", mock.Anything, tt.workflow, "", tt.signal, mock.Anything).Return(nil)
+			}
+			h := &Handlers{TemporalClient: tc, GrantTypes: newMockGrantTypeStore()}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/grants/g1/"+tt.path, bytes.NewReader([]byte(tt.body)))
+			req.SetPathValue("id", "g1")
+			req = withWhoIs(req, tt.login, "node-123")
+			w := httptest.NewRecorder()
+
+			tt.handler(h)(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			tc.AssertExpectations(t)
+			if tt.signal == "" {
+				tc.AssertNotCalled(t, "SignalWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+type fakeDirectory map[string][]string
+
+func (d fakeDirectory) IsMember(_ context.Context, login string, principals []string) (bool, error) {
+	for _, p := range principals {
+		if p == login || slices.Contains(d[p], login) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestHandleApproveGrant_GroupApprover(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["secops-access"] = &grant.GrantType{
+		Name:        "secops-access",
+		Tags:        []string{"tag:secops"},
+		MaxDuration: grant.JSONDuration(time.Hour),
+		RiskLevel:   grant.RiskHigh,
+		Approvers:   []string{"group:secops"},
+		Action:      grant.ActionTag,
+	}
+	state := grant.GrantState{
+		Request: grant.GrantRequest{ID: "g1", Requester: "user@example.com", GrantTypeName: "secops-access"},
+		Status:  grant.StatusPendingApproval,
+	}
+	dir := fakeDirectory{"group:secops": {"alice@example.com"}}
+
+	tests := []struct {
+		name     string
+		dir      grant.Directory
+		login    string
+		wantCode int
+	}{
+		{"group member", dir, "alice@example.com", http.StatusOK},
+		{"not a member", dir, "bob@example.com", http.StatusForbidden},
+		{"no directory", nil, "alice@example.com", http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newGrantStateClient(state)
+			if tt.wantCode == http.StatusOK {
+				tc.On("SignalWorkflow", mock.Anything, "approval-g1", "", "approve", mock.Anything).Return(nil)
+			}
+			h := &Handlers{TemporalClient: tc, GrantTypes: store, Directory: tt.dir}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/grants/g1/approve", nil)
+			req.SetPathValue("id", "g1")
+			req = withWhoIs(req, tt.login, "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleApproveGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			tc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleApproveGrant_EscalationStage(t *testing.T) {
+	store := newMockGrantTypeStore()
+	gt := &grant.GrantType{
+		Name:        "escalating",
+		Tags:        []string{"tag:esc"},
+		MaxDuration: grant.JSONDuration(time.Hour),
+		RiskLevel:   grant.RiskHigh,
+		Approvers:   []string{"oncall@example.com", "lead@example.com"},
+		Action:      grant.ActionTag,
+		ApprovalStages: []grant.ApprovalStage{
+			{Name: "on-call", Approvers: []string{"oncall@example.com"}, Timeout: grant.JSONDuration(15 * time.Minute)},
+			{Name: "leads", Approvers: []string{"lead@example.com"}, Timeout: grant.JSONDuration(time.Hour)},
+		},
+	}
+	store.types[gt.Name] = gt
+
+	tests := []struct {
+		name     string
+		stage    int
+		wantCode int
+	}{
+		{"lead during on-call stage", 0, http.StatusForbidden},
+		{"lead after escalation", 1, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stage := gt.StageStatus(tt.stage, time.Now().Add(time.Hour))
+			tc := newGrantStateClient(grant.GrantState{
+				Request:       grant.GrantRequest{ID: "g1", Requester: "user@example.com", GrantTypeName: gt.Name},
+				Status:        grant.StatusPendingApproval,
+				ApprovalStage: &stage,
+			})
+			if tt.wantCode == http.StatusOK {
+				tc.On("SignalWorkflow", mock.Anything, "approval-g1", "", "approve", mock.Anything).Return(nil)
+			}
+			h := &Handlers{TemporalClient: tc, GrantTypes: store}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/grants/g1/approve", nil)
+			req.SetPathValue("id", "g1")
+			req = withWhoIs(req, "lead@example.com", "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleApproveGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			tc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleCreateGrant_StartAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		startAt  time.Time
+		wantCode int
+	}{
+		{"future", time.Now().Add(24 * time.Hour), http.StatusCreated},
+		{"past", time.Now().Add(-time.Minute), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := &mocks.Client{}
+			if tt.wantCode == http.StatusCreated {
+				tc.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.MatchedBy(func(r grant.GrantRequest) bool {
+					return r.StartAt.Equal(tt.startAt.Truncate(time.Second))
+				}), mock.Anything).Return(nil, nil)
+			}
+			h := &Handlers{TemporalClient: tc, GrantTypes: newMockGrantTypeStore()}
+
+			body, _ := json.Marshal(map[string]string{
+				"grantTypeName": "ssh-access",
+				"targetNodeID":  "node-456",
+				"duration":      "1h",
+				"reason":        "change window",
+				"startAt":       tt.startAt.Format(time.RFC3339),
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/grants", bytes.NewReader(body))
+			req = withWhoIs(req, "user@example.com", "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleCreateGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			tc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleCreateGrant_BreakGlass(t *testing.T) {
+	tests := []struct {
+		name      string
+		grantType string
+		reason    string
+		startAt   string
+		wantCode  int
+		wantErr   string
+	}{
+		{"allowed", "db-access", "INC-42", "", http.StatusCreated, ""},
+		{"not allowed", "ssh-access", "INC-42", "", http.StatusBadRequest, "does not allow break-glass"},
+		{"no reason", "db-access", "", "", http.StatusBadRequest, "need a reason"},
+		{"scheduled", "db-access", "INC-42", time.Now().Add(time.Hour).Format(time.RFC3339), http.StatusBadRequest, "cannot be scheduled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMockGrantTypeStore()
+			store.types["db-access"].BreakGlass = true
+			tc := &mocks.Client{}
+			if tt.wantCode == http.StatusCreated {
+				tc.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.MatchedBy(func(r grant.GrantRequest) bool {
+					return r.BreakGlass
+				}), mock.Anything).Return(nil, nil)
+			}
+			h := &Handlers{TemporalClient: tc, GrantTypes: store}
+
+			payload := map[string]any{
+				"grantTypeName": tt.grantType,
+				"targetNodeID":  "node-456",
+				"duration":      "1h",
+				"reason":        tt.reason,
+				"breakGlass":    true,
+			}
+			if tt.startAt != "" {
+				payload["startAt"] = tt.startAt
+			}
+			body, _ := json.Marshal(payload)
+			req := httptest.NewRequest(http.MethodPost, "/api/grants", bytes.NewReader(body))
+			req = withWhoIs(req, "user@example.com", "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleCreateGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantErr) {
+				t.Errorf("body = %s, want containing %q", w.Body.String(), tt.wantErr)
+			}
+			tc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleCreateGrant_PolicyDenied(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["night-access"] = &grant.GrantType{
+		Name:        "night-access",
+		Tags:        []string{"tag:night"},
+		MaxDuration: grant.JSONDuration(8 * time.Hour),
+		RiskLevel:   grant.RiskLow,
+		Action:      grant.ActionTag,
+		Policy: []grant.PolicyRule{
+			{When: `request.duration > 2h`, Decision: grant.DecisionDeny, Message: "grants over 2h are not allowed"},
+		},
+	}
+	tc := &mocks.Client{}
+	h := &Handlers{TemporalClient: tc, GrantTypes: store}
+
+	body, _ := json.Marshal(map[string]string{
+		"grantTypeName": "night-access",
+		"targetNodeID":  "node-456",
+		"duration":      "4h",
+		"reason":        "batch job",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/grants", bytes.NewReader(body))
+	req = withWhoIs(req, "user@example.com", "node-123")
+	w := httptest.NewRecorder()
+
+	h.HandleCreateGrant(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+	var resp map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp["error"] != "grants over 2h are not allowed" {
+		t.Errorf("unexpected error %q", resp["error"])
+	}
+	tc.AssertNotCalled(t, "ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleListGrantTypes_EligibleRequesters(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["ssh-access"].EligibleRequesters = []string{"group:sre"}
+	store.types["db-access"].EligibleRequesters = []string{"dba@example.com"}
+	h := &Handlers{
+		GrantTypes: store,
+		Directory:  fakeDirectory{"group:sre": {"sre@example.com"}},
+	}
+
+	tests := []struct {
+		login string
+		want  []string
+	}{
+		{"sre@example.com", []string{"ssh-access", "temp-admin", "temp-restore"}},
+		{"dba@example.com", []string{"db-access", "temp-admin", "temp-restore"}},
+		{"other@example.com", []string{"temp-admin", "temp-restore"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.login, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/grant-types", nil)
+			req = withWhoIs(req, tt.login, "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleListGrantTypes(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			var types []*grant.GrantType
+			if err := json.NewDecoder(w.Body).Decode(&types); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			var names []string
+			for _, gt := range types {
+				names = append(names, gt.Name)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("grant types = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleCreateGrant_NotEligible(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["ssh-access"].EligibleRequesters = []string{"sre@example.com"}
+	tc := &mocks.Client{}
+	h := &Handlers{TemporalClient: tc, GrantTypes: store}
+
+	body, _ := json.Marshal(map[string]string{
+		"grantTypeName": "ssh-access",
+		"targetNodeID":  "node-456",
+		"duration":      "1h",
+		"reason":        "debugging",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/grants", bytes.NewReader(body))
+	req = withWhoIs(req, "user@example.com", "node-123")
+	w := httptest.NewRecorder()
+
+	h.HandleCreateGrant(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+	tc.AssertNotCalled(t, "ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// newTestTSClient returns a Tailscale API client backed by handler.
+func newTestTSClient(t *testing.T, handler http.HandlerFunc) *tailscale.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	baseURL, _ := url.Parse(server.URL)
+	return &tailscale.Client{
+		BaseURL:   baseURL,
+		HTTP:      server.Client(),
+		Tailnet:   "test-tailnet",
+		UserAgent: "tailgrant-test",
+	}
+}
+
+// testDevicesAPI serves a small device inventory: a tagged database
+// server, a web server, and a laptop owned by user@example.com.
+func testDevicesAPI(w http.ResponseWriter, r *http.Request) {
+	devices := []map[string]any{
+		{"nodeId": "node-db", "hostname": "db-1", "os": "linux", "tags": []string{"tag:db"}},
+		{"nodeId": "node-web", "hostname": "web-1", "os": "linux", "tags": []string{"tag:web"}},
+		{"nodeId": "node-laptop", "hostname": "laptop", "os": "macOS", "user": "user@example.com"},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/api/v2/tailnet/test-tailnet/devices" {
+		json.NewEncoder(w).Encode(map[string]any{"devices": devices})
+		return
+	}
+	for _, d := range devices {
+		if r.URL.Path == "/api/v2/device/"+d["nodeId"].(string) {
+			json.NewEncoder(w).Encode(d)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func TestHandleCreateGrant_TargetNotAllowed(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["ssh-access"].Targets = &grant.TargetSelector{Tags: []string{"tag:db"}}
+	tc := &mocks.Client{}
+	h := &Handlers{
+		TemporalClient: tc,
+		TSClient:       newTestTSClient(t, testDevicesAPI),
+		GrantTypes:     store,
+	}
+
+	tests := []struct {
+		target   string
+		wantCode int
+	}{
+		{"node-web", http.StatusForbidden},
+		{"node-db", http.StatusCreated},
+	}
+	tc.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(&mocks.WorkflowRun{}, nil)
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{
+				"grantTypeName": "ssh-access",
+				"targetNodeID":  tt.target,
+				"duration":      "1h",
+				"reason":        "debugging",
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/grants", bytes.NewReader(body))
+			req = withWhoIs(req, "user@example.com", "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleCreateGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+	tc.AssertNumberOfCalls(t, "ExecuteWorkflow", 1)
+}
+
+func TestHandleCreateGrant_PolicyDeniesTagSelectedTarget(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["ssh-access"].Policy = []grant.PolicyRule{
+		{When: `"tag:web" in target.tags`, Decision: grant.DecisionDeny, Message: "no web servers"},
+	}
+	tc := &mocks.Client{}
+	h := &Handlers{
+		TemporalClient: tc,
+		TSClient:       newTestTSClient(t, testDevicesAPI),
+		GrantTypes:     store,
+	}
+	tc.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(&mocks.WorkflowRun{}, nil)
+
+	tests := []struct {
+		name     string
+		body     map[string]any
+		wantCode int
+	}{
+		{"tag selector", map[string]any{"targetTag": "tag:web"}, http.StatusForbidden},
+		{"node list", map[string]any{"targetNodeIDs": []string{"node-db", "node-web"}}, http.StatusForbidden},
+		{"allowed tag", map[string]any{"targetTag": "tag:db"}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.body["grantTypeName"] = "ssh-access"
+			tt.body["duration"] = "1h"
+			body, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest(http.MethodPost, "/api/grants", bytes.NewReader(body))
+			req = withWhoIs(req, "user@example.com", "node-laptop")
+			w := httptest.NewRecorder()
+
+			h.HandleCreateGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+	tc.AssertNumberOfCalls(t, "ExecuteWorkflow", 1)
+}
+
+func TestHandleListDevices_GrantTypeFilter(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["ssh-access"].Targets = &grant.TargetSelector{OS: []string{"linux"}, Hostnames: []string{"db-*"}}
+	store.types["db-access"].Targets = &grant.TargetSelector{RequesterOwned: true}
+	h := &Handlers{
+		TSClient:   newTestTSClient(t, testDevicesAPI),
+		GrantTypes: store,
+	}
+
+	tests := []struct {
+		query    string
+		wantCode int
+		want     []string
+	}{
+		{"", http.StatusOK, []string{"db-1", "laptop", "web-1"}},
+		{"?grantType=ssh-access", http.StatusOK, []string{"db-1"}},
+		{"?grantType=db-access", http.StatusOK, []string{"laptop"}},
+		{"?grantType=temp-admin", http.StatusBadRequest, nil},
+		{"?grantType=nope", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/devices"+tt.query, nil)
+			req = withWhoIs(req, "user@example.com", "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleListDevices(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var devices []tailscale.Device
+			if err := json.NewDecoder(w.Body).Decode(&devices); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			var names []string
+			for _, d := range devices {
+				names = append(names, d.Hostname)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("devices = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleCreateGrant_MultipleTargets(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["ssh-access"].Targets = &grant.TargetSelector{OS: []string{"linux"}}
+	tc := &mocks.Client{}
+	h := &Handlers{
+		TemporalClient: tc,
+		TSClient:       newTestTSClient(t, testDevicesAPI),
+		GrantTypes:     store,
+	}
+
+	var started []grant.GrantRequest
+	tc.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { started = append(started, args.Get(3).(grant.GrantRequest)) }).
+		Return(&mocks.WorkflowRun{}, nil)
+
+	tests := []struct {
+		name     string
+		body     map[string]any
+		wantCode int
+	}{
+		{"node list", map[string]any{"targetNodeIDs": []string{"node-db", "node-web"}}, http.StatusCreated},
+		{"tag selector", map[string]any{"targetTag": "tag:web"}, http.StatusCreated},
+		{"node and tag", map[string]any{"targetNodeID": "node-db", "targetTag": "tag:web"}, http.StatusBadRequest},
+		{"duplicate node", map[string]any{"targetNodeIDs": []string{"node-db", "node-db"}}, http.StatusBadRequest},
+		{"invalid tag", map[string]any{"targetTag": "web"}, http.StatusBadRequest},
+		{"unknown node", map[string]any{"targetNodeIDs": []string{"node-db", "node-gone"}}, http.StatusBadRequest},
+		{"node not allowed", map[string]any{"targetNodeIDs": []string{"node-db", "node-laptop"}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.body["grantTypeName"] = "ssh-access"
+			tt.body["duration"] = "1h"
+			body, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest(http.MethodPost, "/api/grants", bytes.NewReader(body))
+			req = withWhoIs(req, "user@example.com", "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleCreateGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if len(started) != 2 {
+		t.Fatalf("started %d workflows, want 2", len(started))
+	}
+	if !slices.Equal(started[0].NodeIDs(), []string{"node-db", "node-web"}) {
+		t.Errorf("NodeIDs() = %v, want [node-db node-web]", started[0].NodeIDs())
+	}
+	if started[1].TargetTag != "tag:web" {
+		t.Errorf("TargetTag = %q, want tag:web", started[1].TargetTag)
+	}
+}
+
+func TestHandleCreateGrant_Quota(t *testing.T) {
+	tests := []struct {
+		name       string
+		updateErr  error
+		wantCode   int
+		wantStarts int
+	}{
+		{"within quota", nil, http.StatusCreated, 1},
+		{"concurrency limit", temporal.NewApplicationError("quota exceeded: maxConcurrentPerUser", grant.ErrTypeConcurrencyLimit), http.StatusConflict, 0},
+		{"rate limit", temporal.NewApplicationError("quota exceeded: maxGrantsPerUserPerDay", grant.ErrTypeRateLimit), http.StatusTooManyRequests, 0},
+		{"quota workflow unavailable", errors.New("unavailable"), http.StatusBadGateway, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMockGrantTypeStore()
+			store.types["temp-admin"].Quota = &grant.Quota{MaxConcurrentPerUser: 1, MaxGrantsPerUserPerDay: 3}
+			tc := &mocks.Client{}
+			h := &Handlers{TemporalClient: tc, GrantTypes: store}
+
+			handle := &mocks.WorkflowUpdateHandle{}
+			handle.On("Get", mock.Anything, mock.Anything).Return(tt.updateErr)
+			tc.On("NewWithStartWorkflowOperation", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			tc.On("UpdateWithStartWorkflow", mock.Anything, mock.MatchedBy(func(o client.UpdateWithStartWorkflowOptions) bool {
+				r, ok := o.UpdateOptions.Args[0].(grant.QuotaReservation)
+				return o.UpdateOptions.UpdateName == "reserve" && ok && r.GrantType == "temp-admin" && r.Duration == time.Hour
+			})).Return(handle, nil)
+			tc.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+				Return(&mocks.WorkflowRun{}, nil)
+
+			body, _ := json.Marshal(map[string]string{
+				"grantTypeName": "temp-admin",
+				"targetUserID":  "user-789",
+				"duration":      "1h",
+				"reason":        "incident",
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/grants", bytes.NewReader(body))
+			req = withWhoIs(req, "user@example.com", "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleCreateGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			tc.AssertNumberOfCalls(t, "ExecuteWorkflow", tt.wantStarts)
+		})
+	}
+}
+
+func TestHandleListGrants(t *testing.T) {
+	memo := func(state grant.GrantState) *commonpb.Memo {
+		payload, err := converter.GetDefaultDataConverter().ToPayload(state)
+		if err != nil {
+			t.Fatalf("ToPayload: %v", err)
+		}
+		return &commonpb.Memo{Fields: map[string]*commonpb.Payload{grant.GrantMemoKey: payload}}
+	}
+	active := grant.GrantState{Request: grant.GrantRequest{ID: "a"}, Status: grant.StatusActive}
+	expired := grant.GrantState{Request: grant.GrantRequest{ID: "b"}, Status: grant.StatusExpired}
+	legacy := grant.GrantState{Request: grant.GrantRequest{ID: "c"}, Status: grant.StatusPendingApproval}
+
+	tc := &mocks.Client{}
+	h := &Handlers{TemporalClient: tc, GrantTypes: newMockGrantTypeStore(), Namespace: "tailgrant-prod"}
+
+	var got *workflowservice.ListWorkflowExecutionsRequest
+	tc.On("ListWorkflow", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		got = args.Get(1).(*workflowservice.ListWorkflowExecutionsRequest)
+	}).Return(&workflowservice.ListWorkflowExecutionsResponse{
+		Executions: []*workflowpb.WorkflowExecutionInfo{
+			{Execution: &commonpb.WorkflowExecution{WorkflowId: "grant-a"}, Status: enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING, Memo: memo(active)},
+			{Execution: &commonpb.WorkflowExecution{WorkflowId: "grant-b"}, Status: enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED, Memo: memo(expired)},
+			{Execution: &commonpb.WorkflowExecution{WorkflowId: "grant-c"}, Status: enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING},
+			{Execution: &commonpb.WorkflowExecution{WorkflowId: "grant-d"}, Status: enumspb.WORKFLOW_EXECUTION_STATUS_TERMINATED, Memo: memo(active)},
+		},
+		NextPageToken: []byte("page-2"),
+	}, nil)
+	legacyValue := &mocks.Value{}
+	legacyValue.On("Get", mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*grant.GrantState) = legacy
+	}).Return(nil)
+	tc.On("QueryWorkflow", mock.Anything, "grant-c", "", "status").Return(legacyValue, nil)
+
+	token := base64.RawURLEncoding.EncodeToString([]byte("page-1"))
+	req := httptest.NewRequest(http.MethodGet, "/api/grants?status=active&requester=user@example.com&target=node-1&pageToken="+token, nil)
+	req = withWhoIs(req, "user@example.com", "node-123")
+	w := httptest.NewRecorder()
+
+	h.HandleListGrants(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	wantQuery := "WorkflowType = 'GrantWorkflow' AND TailgrantStatus = 'active' AND TailgrantRequester = 'user@example.com' AND TailgrantTarget = 'node-1'"
+	if got.Query != wantQuery {
+		t.Errorf("query = %q, want %q", got.Query, wantQuery)
+	}
+	if got.Namespace != "tailgrant-prod" {
+		t.Errorf("namespace = %q, want tailgrant-prod", got.Namespace)
+	}
+	if string(got.NextPageToken) != "page-1" {
+		t.Errorf("page token = %q, want page-1", got.NextPageToken)
+	}
+
+	var resp listGrantsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	var ids []string
+	for _, g := range resp.Grants {
+		ids = append(ids, g.Request.ID)
+	}
+	if !slices.Equal(ids, []string{"a", "b", "c"}) {
+		t.Errorf("grant IDs = %v, want [a b c]", ids)
+	}
+	if next, _ := base64.RawURLEncoding.DecodeString(resp.NextPageToken); string(next) != "page-2" {
+		t.Errorf("nextPageToken = %q, want page-2 encoded", resp.NextPageToken)
+	}
+	tc.AssertNumberOfCalls(t, "QueryWorkflow", 1)
+}
+
+func TestHandleListGrants_InvalidParams(t *testing.T) {
+	tc := &mocks.Client{}
+	h := &Handlers{TemporalClient: tc, GrantTypes: newMockGrantTypeStore()}
+
+	for _, query := range []string{
+		"?status=bogus",
+		"?requester=x'%20OR%20'1'='1",
+		"?pageSize=0",
+		"?pageToken=not*base64",
+	} {
+		t.Run(query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/grants"+query, nil)
+			req = withWhoIs(req, "user@example.com", "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleListGrants(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+	tc.AssertNotCalled(t, "ListWorkflow", mock.Anything, mock.Anything)
+}
+
+func TestHandleListAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := audit.OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	base := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, typ := range []audit.EventType{audit.EventRequested, audit.EventActivated, audit.EventExpired} {
+		ev := audit.Event{ID: strconv.Itoa(i), Time: base.Add(time.Duration(i) * time.Hour), Type: typ, GrantID: "g1"}
+		if err := sink.Write(context.Background(), ev); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	sink.Close()
+
+	h := &Handlers{GrantTypes: newMockGrantTypeStore(), Admins: []string{"secops@example.com"}, AuditFile: path}
+
+	tests := []struct {
+		name     string
+		login    string
+		query    string
+		wantCode int
+		wantIDs  []string
+	}{
+		{"admin reads all", "secops@example.com", "", http.StatusOK, []string{"0", "1", "2"}},
+		{"time range", "secops@example.com", "?from=2025-06-01T13:00:00Z&to=2025-06-01T14:00:00Z", http.StatusOK, []string{"1"}},
+		{"limit", "secops@example.com", "?limit=2", http.StatusOK, []string{"0", "1"}},
+		{"non-admin", "user@example.com", "", http.StatusForbidden, nil},
+		{"bad time", "secops@example.com", "?from=yesterday", http.StatusBadRequest, nil},
+		{"bad limit", "secops@example.com", "?limit=0", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/audit"+tt.query, nil)
+			req = withWhoIs(req, tt.login, "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleListAudit(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp audit.Log
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if !resp.Verified {
+				t.Errorf("expected verified chain, got %q", resp.ChainError)
+			}
+			var ids []string
+			for _, ev := range resp.Events {
+				ids = append(ids, ev.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("event IDs = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestHandleCancelGrant(t *testing.T) {
+	withStatus := func(status grant.GrantStatus) grant.GrantState {
+		return grant.GrantState{
+			Request: grant.GrantRequest{ID: "g1", Requester: "user@example.com", GrantTypeName: "ssh-access"},
+			Status:  status,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		state       grant.GrantState
+		login       string
+		wantCode    int
+		wantSignals []string // workflows signaled, in order
+	}{
+		{"pending", withStatus(grant.StatusPendingApproval), "user@example.com", http.StatusOK, []string{"approval-g1", "grant-g1"}},
+		{"partially approved", withStatus(grant.StatusPartiallyApproved), "user@example.com", http.StatusOK, []string{"approval-g1", "grant-g1"}},
+		{"scheduled", withStatus(grant.StatusScheduled), "user@example.com", http.StatusOK, []string{"grant-g1"}},
+		{"active", withStatus(grant.StatusActive), "user@example.com", http.StatusConflict, nil},
+		{"approver", withStatus(grant.StatusPendingApproval), "admin@example.com", http.StatusForbidden, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newGrantStateClient(tt.state)
+			var signaled []string
+			for _, wf := range tt.wantSignals {
+				tc.On("SignalWorkflow", mock.Anything, wf, "", "cancel", grant.CancelSignal{CancelledBy: tt.login}).
+					Run(func(args mock.Arguments) { signaled = append(signaled, args.String(1)) }).Return(nil)
+			}
+			h := &Handlers{TemporalClient: tc, GrantTypes: newMockGrantTypeStore()}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/grants/g1/cancel", nil)
+			req.SetPathValue("id", "g1")
+			req = withWhoIs(req, tt.login, "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleCancelGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if !slices.Equal(signaled, tt.wantSignals) {
+				t.Errorf("signaled %v, want %v", signaled, tt.wantSignals)
+			}
+			if tt.wantSignals == nil {
+				tc.AssertNotCalled(t, "SignalWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestHandleReviewBreakGlass(t *testing.T) {
+	withReview := func(review *grant.BreakGlassReview) grant.GrantState {
+		return grant.GrantState{
+			Request:    grant.GrantRequest{ID: "g1", Requester: "user@example.com", GrantTypeName: "ssh-access", BreakGlass: review != nil},
+			Status:     grant.StatusActive,
+			BreakGlass: review,
+		}
+	}
+	pending := withReview(&grant.BreakGlassReview{Status: grant.ReviewPending, Approvers: []string{"admin@example.com"}})
+
+	tests := []struct {
+		name       string
+		state      grant.GrantState
+		login      string
+		action     string
+		wantCode   int
+		wantSignal string
+	}{
+		{"acknowledge", pending, "admin@example.com", "acknowledge", http.StatusOK, "acknowledge"},
+		{"reject", pending, "admin@example.com", "reject", http.StatusOK, "reject"},
+		{"requester", pending, "user@example.com", "acknowledge", http.StatusForbidden, ""},
+		{"not break-glass", withReview(nil), "admin@example.com", "acknowledge", http.StatusConflict, ""},
+		{"already reviewed", withReview(&grant.BreakGlassReview{Status: grant.ReviewAcknowledged}), "admin@example.com", "reject", http.StatusConflict, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newGrantStateClient(tt.state)
+			if tt.wantSignal != "" {
+				tc.On("SignalWorkflow", mock.Anything, "grant-g1", "", tt.wantSignal, grant.ReviewSignal{ReviewedBy: tt.login, Note: "checked"}).Return(nil)
+			}
+			h := &Handlers{TemporalClient: tc, GrantTypes: newMockGrantTypeStore()}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/grants/g1/"+tt.action, strings.NewReader(`{"note":"checked"}`))
+			req.SetPathValue("id", "g1")
+			req = withWhoIs(req, tt.login, "node-123")
+			w := httptest.NewRecorder()
+
+			if tt.action == "reject" {
+				h.HandleRejectGrant(w, req)
+			} else {
+				h.HandleAcknowledgeGrant(w, req)
+			}
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantSignal == "" {
+				tc.AssertNotCalled(t, "SignalWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				tc.AssertExpectations(t)
+			}
+		})
+	}
+}
+
+func TestHandleRenewGrant(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["read-only"] = &grant.GrantType{
+		Name:        "read-only",
+		Tags:        []string{"tag:read"},
+		MaxDuration: grant.JSONDuration(time.Hour),
+		RiskLevel:   grant.RiskLow,
+		Action:      grant.ActionTag,
+	}
+	active := func(grantType string) grant.GrantState {
+		return grant.GrantState{
+			Request: grant.GrantRequest{ID: "g1", Requester: "user@example.com", GrantTypeName: grantType},
+			Status:  grant.StatusActive,
+		}
+	}
+	renewing := active("ssh-access")
+	renewing.Renewal = &grant.RenewalStatus{RequestedBy: "user@example.com", Duration: time.Hour}
+	expired := active("ssh-access")
+	expired.Status = grant.StatusExpired
+
+	tests := []struct {
+		name       string
+		state      grant.GrantState
+		login      string
+		body       string
+		wantCode   int
+		wantStatus string
+	}{
+		{"medium risk needs approval", active("ssh-access"), "user@example.com", `{"duration":"1h","reason":"still debugging"}`, http.StatusOK, "renewal_pending"},
+		{"low risk extends", active("read-only"), "user@example.com", `{"duration":"30m"}`, http.StatusOK, "extended"},
+		{"already pending", renewing, "user@example.com", `{"duration":"1h"}`, http.StatusConflict, ""},
+		{"not active", expired, "user@example.com", `{"duration":"1h"}`, http.StatusConflict, ""},
+		{"stranger", active("ssh-access"), "other@example.com", `{"duration":"1h"}`, http.StatusForbidden, ""},
+		{"bad duration", active("ssh-access"), "user@example.com", `{"duration":"soon"}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := &mocks.Client{}
+			tc.On("QueryWorkflow", mock.Anything, "grant-g1", "", "status").Return(fakeEncodedValue{value: tt.state}, nil).Maybe()
+			if tt.wantStatus != "" {
+				tc.On("SignalWorkflow", mock.Anything, "grant-g1", "", "renew", mock.MatchedBy(func(sig grant.RenewSignal) bool {
+					return sig.RequestedBy == tt.login && sig.Duration > 0
+				})).Return(nil)
+			}
+			h := &Handlers{TemporalClient: tc, GrantTypes: store}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/grants/g1/renew", bytes.NewReader([]byte(tt.body)))
+			req.SetPathValue("id", "g1")
+			req = withWhoIs(req, tt.login, "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleRenewGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != "" {
+				var resp map[string]string
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if resp["status"] != tt.wantStatus {
+					t.Errorf("status = %q, want %q", resp["status"], tt.wantStatus)
+				}
+			} else {
+				tc.AssertNotCalled(t, "SignalWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+			tc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleExtendGrant_Limits(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["limited"] = &grant.GrantType{
+		Name:             "limited",
+		Tags:             []string{"tag:read"},
+		MaxDuration:      grant.JSONDuration(time.Hour),
+		MaxTotalDuration: grant.JSONDuration(4 * time.Hour),
+		MaxExtensions:    2,
+		RiskLevel:        grant.RiskLow,
+		Action:           grant.ActionTag,
+	}
+	store.types["reviewed"] = &grant.GrantType{
+		Name:                      "reviewed",
+		Tags:                      []string{"tag:read"},
+		MaxDuration:               grant.JSONDuration(time.Hour),
+		RiskLevel:                 grant.RiskLow,
+		Approvers:                 []string{"admin@example.com"},
+		Action:                    grant.ActionTag,
+		ExtensionRequiresApproval: true,
+	}
+	store.types["sensitive"] = &grant.GrantType{
+		Name:        "sensitive",
+		Tags:        []string{"tag:admin"},
+		MaxDuration: grant.JSONDuration(time.Hour),
+		RiskLevel:   grant.RiskMedium,
+		Approvers:   []string{"admin@example.com"},
+		Action:      grant.ActionTag,
+	}
+	active := func(grantType string, activated time.Duration) grant.GrantState {
+		return grant.GrantState{
+			Request:     grant.GrantRequest{ID: "g1", Requester: "user@example.com", GrantTypeName: grantType},
+			Status:      grant.StatusActive,
+			ActivatedAt: time.Now().Add(-activated),
+		}
+	}
+	extended := active("limited", time.Hour)
+	extended.Extensions = []grant.Extension{{By: "user@example.com", Duration: time.Hour}, {By: "user@example.com", Duration: time.Hour}}
+	pending := active("reviewed", time.Hour)
+	pending.Renewal = &grant.RenewalStatus{RequestedBy: "user@example.com", Duration: time.Hour}
+	sensitivePending := active("sensitive", time.Hour)
+	sensitivePending.Renewal = &grant.RenewalStatus{RequestedBy: "user@example.com", Duration: time.Hour}
+
+	tests := []struct {
+		name       string
+		state      grant.GrantState
+		duration   string
+		wantCode   int
+		wantStatus string
+		wantError  string
+	}{
+		{"within limits", active("limited", time.Hour), "1h", http.StatusOK, "extended", ""},
+		{"over maxDuration", active("limited", time.Hour), "2h", http.StatusBadRequest, "", "exceeds max 1h0m0s"},
+		{"extensions used up", extended, "30m", http.StatusBadRequest, "", "allows at most 2 extensions"},
+		{"over lifetime", active("limited", 3*time.Hour+30*time.Minute), "1h", http.StatusBadRequest, "", "would exceed the max lifetime of 4h0m0s"},
+		{"needs approval", active("reviewed", time.Hour), "1h", http.StatusOK, "renewal_pending", ""},
+		{"approval already pending", pending, "1h", http.StatusConflict, "", "already pending approval"},
+		{"medium risk needs approval", active("sensitive", time.Hour), "1h", http.StatusOK, "renewal_pending", ""},
+		{"medium risk approval pending", sensitivePending, "1h", http.StatusConflict, "", "already pending approval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := &mocks.Client{}
+			tc.On("QueryWorkflow", mock.Anything, "grant-g1", "", "status").Return(fakeEncodedValue{value: tt.state}, nil)
+			if tt.wantStatus != "" {
+				tc.On("SignalWorkflow", mock.Anything, "grant-g1", "", "extend", mock.Anything).Return(nil)
+			}
+			h := &Handlers{TemporalClient: tc, GrantTypes: store}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/grants/g1/extend", bytes.NewReader([]byte(`{"duration":"`+tt.duration+`"}`)))
+			req.SetPathValue("id", "g1")
+			req = withWhoIs(req, "user@example.com", "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleExtendGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			var resp map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if tt.wantStatus != "" && resp["status"] != tt.wantStatus {
+				t.Errorf("status = %q, want %q", resp["status"], tt.wantStatus)
+			}
+			if tt.wantError != "" {
+				if !strings.Contains(resp["error"], tt.wantError) {
+					t.Errorf("error = %q, want containing %q", resp["error"], tt.wantError)
+				}
+				tc.AssertNotCalled(t, "SignalWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+			tc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleApproveGrant_Renewal(t *testing.T) {
+	// The grant is active; its renewal, requested by the original
+	// requester, is what awaits approval.
+	state := grant.GrantState{
+		Request: grant.GrantRequest{ID: "g1", Requester: "user@example.com", GrantTypeName: "ssh-access"},
+		Status:  grant.StatusActive,
+		Renewal: &grant.RenewalStatus{RequestedBy: "user@example.com", Duration: time.Hour},
+	}
+
+	tests := []struct {
+		name     string
+		login    string
+		wantCode int
+	}{
+		{"approver", "admin@example.com", http.StatusOK},
+		{"renewal requester", "user@example.com", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newGrantStateClient(state)
+			if tt.wantCode == http.StatusOK {
+				tc.On("SignalWorkflow", mock.Anything, "approval-g1", "", "approve", mock.Anything).Return(nil)
+			}
+			h := &Handlers{TemporalClient: tc, GrantTypes: newMockGrantTypeStore()}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/grants/g1/approve", nil)
+			req.SetPathValue("id", "g1")
+			req = withWhoIs(req, tt.login, "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleApproveGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			tc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleApproveGrant_RenewalByAnotherUser(t *testing.T) {
+	store := newMockGrantTypeStore()
+	store.types["shared"] = &grant.GrantType{
+		Name:      "shared",
+		Tags:      []string{"tag:admin"},
+		RiskLevel: grant.RiskHigh,
+		Approvers: []string{"user@example.com", "admin@example.com", "dba@example.com"},
+		Action:    grant.ActionTag,
+	}
+	// An approver renewed the requester's grant.
+	state := grant.GrantState{
+		Request: grant.GrantRequest{ID: "g1", Requester: "user@example.com", GrantTypeName: "shared"},
+		Status:  grant.StatusActive,
+		Renewal: &grant.RenewalStatus{RequestedBy: "admin@example.com", Duration: time.Hour},
+	}
+
+	tests := []struct {
+		name     string
+		login    string
+		wantCode int
+	}{
+		{"other approver", "dba@example.com", http.StatusOK},
+		{"renewal requester", "admin@example.com", http.StatusForbidden},
+		{"grant requester", "user@example.com", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newGrantStateClient(state)
+			if tt.wantCode == http.StatusOK {
+				tc.On("SignalWorkflow", mock.Anything, "approval-g1", "", "approve", mock.Anything).Return(nil)
+			}
+			h := &Handlers{TemporalClient: tc, GrantTypes: store}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/grants/g1/approve", nil)
+			req.SetPathValue("id", "g1")
+			req = withWhoIs(req, tt.login, "node-123")
+			w := httptest.NewRecorder()
+
+			h.HandleApproveGrant(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			tc.AssertExpectations(t)
+		})
+	}
+}
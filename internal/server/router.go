@@ -5,17 +5,25 @@ import (
 	"net/http"
 
 	"github.com/rajsinghtech/tailgrant/internal/grant"
+	"github.com/rajsinghtech/tailgrant/internal/notify"
+	"github.com/rajsinghtech/tailgrant/internal/tsapi"
 	"go.temporal.io/sdk/client"
 	"tailscale.com/client/local"
 	tailscale "tailscale.com/client/tailscale/v2"
 )
 
-func NewRouter(lc *local.Client, tc client.Client, tsClient *tailscale.Client, grantTypes grant.GrantTypeStore, taskQueue string, staticFS fs.FS) http.Handler {
+func NewRouter(lc *local.Client, tc client.Client, tsClient *tailscale.Client, grantTypes grant.GrantTypeStore, taskQueue, namespace string, admins []string, auditFile string, staticFS fs.FS) http.Handler {
 	h := &Handlers{
 		TemporalClient: tc,
 		TSClient:       tsClient,
 		GrantTypes:     grantTypes,
 		TaskQueue:      taskQueue,
+		Namespace:      namespace,
+		Admins:         admins,
+		AuditFile:      auditFile,
+	}
+	if tsClient != nil {
+		h.Directory = tsapi.NewPrincipalResolver(tsClient)
 	}
 
 	mux := http.NewServeMux()
@@ -26,6 +34,9 @@ func NewRouter(lc *local.Client, tc client.Client, tsClient *tailscale.Client, g
 	api.HandleFunc("POST /api/grants/{id}/approve", h.HandleApproveGrant)
 	api.HandleFunc("POST /api/grants/{id}/deny", h.HandleDenyGrant)
 	api.HandleFunc("POST /api/grants/{id}/revoke", h.HandleRevokeGrant)
+	api.HandleFunc("POST /api/grants/{id}/cancel", h.HandleCancelGrant)
+	api.HandleFunc("POST /api/grants/{id}/acknowledge", h.HandleAcknowledgeGrant)
+	api.HandleFunc("POST /api/grants/{id}/reject", h.HandleRejectGrant)
 	api.HandleFunc("GET /api/grants/{id}", h.HandleGetGrant)
 	api.HandleFunc("GET /api/grant-types", h.HandleListGrantTypes)
 	api.HandleFunc("GET /api/devices", h.HandleListDevices)
@@ -33,6 +44,8 @@ func NewRouter(lc *local.Client, tc client.Client, tsClient *tailscale.Client, g
 	api.HandleFunc("GET /api/grants", h.HandleListGrants)
 	api.HandleFunc("GET /api/whoami", h.HandleWhoAmI)
 	api.HandleFunc("POST /api/grants/{id}/extend", h.HandleExtendGrant)
+	api.HandleFunc("POST /api/grants/{id}/renew", h.HandleRenewGrant)
+	api.HandleFunc("GET /api/audit", h.HandleListAudit)
 
 	mux.Handle("/api/", WhoIsMiddleware(lc)(api))
 
@@ -41,3 +54,36 @@ func NewRouter(lc *local.Client, tc client.Client, tsClient *tailscale.Client, g
 
 	return mux
 }
+
+// NewWebhookRouter serves the Tailscale webhook receiver and, when Slack is
+// configured, Slack interaction callbacks. It is mounted on its own
+// listener, outside the tailnet and the WhoIs middleware; each handler
+// authenticates requests by signature.
+func NewWebhookRouter(tc client.Client, tsClient *tailscale.Client, grantTypes grant.GrantTypeStore, namespace, secret string, slack *notify.Slack, slackSecret string) http.Handler {
+	mux := http.NewServeMux()
+	if secret != "" {
+		mux.Handle("POST /webhooks/tailscale", &WebhookHandler{
+			TemporalClient: tc,
+			TSClient:       tsClient,
+			Namespace:      namespace,
+			Secret:         secret,
+		})
+	}
+	if slack != nil {
+		h := &Handlers{
+			TemporalClient: tc,
+			TSClient:       tsClient,
+			GrantTypes:     grantTypes,
+			Namespace:      namespace,
+		}
+		if tsClient != nil {
+			h.Directory = tsapi.NewPrincipalResolver(tsClient)
+		}
+		mux.Handle("POST /webhooks/slack", &SlackHandler{
+			Handlers:      h,
+			Slack:         slack,
+			SigningSecret: slackSecret,
+		})
+	}
+	return mux
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/grant"
+	"github.com/rajsinghtech/tailgrant/internal/notify"
+)
+
+const (
+	SlackSignatureHeader = "X-Slack-Signature"
+	SlackTimestampHeader = "X-Slack-Request-Timestamp"
+)
+
+// SlackHandler receives Slack interaction callbacks from approval messages
+// and relays button clicks as approve and deny signals. The Slack user is
+// mapped to a tailnet login by email, and the same checks as the API
+// apply. On success ApprovalWorkflow updates the message in place; a
+// failure is reported back to the user who clicked.
+type SlackHandler struct {
+	Handlers      *Handlers
+	Slack         *notify.Slack
+	SigningSecret string
+	Now           func() time.Time
+}
+
+// slackInteraction holds the fields TailGrant uses from a block_actions
+// payload.
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+func (h *SlackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body: "+err.Error())
+		return
+	}
+	now := time.Now
+	if h.Now != nil {
+		now = h.Now
+	}
+	if err := VerifySlackSignature(r.Header.Get(SlackTimestampHeader), r.Header.Get(SlackSignatureHeader), body, h.SigningSecret, now()); err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form body: "+err.Error())
+		return
+	}
+	var p slackInteraction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &p); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid interaction payload: "+err.Error())
+		return
+	}
+	if p.Type != "block_actions" || len(p.Actions) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	action := p.Actions[0]
+	if reply := h.act(r.Context(), p.User.ID, action.ActionID, action.Value); reply != "" && p.ResponseURL != "" {
+		if err := h.Slack.Respond(r.Context(), p.ResponseURL, reply); err != nil {
+			slog.Error("failed to reply to slack interaction", "error", err)
+		}
+	}
+	// Slack only needs an acknowledgement; the outcome is posted by
+	// ApprovalWorkflow.
+	w.WriteHeader(http.StatusOK)
+}
+
+// act applies a button click and returns a message for the user, or "" if
+// there is nothing to say.
+func (h *SlackHandler) act(ctx context.Context, slackUserID, actionID, grantID string) string {
+	login, err := h.login(ctx, slackUserID)
+	if err != nil {
+		slog.Warn("failed to map slack user to tailnet login", "slackUser", slackUserID, "error", err)
+		return "TailGrant could not match your Slack account to a tailnet user: " + err.Error()
+	}
+	switch actionID {
+	case notify.SlackActionApprove:
+		status, err := h.Handlers.approve(ctx, grantID, login)
+		if err != nil {
+			return "Could not approve: " + err.Error()
+		}
+		if status == string(grant.StatusPartiallyApproved) {
+			return "Your approval is recorded; more approvals are needed."
+		}
+	case notify.SlackActionDeny:
+		if err := h.Handlers.deny(ctx, grantID, login, "denied in Slack"); err != nil {
+			return "Could not deny: " + err.Error()
+		}
+	}
+	return ""
+}
+
+// login maps a Slack user to the tailnet login with the same email
+// address.
+func (h *SlackHandler) login(ctx context.Context, slackUserID string) (string, error) {
+	email, err := h.Slack.UserEmail(ctx, slackUserID)
+	if err != nil {
+		return "", err
+	}
+	if h.Handlers.TSClient == nil {
+		return "", errors.New("tailscale API client not configured")
+	}
+	users, err := h.Handlers.TSClient.Users().List(ctx, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("list users: %w", err)
+	}
+	for _, u := range users {
+		if strings.EqualFold(u.LoginName, email) {
+			return u.LoginName, nil
+		}
+	}
+	return "", fmt.Errorf("no tailnet user with login %s", email)
+}
+
+// VerifySlackSignature checks a Slack request signature: "v0=" and the hex
+// HMAC-SHA256 of "v0:<timestamp>:<body>" keyed with the app's signing
+// secret.
+func VerifySlackSignature(timestamp, signature string, body []byte, secret string, now time.Time) error {
+	if secret == "" {
+		return errors.New("slack signing secret not configured")
+	}
+	if timestamp == "" || !strings.HasPrefix(signature, "v0=") {
+		return errors.New("missing or malformed signature headers")
+	}
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > webhookTolerance || d < -webhookTolerance {
+		return errors.New("signature timestamp outside tolerance")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "v0="))
+	if err != nil || !hmac.Equal(got, mac.Sum(nil)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
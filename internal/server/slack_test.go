@@ -0,0 +1,200 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/grant"
+	"github.com/rajsinghtech/tailgrant/internal/notify"
+	"github.com/stretchr/testify/mock"
+)
+
+const testSlackSecret = "slack-signing-test"
+
+func signSlack(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Unix(1_750_000_000, 0)
+	body := []byte("payload=%7B%7D")
+	ts := strconv.FormatInt(now.Unix(), 10)
+	old := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		secret    string
+		wantErr   bool
+	}{
+		{"valid", ts, signSlack(testSlackSecret, ts, body), testSlackSecret, false},
+		{"wrong secret", ts, signSlack("attacker", ts, body), testSlackSecret, true},
+		{"stale", old, signSlack(testSlackSecret, old, body), testSlackSecret, true},
+		{"missing timestamp", "", signSlack(testSlackSecret, ts, body), testSlackSecret, true},
+		{"wrong version", ts, "v1=" + strings.TrimPrefix(signSlack(testSlackSecret, ts, body), "v0="), testSlackSecret, true},
+		{"no secret configured", ts, signSlack("", ts, body), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySlackSignature(tt.timestamp, tt.signature, body, tt.secret, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeSlack stands in for the Slack API and an interaction's response_url.
+type fakeSlack struct {
+	emails  map[string]string // Slack user ID -> profile email
+	replies []string
+}
+
+func (f *fakeSlack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/users.info":
+		email, ok := f.emails[r.URL.Query().Get("user")]
+		if !ok {
+			_, _ = w.Write([]byte(`{"ok":false,"error":"user_not_found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "user": map[string]any{"profile": map[string]any{"email": email}}})
+	case "/respond":
+		var body struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.replies = append(f.replies, body.Text)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// slackClick builds a signed block_actions callback for a button click.
+func slackClick(t *testing.T, slackURL, user, action, grantID string, now time.Time) *http.Request {
+	t.Helper()
+	payload, err := json.Marshal(map[string]any{
+		"type":         "block_actions",
+		"user":         map[string]any{"id": user},
+		"response_url": slackURL + "/respond",
+		"actions":      []map[string]any{{"action_id": action, "value": grantID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(url.Values{"payload": {string(payload)}}.Encode())
+	ts := strconv.FormatInt(now.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/slack", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(SlackTimestampHeader, ts)
+	req.Header.Set(SlackSignatureHeader, signSlack(testSlackSecret, ts, body))
+	return req
+}
+
+func TestSlackHandler(t *testing.T) {
+	pending := grant.GrantState{
+		Request: grant.GrantRequest{ID: "g1", Requester: "user@example.com", GrantTypeName: "ssh-access"},
+		Status:  grant.StatusPendingApproval,
+	}
+	tsClient := newTestTSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"users": []map[string]any{
+			{"id": "u1", "loginName": "admin@example.com"},
+			{"id": "u2", "loginName": "user@example.com"},
+		}})
+	})
+
+	tests := []struct {
+		name      string
+		user      string
+		action    string
+		signal    string
+		wantReply string
+	}{
+		{"approve", "UADMIN", notify.SlackActionApprove, "approve", ""},
+		{"deny", "UADMIN", notify.SlackActionDeny, "deny", ""},
+		{"requester cannot approve", "UUSER", notify.SlackActionApprove, "", "cannot approve your own grant request"},
+		{"unmapped email", "UGUEST", notify.SlackActionApprove, "", "no tailnet user with login guest@other.example"},
+		{"unknown slack user", "UNOBODY", notify.SlackActionApprove, "", "user_not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slackAPI := &fakeSlack{emails: map[string]string{
+				"UADMIN": "Admin@Example.com",
+				"UUSER":  "user@example.com",
+				"UGUEST": "guest@other.example",
+			}}
+			srv := httptest.NewServer(slackAPI)
+			defer srv.Close()
+
+			tc := newGrantStateClient(pending)
+			if tt.signal != "" {
+				tc.On("SignalWorkflow", mock.Anything, "approval-g1", "", tt.signal, mock.Anything).Return(nil)
+			}
+			now := time.Now()
+			h := &SlackHandler{
+				Handlers:      &Handlers{TemporalClient: tc, TSClient: tsClient, GrantTypes: newMockGrantTypeStore()},
+				Slack:         &notify.Slack{Token: "xoxb-test", Channel: "C42", APIURL: srv.URL},
+				SigningSecret: testSlackSecret,
+				Now:           func() time.Time { return now },
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, slackClick(t, srv.URL, tt.user, tt.action, "g1", now))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if tt.signal == "" {
+				tc.AssertNotCalled(t, "SignalWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				// The tailnet login is used, not the Slack email's casing.
+				tc.AssertCalled(t, "SignalWorkflow", mock.Anything, "approval-g1", "", tt.signal, mock.MatchedBy(func(sig any) bool {
+					switch s := sig.(type) {
+					case grant.ApproveSignal:
+						return s.ApprovedBy == "admin@example.com"
+					case grant.DenySignal:
+						return s.DeniedBy == "admin@example.com"
+					}
+					return false
+				}))
+			}
+			if tt.wantReply == "" {
+				if len(slackAPI.replies) != 0 {
+					t.Errorf("unexpected replies: %q", slackAPI.replies)
+				}
+				return
+			}
+			if len(slackAPI.replies) != 1 || !strings.Contains(slackAPI.replies[0], tt.wantReply) {
+				t.Errorf("replies = %q, want one containing %q", slackAPI.replies, tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestSlackHandler_BadSignature(t *testing.T) {
+	tc := newGrantStateClient(grant.GrantState{})
+	h := &SlackHandler{Handlers: &Handlers{TemporalClient: tc}, SigningSecret: "other-secret"}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, slackClick(t, "http://slack.invalid", "UADMIN", notify.SlackActionApprove, "g1", time.Now()))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	tc.AssertNotCalled(t, "QueryWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/grant"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	tailscale "tailscale.com/client/tailscale/v2"
+)
+
+const (
+	// WebhookSignatureHeader carries the HMAC-SHA256 signature of a
+	// Tailscale webhook delivery.
+	WebhookSignatureHeader = "Tailscale-Webhook-Signature"
+
+	// webhookTolerance bounds how old a signed delivery may be, to limit
+	// replays.
+	webhookTolerance = 5 * time.Minute
+
+	maxWebhookBody = 1 << 20
+)
+
+// TailnetEvent is one event in a Tailscale webhook delivery.
+type TailnetEvent struct {
+	Timestamp time.Time        `json:"timestamp"`
+	Version   int              `json:"version"`
+	Type      string           `json:"type"`
+	Tailnet   string           `json:"tailnet"`
+	Message   string           `json:"message"`
+	Data      TailnetEventData `json:"data"`
+}
+
+// TailnetEventData holds the event fields TailGrant uses. Node events set
+// NodeID; user events set User to the affected login.
+type TailnetEventData struct {
+	NodeID string `json:"nodeID"`
+	User   string `json:"user"`
+	Actor  string `json:"actor"`
+}
+
+// WebhookHandler receives Tailscale webhook deliveries and relays the
+// events GrantWorkflow reacts to as "tailnet-event" signals. It is served
+// outside the tailnet, so it authenticates every request by its signature
+// instead of WhoIs.
+type WebhookHandler struct {
+	TemporalClient client.Client
+	TSClient       *tailscale.Client
+	Namespace      string
+	Secret         string
+	Now            func() time.Time
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body: "+err.Error())
+		return
+	}
+	now := time.Now
+	if h.Now != nil {
+		now = h.Now
+	}
+	if err := VerifyWebhookSignature(r.Header.Get(WebhookSignatureHeader), body, h.Secret, now()); err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var events []TailnetEvent
+	if err := json.Unmarshal(body, &events); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid event payload: "+err.Error())
+		return
+	}
+
+	signaled := 0
+	var errs []error
+	for _, ev := range events {
+		n, err := h.dispatch(r.Context(), ev)
+		signaled += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ev.Type, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		// A non-2xx response makes Tailscale redeliver; signals are safe
+		// to repeat.
+		slog.Error("failed to relay tailnet events", "error", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"signaled": signaled})
+}
+
+// dispatch signals every running grant the event affects and returns how
+// many it signaled. Events TailGrant does not react to are ignored.
+func (h *WebhookHandler) dispatch(ctx context.Context, ev TailnetEvent) (int, error) {
+	sig := grant.TailnetEventSignal{Type: ev.Type, Actor: ev.Data.Actor}
+	var conds []string
+	switch ev.Type {
+	case grant.TailnetNodeDeleted:
+		if ev.Data.NodeID == "" {
+			return 0, nil
+		}
+		sig.NodeID = ev.Data.NodeID
+		conds = append(conds, fmt.Sprintf("%s = %s", grant.SearchAttrTarget.GetName(), quoteQuery(ev.Data.NodeID)))
+	case grant.TailnetUserSuspended, grant.TailnetUserDeleted, grant.TailnetUserRoleUpdated:
+		if ev.Data.User == "" {
+			return 0, nil
+		}
+		sig.User = ev.Data.User
+		conds = append(conds, fmt.Sprintf("%s = %s", grant.SearchAttrRequester.GetName(), quoteQuery(ev.Data.User)))
+		// Role and restore grants index the target user by ID.
+		if id, err := h.userID(ctx, ev.Data.User); err != nil {
+			return 0, err
+		} else if id != "" {
+			conds = append(conds, fmt.Sprintf("%s = %s", grant.SearchAttrTarget.GetName(), quoteQuery(id)))
+		}
+	default:
+		return 0, nil
+	}
+
+	query := fmt.Sprintf("WorkflowType = 'GrantWorkflow' AND ExecutionStatus = 'Running' AND (%s)", strings.Join(conds, " OR "))
+	var ids []string
+	var token []byte
+	for {
+		resp, err := h.TemporalClient.ListWorkflow(ctx, &workflowservice.ListWorkflowExecutionsRequest{
+			Namespace:     h.Namespace,
+			Query:         query,
+			NextPageToken: token,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("list affected grants: %w", err)
+		}
+		for _, exec := range resp.Executions {
+			ids = append(ids, exec.GetExecution().GetWorkflowId())
+		}
+		if token = resp.NextPageToken; len(token) == 0 {
+			break
+		}
+	}
+
+	signaled := 0
+	for _, id := range ids {
+		err := h.TemporalClient.SignalWorkflow(ctx, id, "", "tailnet-event", sig)
+		var notFound *serviceerror.NotFound
+		if errors.As(err, &notFound) {
+			// Completed since it was listed.
+			continue
+		}
+		if err != nil {
+			return signaled, fmt.Errorf("signal %s: %w", id, err)
+		}
+		signaled++
+	}
+	return signaled, nil
+}
+
+// userID looks up the tailnet user ID for a login. It returns "" if the
+// user no longer exists or no Tailscale API client is configured.
+func (h *WebhookHandler) userID(ctx context.Context, login string) (string, error) {
+	if h.TSClient == nil {
+		return "", nil
+	}
+	users, err := h.TSClient.Users().List(ctx, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("list users: %w", err)
+	}
+	for _, u := range users {
+		if strings.EqualFold(u.LoginName, login) {
+			return u.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// quoteQuery quotes a value for a visibility query.
+func quoteQuery(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// VerifyWebhookSignature checks a Tailscale-Webhook-Signature header of the
+// form "t=<unix seconds>,v1=<hex HMAC-SHA256>", where the MAC covers
+// "<t>.<body>" keyed with the webhook secret.
+func VerifyWebhookSignature(header string, body []byte, secret string, now time.Time) error {
+	if secret == "" {
+		return errors.New("webhook secret not configured")
+	}
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	if ts == "" || len(sigs) == 0 {
+		return errors.New("missing or malformed signature header")
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > webhookTolerance || d < -webhookTolerance {
+		return errors.New("signature timestamp outside tolerance")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	want := mac.Sum(nil)
+	for _, s := range sigs {
+		got, err := hex.DecodeString(s)
+		if err == nil && hmac.Equal(got, want) {
+			return nil
+		}
+	}
+	return errors.New("signature mismatch")
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajsinghtech/tailgrant/internal/grant"
+	"github.com/stretchr/testify/mock"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/api/serviceerror"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/mocks"
+)
+
+const testWebhookSecret = "tskey-webhook-test"
+
+// fakeTailscaleSender signs and delivers webhook payloads the way
+// Tailscale does.
+type fakeTailscaleSender struct {
+	secret string
+	now    time.Time
+}
+
+func (s fakeTailscaleSender) sign(body []byte) string {
+	ts := strconv.FormatInt(s.now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	mac.Write([]byte(ts + "." + string(body)))
+	return fmt.Sprintf("t=%s,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (s fakeTailscaleSender) send(t *testing.T, h http.Handler, events ...TailnetEvent) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(events)
+	if err != nil {
+		t.Fatalf("marshal events: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/tailscale", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, s.sign(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func listResponse(ids ...string) *workflowservice.ListWorkflowExecutionsResponse {
+	resp := &workflowservice.ListWorkflowExecutionsResponse{}
+	for _, id := range ids {
+		resp.Executions = append(resp.Executions, &workflowpb.WorkflowExecutionInfo{
+			Execution: &commonpb.WorkflowExecution{WorkflowId: id},
+		})
+	}
+	return resp
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Unix(1_750_000_000, 0)
+	body := []byte(`[{"type":"test"}]`)
+	valid := fakeTailscaleSender{secret: testWebhookSecret, now: now}.sign(body)
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		secret  string
+		wantErr string
+	}{
+		{"valid", valid, body, testWebhookSecret, ""},
+		{"rotated secret alongside", valid + ",v1=" + strings.Repeat("0", 64), body, testWebhookSecret, ""},
+		{"wrong secret", valid, body, "other", "signature mismatch"},
+		{"tampered body", valid, []byte(`[{"type":"nodeDeleted"}]`), testWebhookSecret, "signature mismatch"},
+		{"stale", fakeTailscaleSender{secret: testWebhookSecret, now: now.Add(-10 * time.Minute)}.sign(body), body, testWebhookSecret, "tolerance"},
+		{"missing", "", body, testWebhookSecret, "malformed"},
+		{"no secret configured", valid, body, "", "not configured"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(tt.header, tt.body, tt.secret, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_NodeDeleted(t *testing.T) {
+	now := time.Now()
+	tc := &mocks.Client{}
+	h := &WebhookHandler{TemporalClient: tc, Namespace: "tailgrant", Secret: testWebhookSecret}
+
+	tc.On("ListWorkflow", mock.Anything, mock.MatchedBy(func(req *workflowservice.ListWorkflowExecutionsRequest) bool {
+		return req.Namespace == "tailgrant" &&
+			req.Query == "WorkflowType = 'GrantWorkflow' AND ExecutionStatus = 'Running' AND (TailgrantTarget = 'node-1')"
+	})).Return(listResponse("grant-a", "grant-b"), nil)
+	want := grant.TailnetEventSignal{Type: grant.TailnetNodeDeleted, NodeID: "node-1", Actor: "admin@example.com"}
+	tc.On("SignalWorkflow", mock.Anything, "grant-a", "", "tailnet-event", want).Return(nil)
+	tc.On("SignalWorkflow", mock.Anything, "grant-b", "", "tailnet-event", want).Return(serviceerror.NewNotFound("workflow completed"))
+
+	w := fakeTailscaleSender{secret: testWebhookSecret, now: now}.send(t, h,
+		TailnetEvent{Timestamp: now, Version: 1, Type: "nodeDeleted", Data: TailnetEventData{NodeID: "node-1", Actor: "admin@example.com"}},
+		TailnetEvent{Timestamp: now, Version: 1, Type: "nodeCreated", Data: TailnetEventData{NodeID: "node-2"}},
+	)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp map[string]int
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp["signaled"] != 1 {
+		t.Errorf("signaled = %d, want 1 (grant-b already completed)", resp["signaled"])
+	}
+	tc.AssertExpectations(t)
+}
+
+func TestWebhookHandler_UserSuspended(t *testing.T) {
+	now := time.Now()
+	tc := &mocks.Client{}
+	tsClient := newTestTSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"users": []map[string]any{
+			{"id": "user-42", "loginName": "user@example.com"},
+		}})
+	})
+	h := &WebhookHandler{TemporalClient: tc, TSClient: tsClient, Secret: testWebhookSecret}
+
+	var query string
+	tc.On("ListWorkflow", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		query = args.Get(1).(*workflowservice.ListWorkflowExecutionsRequest).Query
+	}).Return(listResponse("grant-a"), nil)
+	tc.On("SignalWorkflow", mock.Anything, "grant-a", "", "tailnet-event",
+		grant.TailnetEventSignal{Type: grant.TailnetUserSuspended, User: "user@example.com"}).Return(nil)
+
+	w := fakeTailscaleSender{secret: testWebhookSecret, now: now}.send(t, h,
+		TailnetEvent{Timestamp: now, Version: 1, Type: "userSuspended", Data: TailnetEventData{User: "user@example.com"}},
+	)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if !strings.Contains(query, "TailgrantRequester = 'user@example.com' OR TailgrantTarget = 'user-42'") {
+		t.Errorf("query = %q, want requester or target user ID", query)
+	}
+	tc.AssertExpectations(t)
+}
+
+func TestWebhookHandler_Rejected(t *testing.T) {
+	now := time.Now()
+	tc := &mocks.Client{}
+	h := &WebhookHandler{TemporalClient: tc, Secret: testWebhookSecret}
+	events := TailnetEvent{Type: "nodeDeleted", Data: TailnetEventData{NodeID: "node-1"}}
+
+	t.Run("wrong secret", func(t *testing.T) {
+		w := fakeTailscaleSender{secret: "attacker", now: now}.send(t, h, events)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	})
+	t.Run("replayed", func(t *testing.T) {
+		w := fakeTailscaleSender{secret: testWebhookSecret, now: now.Add(-time.Hour)}.send(t, h, events)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	})
+	tc.AssertNotCalled(t, "ListWorkflow", mock.Anything, mock.Anything)
+	tc.AssertNotCalled(t, "SignalWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
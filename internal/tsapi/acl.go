@@ -0,0 +1,74 @@
+package tsapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	tailscale "tailscale.com/client/tailscale/v2"
+)
+
+// PolicyValidationError is returned by ValidatePolicy when the policy
+// validate endpoint rejects a policy file.
+type PolicyValidationError struct {
+	Message string
+	Data    []tailscale.APIErrorData
+}
+
+func (e *PolicyValidationError) Error() string {
+	if len(e.Data) == 0 {
+		return "policy file rejected: " + e.Message
+	}
+	return fmt.Sprintf("policy file rejected: %s; %v", e.Message, e.Data)
+}
+
+// ValidatePolicy checks a HuJSON policy file against the tailnet's policy
+// validate endpoint. The upstream client reports a rejection as an untyped
+// error, so this calls the endpoint directly. The endpoint rejects a
+// policy either in a 200 response carrying a message or with 400 Bad
+// Request; both are returned as a *PolicyValidationError, and any other
+// failure is not.
+// POST /api/v2/tailnet/{tailnet}/acl/validate
+func ValidatePolicy(ctx context.Context, client *tailscale.Client, policy []byte) error {
+	_ = client.PolicyFile() // trigger init
+	path := fmt.Sprintf("/api/v2/tailnet/%s/acl/validate", url.PathEscape(client.Tailnet))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.BaseURL.String()+path, bytes.NewReader(policy))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/hujson")
+	if client.UserAgent != "" {
+		req.Header.Set("User-Agent", client.UserAgent)
+	}
+
+	resp, err := client.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	ok := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !ok && resp.StatusCode != http.StatusBadRequest {
+		return fmt.Errorf("tailscale API %s returned %d: %s", path, resp.StatusCode, string(body))
+	}
+
+	var apiErr tailscale.APIError
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &apiErr); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+	if ok && apiErr.Message == "" {
+		return nil
+	}
+	return &PolicyValidationError{Message: apiErr.Message, Data: apiErr.Data}
+}
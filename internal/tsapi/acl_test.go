@@ -0,0 +1,66 @@
+package tsapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	tailscale "tailscale.com/client/tailscale/v2"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantErr      bool
+		wantRejected bool
+	}{
+		{"valid", http.StatusOK, `{}`, false, false},
+		{"valid empty body", http.StatusOK, ``, false, false},
+		{"rejected in 200", http.StatusOK, `{"message":"test(s) failed","data":[{"user":"alice@example.com","errors":["no access"]}]}`, true, true},
+		{"rejected with 400", http.StatusBadRequest, `{"message":"json: unknown field \"grnts\""}`, true, true},
+		{"server error", http.StatusInternalServerError, `{"message":"internal error"}`, true, false},
+		{"forbidden", http.StatusForbidden, `{"message":"forbidden"}`, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotContentType, gotBody string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotContentType = r.Header.Get("Content-Type")
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			t.Cleanup(server.Close)
+
+			baseURL, _ := url.Parse(server.URL)
+			client := &tailscale.Client{BaseURL: baseURL, HTTP: server.Client(), Tailnet: "example.com"}
+
+			err := ValidatePolicy(context.Background(), client, []byte(`{"grants": []}`))
+
+			if gotPath != "/api/v2/tailnet/example.com/acl/validate" {
+				t.Errorf("path = %s", gotPath)
+			}
+			if gotContentType != "application/hujson" {
+				t.Errorf("content type = %s", gotContentType)
+			}
+			if gotBody != `{"grants": []}` {
+				t.Errorf("body = %s", gotBody)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidatePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var rejected *PolicyValidationError
+			if errors.As(err, &rejected) != tt.wantRejected {
+				t.Errorf("error = %v (%T), want rejection %v", err, err, tt.wantRejected)
+			}
+		})
+	}
+}
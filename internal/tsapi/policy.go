@@ -0,0 +1,286 @@
+package tsapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tailscale/hujson"
+)
+
+// pointerEscaper escapes a policy file key for use in a JSON pointer.
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// grantMarkerRE matches the comment that marks a grants entry TailGrant
+// inserted into the policy file, capturing the grant ID.
+var grantMarkerRE = regexp.MustCompile(`//\s*tailgrant:(\S+)`)
+
+// PolicyGrant is an entry in the grants section of a policy file.
+type PolicyGrant struct {
+	Src []string                    `json:"src"`
+	Dst []string                    `json:"dst"`
+	IP  []string                    `json:"ip,omitempty"`
+	App map[string][]map[string]any `json:"app,omitempty"`
+}
+
+// AddGroupMember adds member to group in a HuJSON policy file and reports
+// whether the policy changed. Comments and formatting are kept; the new
+// entry is indented like the group's last member. The group must already
+// exist. A member that is already in the group is left alone.
+func AddGroupMember(policy []byte, group, member string) ([]byte, bool, error) {
+	v, members, err := parseGroup(policy, group)
+	if err != nil {
+		return nil, false, err
+	}
+	if members == nil {
+		return nil, false, fmt.Errorf("group %q not found in policy file", group)
+	}
+	if groupMemberIndex(members, member) >= 0 {
+		return policy, false, nil
+	}
+
+	entry := hujson.Value{Value: hujson.String(member)}
+	if n := len(members.Elements); n > 0 {
+		entry.BeforeExtra = lineIndent(members.Elements[n-1].BeforeExtra)
+	}
+	appendElement(members, entry)
+	return v.Pack(), true, nil
+}
+
+// RemoveGroupMember removes member from group in a HuJSON policy file and
+// reports whether the policy changed. Comments and formatting around the
+// other members are kept. A missing group or member is not an error.
+func RemoveGroupMember(policy []byte, group, member string) ([]byte, bool, error) {
+	v, members, err := parseGroup(policy, group)
+	if err != nil {
+		return nil, false, err
+	}
+	if members == nil {
+		return policy, false, nil
+	}
+	i := groupMemberIndex(members, member)
+	if i < 0 {
+		return policy, false, nil
+	}
+
+	removeElement(members, i)
+	return v.Pack(), true, nil
+}
+
+// SyncMarkedGrants brings the marked entries in the grants section of a
+// HuJSON policy file in line with grants, keyed by grant ID, and reports
+// whether the policy changed. Each entry TailGrant inserts is preceded by a
+// "// tailgrant:<grant ID>" comment; marked entries whose ID is not in
+// grants are removed, and missing ones are appended. Unmarked entries,
+// comments and formatting are kept. The grants section is created if the
+// policy file has none.
+func SyncMarkedGrants(policy []byte, grants map[string]PolicyGrant) ([]byte, bool, error) {
+	v, err := hujson.Parse(policy)
+	if err != nil {
+		return nil, false, fmt.Errorf("parse policy file: %w", err)
+	}
+	root, ok := v.Value.(*hujson.Object)
+	if !ok {
+		return nil, false, fmt.Errorf("policy file is not an object")
+	}
+
+	var arr *hujson.Array
+	var base hujson.Extra // indentation of the grants section
+	if found := v.Find("/grants"); found != nil {
+		if arr, ok = found.Value.(*hujson.Array); !ok {
+			return nil, false, fmt.Errorf("grants in policy file is not a list")
+		}
+		for _, m := range root.Members {
+			if m.Value.Value == found.Value {
+				base = lineIndent(m.Name.BeforeExtra)
+			}
+		}
+	}
+
+	changed := false
+	seen := make(map[string]bool)
+	if arr != nil {
+		for i := 0; i < len(arr.Elements); {
+			id := grantMarker(arr.Elements[i].BeforeExtra)
+			if id == "" {
+				i++
+				continue
+			}
+			if _, want := grants[id]; want && !seen[id] {
+				seen[id] = true
+				i++
+				continue
+			}
+			removeElement(arr, i)
+			changed = true
+		}
+		if len(arr.Elements) == 0 && changed {
+			arr.AfterExtra = nil
+		}
+	}
+
+	var missing []string
+	for id := range grants {
+		if !seen[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		if !changed {
+			return policy, false, nil
+		}
+		return v.Pack(), true, nil
+	}
+	slices.Sort(missing)
+
+	if arr == nil {
+		base = hujson.Extra("\n\t")
+		if n := len(root.Members); n > 0 {
+			base = lineIndent(root.Members[n-1].Name.BeforeExtra)
+		} else {
+			root.AfterExtra = hujson.Extra("\n")
+		}
+		arr = &hujson.Array{}
+		member := hujson.ObjectMember{
+			Name:  hujson.Value{BeforeExtra: base, Value: hujson.String("grants")},
+			Value: hujson.Value{BeforeExtra: hujson.Extra(" "), Value: arr},
+		}
+		if n := len(root.Members); n > 0 && root.Members[n-1].Value.AfterExtra != nil {
+			member.Value.AfterExtra = hujson.Extra{}
+		}
+		root.Members = append(root.Members, member)
+	}
+	if !bytes.HasPrefix(base, []byte("\n")) {
+		base = hujson.Extra("\n\t")
+	}
+	indent := append(slices.Clone(base), '\t')
+	if n := len(arr.Elements); n > 0 {
+		if last := lineIndent(arr.Elements[n-1].BeforeExtra); bytes.HasPrefix(last, []byte("\n")) {
+			indent = last
+		}
+	} else {
+		arr.AfterExtra = base
+	}
+
+	for _, id := range missing {
+		b, err := json.MarshalIndent(grants[id], string(indent[1:]), "\t")
+		if err != nil {
+			return nil, false, fmt.Errorf("marshal grant %s: %w", id, err)
+		}
+		entry, err := hujson.Parse(b)
+		if err != nil {
+			return nil, false, fmt.Errorf("parse grant %s: %w", id, err)
+		}
+		entry.BeforeExtra = slices.Concat(indent, hujson.Extra("// tailgrant:"+id), indent)
+		appendElement(arr, entry)
+	}
+	return v.Pack(), true, nil
+}
+
+// MarkedGrantIDs returns the grant IDs of the marked entries in the grants
+// section of a HuJSON policy file, in the order they appear.
+func MarkedGrantIDs(policy []byte) ([]string, error) {
+	v, err := hujson.Parse(policy)
+	if err != nil {
+		return nil, fmt.Errorf("parse policy file: %w", err)
+	}
+	found := v.Find("/grants")
+	if found == nil {
+		return nil, nil
+	}
+	arr, ok := found.Value.(*hujson.Array)
+	if !ok {
+		return nil, fmt.Errorf("grants in policy file is not a list")
+	}
+	var ids []string
+	for _, e := range arr.Elements {
+		if id := grantMarker(e.BeforeExtra); id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// grantMarker returns the grant ID in the last marker comment before a
+// grants entry, or "" if there is none.
+func grantMarker(before hujson.Extra) string {
+	matches := grantMarkerRE.FindAllSubmatch(before, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return string(matches[len(matches)-1][1])
+}
+
+// parseGroup parses a HuJSON policy file and finds a group's member list.
+// The list is nil if the group does not exist.
+func parseGroup(policy []byte, group string) (*hujson.Value, *hujson.Array, error) {
+	if !strings.HasPrefix(group, "group:") {
+		return nil, nil, fmt.Errorf("invalid group %q, want group:<name>", group)
+	}
+	v, err := hujson.Parse(policy)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse policy file: %w", err)
+	}
+	found := v.Find("/groups/" + pointerEscaper.Replace(group))
+	if found == nil {
+		return &v, nil, nil
+	}
+	members, ok := found.Value.(*hujson.Array)
+	if !ok {
+		return nil, nil, fmt.Errorf("group %q in policy file is not a list", group)
+	}
+	return &v, members, nil
+}
+
+// groupMemberIndex returns the index of member in a group's member list,
+// or -1 if it is not there.
+func groupMemberIndex(members *hujson.Array, member string) int {
+	for i, e := range members.Elements {
+		if lit, ok := e.Value.(hujson.Literal); ok && lit.Kind() == '"' && lit.String() == member {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendElement appends v to arr, keeping a trailing comma if arr has one.
+func appendElement(arr *hujson.Array, v hujson.Value) {
+	if n := len(arr.Elements); n > 0 && arr.Elements[n-1].AfterExtra != nil {
+		v.AfterExtra = hujson.Extra{}
+	}
+	arr.Elements = append(arr.Elements, v)
+}
+
+// removeElement removes the i'th element of arr along with its comments.
+func removeElement(arr *hujson.Array, i int) {
+	removed := arr.Elements[i]
+	arr.Elements = append(arr.Elements[:i], arr.Elements[i+1:]...)
+	switch {
+	case i < len(arr.Elements):
+		// The next element takes over the removed one's position, unless
+		// either has comments of its own.
+		if next := &arr.Elements[i]; !hasComment(next.BeforeExtra) && !hasComment(removed.BeforeExtra) {
+			next.BeforeExtra = removed.BeforeExtra
+		}
+	case i > 0:
+		// The new last element keeps the trailing comma, or lack of one.
+		arr.Elements[i-1].AfterExtra = removed.AfterExtra
+	}
+}
+
+// lineIndent returns the whitespace that starts a list entry, given the
+// text before the previous entry: its newline and indentation for one
+// entry per line, or a single space for entries on one line.
+func lineIndent(before hujson.Extra) hujson.Extra {
+	if i := bytes.LastIndexByte(before, '\n'); i >= 0 {
+		return append(hujson.Extra{}, before[i:]...)
+	}
+	return hujson.Extra(" ")
+}
+
+func hasComment(extra hujson.Extra) bool {
+	return bytes.Contains(extra, []byte("//")) || bytes.Contains(extra, []byte("/*"))
+}
@@ -0,0 +1,284 @@
+package tsapi
+
+import (
+	"strings"
+	"testing"
+)
+
+const testPolicy = `// Example policy
+{
+	// Groups referenced by the ACLs below.
+	"groups": {
+		"group:eng": ["alice@example.com", "bob@example.com"], // engineers
+		"group:dba": [
+			// on-call
+			"carol@example.com",
+		],
+		"group:empty": [],
+	},
+	"acls": [
+		{"action": "accept", "src": ["group:dba"], "dst": ["tag:db:5432"]},
+	],
+}
+`
+
+func TestAddGroupMember(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   string
+		want    string // replaces the group's line(s) in testPolicy
+		changed bool
+		wantErr string
+	}{
+		{
+			name:    "single line",
+			group:   "group:eng",
+			want:    `"group:eng": ["alice@example.com", "bob@example.com", "dave@example.com"], // engineers`,
+			changed: true,
+		},
+		{
+			name:  "one per line with trailing comma",
+			group: "group:dba",
+			want: `"group:dba": [
+			// on-call
+			"carol@example.com",
+			"dave@example.com",
+		],`,
+			changed: true,
+		},
+		{
+			name:    "empty group",
+			group:   "group:empty",
+			want:    `"group:empty": ["dave@example.com"],`,
+			changed: true,
+		},
+		{
+			name:    "missing group",
+			group:   "group:ops",
+			wantErr: `group "group:ops" not found`,
+		},
+		{
+			name:    "not a group",
+			group:   "tag:db",
+			wantErr: "invalid group",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := AddGroupMember([]byte(testPolicy), tt.group, "dave@example.com")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			if !strings.Contains(string(got), tt.want) {
+				t.Errorf("policy does not contain %q:\n%s", tt.want, got)
+			}
+			// Everything else is untouched.
+			if !strings.Contains(string(got), "// Groups referenced by the ACLs below.") ||
+				!strings.Contains(string(got), `{"action": "accept", "src": ["group:dba"], "dst": ["tag:db:5432"]},`) {
+				t.Errorf("policy lost comments or formatting:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestAddGroupMember_AlreadyMember(t *testing.T) {
+	got, changed, err := AddGroupMember([]byte(testPolicy), "group:eng", "bob@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed {
+		t.Error("expected no change for an existing member")
+	}
+	if string(got) != testPolicy {
+		t.Errorf("policy changed:\n%s", got)
+	}
+}
+
+func TestRemoveGroupMember(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   string
+		member  string
+		want    string
+		changed bool
+	}{
+		{
+			name:    "last on one line",
+			group:   "group:eng",
+			member:  "bob@example.com",
+			want:    `"group:eng": ["alice@example.com"], // engineers`,
+			changed: true,
+		},
+		{
+			name:    "first on one line",
+			group:   "group:eng",
+			member:  "alice@example.com",
+			want:    `"group:eng": ["bob@example.com"], // engineers`,
+			changed: true,
+		},
+		{
+			name:    "not a member",
+			group:   "group:eng",
+			member:  "dave@example.com",
+			want:    testPolicy,
+			changed: false,
+		},
+		{
+			name:    "missing group",
+			group:   "group:ops",
+			member:  "alice@example.com",
+			want:    testPolicy,
+			changed: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := RemoveGroupMember([]byte(testPolicy), tt.group, tt.member)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			if !strings.Contains(string(got), tt.want) {
+				t.Errorf("policy does not contain %q:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAddRemoveGroupMember_RoundTrip(t *testing.T) {
+	for _, group := range []string{"group:eng", "group:dba", "group:empty"} {
+		added, _, err := AddGroupMember([]byte(testPolicy), group, "dave@example.com")
+		if err != nil {
+			t.Fatalf("%s: add: %v", group, err)
+		}
+		removed, _, err := RemoveGroupMember(added, group, "dave@example.com")
+		if err != nil {
+			t.Fatalf("%s: remove: %v", group, err)
+		}
+		if string(removed) != testPolicy {
+			t.Errorf("%s: round trip changed the policy:\n%s", group, removed)
+		}
+	}
+}
+
+const testGrantsPolicy = `{
+	"grants": [
+		// Everyone can reach the wiki.
+		{"src": ["autogroup:member"], "dst": ["tag:wiki"], "ip": ["443"]},
+	],
+}
+`
+
+var testGrant = PolicyGrant{
+	Src: []string{"alice@example.com"},
+	Dst: []string{"100.64.0.1"},
+	IP:  []string{"22"},
+}
+
+func TestSyncMarkedGrants(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		want   string
+	}{
+		{
+			name:   "existing grants",
+			policy: testGrantsPolicy,
+			want: `{"src": ["autogroup:member"], "dst": ["tag:wiki"], "ip": ["443"]},
+		// tailgrant:grant-1
+		{
+			"src": [
+				"alice@example.com"
+			],
+			"dst": [
+				"100.64.0.1"
+			],
+			"ip": [
+				"22"
+			]
+		},
+	],`,
+		},
+		{
+			name:   "no grants section",
+			policy: testPolicy,
+			want: `	"grants": [
+		// tailgrant:grant-1
+		{`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := SyncMarkedGrants([]byte(tt.policy), map[string]PolicyGrant{"grant-1": testGrant})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !changed {
+				t.Error("expected the policy to change")
+			}
+			if !strings.Contains(string(got), tt.want) {
+				t.Errorf("policy does not contain %q:\n%s", tt.want, got)
+			}
+			ids, err := MarkedGrantIDs(got)
+			if err != nil {
+				t.Fatalf("MarkedGrantIDs: %v", err)
+			}
+			if len(ids) != 1 || ids[0] != "grant-1" {
+				t.Errorf("MarkedGrantIDs = %v, want [grant-1]", ids)
+			}
+
+			// Syncing again is a no-op.
+			again, changed, err := SyncMarkedGrants(got, map[string]PolicyGrant{"grant-1": testGrant})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if changed || string(again) != string(got) {
+				t.Errorf("second sync changed the policy:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestSyncMarkedGrants_RemovesOrphans(t *testing.T) {
+	grants := map[string]PolicyGrant{"grant-1": testGrant, "grant-2": testGrant}
+	added, _, err := SyncMarkedGrants([]byte(testGrantsPolicy), grants)
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	delete(grants, "grant-1")
+	got, changed, err := SyncMarkedGrants(added, grants)
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if !changed {
+		t.Error("expected the policy to change")
+	}
+	ids, err := MarkedGrantIDs(got)
+	if err != nil {
+		t.Fatalf("MarkedGrantIDs: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "grant-2" {
+		t.Errorf("MarkedGrantIDs = %v, want [grant-2]", ids)
+	}
+
+	// Removing the rest restores the original policy.
+	got, _, err = SyncMarkedGrants(got, nil)
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if string(got) != testGrantsPolicy {
+		t.Errorf("round trip changed the policy:\n%s", got)
+	}
+}
@@ -0,0 +1,131 @@
+package tsapi
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	tailscale "tailscale.com/client/tailscale/v2"
+)
+
+// autogroupRoles maps role-based autogroups to the user roles they contain.
+// autogroup:member is handled separately since it matches any member user.
+var autogroupRoles = map[string]tailscale.UserRole{
+	"autogroup:owner":         tailscale.UserRoleOwner,
+	"autogroup:admin":         tailscale.UserRoleAdmin,
+	"autogroup:it-admin":      tailscale.UserRoleITAdmin,
+	"autogroup:network-admin": tailscale.UserRoleNetworkAdmin,
+	"autogroup:billing-admin": tailscale.UserRoleBillingAdmin,
+	"autogroup:auditor":       tailscale.UserRoleAuditor,
+}
+
+// IsGroupPrincipal reports whether p names a group ("group:..." or
+// "autogroup:...") rather than a single login.
+func IsGroupPrincipal(p string) bool {
+	return strings.HasPrefix(p, "group:") || strings.HasPrefix(p, "autogroup:")
+}
+
+// ValidatePrincipal checks that p is a login, a policy-file group, or a
+// supported role-based autogroup.
+func ValidatePrincipal(p string) error {
+	switch {
+	case p == "":
+		return fmt.Errorf("empty principal")
+	case strings.HasPrefix(p, "autogroup:"):
+		if _, ok := autogroupRoles[p]; !ok && p != "autogroup:member" {
+			return fmt.Errorf("unsupported autogroup %q", p)
+		}
+	case strings.HasPrefix(p, "group:"):
+		if p == "group:" {
+			return fmt.Errorf("group %q has empty name", p)
+		}
+	}
+	return nil
+}
+
+// MatchPrincipals reports whether a user matches any of the principals.
+// groups is the policy file's groups section; user may be nil if the login
+// is not a member of the tailnet, in which case autogroups never match.
+func MatchPrincipals(login string, user *tailscale.User, groups map[string][]string, principals []string) bool {
+	if login == "" {
+		return false
+	}
+	for _, p := range principals {
+		switch {
+		case strings.HasPrefix(p, "autogroup:"):
+			if user == nil {
+				continue
+			}
+			if p == "autogroup:member" && user.Type == tailscale.UserTypeMember {
+				return true
+			}
+			if role, ok := autogroupRoles[p]; ok && user.Role == role {
+				return true
+			}
+		case strings.HasPrefix(p, "group:"):
+			if slices.Contains(groups[p], login) {
+				return true
+			}
+		default:
+			if p == login {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PrincipalResolver resolves group and autogroup principals against the
+// tailnet's policy file and user roles. Nothing is cached: every call reads
+// the current policy file and user list so membership changes take effect
+// immediately.
+type PrincipalResolver struct {
+	client *tailscale.Client
+}
+
+// NewPrincipalResolver creates a PrincipalResolver backed by the given client.
+func NewPrincipalResolver(client *tailscale.Client) *PrincipalResolver {
+	return &PrincipalResolver{client: client}
+}
+
+// IsMember reports whether login matches any of the principals. The policy
+// file and user list are only fetched when a principal needs them.
+func (r *PrincipalResolver) IsMember(ctx context.Context, login string, principals []string) (bool, error) {
+	if login == "" {
+		return false, nil
+	}
+
+	var groups map[string][]string
+	var user *tailscale.User
+	for _, p := range principals {
+		switch {
+		case strings.HasPrefix(p, "group:") && groups == nil:
+			acl, err := r.client.PolicyFile().Get(ctx)
+			if err != nil {
+				return false, fmt.Errorf("get policy file: %w", err)
+			}
+			groups = acl.Groups
+			if groups == nil {
+				groups = map[string][]string{}
+			}
+		case strings.HasPrefix(p, "autogroup:") && user == nil:
+			users, err := r.client.Users().List(ctx, nil, nil)
+			if err != nil {
+				return false, fmt.Errorf("list users: %w", err)
+			}
+			for i := range users {
+				if strings.EqualFold(users[i].LoginName, login) {
+					user = &users[i]
+					break
+				}
+			}
+			if user == nil {
+				// Not a tailnet member; no autogroup can match.
+				user = &tailscale.User{}
+			}
+		}
+	}
+
+	return MatchPrincipals(login, user, groups, principals), nil
+}
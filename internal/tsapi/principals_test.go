@@ -0,0 +1,98 @@
+package tsapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestValidatePrincipal(t *testing.T) {
+	tests := []struct {
+		principal string
+		wantErr   bool
+	}{
+		{"alice@example.com", false},
+		{"group:secops", false},
+		{"autogroup:admin", false},
+		{"autogroup:member", false},
+		{"autogroup:tagged", true},
+		{"group:", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.principal, func(t *testing.T) {
+			err := ValidatePrincipal(tt.principal)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePrincipal(%q) error = %v, wantErr %v", tt.principal, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrincipalResolver_IsMember(t *testing.T) {
+	var aclCalls, userCalls int
+	client, _ := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v2/tailnet/test-tailnet/acl":
+			aclCalls++
+			w.Write([]byte(`{"groups":{"group:secops":["alice@example.com"]}}`))
+		case "/api/v2/tailnet/test-tailnet/users":
+			userCalls++
+			w.Write([]byte(`{"users":[
+				{"loginName":"root@example.com","type":"member","role":"admin"},
+				{"loginName":"bob@example.com","type":"member","role":"member"},
+				{"loginName":"guest@example.com","type":"shared","role":"member"}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	resolver := NewPrincipalResolver(client)
+
+	tests := []struct {
+		name       string
+		login      string
+		principals []string
+		want       bool
+	}{
+		{"login match", "lead@example.com", []string{"lead@example.com"}, true},
+		{"group member", "alice@example.com", []string{"group:secops"}, true},
+		{"not in group", "bob@example.com", []string{"group:secops"}, false},
+		{"admin role", "root@example.com", []string{"autogroup:admin"}, true},
+		{"member role is not admin", "bob@example.com", []string{"autogroup:admin"}, false},
+		{"autogroup member", "bob@example.com", []string{"autogroup:member"}, true},
+		{"shared user is not member", "guest@example.com", []string{"autogroup:member"}, false},
+		{"unknown user", "nobody@example.com", []string{"autogroup:member"}, false},
+		{"empty login", "", []string{"group:secops"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.IsMember(context.Background(), tt.login, tt.principals)
+			if err != nil {
+				t.Fatalf("IsMember() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IsMember(%q, %v) = %v, want %v", tt.login, tt.principals, got, tt.want)
+			}
+		})
+	}
+
+	if aclCalls != 2 {
+		t.Errorf("policy file fetched %d times, want 2", aclCalls)
+	}
+	if userCalls != 5 {
+		t.Errorf("users listed %d times, want 5", userCalls)
+	}
+}
+
+func TestPrincipalResolver_APIError(t *testing.T) {
+	client, _ := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"message":"boom"}`))
+	})
+
+	if _, err := NewPrincipalResolver(client).IsMember(context.Background(), "alice@example.com", []string{"group:secops"}); err == nil {
+		t.Fatal("expected error")
+	}
+}